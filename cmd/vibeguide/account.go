@@ -0,0 +1,254 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"github.com/supabase-community/gotrue-go/types"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// deletedUserID replaces a deleted user's ID in records that outlive the account
+const deletedUserID = "deleted-user"
+
+// accountTable is a table holding rows about a user, keyed by their Supabase user ID in column
+type accountTable struct {
+	file    string // Name of the file in the export
+	model   any
+	column  string
+	preload string
+	// anonymise keeps the rows on account deletion and replaces the user ID. Used for admin
+	// audit records that must survive the admin.
+	anonymise bool
+}
+
+// accountTables lists every table with per-user rows. New user-owned models must be added here
+// so they are exported and removed with the account.
+var accountTables = []accountTable{
+	{file: "alert_subscriptions", model: &AlertSubscription{}, column: "supabase_user_id"},
+	{file: "alert_destinations", model: &AlertDestination{}, column: "supabase_user_id"},
+	{file: "alert_preferences", model: &AlertPreference{}, column: "supabase_user_id"},
+	{file: "alert_history", model: &AlertOutbox{}, column: "supabase_user_id"},
+	{file: "digest_subscription", model: &DigestSubscription{}, column: "supabase_user_id"},
+	{file: "lineups", model: &Lineup{}, column: "supabase_user_id"},
+	{file: "vibes", model: &Vibe{}, column: "supabase_user_id", preload: "Rules"},
+	{file: "viewing_preferences", model: &ViewingPreference{}, column: "supabase_user_id"},
+	{file: "twitch_accounts", model: &TwitchAccount{}, column: "supabase_user_id"},
+	{file: "twitch_tokens", model: &TwitchToken{}, column: "supabase_user_id"},
+	{file: "sessions", model: &UserSession{}, column: "supabase_user_id"},
+	{file: "api_keys", model: &APIKey{}, column: "supabase_user_id"},
+	{file: "blocklist_entries", model: &BlocklistEntry{}, column: "created_by", anonymise: true},
+	{file: "blocklist_audit", model: &BlocklistAudit{}, column: "actor_id", anonymise: true},
+}
+
+// loadAccountRows loads a user's rows from one table into a new slice
+func loadAccountRows(ctx context.Context, db *gorm.DB, table accountTable, userID string) (any, error) {
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(table.model).Elem())).Interface()
+	query := db.WithContext(ctx).Where(table.column+" = ?", userID)
+	if table.preload != "" {
+		query = query.Preload(table.preload)
+	}
+	if err := query.Order("id").Find(rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", table.file, err)
+	}
+	return rows, nil
+}
+
+// linkedTwitchUserIDs returns the Twitch user IDs a user's data is cached under
+func linkedTwitchUserIDs(ctx context.Context, db *gorm.DB, userID string) ([]string, error) {
+	var ids []string
+	for _, model := range []any{&TwitchAccount{}, &TwitchToken{}, &DigestSubscription{}} {
+		var found []string
+		err := db.WithContext(ctx).Model(model).
+			Where("supabase_user_id = ? AND twitch_user_id <> ''", userID).
+			Pluck("twitch_user_id", &found).Error
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, found...)
+	}
+	return ids, nil
+}
+
+// revokeStoredTwitchToken revokes the user's stored Twitch grant at Twitch. An expired access
+// token is refreshed first, since revoking it would leave the refresh token live.
+func revokeStoredTwitchToken(ctx context.Context, db *gorm.DB, twitchClient twitch.Client, userID string, now time.Time) error {
+	if twitchTokenKeys == nil {
+		return nil
+	}
+	var row TwitchToken
+	err := db.WithContext(ctx).Where("supabase_user_id = ?", userID).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	access, refresh, err := row.open(twitchTokenKeys)
+	if err != nil {
+		return err
+	}
+	if now.After(row.ExpiresAt) {
+		access, err = refreshTwitchToken(ctx, db, twitchClient, &row, refresh, now)
+		if errors.Is(err, errNoTwitchToken) {
+			return nil // Twitch already dropped the grant
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := twitchClient.RevokeToken(ctx, access); err != nil && !errors.Is(err, twitch.ErrTokenInvalid) {
+		return err
+	}
+	return nil
+}
+
+// deleteAccountData removes every local row about a user in one transaction, anonymising audit
+// records instead of deleting them
+func deleteAccountData(ctx context.Context, db *gorm.DB, user *User) error {
+	userID := user.SupabaseUserID
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("vibe_id IN (?)", tx.Model(&Vibe{}).Unscoped().Select("id").Where("supabase_user_id = ?", userID)).
+			Delete(&VibeRule{}).Error
+		if err != nil {
+			return err
+		}
+		for _, table := range accountTables {
+			query := tx.Model(table.model).Where(table.column+" = ?", userID)
+			if table.anonymise {
+				err = query.UpdateColumn(table.column, deletedUserID).Error
+			} else {
+				err = query.Unscoped().Delete(table.model).Error
+			}
+			if err != nil {
+				return fmt.Errorf("failed to remove %s: %w", table.file, err)
+			}
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&Image{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&User{}, user.ID).Error
+	})
+}
+
+// ============= HANDLERS =============
+
+// deleteAccount deletes the caller's account: it revokes their Twitch grant, removes their local
+// data and cached follows, then deletes the Supabase user. Local data goes first so a failed
+// Supabase call can be retried; the next request recreates an empty local user.
+func deleteAccount(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) deleteAccount: %v", tId, apiVersion)
+
+	user, _ := currentUser(r)
+	sbUserID, err := uuid.Parse(user.SupabaseUserID)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("invalid user id"), http.StatusBadRequest)
+		return
+	}
+	admin, err := supabaseAdmin()
+	if err != nil {
+		handleErr(w, r, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	twitchClient := r.Context().Value("twitchClient").(twitch.Client)
+	if err := revokeStoredTwitchToken(r.Context(), DB, twitchClient, user.SupabaseUserID, time.Now()); err != nil {
+		// The stored grant is deleted below either way; the user can still disconnect the app on Twitch
+		zlog.Warn().Err(err).Str("supabase_user_id", user.SupabaseUserID).Msg("Failed to revoke Twitch token")
+	}
+
+	twitchUserIDs, err := linkedTwitchUserIDs(r.Context(), DB, user.SupabaseUserID)
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if err := deleteAccountData(r.Context(), DB, user); err != nil {
+		zlog.Error().Msgf("(%s) deleteAccount: delete data error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	for _, id := range twitchUserIDs {
+		followsCache.Delete(id)
+	}
+
+	err = admin.AdminDeleteUser(types.AdminDeleteUserRequest{UserID: sbUserID})
+	if err != nil && gotrueStatus(err) != http.StatusNotFound {
+		zlog.Error().Msgf("(%s) deleteAccount: delete supabase user error: %s", tId, err.Error())
+		handleErr(w, r, fmt.Errorf("failed to delete auth user, try again"), http.StatusBadGateway)
+		return
+	}
+	if sessionCookies {
+		setSessionCookies(w, "", "", -1)
+	}
+
+	zlog.Info().Str("supabase_user_id", user.SupabaseUserID).Msgf("(%s) deleteAccount done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// exportAccount streams a ZIP of everything held about the caller, one JSON file per table
+func exportAccount(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	zlog.Info().Msgf("(%s) exportAccount: %v", tId, apiVersion)
+
+	user, _ := currentUser(r)
+	var images []Image
+	if err := DB.WithContext(r.Context()).Where("user_id = ?", user.ID).Order("id").Find(&images).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="vibeguide-export-%s.zip"`, now.Format("2006-01-02")))
+
+	// Headers are sent with the first write, so later failures can only cut the archive short;
+	// the missing central directory tells the client it is incomplete
+	zw := zip.NewWriter(w)
+	write := func(file string, data any) error {
+		f, err := zw.Create(file + ".json")
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	}
+
+	err := write("account", map[string]any{"exported_at": now, "user": user, "images": images})
+	for _, table := range accountTables {
+		if err != nil {
+			break
+		}
+		var rows any
+		if rows, err = loadAccountRows(r.Context(), DB, table, user.SupabaseUserID); err == nil {
+			err = write(table.file, rows)
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		zlog.Error().Msgf("(%s) exportAccount: export aborted: %s", tId, err.Error())
+		return
+	}
+
+	zlog.Info().Msgf("(%s) exportAccount done.", tId)
+}
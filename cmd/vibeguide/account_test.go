@@ -0,0 +1,211 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+// revokeRecordingClient records the tokens revoked through it
+type revokeRecordingClient struct {
+	mockTwitchClient
+	revoked []string
+}
+
+func (m *revokeRecordingClient) RevokeToken(ctx context.Context, accessToken string) error {
+	m.revoked = append(m.revoked, accessToken)
+	return nil
+}
+
+// setupAccountRouter serves the account endpoints for a signed-in user
+func setupAccountRouter(twitchClient twitch.Client, user *User) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(twitchClientContext(twitchClient))
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authctx, user)))
+		})
+	})
+	r.Delete("/users/me", deleteAccount)
+	r.Get("/users/me/export", exportAccount)
+	return r
+}
+
+func TestDeleteAccount(t *testing.T) {
+	withTestTokenKeys(t, "k1:"+testTokenKey(1))
+	fake, _ := withFakeGoTrue(t)
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	followsCache.Set("42", &twitch.FollowsResponse{})
+	followsCache.Set("99", &twitch.FollowsResponse{})
+	defer followsCache.Delete("99")
+
+	mock.ExpectQuery(`SELECT \* FROM "twitch_tokens" WHERE supabase_user_id = \$1`).
+		WithArgs(testSupabaseUserID, 1).
+		WillReturnRows(sealedTokenRow(t, testSupabaseUserID, time.Now().Add(time.Hour), time.Now()))
+	mock.ExpectQuery(`SELECT "twitch_user_id" FROM "twitch_accounts"`).
+		WillReturnRows(sqlmock.NewRows([]string{"twitch_user_id"}).AddRow("42"))
+	mock.ExpectQuery(`SELECT "twitch_user_id" FROM "twitch_tokens"`).
+		WillReturnRows(sqlmock.NewRows([]string{"twitch_user_id"}).AddRow("42"))
+	mock.ExpectQuery(`SELECT "twitch_user_id" FROM "digest_subscriptions"`).
+		WillReturnRows(sqlmock.NewRows([]string{"twitch_user_id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "vibe_rules" WHERE vibe_id IN \(SELECT "id" FROM "vibes" WHERE supabase_user_id = \$1\)`).
+		WithArgs(testSupabaseUserID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	for _, table := range accountTables {
+		if table.anonymise {
+			mock.ExpectExec(`UPDATE "\w+" SET "`+table.column+`"=\$1 WHERE `+table.column+` = \$2`).
+				WithArgs(deletedUserID, testSupabaseUserID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			continue
+		}
+		mock.ExpectExec(`DELETE FROM "\w+" WHERE ` + table.column + ` = \$1`).
+			WithArgs(testSupabaseUserID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(`DELETE FROM "images" WHERE user_id = \$1`).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	twitchClient := &revokeRecordingClient{}
+	user := &User{SupabaseUserID: testSupabaseUserID}
+	user.ID = 7
+	r := setupAccountRouter(twitchClient, user)
+
+	req := httptest.NewRequest("DELETE", "/users/me", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(twitchClient.revoked) != 1 || twitchClient.revoked[0] != "stored-access" {
+		t.Errorf("Expected the stored Twitch token to be revoked, got %v", twitchClient.revoked)
+	}
+	if _, ok := fake.requests["DELETE /admin/users/"+testSupabaseUserID]; !ok {
+		t.Errorf("Expected the Supabase user to be deleted, got requests %v", fake.requests)
+	}
+	if _, ok := followsCache.Get("42"); ok {
+		t.Error("Expected the user's cached follows to be purged")
+	}
+	if _, ok := followsCache.Get("99"); !ok {
+		t.Error("Expected other users' cached follows to be kept")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestDeleteAccount_AdminUnavailable(t *testing.T) {
+	origConfig := Config
+	Config = &VibeConfig{}
+	defer func() { Config = origConfig }()
+
+	user := &User{SupabaseUserID: testSupabaseUserID}
+	r := setupAccountRouter(&mockTwitchClient{}, user)
+
+	req := httptest.NewRequest("DELETE", "/users/me", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestExportAccount(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	mock.ExpectQuery(`SELECT \* FROM "images" WHERE user_id = \$1`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	for _, table := range accountTables {
+		rows := sqlmock.NewRows([]string{"id"})
+		if table.file == "lineups" {
+			rows = sqlmock.NewRows([]string{"id", "supabase_user_id", "name", "slug", "public", "rows"}).
+				AddRow(1, testSupabaseUserID, "Evening", "evening", false, `[]`)
+		}
+		mock.ExpectQuery(`SELECT \* FROM "\w+" WHERE ` + table.column + ` = \$1`).
+			WithArgs(testSupabaseUserID).
+			WillReturnRows(rows)
+	}
+
+	user := &User{SupabaseUserID: testSupabaseUserID, Email: "viewer@example.com"}
+	user.ID = 7
+	r := setupAccountRouter(&mockTwitchClient{}, user)
+
+	req := httptest.NewRequest("GET", "/users/me/export", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected a zip, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Expected a complete zip, got: %v", err)
+	}
+	if len(zr.File) != len(accountTables)+1 {
+		t.Errorf("Expected %d files, got %d", len(accountTables)+1, len(zr.File))
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	var account struct {
+		User User `json:"user"`
+	}
+	readZipJSON(t, files["account.json"], &account)
+	if account.User.Email != "viewer@example.com" {
+		t.Errorf("Expected the user profile, got %+v", account.User)
+	}
+	var lineups []Lineup
+	readZipJSON(t, files["lineups.json"], &lineups)
+	if len(lineups) != 1 || lineups[0].Slug != "evening" {
+		t.Errorf("Expected the user's lineup, got %+v", lineups)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func readZipJSON(t *testing.T, f *zip.File, v any) {
+	t.Helper()
+	if f == nil {
+		t.Fatal("Expected file missing from export")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		t.Fatalf("Failed to decode %s: %v", f.Name, err)
+	}
+}
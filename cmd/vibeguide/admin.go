@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// adminRouter creates a router for operator-only moderation endpoints
+func adminRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(requireAdmin)
+	r.Get("/anomalies", listStreamAnomalies)
+	r.Get("/anomalies/policy", getAnomalyPolicy)
+	r.Put("/anomalies/policy", updateAnomalyPolicy)
+	r.Route("/blocklist", func(r chi.Router) {
+		r.Get("/", listBlocklist)
+		r.Post("/", createBlocklistEntry)
+		r.Get("/audit", listBlocklistAudit)
+		r.Put("/{id}", updateBlocklistEntry)
+		r.Delete("/{id}", deleteBlocklistEntry)
+	})
+	r.Put("/api-keys/{id}", updateAPIKeyQuota)
+	return r
+}
+
+// adminUserID returns the Supabase user ID of the admin making the request
+func adminUserID(r *http.Request) string {
+	if user, ok := currentUser(r); ok {
+		return user.SupabaseUserID
+	}
+	return ""
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/site-tech/VibeGuide/pkg/notify"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+const (
+	alertMaxAttempts  = 8
+	alertBaseBackoff  = 30 * time.Second
+	alertMaxBackoff   = time.Hour
+	alertDeliverBatch = 50
+	// alertLease is how long a claimed outbox row is hidden from other workers while it is delivered
+	alertLease = 2 * time.Minute
+)
+
+// buildNotifiers creates a notifier for every destination type; Web Push is only
+// available when VAPID keys are configured
+func buildNotifiers(config *VibeConfig) (map[string]notify.Notifier, error) {
+	notifiers := map[string]notify.Notifier{
+		destinationDiscord: notify.NewDiscordNotifier(nil),
+		destinationSlack:   notify.NewSlackNotifier(nil),
+		destinationWebhook: notify.NewWebhookNotifier(nil),
+	}
+
+	if config.VapidPrivateKey != "" {
+		webPush, err := notify.NewWebPushNotifier(notify.VAPIDKeys{
+			PublicKey:  config.VapidPublicKey,
+			PrivateKey: config.VapidPrivateKey,
+			Subject:    config.VapidSubject,
+		}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize web push: %w", err)
+		}
+		notifiers[destinationWebPush] = webPush
+	}
+
+	return notifiers, nil
+}
+
+// AlertDispatcher detects go-lives for subscribed channels and categories and delivers
+// alerts through an outbox table, giving at-least-once delivery with retries
+type AlertDispatcher struct {
+	db           *gorm.DB
+	twitchClient twitch.Client
+	notifiers    map[string]notify.Notifier
+	pollInterval time.Duration
+
+	channels   *twitch.Detector
+	categories map[string]*twitch.Detector
+	subs       []AlertSubscription
+}
+
+// NewAlertDispatcher creates a dispatcher; notifiers are keyed by destination type
+func NewAlertDispatcher(db *gorm.DB, twitchClient twitch.Client, notifiers map[string]notify.Notifier, pollInterval time.Duration) *AlertDispatcher {
+	d := &AlertDispatcher{
+		db:           db,
+		twitchClient: twitchClient,
+		notifiers:    notifiers,
+		pollInterval: pollInterval,
+		categories:   make(map[string]*twitch.Detector),
+	}
+	d.channels = twitch.NewDetector(twitch.DetectorOptions{OfflineGrace: twitch.DefaultOfflineGrace},
+		twitch.EventSinkFunc(d.handleChannelEvent))
+	return d
+}
+
+// Run polls for go-lives and drains the outbox until ctx is cancelled
+func (d *AlertDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			zlog.Info().Msg("Alert dispatcher stopping")
+			return
+		case <-ticker.C:
+			now := time.Now().UTC()
+			pollErr := d.Poll(ctx, now)
+			if pollErr != nil {
+				zlog.Error().Err(pollErr).Msg("Alert poll failed")
+			}
+			sent, deliverErr := d.Deliver(ctx, now)
+			if deliverErr != nil {
+				zlog.Error().Err(deliverErr).Msg("Alert delivery failed")
+			} else if sent > 0 {
+				zlog.Info().Int("delivered", sent).Msg("Alerts delivered")
+			}
+			workerHeartbeats.Beat(workerAlertDispatcher, errors.Join(pollErr, deliverErr))
+		}
+	}
+}
+
+// Poll fetches the live state of every subscribed channel and category and enqueues alerts
+func (d *AlertDispatcher) Poll(ctx context.Context, now time.Time) error {
+	if err := d.db.WithContext(ctx).Find(&d.subs).Error; err != nil {
+		return err
+	}
+
+	channelIDs := make(map[string]bool)
+	gameIDs := make(map[string]bool)
+	for _, sub := range d.subs {
+		switch sub.Kind {
+		case alertKindChannel:
+			channelIDs[sub.BroadcasterID] = true
+		case alertKindCategory:
+			gameIDs[sub.GameID] = true
+		}
+	}
+
+	var errs []error
+	if err := d.pollChannels(ctx, channelIDs, now); err != nil {
+		errs = append(errs, err)
+	}
+	for gameID := range gameIDs {
+		if err := d.pollCategory(ctx, gameID, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// Forget categories nobody subscribes to anymore
+	for gameID := range d.categories {
+		if !gameIDs[gameID] {
+			delete(d.categories, gameID)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// pollChannels syncs the watched set with the subscriptions and diffs the subscribed channels' streams
+func (d *AlertDispatcher) pollChannels(ctx context.Context, channelIDs map[string]bool, now time.Time) error {
+	for _, id := range d.channels.Watched() {
+		if !channelIDs[id] {
+			d.channels.Unwatch(id)
+		}
+	}
+	if len(channelIDs) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(channelIDs))
+	for id := range channelIDs {
+		ids = append(ids, id)
+	}
+	d.channels.Watch(ids...)
+
+	streams, err := getStreamsByUserIDs(ctx, d.twitchClient, ids)
+	if err != nil {
+		return fmt.Errorf("failed to poll subscribed channels: %w", err)
+	}
+	_, err = d.channels.Process(ctx, &twitch.StreamsResponse{Data: streams}, now)
+	return err
+}
+
+// pollCategory diffs the top streams of a category
+func (d *AlertDispatcher) pollCategory(ctx context.Context, gameID string, now time.Time) error {
+	detector, ok := d.categories[gameID]
+	if !ok {
+		detector = twitch.NewDetector(twitch.DetectorOptions{OfflineGrace: twitch.DefaultOfflineGrace},
+			twitch.EventSinkFunc(d.handleCategoryEvent))
+		d.categories[gameID] = detector
+	}
+
+	streams, err := d.twitchClient.GetStreams(ctx, twitch.StreamsQueryParams{
+		Limit:  twitch.MaxStreamQueryLimit,
+		GameID: gameID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to poll category %s: %w", gameID, err)
+	}
+	_, err = detector.Process(ctx, streams, now)
+	return err
+}
+
+// handleChannelEvent is the detector sink for subscribed channels
+func (d *AlertDispatcher) handleChannelEvent(ctx context.Context, event twitch.StreamEvent) error {
+	// The shared detector first sees a channel when it is subscribed to, so a channel that was
+	// already live shows up as a go-live; only alert for streams that actually started recently
+	if event.Type == twitch.EventWentLive && !streamStartedWithin(event.Stream, event.OccurredAt, 2*d.pollInterval) {
+		return nil
+	}
+
+	var matched []AlertSubscription
+	for _, sub := range d.subs {
+		if channelSubscriptionMatches(sub, event) {
+			matched = append(matched, sub)
+		}
+	}
+	return d.enqueue(ctx, event, matched)
+}
+
+// handleCategoryEvent is the detector sink for subscribed categories
+func (d *AlertDispatcher) handleCategoryEvent(ctx context.Context, event twitch.StreamEvent) error {
+	// A stream entering a category's top list is only a go-live if it started recently
+	if !streamStartedWithin(event.Stream, event.OccurredAt, 2*d.pollInterval) {
+		return nil
+	}
+
+	var matched []AlertSubscription
+	for _, sub := range d.subs {
+		if categorySubscriptionMatches(sub, event) {
+			matched = append(matched, sub)
+		}
+	}
+	return d.enqueue(ctx, event, matched)
+}
+
+// channelSubscriptionMatches reports whether a channel rule applies to an event
+func channelSubscriptionMatches(sub AlertSubscription, event twitch.StreamEvent) bool {
+	if sub.Kind != alertKindChannel || sub.BroadcasterID != event.BroadcasterID {
+		return false
+	}
+	switch event.Type {
+	case twitch.EventWentLive:
+		return sub.GameID == "" || sub.GameID == event.Stream.GameID
+	case twitch.EventCategoryChanged:
+		// A category-filtered rule also fires when the channel switches into that category
+		return sub.GameID != "" && sub.GameID == event.Stream.GameID
+	}
+	return false
+}
+
+// categorySubscriptionMatches reports whether a category rule applies to an event
+func categorySubscriptionMatches(sub AlertSubscription, event twitch.StreamEvent) bool {
+	return sub.Kind == alertKindCategory &&
+		event.Type == twitch.EventWentLive &&
+		sub.GameID == event.Stream.GameID
+}
+
+// streamStartedWithin reports whether the stream started no earlier than window before at
+func streamStartedWithin(stream twitch.Stream, at time.Time, window time.Duration) bool {
+	startedAt, err := time.Parse(time.RFC3339, stream.StartedAt)
+	if err != nil {
+		return false
+	}
+	return at.Sub(startedAt) <= window
+}
+
+// enqueue writes one outbox row per destination of every matched user, skipping users in quiet hours
+func (d *AlertDispatcher) enqueue(ctx context.Context, event twitch.StreamEvent, matched []AlertSubscription) error {
+	users := make(map[string]bool)
+	for _, sub := range matched {
+		users[sub.SupabaseUserID] = true
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	alert := buildStreamAlert(event)
+	for userID := range users {
+		var pref AlertPreference
+		err := d.db.WithContext(ctx).Where("supabase_user_id = ?", userID).First(&pref).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && inQuietHours(&pref, event.OccurredAt) {
+			zlog.Debug().Str("supabase_user_id", userID).Str("broadcaster_id", event.BroadcasterID).Msg("Alert suppressed by quiet hours")
+			continue
+		}
+
+		var dests []AlertDestination
+		if err := d.db.WithContext(ctx).Where("supabase_user_id = ? AND disabled = ?", userID, false).Find(&dests).Error; err != nil {
+			return err
+		}
+
+		for _, dest := range dests {
+			row := AlertOutbox{
+				// One alert per stream per destination, however many rules matched
+				DedupKey:       fmt.Sprintf("%d:%s", dest.ID, event.Stream.ID),
+				SupabaseUserID: userID,
+				DestinationID:  dest.ID,
+				Alert:          alert,
+				Status:         outboxPending,
+				NextAttemptAt:  event.OccurredAt,
+			}
+			err := d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Deliver claims due outbox rows and sends them. It returns the number delivered.
+func (d *AlertDispatcher) Deliver(ctx context.Context, now time.Time) (int, error) {
+	var due []AlertOutbox
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", outboxPending, now).
+			Order("next_attempt_at").
+			Limit(alertDeliverBatch).
+			Find(&due).Error
+		if err != nil || len(due) == 0 {
+			return err
+		}
+
+		// Lease the rows so other instances skip them; if we crash they become due again
+		ids := make([]uint, 0, len(due))
+		for _, row := range due {
+			ids = append(ids, row.ID)
+		}
+		return tx.Model(&AlertOutbox{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(alertLease)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range due {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		if d.deliverOne(ctx, &due[i], now) {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// deliverOne sends a single outbox row and records the outcome
+func (d *AlertDispatcher) deliverOne(ctx context.Context, row *AlertOutbox, now time.Time) bool {
+	var dest AlertDestination
+	err := d.db.WithContext(ctx).First(&dest, row.DestinationID).Error
+	if err != nil || dest.Disabled {
+		d.finishOutbox(ctx, row, outboxFailed, "destination removed or disabled", now)
+		return false
+	}
+
+	notifier, ok := d.notifiers[dest.Type]
+	if !ok {
+		d.finishOutbox(ctx, row, outboxFailed, fmt.Sprintf("no notifier configured for %s", dest.Type), now)
+		return false
+	}
+
+	row.Attempts++
+	err = notifier.Notify(ctx, dest.Target(), row.Alert)
+	switch {
+	case err == nil:
+		d.finishOutbox(ctx, row, outboxSent, "", now)
+		return true
+	case errors.Is(err, notify.ErrGone):
+		d.db.WithContext(ctx).Model(&dest).Update("disabled", true)
+		d.finishOutbox(ctx, row, outboxFailed, err.Error(), now)
+	case notify.IsRetryable(err) && row.Attempts < alertMaxAttempts:
+		d.finishOutbox(ctx, row, outboxPending, err.Error(), now.Add(alertBackoff(row.Attempts)))
+	default:
+		d.finishOutbox(ctx, row, outboxFailed, err.Error(), now)
+	}
+
+	zlog.Warn().Err(err).Uint("outbox_id", row.ID).Int("attempts", row.Attempts).Msg("Alert delivery attempt failed")
+	return false
+}
+
+// finishOutbox persists the result of a delivery attempt; for pending rows at is the next attempt time
+func (d *AlertDispatcher) finishOutbox(ctx context.Context, row *AlertOutbox, status, lastError string, at time.Time) {
+	updates := map[string]any{
+		"status":     status,
+		"attempts":   row.Attempts,
+		"last_error": lastError,
+	}
+	switch status {
+	case outboxSent:
+		updates["delivered_at"] = at
+	case outboxPending:
+		updates["next_attempt_at"] = at
+	}
+
+	if err := d.db.WithContext(ctx).Model(row).Updates(updates).Error; err != nil {
+		zlog.Error().Err(err).Uint("outbox_id", row.ID).Msg("Failed to record alert delivery result")
+	}
+}
+
+// alertBackoff returns the exponential retry delay after the given number of attempts
+func alertBackoff(attempts int) time.Duration {
+	backoff := alertBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= alertMaxBackoff {
+			return alertMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// buildStreamAlert renders a detector event as a notification
+func buildStreamAlert(event twitch.StreamEvent) notify.Alert {
+	stream := event.Stream
+	name := stream.UserName
+	if name == "" {
+		name = stream.UserLogin
+	}
+
+	title := fmt.Sprintf("%s is live", name)
+	if event.Type == twitch.EventCategoryChanged {
+		title = fmt.Sprintf("%s switched to %s", name, stream.GameName)
+	}
+
+	return notify.Alert{
+		Type:             string(event.Type),
+		Title:            title,
+		Message:          fmt.Sprintf("%s — %s", stream.GameName, stream.Title),
+		URL:              "https://twitch.tv/" + stream.UserLogin,
+		BroadcasterID:    stream.UserID,
+		BroadcasterLogin: stream.UserLogin,
+		BroadcasterName:  stream.UserName,
+		GameID:           stream.GameID,
+		GameName:         stream.GameName,
+		StreamTitle:      stream.Title,
+		ThumbnailURL:     strings.NewReplacer("{width}", "440", "{height}", "248").Replace(stream.ThumbnailURL),
+		OccurredAt:       event.OccurredAt,
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/notify"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Alert subscription kinds
+const (
+	alertKindChannel  = "channel"  // A specific broadcaster goes live (optionally only in one category)
+	alertKindCategory = "category" // Any broadcaster goes live in a category
+)
+
+// Alert destination types, each backed by a notify.Notifier
+const (
+	destinationDiscord = "discord"
+	destinationSlack   = "slack"
+	destinationWebhook = "webhook"
+	destinationWebPush = "webpush"
+)
+
+// Outbox delivery states
+const (
+	outboxPending = "pending"
+	outboxSent    = "sent"
+	outboxFailed  = "failed"
+)
+
+// AlertSubscription is a go-live rule owned by a Supabase user
+type AlertSubscription struct {
+	gorm.Model
+	SupabaseUserID   string `gorm:"index" json:"supabase_user_id"`
+	Kind             string `json:"kind"`
+	BroadcasterID    string `gorm:"index" json:"broadcaster_id,omitempty"`
+	BroadcasterLogin string `json:"broadcaster_login,omitempty"`
+	GameID           string `gorm:"index" json:"game_id,omitempty"`
+	GameName         string `json:"game_name,omitempty"`
+}
+
+// AlertDestination is somewhere a user wants alerts delivered
+type AlertDestination struct {
+	gorm.Model
+	SupabaseUserID string `gorm:"index" json:"supabase_user_id"`
+	Type           string `json:"type"`
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	Secret         string `json:"-"`
+	P256dh         string `json:"-"`
+	Auth           string `json:"-"`
+	Disabled       bool   `json:"disabled"`
+}
+
+// AlertPreference holds per-user alert settings such as quiet hours
+type AlertPreference struct {
+	gorm.Model
+	SupabaseUserID  string `gorm:"uniqueIndex" json:"supabase_user_id"`
+	QuietHoursStart string `json:"quiet_hours_start"` // "HH:MM", empty disables quiet hours
+	QuietHoursEnd   string `json:"quiet_hours_end"`   // "HH:MM"
+	Timezone        string `json:"timezone"`          // IANA name, defaults to UTC
+}
+
+// AlertOutbox is a pending or completed delivery of one alert to one destination
+type AlertOutbox struct {
+	gorm.Model
+	DedupKey       string       `gorm:"uniqueIndex" json:"-"`
+	SupabaseUserID string       `gorm:"index" json:"supabase_user_id"`
+	DestinationID  uint         `gorm:"index" json:"destination_id"`
+	Alert          notify.Alert `gorm:"serializer:json" json:"alert"`
+	Status         string       `gorm:"index" json:"status"`
+	Attempts       int          `json:"attempts"`
+	NextAttemptAt  time.Time    `gorm:"index" json:"next_attempt_at"`
+	LastError      string       `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time   `json:"delivered_at,omitempty"`
+}
+
+// Target converts a destination into a notify.Target
+func (d *AlertDestination) Target() notify.Target {
+	return notify.Target{URL: d.URL, Secret: d.Secret, P256dh: d.P256dh, Auth: d.Auth}
+}
+
+// inQuietHours reports whether now falls inside the user's quiet hours
+func inQuietHours(pref *AlertPreference, now time.Time) bool {
+	if pref == nil || pref.QuietHoursStart == "" || pref.QuietHoursEnd == "" {
+		return false
+	}
+
+	start, err := parseClock(pref.QuietHoursStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(pref.QuietHoursEnd)
+	if err != nil {
+		return false
+	}
+
+	loc := time.UTC
+	if pref.Timezone != "" {
+		if l, err := time.LoadLocation(pref.Timezone); err == nil {
+			loc = l
+		}
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	// Window wraps past midnight, e.g. 22:00-07:00
+	return minute >= start || minute < end
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validateAlertSubscription checks a subscription rule submitted by a user
+func validateAlertSubscription(sub *AlertSubscription) error {
+	switch sub.Kind {
+	case alertKindChannel:
+		if sub.BroadcasterID == "" {
+			return fmt.Errorf("broadcaster_id is required for channel subscriptions")
+		}
+		if err := twitch.ValidateUserIDs([]string{sub.BroadcasterID}); err != nil {
+			return err
+		}
+	case alertKindCategory:
+		if sub.GameID == "" {
+			return fmt.Errorf("game_id is required for category subscriptions")
+		}
+	default:
+		return fmt.Errorf("kind must be '%s' or '%s', got %s", alertKindChannel, alertKindCategory, sub.Kind)
+	}
+	return twitch.ValidateGameID(sub.GameID)
+}
+
+// destinationHosts pins the destination types with a single well-known provider to its hosts
+var destinationHosts = map[string][]string{
+	destinationDiscord: {"discord.com", "discordapp.com"},
+	destinationSlack:   {"hooks.slack.com"},
+}
+
+// validateAlertDestination checks a delivery destination submitted by a user. The server posts to
+// the URL, so it must be https and, unless pinned to a provider, resolve to public addresses only.
+func validateAlertDestination(ctx context.Context, dest *AlertDestination) error {
+	switch dest.Type {
+	case destinationDiscord, destinationSlack, destinationWebhook:
+	case destinationWebPush:
+		if dest.P256dh == "" || dest.Auth == "" {
+			return fmt.Errorf("p256dh and auth are required for webpush destinations")
+		}
+	default:
+		return fmt.Errorf("type must be one of discord, slack, webhook or webpush, got %s", dest.Type)
+	}
+
+	u, err := url.Parse(dest.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("url must be an absolute https URL")
+	}
+	if hosts, ok := destinationHosts[dest.Type]; ok {
+		if !slices.Contains(hosts, strings.ToLower(u.Hostname())) {
+			return fmt.Errorf("%s url must be on %s", dest.Type, strings.Join(hosts, " or "))
+		}
+		return nil
+	}
+	return notify.CheckPublicHost(ctx, u.Hostname())
+}
+
+// alertsRouter creates a router for go-live alert management
+func alertsRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/subscriptions", listAlertSubscriptions)
+	r.Post("/subscriptions", createAlertSubscription)
+	r.Delete("/subscriptions/{id}", deleteAlertSubscription)
+	r.Get("/destinations", listAlertDestinations)
+	r.Post("/destinations", createAlertDestination)
+	r.Delete("/destinations/{id}", deleteAlertDestination)
+	r.Get("/preferences", getAlertPreferences)
+	r.Put("/preferences", updateAlertPreferences)
+	r.Get("/webpush/key", getWebPushKey)
+	return r
+}
+
+// requestUserID authenticates a request for user-owned data and checks the database is available.
+// It writes the error response and returns false when the request cannot proceed.
+func requestUserID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, err := getAuthenticatedUser(r)
+	if err != nil {
+		handleErr(w, r, err, http.StatusUnauthorized)
+		return "", false
+	}
+	if DB == nil {
+		handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+		return "", false
+	}
+	return user.ID.String(), true
+}
+
+func listAlertSubscriptions(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) listAlertSubscriptions: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var subs []AlertSubscription
+	if err := DB.WithContext(r.Context()).Where("supabase_user_id = ?", userID).Order("id").Find(&subs).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = subs
+
+	zlog.Info().Msgf("(%s) listAlertSubscriptions done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func createAlertSubscription(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) createAlertSubscription: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Kind             string `json:"kind"`
+		BroadcasterID    string `json:"broadcaster_id"`
+		BroadcasterLogin string `json:"broadcaster_login"`
+		GameID           string `json:"game_id"`
+		GameName         string `json:"game_name"`
+	}
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) createAlertSubscription: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	sub := AlertSubscription{
+		SupabaseUserID:   userID,
+		Kind:             body.Kind,
+		BroadcasterID:    body.BroadcasterID,
+		BroadcasterLogin: body.BroadcasterLogin,
+		GameID:           body.GameID,
+		GameName:         body.GameName,
+	}
+	if err := validateAlertSubscription(&sub); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := DB.WithContext(r.Context()).Create(&sub).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = sub
+
+	zlog.Info().Msgf("(%s) createAlertSubscription done.", tId)
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, resp)
+}
+
+func deleteAlertSubscription(w http.ResponseWriter, r *http.Request) {
+	deleteOwnedRow(w, r, &AlertSubscription{}, "deleteAlertSubscription")
+}
+
+func listAlertDestinations(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) listAlertDestinations: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var dests []AlertDestination
+	if err := DB.WithContext(r.Context()).Where("supabase_user_id = ?", userID).Order("id").Find(&dests).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = dests
+
+	zlog.Info().Msgf("(%s) listAlertDestinations done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func createAlertDestination(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) createAlertDestination: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Type   string `json:"type"`
+		Name   string `json:"name"`
+		URL    string `json:"url"`
+		Secret string `json:"secret"`
+		// Web Push subscriptions are posted in the browser's PushSubscription.toJSON() shape
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			P256dh string `json:"p256dh"`
+			Auth   string `json:"auth"`
+		} `json:"keys"`
+	}
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) createAlertDestination: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	dest := AlertDestination{
+		SupabaseUserID: userID,
+		Type:           body.Type,
+		Name:           body.Name,
+		URL:            body.URL,
+		Secret:         body.Secret,
+		P256dh:         body.Keys.P256dh,
+		Auth:           body.Keys.Auth,
+	}
+	if dest.URL == "" {
+		dest.URL = body.Endpoint
+	}
+	if err := validateAlertDestination(r.Context(), &dest); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := DB.WithContext(r.Context()).Create(&dest).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = dest
+
+	zlog.Info().Msgf("(%s) createAlertDestination done.", tId)
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, resp)
+}
+
+func deleteAlertDestination(w http.ResponseWriter, r *http.Request) {
+	deleteOwnedRow(w, r, &AlertDestination{}, "deleteAlertDestination")
+}
+
+// deleteOwnedRow deletes the row identified by the {id} URL param if it belongs to the caller
+func deleteOwnedRow(w http.ResponseWriter, r *http.Request, model any, handlerName string) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) %s: %v", tId, handlerName, apiVersion)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("id must be numeric"), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	result := DB.WithContext(r.Context()).Where("id = ? AND supabase_user_id = ?", id, userID).Delete(model)
+	if result.Error != nil {
+		handleErr(w, r, result.Error, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		handleErr(w, r, fmt.Errorf("not found"), http.StatusNotFound)
+		return
+	}
+
+	zlog.Info().Msgf("(%s) %s done.", tId, handlerName)
+	render.JSON(w, r, resp)
+}
+
+func getAlertPreferences(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getAlertPreferences: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	pref := AlertPreference{SupabaseUserID: userID}
+	err := DB.WithContext(r.Context()).Where("supabase_user_id = ?", userID).First(&pref).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = pref
+
+	zlog.Info().Msgf("(%s) getAlertPreferences done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func updateAlertPreferences(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) updateAlertPreferences: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		QuietHoursStart string `json:"quiet_hours_start"`
+		QuietHoursEnd   string `json:"quiet_hours_end"`
+		Timezone        string `json:"timezone"`
+	}
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) updateAlertPreferences: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if (body.QuietHoursStart == "") != (body.QuietHoursEnd == "") {
+		handleErr(w, r, fmt.Errorf("quiet_hours_start and quiet_hours_end must be set together"), http.StatusBadRequest)
+		return
+	}
+	for _, clock := range []string{body.QuietHoursStart, body.QuietHoursEnd} {
+		if clock == "" {
+			continue
+		}
+		if _, err := parseClock(clock); err != nil {
+			handleErr(w, r, err, http.StatusBadRequest)
+			return
+		}
+	}
+	if body.Timezone != "" {
+		if _, err := time.LoadLocation(body.Timezone); err != nil {
+			handleErr(w, r, fmt.Errorf("unknown timezone %s", body.Timezone), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var pref AlertPreference
+	err := DB.WithContext(r.Context()).
+		Where(AlertPreference{SupabaseUserID: userID}).
+		// A map so that empty values clear previously set quiet hours
+		Assign(map[string]any{
+			"quiet_hours_start": body.QuietHoursStart,
+			"quiet_hours_end":   body.QuietHoursEnd,
+			"timezone":          body.Timezone,
+		}).
+		FirstOrCreate(&pref).Error
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = pref
+
+	zlog.Info().Msgf("(%s) updateAlertPreferences done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// getWebPushKey returns the VAPID public key browsers need to create a push subscription
+func getWebPushKey(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+
+	if Config == nil || Config.VapidPublicKey == "" {
+		handleErr(w, r, fmt.Errorf("web push is not configured"), http.StatusNotFound)
+		return
+	}
+	resp.Data = map[string]string{"public_key": Config.VapidPublicKey}
+
+	render.JSON(w, r, resp)
+}
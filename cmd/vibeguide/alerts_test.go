@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+func TestInQuietHours(t *testing.T) {
+	tests := []struct {
+		name     string
+		pref     *AlertPreference
+		now      time.Time
+		expected bool
+	}{
+		{"no preferences", nil, time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), false},
+		{"disabled", &AlertPreference{}, time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), false},
+		{"inside same-day window", &AlertPreference{QuietHoursStart: "09:00", QuietHoursEnd: "17:00"}, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), true},
+		{"end is exclusive", &AlertPreference{QuietHoursStart: "09:00", QuietHoursEnd: "17:00"}, time.Date(2024, 1, 1, 17, 0, 0, 0, time.UTC), false},
+		{"wrapping window before midnight", &AlertPreference{QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}, time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC), true},
+		{"wrapping window after midnight", &AlertPreference{QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}, time.Date(2024, 1, 1, 6, 59, 0, 0, time.UTC), true},
+		{"wrapping window outside", &AlertPreference{QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), false},
+		// 21:30 UTC is 22:30 in Berlin during winter
+		{"timezone applied", &AlertPreference{QuietHoursStart: "22:00", QuietHoursEnd: "07:00", Timezone: "Europe/Berlin"}, time.Date(2024, 1, 1, 21, 30, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inQuietHours(tt.pref, tt.now); got != tt.expected {
+				t.Errorf("Expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSubscriptionMatching(t *testing.T) {
+	stream := twitch.Stream{ID: "1", UserID: "987654321", GameID: "509658"}
+	wentLive := twitch.StreamEvent{Type: twitch.EventWentLive, BroadcasterID: "987654321", Stream: stream}
+	switched := twitch.StreamEvent{Type: twitch.EventCategoryChanged, BroadcasterID: "987654321", Stream: stream}
+	titleChanged := twitch.StreamEvent{Type: twitch.EventTitleChanged, BroadcasterID: "987654321", Stream: stream}
+
+	anyCategory := AlertSubscription{Kind: alertKindChannel, BroadcasterID: "987654321"}
+	justChatting := AlertSubscription{Kind: alertKindChannel, BroadcasterID: "987654321", GameID: "509658"}
+	otherGame := AlertSubscription{Kind: alertKindChannel, BroadcasterID: "987654321", GameID: "32982"}
+	otherChannel := AlertSubscription{Kind: alertKindChannel, BroadcasterID: "111"}
+	category := AlertSubscription{Kind: alertKindCategory, GameID: "509658"}
+
+	tests := []struct {
+		name     string
+		sub      AlertSubscription
+		event    twitch.StreamEvent
+		matcher  func(AlertSubscription, twitch.StreamEvent) bool
+		expected bool
+	}{
+		{"channel went live", anyCategory, wentLive, channelSubscriptionMatches, true},
+		{"channel filtered by matching game", justChatting, wentLive, channelSubscriptionMatches, true},
+		{"channel filtered by other game", otherGame, wentLive, channelSubscriptionMatches, false},
+		{"other channel", otherChannel, wentLive, channelSubscriptionMatches, false},
+		{"switch into filtered game", justChatting, switched, channelSubscriptionMatches, true},
+		{"switch without game filter", anyCategory, switched, channelSubscriptionMatches, false},
+		{"title change never alerts", anyCategory, titleChanged, channelSubscriptionMatches, false},
+		{"category went live", category, wentLive, categorySubscriptionMatches, true},
+		{"category rule ignores channel rules", anyCategory, wentLive, categorySubscriptionMatches, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.matcher(tt.sub, tt.event); got != tt.expected {
+				t.Errorf("Expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandleChannelEvent_IgnoresStreamsAlreadyLive(t *testing.T) {
+	_, db, mock := DbMock(t)
+	d := NewAlertDispatcher(db, nil, nil, time.Minute)
+	d.subs = []AlertSubscription{{Kind: alertKindChannel, BroadcasterID: "987654321", SupabaseUserID: testSupabaseUserID}}
+
+	// Subscribing to a channel mid-stream makes the detector report it as going live
+	now := time.Now().UTC()
+	event := twitch.StreamEvent{
+		Type:          twitch.EventWentLive,
+		BroadcasterID: "987654321",
+		OccurredAt:    now,
+		Stream:        twitch.Stream{ID: "1", UserID: "987654321", StartedAt: now.Add(-time.Hour).Format(time.RFC3339)},
+	}
+	if err := d.handleChannelEvent(context.Background(), event); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Expected no alert to be enqueued: %v", err)
+	}
+}
+
+func TestAlertBackoff(t *testing.T) {
+	if alertBackoff(1) != 30*time.Second {
+		t.Errorf("Expected first retry after 30s, got %s", alertBackoff(1))
+	}
+	if alertBackoff(3) != 2*time.Minute {
+		t.Errorf("Expected third retry after 2m, got %s", alertBackoff(3))
+	}
+	if alertBackoff(20) != time.Hour {
+		t.Errorf("Expected backoff capped at 1h, got %s", alertBackoff(20))
+	}
+}
+
+func TestValidateAlertDestination(t *testing.T) {
+	tests := []struct {
+		name    string
+		dest    AlertDestination
+		wantErr bool
+	}{
+		// Public IP literals keep the test from depending on DNS
+		{"discord", AlertDestination{Type: destinationDiscord, URL: "https://discord.com/api/webhooks/1/abc"}, false},
+		{"discord on another host", AlertDestination{Type: destinationDiscord, URL: "https://example.com/api/webhooks/1/abc"}, true},
+		{"slack", AlertDestination{Type: destinationSlack, URL: "https://hooks.slack.com/services/T0/B0/x"}, false},
+		{"slack on another host", AlertDestination{Type: destinationSlack, URL: "https://hooks.slack.com.example.com/services"}, true},
+		{"webhook", AlertDestination{Type: destinationWebhook, URL: "https://93.184.216.34/hook"}, false},
+		{"webhook over http", AlertDestination{Type: destinationWebhook, URL: "http://93.184.216.34/hook"}, true},
+		{"webhook on localhost", AlertDestination{Type: destinationWebhook, URL: "https://localhost:9000/hook"}, true},
+		{"webhook on a private address", AlertDestination{Type: destinationWebhook, URL: "https://10.0.0.5/hook"}, true},
+		{"webhook on link-local metadata", AlertDestination{Type: destinationWebhook, URL: "https://169.254.169.254/latest"}, true},
+		{"webhook on unspecified address", AlertDestination{Type: destinationWebhook, URL: "https://[::]/hook"}, true},
+		{"webpush", AlertDestination{Type: destinationWebPush, URL: "https://93.184.216.34/push/x", P256dh: "key", Auth: "auth"}, false},
+		{"webpush on loopback", AlertDestination{Type: destinationWebPush, URL: "https://127.0.0.1/push/x", P256dh: "key", Auth: "auth"}, true},
+		{"webpush without keys", AlertDestination{Type: destinationWebPush, URL: "https://fcm.googleapis.com/fcm/send/x"}, true},
+		{"unknown type", AlertDestination{Type: "pager", URL: "https://example.com"}, true},
+		{"relative url", AlertDestination{Type: destinationSlack, URL: "/hooks"}, true},
+		{"non-http scheme", AlertDestination{Type: destinationWebhook, URL: "file:///etc/passwd"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAlertDestination(context.Background(), &tt.dest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %t, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAlertsRouter_RequiresAuth(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/alerts", alertsRouter())
+
+	req := httptest.NewRequest("POST", "/alerts/subscriptions", strings.NewReader(`{"kind":"channel","broadcaster_id":"1"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/anomaly"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Actions taken on streams the anomaly detector flags
+const (
+	anomalyActionOff    = "off"    // Ignore flags entirely
+	anomalyActionFlag   = "flag"   // Report reason codes on the stream but keep its position
+	anomalyActionDemote = "demote" // Report reason codes and move the stream to the end of the list
+	anomalyActionHide   = "hide"   // Remove the stream from the list
+)
+
+// anomalyRetention is how long a stream's samples are kept after it was last seen
+const anomalyRetention = 30 * time.Minute
+
+// anomalyPolicyRefreshInterval is how stale an instance's policy may get after another
+// instance changed it
+const anomalyPolicyRefreshInterval = time.Minute
+
+// viewerAnomalies holds the rolling viewer count windows fed by startAnomalyMonitor
+var viewerAnomalies = anomaly.NewDetector(anomaly.Options{})
+
+// AnomalyPolicy is the admin-configured handling of flagged streams. There is a single row.
+type AnomalyPolicy struct {
+	gorm.Model
+	Action string `json:"action"`
+	// Reasons limits the action to these reason codes, empty applies it to all
+	Reasons []string `gorm:"serializer:json" json:"reasons"`
+}
+
+var (
+	anomalyPolicyMu sync.RWMutex
+	anomalyPolicy   = AnomalyPolicy{Action: anomalyActionFlag, Reasons: []string{}}
+)
+
+// currentAnomalyPolicy returns the policy in effect
+func currentAnomalyPolicy() AnomalyPolicy {
+	anomalyPolicyMu.RLock()
+	defer anomalyPolicyMu.RUnlock()
+	return anomalyPolicy
+}
+
+func setAnomalyPolicy(policy AnomalyPolicy) {
+	anomalyPolicyMu.Lock()
+	defer anomalyPolicyMu.Unlock()
+	anomalyPolicy = policy
+}
+
+// validateAnomalyPolicy checks the action and reason codes
+func validateAnomalyPolicy(policy AnomalyPolicy) error {
+	switch policy.Action {
+	case anomalyActionOff, anomalyActionFlag, anomalyActionDemote, anomalyActionHide:
+	default:
+		return fmt.Errorf("action must be one of off, flag, demote or hide, got %q", policy.Action)
+	}
+	for _, reason := range policy.Reasons {
+		switch reason {
+		case anomaly.ReasonViewerSpike, anomaly.ReasonChatRatio, anomaly.ReasonFlatLine:
+		default:
+			return fmt.Errorf("unknown reason code %q", reason)
+		}
+	}
+	return nil
+}
+
+// loadAnomalyPolicy replaces the default policy with the stored one, if any
+func loadAnomalyPolicy(ctx context.Context, db *gorm.DB) error {
+	var policies []AnomalyPolicy
+	if err := db.WithContext(ctx).Order("id").Limit(1).Find(&policies).Error; err != nil {
+		return err
+	}
+	if len(policies) > 0 {
+		setAnomalyPolicy(policies[0])
+	}
+	return nil
+}
+
+// startAnomalyPolicyRefresh periodically reloads the policy, so changes made through any
+// instance reach all of them
+func startAnomalyPolicyRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			zlog.Info().Msg("Anomaly policy refresh stopping")
+			return
+		case <-ticker.C:
+			if err := loadAnomalyPolicy(ctx, DB); err != nil {
+				zlog.Error().Err(err).Msg("Anomaly policy refresh failed, keeping the current policy")
+			}
+		}
+	}
+}
+
+// ============= MONITOR =============
+
+// startAnomalyMonitor samples viewer counts for the top streams on a fixed interval so
+// the detector sees evenly spaced observations
+func startAnomalyMonitor(ctx context.Context, twitchClient twitch.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := sampleViewerCounts(ctx, twitchClient, time.Now())
+		if err != nil {
+			zlog.Error().Err(err).Msg("Anomaly sampling failed")
+		}
+		workerHeartbeats.Beat(workerAnomalyMonitor, err)
+
+		select {
+		case <-ctx.Done():
+			zlog.Info().Msg("Anomaly monitor stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sampleViewerCounts records one viewer count sample for each of the top streams
+func sampleViewerCounts(ctx context.Context, twitchClient twitch.Client, now time.Time) error {
+	streams, err := twitchClient.GetStreams(ctx, twitch.StreamsQueryParams{Limit: twitch.MaxStreamQueryLimit, Sort: "viewers"})
+	if err != nil {
+		return err
+	}
+
+	flagged := 0
+	for _, stream := range streams.Data {
+		sample := anomaly.Sample{At: now, Viewers: stream.ViewerCount, Chatters: chatterCount(stream.UserLogin)}
+		if viewerAnomalies.Observe(stream.ID, stream.UserLogin, sample).Flagged {
+			flagged++
+		}
+	}
+	viewerAnomalies.Prune(now.Add(-anomalyRetention))
+
+	zlog.Debug().Int("sampled", len(streams.Data)).Int("flagged", flagged).Msg("Viewer counts sampled")
+	return nil
+}
+
+// chatterCount returns the unique chatters for a channel, or -1 when its chat is not
+// being read or has not been watched for a full window yet
+func chatterCount(login string) int {
+	if chatReader == nil {
+		return -1
+	}
+	stats, ok := chatReader.Stats(login)
+	if !ok || stats.Observed < stats.Window {
+		return -1
+	}
+	return stats.UniqueChatters
+}
+
+// applyAnomalyPolicy marks, demotes or hides flagged streams according to the current policy
+func applyAnomalyPolicy(streams []twitch.Stream) []twitch.Stream {
+	policy := currentAnomalyPolicy()
+	if policy.Action == anomalyActionOff {
+		return streams
+	}
+
+	kept := make([]twitch.Stream, 0, len(streams))
+	demoted := []twitch.Stream{}
+	for _, stream := range streams {
+		reasons := policyReasons(policy, stream.ID)
+		if len(reasons) == 0 {
+			kept = append(kept, stream)
+			continue
+		}
+
+		stream.Anomalies = reasons
+		switch policy.Action {
+		case anomalyActionHide:
+		case anomalyActionDemote:
+			demoted = append(demoted, stream)
+		default:
+			kept = append(kept, stream)
+		}
+	}
+	return append(kept, demoted...)
+}
+
+// policyReasons returns the stream's flagged reason codes that the policy acts on
+func policyReasons(policy AnomalyPolicy, streamID string) []string {
+	assessment, ok := viewerAnomalies.Assessment(streamID)
+	if !ok || !assessment.Flagged {
+		return nil
+	}
+
+	reasons := []string{}
+	for _, code := range assessment.Codes() {
+		if len(policy.Reasons) == 0 || slices.Contains(policy.Reasons, code) {
+			reasons = append(reasons, code)
+		}
+	}
+	return reasons
+}
+
+// ============= HANDLERS =============
+
+func listStreamAnomalies(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) listStreamAnomalies: %v", tId, apiVersion)
+
+	resp.Data = viewerAnomalies.Flagged()
+
+	zlog.Info().Msgf("(%s) listStreamAnomalies done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func getAnomalyPolicy(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getAnomalyPolicy: %v", tId, apiVersion)
+
+	resp.Data = currentAnomalyPolicy()
+
+	zlog.Info().Msgf("(%s) getAnomalyPolicy done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func updateAnomalyPolicy(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) updateAnomalyPolicy: %v", tId, apiVersion)
+
+	var body AnomalyPolicy
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) updateAnomalyPolicy: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if body.Reasons == nil {
+		body.Reasons = []string{}
+	}
+	if err := validateAnomalyPolicy(body); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	policy := currentAnomalyPolicy()
+	policy.Action = body.Action
+	policy.Reasons = body.Reasons
+	// Without a database the policy only lasts until restart
+	if DB != nil {
+		policy.ID = 1
+		if err := DB.WithContext(r.Context()).Save(&policy).Error; err != nil {
+			handleErr(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	setAnomalyPolicy(policy)
+	resp.Data = policy
+
+	zlog.Info().Msgf("(%s) updateAnomalyPolicy done.", tId)
+	render.JSON(w, r, resp)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/site-tech/VibeGuide/pkg/anomaly"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+// withFlaggedStream swaps in a detector where streamID has a chat_ratio flag
+func withFlaggedStream(t *testing.T, streamID string, action string) {
+	t.Helper()
+	origDetector, origPolicy := viewerAnomalies, currentAnomalyPolicy()
+	viewerAnomalies = anomaly.NewDetector(anomaly.Options{})
+	viewerAnomalies.Observe(streamID, "suspicious", anomaly.Sample{At: time.Now(), Viewers: 50000, Chatters: 2})
+	setAnomalyPolicy(AnomalyPolicy{Action: action, Reasons: []string{}})
+	t.Cleanup(func() {
+		viewerAnomalies = origDetector
+		setAnomalyPolicy(origPolicy)
+	})
+}
+
+func TestApplyAnomalyPolicy(t *testing.T) {
+	tests := []struct {
+		action   string
+		expected []string
+		flagged  bool
+	}{
+		{anomalyActionOff, []string{"teststreamer", "anotherstreamer"}, false},
+		{anomalyActionFlag, []string{"teststreamer", "anotherstreamer"}, true},
+		{anomalyActionDemote, []string{"anotherstreamer", "teststreamer"}, true},
+		{anomalyActionHide, []string{"anotherstreamer"}, false},
+	}
+	for _, tt := range tests {
+		withFlaggedStream(t, "123456789", tt.action)
+
+		streams := applyAnomalyPolicy(createTestStreamsResponse().Data)
+		logins := []string{}
+		flagged := false
+		for _, stream := range streams {
+			logins = append(logins, stream.UserLogin)
+			if stream.UserLogin == "teststreamer" && len(stream.Anomalies) == 1 && stream.Anomalies[0] == anomaly.ReasonChatRatio {
+				flagged = true
+			}
+		}
+		if strings.Join(logins, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.action, tt.expected, logins)
+		}
+		if flagged != tt.flagged {
+			t.Errorf("%s: expected flagged %v, got %v", tt.action, tt.flagged, flagged)
+		}
+	}
+
+	// A policy scoped to other reasons leaves the stream alone
+	withFlaggedStream(t, "123456789", anomalyActionHide)
+	setAnomalyPolicy(AnomalyPolicy{Action: anomalyActionHide, Reasons: []string{anomaly.ReasonFlatLine}})
+	if streams := applyAnomalyPolicy(createTestStreamsResponse().Data); len(streams) != 2 {
+		t.Errorf("Expected scoped policy to keep both streams, got %d", len(streams))
+	}
+}
+
+func TestApplyMatchAnomalyPolicy_DemotesAfterRanking(t *testing.T) {
+	withFlaggedStream(t, "123456789", anomalyActionDemote)
+
+	streams := createTestStreamsResponse().Data
+	matches := []VibeMatch{{Stream: streams[0], Score: 3}, {Stream: streams[1], Score: 1}}
+	demoted := applyMatchAnomalyPolicy(matches)
+	if len(demoted) != 2 || demoted[0].UserLogin != "anotherstreamer" || demoted[1].UserLogin != "teststreamer" {
+		t.Fatalf("Expected the flagged match demoted below the other, got %+v", demoted)
+	}
+	if demoted[1].Score != 3 || len(demoted[1].Anomalies) != 1 {
+		t.Errorf("Expected the demoted match to keep its score and report its flag, got %+v", demoted[1])
+	}
+}
+
+func TestGetStreamsHandler_HidesFlaggedStreams(t *testing.T) {
+	withFlaggedStream(t, "987654321", anomalyActionHide)
+
+	router := setupTestRouter(&mockTwitchClient{streams: createTestStreamsResponse()})
+	req := httptest.NewRequest("GET", "/twitch/streams", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response struct {
+		Data twitch.StreamsResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if len(response.Data.Data) != 1 || response.Data.Data[0].UserLogin != "teststreamer" {
+		t.Errorf("Expected the flagged stream hidden, got %+v", response.Data.Data)
+	}
+}
+
+func TestSampleViewerCounts(t *testing.T) {
+	orig := viewerAnomalies
+	viewerAnomalies = anomaly.NewDetector(anomaly.Options{FlatLineSamples: 3})
+	defer func() { viewerAnomalies = orig }()
+
+	client := &mockTwitchClient{streams: createTestStreamsResponse()}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := sampleViewerCounts(context.Background(), client, now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	// The mock returns the same counts every poll, which is a flat line
+	assessment, ok := viewerAnomalies.Assessment("123456789")
+	if !ok || assessment.Samples != 3 || assessment.Codes()[0] != anomaly.ReasonFlatLine {
+		t.Errorf("Expected a flat_line flag after 3 samples, got %+v", assessment)
+	}
+	if len(viewerAnomalies.Flagged()) != 2 {
+		t.Errorf("Expected both streams flagged, got %+v", viewerAnomalies.Flagged())
+	}
+}
+
+func TestAdminRouter_RequiresAuth(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/admin", adminRouter())
+
+	req := httptest.NewRequest("PUT", "/admin/anomalies/policy", strings.NewReader(`{"action":"hide"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestValidateAnomalyPolicy(t *testing.T) {
+	if err := validateAnomalyPolicy(AnomalyPolicy{Action: anomalyActionDemote, Reasons: []string{anomaly.ReasonViewerSpike}}); err != nil {
+		t.Errorf("Expected valid policy, got: %v", err)
+	}
+	if err := validateAnomalyPolicy(AnomalyPolicy{Action: "ban"}); err == nil {
+		t.Error("Expected unknown action to be rejected")
+	}
+	if err := validateAnomalyPolicy(AnomalyPolicy{Action: anomalyActionHide, Reasons: []string{"vibes"}}); err == nil {
+		t.Error("Expected unknown reason code to be rejected")
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/oauthstate"
+	"github.com/site-tech/VibeGuide/pkg/ratelimit"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// API key scopes
+const (
+	scopeGuideRead     = "guide:read"     // Live streams, categories, vibes and shared lineups
+	scopeTrendsRead    = "trends:read"    // Channel schedules inferred from stream history
+	scopeLineupsManage = "lineups:manage" // The key owner's own lineups
+)
+
+var apiKeyScopes = []string{scopeGuideRead, scopeTrendsRead, scopeLineupsManage}
+
+const (
+	// apiKeyHeader carries a developer API key, as an alternative to bearer auth
+	apiKeyHeader = "X-API-Key"
+	// apiKeyPrefix marks VibeGuide keys so secret scanners and humans can spot them
+	apiKeyPrefix = "vg_"
+	// maxAPIKeysPerUser bounds how many live keys one user can hold
+	maxAPIKeysPerUser = 10
+	// apiKeyTouchInterval is how stale last_used_at may get before a request updates it
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	errInvalidAPIKey      = errors.New("invalid or revoked API key")
+	errAPIKeyAndBearer    = errors.New("send either X-API-Key or a bearer token, not both")
+	errAPIKeyScope        = errors.New("API key is not allowed to call this endpoint")
+	errAPIKeyLimitReached = fmt.Errorf("at most %d API keys per user, revoke one first", maxAPIKeysPerUser)
+)
+
+// APIKey is a developer key acting as its owner with limited scopes. Only the SHA-256 of the key
+// is stored; Prefix identifies it in listings.
+type APIKey struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"-"`
+	SupabaseUserID string     `gorm:"index" json:"-"`
+	Name           string     `json:"name"`
+	Prefix         string     `json:"prefix"`
+	Hash           string     `gorm:"uniqueIndex" json:"-"`
+	Scopes         []string   `gorm:"serializer:json" json:"scopes"`
+	Quota          string     `json:"quota"` // "<limit>/<window>" across all routes
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKey generates a key, returning the secret and its row
+func newAPIKey(userID, name string, scopes []string, quota string) (string, *APIKey, error) {
+	token, err := oauthstate.RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + token
+	return key, &APIKey{
+		SupabaseUserID: userID,
+		Name:           name,
+		Prefix:         key[:len(apiKeyPrefix)+8],
+		Hash:           hashAPIKey(key),
+		Scopes:         scopes,
+		Quota:          quota,
+	}, nil
+}
+
+// apiKeyRoute grants a scope to requests under a path prefix
+type apiKeyRoute struct {
+	prefix   string
+	readOnly bool
+	scope    string
+}
+
+// apiKeyRoutes are the only endpoints API keys may call, first match wins. Everything else
+// (account, alerts, admin, the key endpoints themselves) needs a user session.
+var apiKeyRoutes = []apiKeyRoute{
+	{prefix: "/v1/twitch/streams", readOnly: true, scope: scopeGuideRead},
+	{prefix: "/v1/twitch/categories", readOnly: true, scope: scopeGuideRead},
+	{prefix: "/v1/twitch/channels", readOnly: true, scope: scopeTrendsRead},
+	{prefix: "/v1/vibe", readOnly: true, scope: scopeGuideRead},
+	{prefix: "/v1/lineups/shared", readOnly: true, scope: scopeGuideRead},
+	{prefix: "/v1/lineups", scope: scopeLineupsManage},
+}
+
+// apiKeyScopeFor returns the scope a request needs, or "" when API keys can't make it
+func apiKeyScopeFor(r *http.Request) string {
+	for _, route := range apiKeyRoutes {
+		if r.URL.Path != route.prefix && !strings.HasPrefix(r.URL.Path, route.prefix+"/") {
+			continue
+		}
+		if route.readOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return ""
+		}
+		return route.scope
+	}
+	return ""
+}
+
+type apiKeyCtx string
+
+var (
+	apikeyctx        apiKeyCtx = "auth.apikey"
+	invalidapikeyctx apiKeyCtx = "auth.apikey.invalid"
+)
+
+// currentAPIKey returns the API key APIKeyAuth put in the request context
+func currentAPIKey(r *http.Request) (*APIKey, bool) {
+	key, ok := r.Context().Value(apikeyctx).(*APIKey)
+	return key, ok
+}
+
+// loadAPIKey finds the live key for a secret and refreshes its last use
+func loadAPIKey(ctx context.Context, db *gorm.DB, secret string, now time.Time) (*APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, errInvalidAPIKey
+	}
+	var key APIKey
+	err := db.WithContext(ctx).Where("hash = ? AND revoked_at IS NULL", hashAPIKey(secret)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		key.LastUsedAt = &now
+		if err := db.WithContext(ctx).Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			zlog.Error().Err(err).Uint("api_key_id", key.ID).Msg("Failed to record API key use")
+		}
+	}
+	return &key, nil
+}
+
+// APIKeyAuth accepts X-API-Key as an alternative to bearer auth. The key acts as its owner, but
+// only on the endpoints its scopes cover. Unknown and revoked keys are passed on unauthenticated
+// and marked, so the rate limiter counts them against the client's IP before
+// RejectInvalidAPIKey answers 401.
+func APIKeyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(apiKeyHeader)
+		if secret == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "" {
+			handleErr(w, r, errAPIKeyAndBearer, http.StatusBadRequest)
+			return
+		}
+		if DB == nil {
+			handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+			return
+		}
+
+		key, err := loadAPIKey(r.Context(), DB, secret, time.Now())
+		if errors.Is(err, errInvalidAPIKey) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), invalidapikeyctx, true)))
+			return
+		}
+		if err != nil {
+			zlog.Error().Err(err).Msg("Failed to load API key")
+			handleErr(w, r, fmt.Errorf("failed to check API key"), http.StatusInternalServerError)
+			return
+		}
+		if scope := apiKeyScopeFor(r); scope == "" || !slices.Contains(key.Scopes, scope) {
+			handleErr(w, r, errAPIKeyScope, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apikeyctx, key)))
+	})
+}
+
+// RejectInvalidAPIKey answers 401 for requests APIKeyAuth found an unknown or revoked key on. It
+// runs after the rate limiter, so guessing keys is throttled like any other anonymous traffic.
+func RejectInvalidAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if invalid, _ := r.Context().Value(invalidapikeyctx).(bool); invalid {
+			handleErr(w, r, errInvalidAPIKey, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateAPIKeyQuota checks a requested quota parses and doesn't exceed the default key quota
+func validateAPIKeyQuota(quota string) error {
+	requested, err := ratelimit.ParseQuota(quota)
+	if err != nil {
+		return err
+	}
+	limit, err := ratelimit.ParseQuota(Config.APIKeyQuota)
+	if err != nil {
+		return err
+	}
+	if float64(requested.Limit)/requested.Window.Seconds() > float64(limit.Limit)/limit.Window.Seconds() {
+		return fmt.Errorf("quota may be at most %s", limit)
+	}
+	return nil
+}
+
+// ============= HANDLERS =============
+
+func listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) listAPIKeys: %v", tId, apiVersion)
+
+	user, _ := currentUser(r)
+	var keys []APIKey
+	err := DB.WithContext(r.Context()).Where("supabase_user_id = ?", user.SupabaseUserID).Order("id").Find(&keys).Error
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = keys
+
+	zlog.Info().Msgf("(%s) listAPIKeys done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// createAPIKey issues a key. The secret is only ever returned here.
+func createAPIKey(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) createAPIKey: %v", tId, apiVersion)
+
+	var body struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		Quota  string   `json:"quota"`
+	}
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) createAPIKey: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > 100 {
+		handleErr(w, r, fmt.Errorf("name is required, up to 100 characters"), http.StatusBadRequest)
+		return
+	}
+	if len(body.Scopes) == 0 {
+		handleErr(w, r, fmt.Errorf("at least one scope is required: %s", strings.Join(apiKeyScopes, ", ")), http.StatusBadRequest)
+		return
+	}
+	for _, scope := range body.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			handleErr(w, r, fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(apiKeyScopes, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+	if body.Quota == "" {
+		body.Quota = Config.APIKeyQuota
+	} else if err := validateAPIKeyQuota(body.Quota); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	user, _ := currentUser(r)
+	var live int64
+	err := DB.WithContext(r.Context()).Model(&APIKey{}).
+		Where("supabase_user_id = ? AND revoked_at IS NULL", user.SupabaseUserID).Count(&live).Error
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if live >= maxAPIKeysPerUser {
+		handleErr(w, r, errAPIKeyLimitReached, http.StatusConflict)
+		return
+	}
+
+	secret, key, err := newAPIKey(user.SupabaseUserID, body.Name, body.Scopes, body.Quota)
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if err := DB.WithContext(r.Context()).Create(key).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = struct {
+		*APIKey
+		Key string `json:"key"`
+	}{key, secret}
+
+	zlog.Info().Msgf("(%s) createAPIKey done.", tId)
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, resp)
+}
+
+func revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) revokeAPIKey: %v", tId, apiVersion)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("id must be numeric"), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := currentUser(r)
+	result := DB.WithContext(r.Context()).Model(&APIKey{}).
+		Where("id = ? AND supabase_user_id = ? AND revoked_at IS NULL", id, user.SupabaseUserID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		handleErr(w, r, result.Error, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		handleErr(w, r, fmt.Errorf("not found"), http.StatusNotFound)
+		return
+	}
+
+	zlog.Info().Msgf("(%s) revokeAPIKey done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// updateAPIKeyQuota lets an admin set any quota on a key, e.g. raising it for a popular overlay
+func updateAPIKeyQuota(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) updateAPIKeyQuota: %v", tId, apiVersion)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("id must be numeric"), http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Quota string `json:"quota"`
+	}
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if _, err := ratelimit.ParseQuota(body.Quota); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	var key APIKey
+	if err := DB.WithContext(r.Context()).First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErr(w, r, fmt.Errorf("not found"), http.StatusNotFound)
+			return
+		}
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	key.Quota = body.Quota
+	if err := DB.WithContext(r.Context()).Model(&key).Update("quota", key.Quota).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = key
+
+	zlog.Info().Msgf("(%s) updateAPIKeyQuota done.", tId)
+	render.JSON(w, r, resp)
+}
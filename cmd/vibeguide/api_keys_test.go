@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/ratelimit"
+)
+
+func TestAPIKeyScopeFor(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/v1/twitch/streams", scopeGuideRead},
+		{"GET", "/v1/twitch/categories/509658", scopeGuideRead},
+		{"GET", "/v1/twitch/channels/123/schedule", scopeTrendsRead},
+		{"GET", "/v1/lineups/shared/abc", scopeGuideRead},
+		{"POST", "/v1/lineups", scopeLineupsManage},
+		{"POST", "/v1/vibe/classify", ""},
+		{"GET", "/v1/users/me", ""},
+		{"GET", "/v1/twitch/streamsx", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := apiKeyScopeFor(req); got != tt.expected {
+			t.Errorf("%s %s: expected %q, got %q", tt.method, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func setupAPIKeyAuthRouter() *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(APIKeyAuth)
+	r.Use(RejectInvalidAPIKey)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if key, ok := currentAPIKey(r); ok {
+			w.Header().Set("X-Key-ID", key.Name)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	r.Get("/v1/twitch/streams", handler)
+	r.Get("/v1/users/me", handler)
+	return r
+}
+
+func apiKeyRows(scopes string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "supabase_user_id", "name", "prefix", "hash", "scopes", "quota", "last_used_at"}).
+		AddRow(7, testSupabaseUserID, "overlay", "vg_abcdefgh", hashAPIKey("vg_secret"), scopes, "600/1m", nil)
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	r := setupAPIKeyAuthRouter()
+	do := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// No key: passes through untouched
+	if w := do("/v1/users/me", nil); w.Code != http.StatusOK || w.Header().Get("X-Key-ID") != "" {
+		t.Errorf("Expected requests without a key to pass through, got %d", w.Code)
+	}
+
+	if w := do("/v1/twitch/streams", map[string]string{apiKeyHeader: "vg_secret", "Authorization": "Bearer x"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d with both credentials, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "api_keys" WHERE hash = \$1 AND revoked_at IS NULL`).
+		WithArgs(hashAPIKey("vg_unknown"), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if w := do("/v1/twitch/streams", map[string]string{apiKeyHeader: "vg_unknown"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d for an unknown key, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "api_keys" WHERE hash = \$1 AND revoked_at IS NULL`).
+		WithArgs(hashAPIKey("vg_secret"), 1).
+		WillReturnRows(apiKeyRows(`["guide:read"]`))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "api_keys" SET "last_used_at"=\$1 WHERE "id" = \$2`).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if w := do("/v1/twitch/streams", map[string]string{apiKeyHeader: "vg_secret"}); w.Code != http.StatusOK || w.Header().Get("X-Key-ID") != "overlay" {
+		t.Errorf("Expected the key to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "api_keys" WHERE hash = \$1 AND revoked_at IS NULL`).
+		WithArgs(hashAPIKey("vg_secret"), 1).
+		WillReturnRows(apiKeyRows(`["guide:read"]`))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "api_keys" SET "last_used_at"=\$1 WHERE "id" = \$2`).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if w := do("/v1/users/me", map[string]string{apiKeyHeader: "vg_secret"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d outside the key's scopes, got %d", http.StatusForbidden, w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestAPIKeyAuth_InvalidKeysAreRateLimited(t *testing.T) {
+	sqldb, gormdb, _ := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	limit, err := newRateLimitMiddleware(&VibeConfig{RateLimit: "2/1m"}, ratelimit.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(APIKeyAuth)
+	r.Use(limit)
+	r.Use(RejectInvalidAPIKey)
+	r.Get("/v1/lineups", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	// Each guess is a different key, so only the IP ties them together
+	codes := []int{}
+	for _, guess := range []string{"guess-1", "guess-2", "guess-3"} {
+		req := httptest.NewRequest("GET", "/v1/lineups", nil)
+		req.RemoteAddr = "203.0.113.7:1000"
+		req.Header.Set(apiKeyHeader, guess)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	expected := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	if !slices.Equal(codes, expected) {
+		t.Errorf("Expected %v, got %v", expected, codes)
+	}
+}
+
+func setupAPIKeysRouter(user *User) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authctx, user)))
+		})
+	})
+	r.Post("/users/me/api-keys", createAPIKey)
+	r.Delete("/users/me/api-keys/{id}", revokeAPIKey)
+	return r
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	origConfig := Config
+	Config = &VibeConfig{APIKeyQuota: "600/1m"}
+	defer func() { Config = origConfig }()
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	r := setupAPIKeysRouter(&User{SupabaseUserID: testSupabaseUserID})
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/users/me/api-keys", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, body := range []string{
+		`{"scopes":["guide:read"]}`,
+		`{"name":"overlay"}`,
+		`{"name":"overlay","scopes":["admin"]}`,
+		`{"name":"overlay","scopes":["guide:read"],"quota":"10000/1m"}`,
+	} {
+		if w := post(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "api_keys" WHERE supabase_user_id = \$1 AND revoked_at IS NULL`).
+		WithArgs(testSupabaseUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(maxAPIKeysPerUser))
+	if w := post(`{"name":"overlay","scopes":["guide:read"]}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d at the key limit, got %d", http.StatusConflict, w.Code)
+	}
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "api_keys" WHERE supabase_user_id = \$1 AND revoked_at IS NULL`).
+		WithArgs(testSupabaseUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "api_keys"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectCommit()
+	w := post(`{"name":"overlay","scopes":["guide:read","lineups:manage"],"quota":"60/1m"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var resp struct {
+		mytypes.APIHandlerResp
+		Data struct {
+			ID     uint     `json:"id"`
+			Key    string   `json:"key"`
+			Prefix string   `json:"prefix"`
+			Hash   string   `json:"hash"`
+			Scopes []string `json:"scopes"`
+			Quota  string   `json:"quota"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !strings.HasPrefix(resp.Data.Key, apiKeyPrefix) || !strings.HasPrefix(resp.Data.Key, resp.Data.Prefix) {
+		t.Errorf("Expected a %s key matching its prefix, got %+v", apiKeyPrefix, resp.Data)
+	}
+	if resp.Data.Hash != "" {
+		t.Error("Expected the hash not to be returned")
+	}
+	if resp.Data.ID != 3 || resp.Data.Quota != "60/1m" || len(resp.Data.Scopes) != 2 {
+		t.Errorf("Unexpected key: %+v", resp.Data)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	r := setupAPIKeysRouter(&User{SupabaseUserID: testSupabaseUserID})
+	revoke := func(id string) int {
+		req := httptest.NewRequest("DELETE", "/users/me/api-keys/"+id, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "api_keys" SET "revoked_at"=\$1,"updated_at"=\$2 WHERE id = \$3 AND supabase_user_id = \$4 AND revoked_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 3, testSupabaseUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if code := revoke("3"); code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+
+	// Someone else's key, or one already revoked
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "api_keys" SET "revoked_at"=`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	if code := revoke("4"); code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, code)
+	}
+
+	if code := revoke("abc"); code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestLoadAPIKey_SkipsRecentTouch(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT \* FROM "api_keys" WHERE hash = \$1 AND revoked_at IS NULL`).
+		WithArgs(hashAPIKey("vg_secret"), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scopes", "last_used_at"}).AddRow(7, `["guide:read"]`, now.Add(-10*time.Second)))
+
+	key, err := loadAPIKey(context.Background(), gormdb, "vg_secret", now)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if key.ID != 7 {
+		t.Errorf("Expected key 7, got %d", key.ID)
+	}
+	if _, err := loadAPIKey(context.Background(), gormdb, "not-a-key", now); err != errInvalidAPIKey {
+		t.Errorf("Expected errInvalidAPIKey without a database call, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
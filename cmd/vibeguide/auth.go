@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
+	"github.com/google/uuid"
 	zlog "github.com/rs/zerolog/log"
 	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/supajwt"
 	"github.com/site-tech/VibeGuide/pkg/twitch"
 	"github.com/supabase-community/gotrue-go/types"
 )
@@ -29,7 +32,7 @@ func signupUser(w http.ResponseWriter, r *http.Request) {
 	err := render.DecodeJSON(r.Body, &emailPass)
 	if err != nil {
 		zlog.Error().Msgf("(%s) signupUser: body decode error: %s", tId, err.Error())
-		handleErr(w, r, err, http.StatusBadRequest)
+		handleAuthErr(w, r, newAuthError(http.StatusBadRequest, authErrInvalidRequest, "invalid request body"))
 		return
 	}
 	// use supabase client to sign up
@@ -39,7 +42,7 @@ func signupUser(w http.ResponseWriter, r *http.Request) {
 	})
 	if err != nil {
 		zlog.Error().Msgf("(%s) signupUser: signup user error: %s", tId, err.Error())
-		handleErr(w, r, err, http.StatusBadRequest)
+		handleAuthErr(w, r, err)
 		return
 	}
 	resp.Data = signupResp
@@ -62,17 +65,24 @@ func loginUser(w http.ResponseWriter, r *http.Request) {
 	err := render.DecodeJSON(r.Body, &emailPass)
 	if err != nil {
 		zlog.Error().Msgf("(%s) loginUser: body decode error: %s", tId, err.Error())
-		handleErr(w, r, err, http.StatusBadRequest)
+		handleAuthErr(w, r, newAuthError(http.StatusBadRequest, authErrInvalidRequest, "invalid request body"))
 		return
 	}
-	// use supabase client to login
-	session, err := SBClient.SignInWithEmailPassword(emailPass.Email, emailPass.Password)
+	// use the auth client directly: the supabase client's SignInWithEmailPassword stores the
+	// user's token on the shared client
+	token, err := SBClient.Auth.SignInWithEmailPassword(emailPass.Email, emailPass.Password)
 	if err != nil {
 		zlog.Error().Msgf("(%s) loginUser: login user error: %s", tId, err.Error())
-		handleErr(w, r, err, http.StatusBadRequest)
+		handleAuthErr(w, r, err)
+		return
+	}
+	// In cookie session mode the tokens stay server-side
+	resp.Data, err = sessionData(w, r, token.Session)
+	if err != nil {
+		zlog.Error().Msgf("(%s) loginUser: start session error: %s", tId, err.Error())
+		handleAuthErr(w, r, err)
 		return
 	}
-	resp.Data = session
 
 	zlog.Info().Msgf("(%s) loginUser done.", tId)
 	render.JSON(w, r, resp)
@@ -88,7 +98,7 @@ func logoutUser(w http.ResponseWriter, r *http.Request) {
 	accessToken, err := extractBearerToken(r)
 	if err != nil {
 		zlog.Error().Msgf("(%s) logoutUser: token extraction error: %s", tId, err.Error())
-		handleErr(w, r, err, http.StatusUnauthorized)
+		handleAuthErr(w, r, newAuthError(http.StatusUnauthorized, authErrUnauthorized, err.Error()))
 		return
 	}
 
@@ -97,10 +107,14 @@ func logoutUser(w http.ResponseWriter, r *http.Request) {
 	err = authClient.Logout()
 	if err != nil {
 		zlog.Error().Msgf("(%s) logoutUser: logout error: %s", tId, err.Error())
-		handleErr(w, r, err, http.StatusBadRequest)
+		handleAuthErr(w, r, err)
 		return
 	}
 
+	if sessionCookies {
+		endCookieSession(w, r)
+	}
+
 	zlog.Info().Msgf("(%s) logoutUser done.", tId)
 	render.JSON(w, r, resp)
 }
@@ -115,7 +129,7 @@ func getUserAuth(w http.ResponseWriter, r *http.Request) {
 	accessToken, err := extractBearerToken(r)
 	if err != nil {
 		zlog.Error().Msgf("(%s) getUserAuth: token extraction error: %s", tId, err.Error())
-		handleErr(w, r, err, http.StatusUnauthorized)
+		handleAuthErr(w, r, newAuthError(http.StatusUnauthorized, authErrUnauthorized, err.Error()))
 		return
 	}
 
@@ -124,7 +138,7 @@ func getUserAuth(w http.ResponseWriter, r *http.Request) {
 	user, err := authClient.GetUser()
 	if err != nil {
 		zlog.Error().Msgf("(%s) getUserAuth: get user error: %s", tId, err.Error())
-		handleErr(w, r, err, http.StatusUnauthorized)
+		handleAuthErr(w, r, err)
 		return
 	}
 	resp.Data = user
@@ -149,6 +163,82 @@ func extractBearerToken(r *http.Request) (string, error) {
 	return parts[1], nil
 }
 
+type authClaimsCtx string
+
+var claimsctx authClaimsCtx = "auth.claims"
+
+// tokenVerifier checks Supabase access tokens locally. Created in run().
+var tokenVerifier *supajwt.Verifier
+
+// VerifyBearer verifies the request's Supabase access token once, if there is one, and keeps the
+// claims in the request context for the handlers. Invalid tokens are not rejected here: public
+// routes treat the caller as anonymous and protected routes fail in getAuthenticatedUser.
+func VerifyBearer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := extractBearerToken(r); err != nil || tokenVerifier == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := verifyRequestToken(r)
+		if err != nil {
+			zlog.Debug().Err(err).Msg("Ignoring unverifiable access token")
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsctx, claims)))
+	})
+}
+
+func verifyRequestToken(r *http.Request) (*supajwt.Claims, error) {
+	accessToken, err := extractBearerToken(r)
+	if err != nil {
+		return nil, fmt.Errorf("authentication required")
+	}
+	if tokenVerifier == nil {
+		return nil, fmt.Errorf("token verification unavailable")
+	}
+	claims, err := tokenVerifier.Verify(r.Context(), accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authentication token")
+	}
+	return claims, nil
+}
+
+// getAuthenticatedUser returns the user the request's Supabase access token belongs to. The token
+// is verified locally, so only the fields carried in its claims (ID, email, phone, role and
+// metadata) are filled in; call GetUser when the full profile is needed. Requests made with an
+// API key act as the key's owner, with only the ID filled in.
+func getAuthenticatedUser(r *http.Request) (*types.User, error) {
+	if key, ok := currentAPIKey(r); ok {
+		id, err := uuid.Parse(key.SupabaseUserID)
+		if err != nil {
+			return nil, errInvalidAPIKey
+		}
+		return &types.User{ID: id}, nil
+	}
+
+	claims, ok := r.Context().Value(claimsctx).(*supajwt.Claims)
+	if !ok {
+		var err error
+		if claims, err = verifyRequestToken(r); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authentication token")
+	}
+	return &types.User{
+		ID:           id,
+		Role:         claims.Role,
+		Email:        claims.Email,
+		Phone:        claims.Phone,
+		AppMetadata:  claims.AppMetadata,
+		UserMetadata: claims.UserMetadata,
+	}, nil
+}
+
 // Twitch OAuth Methods =============================================================
 
 func getTwitchAuthURL(w http.ResponseWriter, r *http.Request) {
@@ -157,9 +247,8 @@ func getTwitchAuthURL(w http.ResponseWriter, r *http.Request) {
 	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
 	zlog.Info().Msgf("(%s) getTwitchAuthURL: %v", tId, apiVersion)
 
-	// Get redirect URI and state from query params
+	// Get redirect URI from query params
 	redirectURI := r.URL.Query().Get("redirect_uri")
-	state := r.URL.Query().Get("state")
 
 	if redirectURI == "" {
 		zlog.Error().Msgf("(%s) getTwitchAuthURL: missing redirect_uri parameter", tId)
@@ -167,21 +256,32 @@ func getTwitchAuthURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if state == "" {
-		zlog.Error().Msgf("(%s) getTwitchAuthURL: missing state parameter", tId)
-		handleErr(w, r, http.ErrNotSupported, http.StatusBadRequest)
+	if !allowedRedirectURI(redirectURI) {
+		zlog.Warn().Msgf("(%s) getTwitchAuthURL: redirect_uri not allowed: %s", tId, redirectURI)
+		handleErr(w, r, fmt.Errorf("redirect_uri is not allowed"), http.StatusBadRequest)
 		return
 	}
 
-	// Define scopes for Twitch OAuth
-	scopes := []string{"user:read:email", "user:read:follows"}
+	// The state is minted here, bound to this browser, and verified by twitchCallback
+	session, err := oauthSession(w, r)
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	state, err := oauthStates.Mint(redirectURI, session)
+	if err != nil {
+		zlog.Error().Msgf("(%s) getTwitchAuthURL: mint state error: %s", tId, err.Error())
+		handleErr(w, r, fmt.Errorf("failed to start twitch login"), http.StatusInternalServerError)
+		return
+	}
 
 	// Get Twitch client from context (passed via router)
 	twitchClient := r.Context().Value("twitchClient").(twitch.Client)
-	authURL := twitchClient.GetAuthorizationURL(redirectURI, state, scopes)
+	authURL := twitchClient.GetAuthorizationURL(redirectURI, state, twitchLoginScopes)
 
 	resp.Data = map[string]string{
 		"auth_url": authURL,
+		"state":    state,
 	}
 
 	zlog.Info().Msgf("(%s) getTwitchAuthURL done.", tId)
@@ -211,6 +311,18 @@ func twitchCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject states we didn't mint, minted for another browser or redirect URI, expired or reused
+	cookie, err := r.Cookie(oauthSessionCookie)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("twitch login session not found, start the login again"), http.StatusBadRequest)
+		return
+	}
+	if err := oauthStates.Verify(state, redirectURI, cookie.Value); err != nil {
+		zlog.Warn().Msgf("(%s) twitchCallback: state rejected: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
 	// Get Twitch client from context
 	twitchClient := r.Context().Value("twitchClient").(twitch.Client)
 
@@ -230,23 +342,14 @@ func twitchCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create or update user in Supabase using Twitch ID
-	// Note: You may want to link this with Supabase auth or store in your database
-	resp.Data = map[string]interface{}{
-		"access_token":  userToken.AccessToken,
-		"refresh_token": userToken.RefreshToken,
-		"expires_in":    userToken.ExpiresIn,
-		"token_type":    userToken.TokenType,
-		"scope":         userToken.Scope,
-		"state":         state,
-		"user": map[string]interface{}{
-			"id":                user.ID,
-			"login":             user.Login,
-			"display_name":      user.DisplayName,
-			"email":             user.Email,
-			"profile_image_url": user.ProfileImageURL,
-		},
+	data, status, err := completeTwitchLogin(w, r, userToken, user, redirectURI)
+	if err != nil {
+		zlog.Error().Msgf("(%s) twitchCallback: link account error: %s", tId, err.Error())
+		handleErr(w, r, err, status)
+		return
 	}
+	data["state"] = state
+	resp.Data = data
 
 	zlog.Info().Msgf("(%s) twitchCallback done.", tId)
 	render.JSON(w, r, resp)
@@ -282,64 +385,3 @@ func validateTwitchToken(w http.ResponseWriter, r *http.Request) {
 	zlog.Info().Msgf("(%s) validateTwitchToken done.", tId)
 	render.JSON(w, r, resp)
 }
-
-// extractTwitchTokenFromUser extracts the Twitch access token from Supabase user metadata
-func extractTwitchTokenFromUser(user *types.User) (string, error) {
-	if user.UserMetadata == nil {
-		return "", fmt.Errorf("user metadata not found")
-	}
-
-	// Check for Twitch token in user metadata
-	if twitchData, exists := user.UserMetadata["twitch"]; exists {
-		if twitchMap, ok := twitchData.(map[string]interface{}); ok {
-			if accessToken, exists := twitchMap["access_token"]; exists {
-				if tokenStr, ok := accessToken.(string); ok && tokenStr != "" {
-					return tokenStr, nil
-				}
-			}
-		}
-	}
-
-	// Also check for direct access_token field (alternative storage format)
-	if accessToken, exists := user.UserMetadata["twitch_access_token"]; exists {
-		if tokenStr, ok := accessToken.(string); ok && tokenStr != "" {
-			return tokenStr, nil
-		}
-	}
-
-	return "", fmt.Errorf("twitch access token not found in user metadata")
-}
-
-// extractTwitchUserIDFromUser extracts the Twitch user ID from Supabase user metadata
-func extractTwitchUserIDFromUser(user *types.User) (string, error) {
-	if user.UserMetadata == nil {
-		return "", fmt.Errorf("user metadata not found")
-	}
-
-	// Check for Twitch user ID in user metadata
-	if twitchData, exists := user.UserMetadata["twitch"]; exists {
-		if twitchMap, ok := twitchData.(map[string]interface{}); ok {
-			if userID, exists := twitchMap["user_id"]; exists {
-				if userIDStr, ok := userID.(string); ok && userIDStr != "" {
-					return userIDStr, nil
-				}
-			}
-		}
-	}
-
-	// Also check for direct user_id field (alternative storage format)
-	if userID, exists := user.UserMetadata["twitch_user_id"]; exists {
-		if userIDStr, ok := userID.(string); ok && userIDStr != "" {
-			return userIDStr, nil
-		}
-	}
-
-	// Check if the user ID is stored in the sub field (common OAuth pattern)
-	if sub, exists := user.UserMetadata["sub"]; exists {
-		if subStr, ok := sub.(string); ok && subStr != "" {
-			return subStr, nil
-		}
-	}
-
-	return "", fmt.Errorf("twitch user ID not found in user metadata")
-}
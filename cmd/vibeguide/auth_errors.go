@@ -0,0 +1,136 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+)
+
+// authErrorCode is the machine-readable reason in an auth error response, stable across GoTrue
+// versions so clients can branch on it
+type authErrorCode string
+
+const (
+	authErrInvalidRequest authErrorCode = "invalid_request"  // Missing or malformed input
+	authErrInvalidGrant   authErrorCode = "invalid_grant"    // Wrong password, bad or reused refresh token
+	authErrInvalidToken   authErrorCode = "invalid_token"    // Bad or expired OTP or link token
+	authErrUnauthorized   authErrorCode = "unauthorized"     // Missing or invalid access token
+	authErrConflict       authErrorCode = "conflict"         // Email or phone already registered
+	authErrWeakPassword   authErrorCode = "weak_password"    // Rejected by the password policy
+	authErrRateLimited    authErrorCode = "rate_limited"     // Too many requests or emails
+	authErrUnavailable    authErrorCode = "auth_unavailable" // GoTrue unreachable or failing
+)
+
+// authError is an auth failure with the HTTP status and code to answer with
+type authError struct {
+	status  int
+	code    authErrorCode
+	message string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+func newAuthError(status int, code authErrorCode, message string) *authError {
+	return &authError{status: status, code: code, message: message}
+}
+
+// gotrueErrorCodes maps GoTrue error_code and OAuth error values to our codes
+var gotrueErrorCodes = map[string]authErrorCode{
+	"invalid_grant":              authErrInvalidGrant,
+	"invalid_credentials":        authErrInvalidGrant,
+	"refresh_token_not_found":    authErrInvalidGrant,
+	"refresh_token_already_used": authErrInvalidGrant,
+	"session_not_found":          authErrInvalidGrant,
+	"otp_expired":                authErrInvalidToken,
+	"bad_jwt":                    authErrUnauthorized,
+	"no_authorization":           authErrUnauthorized,
+	"email_exists":               authErrConflict,
+	"phone_exists":               authErrConflict,
+	"user_already_exists":        authErrConflict,
+	"weak_password":              authErrWeakPassword,
+	"over_request_rate_limit":    authErrRateLimited,
+	"over_email_send_rate_limit": authErrRateLimited,
+	"over_sms_send_rate_limit":   authErrRateLimited,
+	"validation_failed":          authErrInvalidRequest,
+}
+
+var authErrorStatus = map[authErrorCode]int{
+	authErrInvalidRequest: http.StatusBadRequest,
+	authErrInvalidGrant:   http.StatusUnauthorized,
+	authErrInvalidToken:   http.StatusUnauthorized,
+	authErrUnauthorized:   http.StatusUnauthorized,
+	authErrConflict:       http.StatusConflict,
+	authErrWeakPassword:   http.StatusUnprocessableEntity,
+	authErrRateLimited:    http.StatusTooManyRequests,
+	authErrUnavailable:    http.StatusBadGateway,
+}
+
+// toAuthError classifies an error from the gotrue-go client ("response status code 400: {...}")
+// by GoTrue's error code when it sends one, otherwise by status
+func toAuthError(err error) *authError {
+	var ae *authError
+	if errors.As(err, &ae) {
+		return ae
+	}
+
+	status := gotrueStatus(err)
+	var body struct {
+		ErrorCode        string `json:"error_code"`
+		Error            string `json:"error"`
+		Msg              string `json:"msg"`
+		Message          string `json:"message"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if _, raw, ok := strings.Cut(err.Error(), ": "); ok && status != 0 {
+		_ = json.Unmarshal([]byte(raw), &body)
+	}
+	message := cmp.Or(body.Msg, body.Message, body.ErrorDescription, http.StatusText(status))
+
+	code, ok := gotrueErrorCodes[body.ErrorCode]
+	if !ok {
+		code, ok = gotrueErrorCodes[body.Error]
+	}
+	if !ok {
+		switch {
+		case status == 0 || status >= http.StatusInternalServerError:
+			code, message = authErrUnavailable, "authentication service unavailable"
+		case status == http.StatusTooManyRequests:
+			code = authErrRateLimited
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			code = authErrUnauthorized
+		default:
+			code = authErrInvalidRequest
+		}
+	}
+	return newAuthError(authErrorStatus[code], code, message)
+}
+
+// handleAuthErr writes an auth error envelope whose data is {code, message}
+func handleAuthErr(w http.ResponseWriter, r *http.Request, err error) {
+	ae := toAuthError(err)
+	ctx := r.Context()
+	tId := middleware.GetReqID(ctx)
+	apiVersion := ctx.Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	resp.Data = mytypes.APIError{Code: string(ae.code), Message: ae.message}
+	zlog.Error().
+		Err(err).
+		Int("status_code", ae.status).
+		Str("error_code", string(ae.code)).
+		Str("transaction_id", tId).
+		Str("api_version", apiVersion).
+		Str("request_path", r.URL.Path).
+		Str("request_method", r.Method).
+		Msg("Auth Error")
+	w.WriteHeader(ae.status)
+	render.JSON(w, r, resp)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/supabase-community/gotrue-go/types"
+)
+
+// Session-issuing and account recovery flows, all proxied to GoTrue. Errors are answered with
+// handleAuthErr so every auth route shares the same {code, message} error shape.
+
+// verifyTypes are the OTP and link types /verify accepts
+var verifyTypes = map[types.VerificationType]bool{
+	types.VerificationTypeSignup:      true,
+	types.VerificationTypeRecovery:    true,
+	types.VerificationTypeInvite:      true,
+	types.VerificationTypeMagiclink:   true,
+	types.VerificationTypeEmailChange: true,
+	types.VerificationTypeSMS:         true,
+	types.VerificationTypePhoneChange: true,
+}
+
+// sessionData is what a handler returns for a new Supabase session: the session itself, or in
+// cookie session mode the user and CSRF token while the tokens stay server-side
+func sessionData(w http.ResponseWriter, r *http.Request, session types.Session) (any, error) {
+	if !sessionCookies {
+		return session, nil
+	}
+	csrfToken, err := startCookieSession(w, r, session)
+	if err != nil {
+		return nil, newAuthError(http.StatusInternalServerError, authErrUnavailable, "failed to start session")
+	}
+	return map[string]interface{}{
+		"user":       session.User,
+		"csrf_token": csrfToken,
+	}, nil
+}
+
+// decodeAuthBody decodes a JSON request body, answering invalid_request when it can't
+func decodeAuthBody(r *http.Request, v any) error {
+	if err := render.DecodeJSON(r.Body, v); err != nil {
+		return newAuthError(http.StatusBadRequest, authErrInvalidRequest, "invalid request body")
+	}
+	return nil
+}
+
+func refreshSession(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) refreshSession: %v", tId, apiVersion)
+
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := decodeAuthBody(r, &body); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	if body.RefreshToken == "" {
+		handleAuthErr(w, r, newAuthError(http.StatusBadRequest, authErrInvalidRequest, "refresh_token is required"))
+		return
+	}
+
+	token, err := SBClient.Auth.RefreshToken(body.RefreshToken)
+	if err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	resp.Data, err = sessionData(w, r, token.Session)
+	if err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+
+	zlog.Info().Msgf("(%s) refreshSession done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// recoverPassword sends a password reset email. GoTrue answers the same whether or not the
+// email is registered, so this can't be used to probe for accounts.
+func recoverPassword(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) recoverPassword: %v", tId, apiVersion)
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := decodeAuthBody(r, &body); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	if body.Email == "" {
+		handleAuthErr(w, r, newAuthError(http.StatusBadRequest, authErrInvalidRequest, "email is required"))
+		return
+	}
+
+	if err := SBClient.Auth.Recover(types.RecoverRequest{Email: body.Email}); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	resp.Data = map[string]bool{"sent": true}
+
+	zlog.Info().Msgf("(%s) recoverPassword done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// verifyOTP redeems an emailed or texted OTP (signup, recovery, magic link, email or phone
+// change) for a session
+func verifyOTP(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) verifyOTP: %v", tId, apiVersion)
+
+	var body struct {
+		Type  types.VerificationType `json:"type"`
+		Token string                 `json:"token"`
+		Email string                 `json:"email"`
+		Phone string                 `json:"phone"`
+	}
+	if err := decodeAuthBody(r, &body); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	switch {
+	case !verifyTypes[body.Type]:
+		handleAuthErr(w, r, newAuthError(http.StatusBadRequest, authErrInvalidRequest, "unsupported verification type"))
+		return
+	case body.Token == "" || (body.Email == "" && body.Phone == ""):
+		handleAuthErr(w, r, newAuthError(http.StatusBadRequest, authErrInvalidRequest, "token and email or phone are required"))
+		return
+	}
+
+	session, err := verifyForSession(types.VerifyForUserRequest{
+		Type:  body.Type,
+		Token: body.Token,
+		Email: body.Email,
+		Phone: body.Phone,
+	})
+	if err != nil {
+		// GoTrue answers 403 for an expired or already used token
+		if status := gotrueStatus(err); status == http.StatusForbidden || status == http.StatusUnauthorized {
+			err = newAuthError(http.StatusUnauthorized, authErrInvalidToken, "token is invalid or has expired")
+		}
+		handleAuthErr(w, r, err)
+		return
+	}
+	resp.Data, err = sessionData(w, r, *session)
+	if err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+
+	zlog.Info().Msgf("(%s) verifyOTP done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func sendMagicLink(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) sendMagicLink: %v", tId, apiVersion)
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := decodeAuthBody(r, &body); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	if body.Email == "" {
+		handleAuthErr(w, r, newAuthError(http.StatusBadRequest, authErrInvalidRequest, "email is required"))
+		return
+	}
+
+	if err := SBClient.Auth.Magiclink(types.MagiclinkRequest{Email: body.Email}); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	resp.Data = map[string]bool{"sent": true}
+
+	zlog.Info().Msgf("(%s) sendMagicLink done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// sendOTP emails or texts a one-time code, redeemed with /verify. New users are only created
+// when create_user is set.
+func sendOTP(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) sendOTP: %v", tId, apiVersion)
+
+	var body struct {
+		Email      string `json:"email"`
+		Phone      string `json:"phone"`
+		CreateUser bool   `json:"create_user"`
+	}
+	if err := decodeAuthBody(r, &body); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	if (body.Email == "") == (body.Phone == "") {
+		handleAuthErr(w, r, newAuthError(http.StatusBadRequest, authErrInvalidRequest, "exactly one of email or phone is required"))
+		return
+	}
+
+	err := SBClient.Auth.OTP(types.OTPRequest{Email: body.Email, Phone: body.Phone, CreateUser: body.CreateUser})
+	if err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	resp.Data = map[string]bool{"sent": true}
+
+	zlog.Info().Msgf("(%s) sendOTP done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// updateUserAuth changes the signed-in user's email or password. Email changes only take effect
+// once confirmed through the link GoTrue sends.
+func updateUserAuth(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) updateUserAuth: %v", tId, apiVersion)
+
+	accessToken, err := extractBearerToken(r)
+	if err != nil {
+		handleAuthErr(w, r, newAuthError(http.StatusUnauthorized, authErrUnauthorized, "authentication required"))
+		return
+	}
+
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := decodeAuthBody(r, &body); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	if body.Email == "" && body.Password == "" {
+		handleAuthErr(w, r, newAuthError(http.StatusBadRequest, authErrInvalidRequest, "email or password is required"))
+		return
+	}
+
+	update := types.UpdateUserRequest{Email: body.Email}
+	if body.Password != "" {
+		update.Password = &body.Password
+	}
+	user, err := SBClient.Auth.WithToken(accessToken).UpdateUser(update)
+	if err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	resp.Data = user
+
+	zlog.Info().Msgf("(%s) updateUserAuth done.", tId)
+	render.JSON(w, r, resp)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// goTrueReply is a canned GoTrue response
+type goTrueReply struct {
+	status int
+	body   string
+}
+
+const testGoTrueSession = `{"access_token":"access","refresh_token":"refresh","token_type":"bearer","expires_in":3600,"user":{"id":"` + testSupabaseUserID + `"}}`
+
+func setupAuthFlowRouter(t *testing.T, replies map[string]goTrueReply, seen map[string]*http.Request) *chi.Mux {
+	t.Helper()
+	withGoTrueServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		if seen != nil {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(strings.NewReader(string(body)))
+			seen[key] = r
+		}
+		reply, ok := replies[key]
+		if !ok {
+			t.Errorf("Unexpected GoTrue request %s", key)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(reply.status)
+		w.Write([]byte(reply.body))
+	}))
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/auth", authRouter())
+	return r
+}
+
+// authErrorCodeOf returns data.code from an error envelope
+func authErrorCodeOf(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response struct {
+		Data struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if response.Data.Message == "" {
+		t.Errorf("Expected an error message, got %s", w.Body.String())
+	}
+	return response.Data.Code
+}
+
+func TestAuthFlows(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		bearer string
+		reply  map[string]goTrueReply
+		status int
+		code   string
+	}{
+		{"refresh", "POST", "/auth/refresh", `{"refresh_token":"refresh"}`, "",
+			map[string]goTrueReply{"POST /token": {200, testGoTrueSession}}, http.StatusOK, ""},
+		{"refresh revoked", "POST", "/auth/refresh", `{"refresh_token":"old"}`, "",
+			map[string]goTrueReply{"POST /token": {400, `{"error":"invalid_grant","error_description":"Invalid Refresh Token: Already Used"}`}}, http.StatusUnauthorized, "invalid_grant"},
+		{"refresh missing token", "POST", "/auth/refresh", `{}`, "", nil, http.StatusBadRequest, "invalid_request"},
+		{"recover", "POST", "/auth/recover", `{"email":"a@example.com"}`, "",
+			map[string]goTrueReply{"POST /recover": {200, `{}`}}, http.StatusOK, ""},
+		{"recover rate limited", "POST", "/auth/recover", `{"email":"a@example.com"}`, "",
+			map[string]goTrueReply{"POST /recover": {429, `{"code":429,"error_code":"over_email_send_rate_limit","msg":"email rate limit exceeded"}`}}, http.StatusTooManyRequests, "rate_limited"},
+		{"verify", "POST", "/auth/verify", `{"type":"magiclink","token":"123456","email":"a@example.com"}`, "",
+			map[string]goTrueReply{"POST /verify": {200, testGoTrueSession}}, http.StatusOK, ""},
+		{"verify expired", "POST", "/auth/verify", `{"type":"recovery","token":"123456","email":"a@example.com"}`, "",
+			map[string]goTrueReply{"POST /verify": {403, `{"code":403,"error_code":"otp_expired","msg":"Token has expired or is invalid"}`}}, http.StatusUnauthorized, "invalid_token"},
+		{"verify bad type", "POST", "/auth/verify", `{"type":"password","token":"1","email":"a@example.com"}`, "", nil, http.StatusBadRequest, "invalid_request"},
+		{"magic link", "POST", "/auth/magiclink", `{"email":"a@example.com"}`, "",
+			map[string]goTrueReply{"POST /magiclink": {200, `{}`}}, http.StatusOK, ""},
+		{"otp", "POST", "/auth/otp", `{"phone":"+15555550100"}`, "",
+			map[string]goTrueReply{"POST /otp": {200, `{}`}}, http.StatusOK, ""},
+		{"otp email and phone", "POST", "/auth/otp", `{"email":"a@example.com","phone":"+15555550100"}`, "", nil, http.StatusBadRequest, "invalid_request"},
+		{"update without token", "PUT", "/auth/user", `{"password":"hunter22"}`, "", nil, http.StatusUnauthorized, "unauthorized"},
+		{"update weak password", "PUT", "/auth/user", `{"password":"a"}`, "access",
+			map[string]goTrueReply{"PUT /user": {422, `{"code":422,"error_code":"weak_password","msg":"Password should be at least 6 characters."}`}}, http.StatusUnprocessableEntity, "weak_password"},
+		{"update email", "PUT", "/auth/user", `{"email":"new@example.com"}`, "access",
+			map[string]goTrueReply{"PUT /user": {200, `{"id":"` + testSupabaseUserID + `","new_email":"new@example.com"}`}}, http.StatusOK, ""},
+		{"gotrue down", "POST", "/auth/magiclink", `{"email":"a@example.com"}`, "",
+			map[string]goTrueReply{"POST /magiclink": {500, `{"msg":"internal"}`}}, http.StatusBadGateway, "auth_unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := map[string]*http.Request{}
+			r := setupAuthFlowRouter(t, tt.reply, seen)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.code != "" {
+				if code := authErrorCodeOf(t, w); code != tt.code {
+					t.Errorf("Expected error code %s, got %s", tt.code, code)
+				}
+			}
+			if tt.bearer != "" && seen["PUT /user"] != nil && seen["PUT /user"].Header.Get("Authorization") != "Bearer "+tt.bearer {
+				t.Errorf("Expected the caller's token sent to GoTrue, got %q", seen["PUT /user"].Header.Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestAuthFlows_RefreshReturnsSession(t *testing.T) {
+	r := setupAuthFlowRouter(t, map[string]goTrueReply{"POST /token": {200, testGoTrueSession}}, nil)
+
+	req := httptest.NewRequest("POST", "/auth/refresh", strings.NewReader(`{"refresh_token":"refresh"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response struct {
+		TransactionId string `json:"transactionID"`
+		ApiVersion    string `json:"apiVersion"`
+		Data          struct {
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if response.ApiVersion != "v1" || response.TransactionId == "" {
+		t.Errorf("Expected the API envelope, got %s", w.Body.String())
+	}
+	if response.Data.AccessToken != "access" || response.Data.RefreshToken != "refresh" {
+		t.Errorf("Expected the refreshed session, got %+v", response.Data)
+	}
+}
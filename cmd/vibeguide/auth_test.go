@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/site-tech/VibeGuide/pkg/supajwt"
+)
+
+var testJWTSecret = []byte("test-jwt-secret-with-at-least-32-characters")
+
+// withTestVerifier installs an HS256 token verifier for the duration of the test
+func withTestVerifier(t *testing.T) {
+	t.Helper()
+	verifier, err := supajwt.NewVerifier(supajwt.Config{Secret: testJWTSecret})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	orig := tokenVerifier
+	tokenVerifier = verifier
+	t.Cleanup(func() { tokenVerifier = orig })
+}
+
+func signTestToken(t *testing.T, subject string, expiresIn time.Duration) string {
+	t.Helper()
+	claims := supajwt.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{supajwt.DefaultAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+		Email:        "viewer@example.com",
+		UserMetadata: map[string]any{"twitch": map[string]any{"user_id": "42"}},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testJWTSecret)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestGetAuthenticatedUser_VerifiesLocally(t *testing.T) {
+	withTestVerifier(t)
+
+	const userID = "0b5d1c8e-3f7a-4c2e-9d41-6a8b2f1e7c53"
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(VerifyBearer)
+	r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
+		user, err := getAuthenticatedUser(r)
+		if err != nil {
+			handleErr(w, r, err, http.StatusUnauthorized)
+			return
+		}
+		if user.ID.String() != userID || user.Email != "viewer@example.com" {
+			t.Errorf("Unexpected user from claims: %+v", user)
+		}
+		if _, ok := user.UserMetadata["twitch"]; !ok {
+			t.Errorf("Expected user metadata from claims, got %+v", user.UserMetadata)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		header   string
+		expected int
+	}{
+		{"valid", "Bearer " + signTestToken(t, userID, time.Hour), http.StatusOK},
+		{"expired", "Bearer " + signTestToken(t, userID, -time.Hour), http.StatusUnauthorized},
+		{"not a uuid", "Bearer " + signTestToken(t, "someone", time.Hour), http.StatusUnauthorized},
+		{"missing", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/me", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status code %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Blocklist entry kinds
+const (
+	blockBroadcaster = "broadcaster" // Broadcaster user ID or login
+	blockCategory    = "category"    // Game ID or name
+	blockKeyword     = "keyword"     // Case-insensitive substring of the stream title
+)
+
+// Blocklist audit actions
+const (
+	blocklistCreated = "create"
+	blocklistUpdated = "update"
+	blocklistDeleted = "delete"
+)
+
+// errInvalidBlocklistEntry is returned for entries that fail validation
+var errInvalidBlocklistEntry = errors.New("invalid blocklist entry")
+
+// maxBlocklistAuditLimit bounds one page of the audit trail
+const maxBlocklistAuditLimit = 500
+
+// blocklistRefreshInterval is how stale an instance's blocklist may get after another
+// instance changed it
+const blocklistRefreshInterval = time.Minute
+
+// BlocklistEntry keeps a broadcaster, category or title keyword out of the public guide
+type BlocklistEntry struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Kind      string    `gorm:"uniqueIndex:idx_blocklist_kind_value" json:"kind"`
+	Value     string    `gorm:"uniqueIndex:idx_blocklist_kind_value" json:"value"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"` // Supabase user ID of the admin who added it
+}
+
+// BlocklistAudit records one change to the blocklist
+type BlocklistAudit struct {
+	ID        uint            `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time       `gorm:"index" json:"created_at"`
+	ActorID   string          `gorm:"index" json:"actor_id"` // Supabase user ID of the admin
+	Action    string          `json:"action"`
+	EntryID   uint            `gorm:"index" json:"entry_id"`
+	Before    *BlocklistEntry `gorm:"serializer:json" json:"before,omitempty"`
+	After     *BlocklistEntry `gorm:"serializer:json" json:"after,omitempty"`
+}
+
+// Blocklist is the in-memory copy of the blocklist consulted on every Twitch call
+type Blocklist struct {
+	mu           sync.RWMutex
+	broadcasters map[string]bool
+	categories   map[string]bool
+	keywords     []string
+}
+
+// contentBlocklist filters the Twitch client used by the API routes
+var contentBlocklist = NewBlocklist()
+
+// NewBlocklist creates an empty blocklist
+func NewBlocklist() *Blocklist {
+	return &Blocklist{broadcasters: map[string]bool{}, categories: map[string]bool{}}
+}
+
+// Set replaces the blocklist contents
+func (b *Blocklist) Set(entries []BlocklistEntry) {
+	broadcasters := map[string]bool{}
+	categories := map[string]bool{}
+	keywords := []string{}
+	for _, entry := range entries {
+		switch entry.Kind {
+		case blockBroadcaster:
+			broadcasters[entry.Value] = true
+		case blockCategory:
+			categories[entry.Value] = true
+		case blockKeyword:
+			keywords = append(keywords, entry.Value)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.broadcasters, b.categories, b.keywords = broadcasters, categories, keywords
+}
+
+// AllowStream rejects streams by blocked broadcasters or categories, or with a blocked title keyword
+func (b *Blocklist) AllowStream(stream twitch.Stream) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.broadcasters[stream.UserID] || b.broadcasters[strings.ToLower(stream.UserLogin)] {
+		return false
+	}
+	if b.categories[stream.GameID] || b.categories[strings.ToLower(stream.GameName)] {
+		return false
+	}
+	title := strings.ToLower(stream.Title)
+	for _, keyword := range b.keywords {
+		if strings.Contains(title, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowCategory rejects blocked categories
+func (b *Blocklist) AllowCategory(category twitch.Category) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return !b.categories[category.ID] && !b.categories[strings.ToLower(category.Name)]
+}
+
+// reloadBlocklist refreshes contentBlocklist from the database
+func reloadBlocklist(ctx context.Context, db *gorm.DB) error {
+	var entries []BlocklistEntry
+	if err := db.WithContext(ctx).Find(&entries).Error; err != nil {
+		return err
+	}
+	contentBlocklist.Set(entries)
+	return nil
+}
+
+// startBlocklistRefresh periodically reloads the blocklist, so changes made through any
+// instance reach all of them
+func startBlocklistRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			zlog.Info().Msg("Blocklist refresh stopping")
+			return
+		case <-ticker.C:
+			if err := reloadBlocklist(ctx, DB); err != nil {
+				zlog.Error().Err(err).Msg("Blocklist refresh failed, keeping the current entries")
+			}
+		}
+	}
+}
+
+// normalizeBlocklistEntry validates the kind and lowercases names so matching is case-insensitive
+func normalizeBlocklistEntry(entry *BlocklistEntry) error {
+	entry.Value = strings.ToLower(strings.TrimSpace(entry.Value))
+	if entry.Value == "" {
+		return fmt.Errorf("%w: value is required", errInvalidBlocklistEntry)
+	}
+	switch entry.Kind {
+	case blockBroadcaster, blockCategory, blockKeyword:
+	default:
+		return fmt.Errorf("%w: kind must be broadcaster, category or keyword, got %q", errInvalidBlocklistEntry, entry.Kind)
+	}
+	return nil
+}
+
+// ============= HANDLERS =============
+
+type blocklistBody struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// changeBlocklist applies a change and its audit row in one transaction, then refreshes this
+// instance's in-memory blocklist; other instances pick it up on their next refresh
+func changeBlocklist(r *http.Request, change func(tx *gorm.DB) (*BlocklistAudit, error)) error {
+	err := DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		audit, err := change(tx)
+		if err != nil {
+			return err
+		}
+		audit.ActorID = adminUserID(r)
+		return tx.Create(audit).Error
+	})
+	if err != nil {
+		return err
+	}
+	return reloadBlocklist(r.Context(), DB)
+}
+
+// blocklistDBError maps a failed change to a status code
+func blocklistDBError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errInvalidBlocklistEntry):
+		handleErr(w, r, err, http.StatusBadRequest)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		handleErr(w, r, fmt.Errorf("not found"), http.StatusNotFound)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		handleErr(w, r, fmt.Errorf("entry already blocked"), http.StatusConflict)
+	default:
+		handleErr(w, r, err, http.StatusInternalServerError)
+	}
+}
+
+// blocklistDB returns false and writes a 503 when there is no database
+func blocklistDB(w http.ResponseWriter, r *http.Request) bool {
+	if DB == nil {
+		handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+func listBlocklist(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) listBlocklist: %v", tId, apiVersion)
+
+	if !blocklistDB(w, r) {
+		return
+	}
+
+	query := DB.WithContext(r.Context()).Order("kind, value")
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	var entries []BlocklistEntry
+	if err := query.Find(&entries).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = entries
+
+	zlog.Info().Msgf("(%s) listBlocklist done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func createBlocklistEntry(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) createBlocklistEntry: %v", tId, apiVersion)
+
+	if !blocklistDB(w, r) {
+		return
+	}
+
+	var body blocklistBody
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) createBlocklistEntry: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+	entry := BlocklistEntry{Kind: body.Kind, Value: body.Value, Reason: body.Reason, CreatedBy: adminUserID(r)}
+	if err := normalizeBlocklistEntry(&entry); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	err := changeBlocklist(r, func(tx *gorm.DB) (*BlocklistAudit, error) {
+		if err := tx.Create(&entry).Error; err != nil {
+			return nil, err
+		}
+		return &BlocklistAudit{Action: blocklistCreated, EntryID: entry.ID, After: &entry}, nil
+	})
+	if err != nil {
+		blocklistDBError(w, r, err)
+		return
+	}
+	resp.Data = entry
+
+	zlog.Info().Msgf("(%s) createBlocklistEntry done.", tId)
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, resp)
+}
+
+func updateBlocklistEntry(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) updateBlocklistEntry: %v", tId, apiVersion)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("id must be numeric"), http.StatusBadRequest)
+		return
+	}
+	if !blocklistDB(w, r) {
+		return
+	}
+
+	var body blocklistBody
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) updateBlocklistEntry: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	var entry BlocklistEntry
+	err = changeBlocklist(r, func(tx *gorm.DB) (*BlocklistAudit, error) {
+		if err := tx.First(&entry, id).Error; err != nil {
+			return nil, err
+		}
+		before := entry
+		entry.Kind, entry.Value, entry.Reason = body.Kind, body.Value, body.Reason
+		if err := normalizeBlocklistEntry(&entry); err != nil {
+			return nil, err
+		}
+		if err := tx.Save(&entry).Error; err != nil {
+			return nil, err
+		}
+		return &BlocklistAudit{Action: blocklistUpdated, EntryID: entry.ID, Before: &before, After: &entry}, nil
+	})
+	if err != nil {
+		blocklistDBError(w, r, err)
+		return
+	}
+	resp.Data = entry
+
+	zlog.Info().Msgf("(%s) updateBlocklistEntry done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func deleteBlocklistEntry(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) deleteBlocklistEntry: %v", tId, apiVersion)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("id must be numeric"), http.StatusBadRequest)
+		return
+	}
+	if !blocklistDB(w, r) {
+		return
+	}
+
+	err = changeBlocklist(r, func(tx *gorm.DB) (*BlocklistAudit, error) {
+		var entry BlocklistEntry
+		if err := tx.First(&entry, id).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Delete(&entry).Error; err != nil {
+			return nil, err
+		}
+		return &BlocklistAudit{Action: blocklistDeleted, EntryID: entry.ID, Before: &entry}, nil
+	})
+	if err != nil {
+		blocklistDBError(w, r, err)
+		return
+	}
+
+	zlog.Info().Msgf("(%s) deleteBlocklistEntry done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func listBlocklistAudit(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) listBlocklistAudit: %v", tId, apiVersion)
+
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxBlocklistAuditLimit {
+			handleErr(w, r, fmt.Errorf("limit must be between 1 and %d", maxBlocklistAuditLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if !blocklistDB(w, r) {
+		return
+	}
+
+	query := DB.WithContext(r.Context()).Order("id DESC").Limit(limit)
+	if entryID := r.URL.Query().Get("entry_id"); entryID != "" {
+		query = query.Where("entry_id = ?", entryID)
+	}
+	var audits []BlocklistAudit
+	if err := query.Find(&audits).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = audits
+
+	zlog.Info().Msgf("(%s) listBlocklistAudit done.", tId)
+	render.JSON(w, r, resp)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+func TestBlocklist_Allow(t *testing.T) {
+	b := NewBlocklist()
+	b.Set([]BlocklistEntry{
+		{Kind: blockBroadcaster, Value: "teststreamer"},
+		{Kind: blockCategory, Value: "32982"},
+		{Kind: blockKeyword, Value: "casino"},
+	})
+
+	tests := []struct {
+		stream  twitch.Stream
+		allowed bool
+	}{
+		{twitch.Stream{UserLogin: "TestStreamer", GameID: "1"}, false},
+		{twitch.Stream{UserLogin: "other", GameID: "32982"}, false},
+		{twitch.Stream{UserLogin: "other", GameID: "1", Title: "Big CASINO night"}, false},
+		{twitch.Stream{UserLogin: "other", GameID: "1", Title: "chill stream"}, true},
+	}
+	for _, tt := range tests {
+		if got := b.AllowStream(tt.stream); got != tt.allowed {
+			t.Errorf("AllowStream(%+v) = %v, expected %v", tt.stream, got, tt.allowed)
+		}
+	}
+	if b.AllowCategory(twitch.Category{ID: "32982"}) || !b.AllowCategory(twitch.Category{ID: "509658"}) {
+		t.Error("Expected only the blocked category rejected")
+	}
+}
+
+func TestCreateBlocklistEntry_WritesAudit(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+	defer contentBlocklist.Set(nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "blocklist_entries"`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "keyword", "casino", "brand safety", "admin-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery(`INSERT INTO "blocklist_audits"`).
+		WithArgs(sqlmock.AnyArg(), "admin-1", "create", 4, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "blocklist_entries"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "value"}).AddRow(4, "keyword", "casino"))
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Post("/blocklist", createBlocklistEntry)
+
+	req := httptest.NewRequest("POST", "/blocklist", strings.NewReader(`{"kind":"keyword","value":" Casino ","reason":"brand safety"}`))
+	req = req.WithContext(context.WithValue(req.Context(), authctx, &User{SupabaseUserID: "admin-1", Role: Role{Name: RoleAdmin}}))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+	if contentBlocklist.AllowStream(twitch.Stream{Title: "casino time"}) {
+		t.Error("Expected the in-memory blocklist reloaded")
+	}
+}
+
+func TestCreateBlocklistEntry_Invalid(t *testing.T) {
+	sqldb, gormdb, _ := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Post("/blocklist", createBlocklistEntry)
+
+	req := httptest.NewRequest("POST", "/blocklist", strings.NewReader(`{"kind":"mood","value":"sad"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
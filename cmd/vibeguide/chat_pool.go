@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// chatReader tracks chat activity for the top live channels. It is nil when CHAT_ENABLED is off.
+var chatReader *twitch.ChatReader
+
+// startChatPool keeps the chat reader joined to the current top streams
+func startChatPool(ctx context.Context, twitchClient twitch.Client, reader *twitch.ChatReader, maxChannels int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := reconcileChatPool(ctx, twitchClient, reader, maxChannels)
+		if err != nil {
+			zlog.Error().Err(err).Msg("Chat pool reconcile failed")
+		}
+		workerHeartbeats.Beat(workerChatPool, err)
+
+		select {
+		case <-ctx.Done():
+			zlog.Info().Msg("Chat pool stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcileChatPool joins the top maxChannels live channels and parts channels that dropped out
+func reconcileChatPool(ctx context.Context, twitchClient twitch.Client, reader *twitch.ChatReader, maxChannels int) error {
+	limit := min(maxChannels, twitch.MaxStreamQueryLimit)
+	streams, err := twitchClient.GetStreams(ctx, twitch.StreamsQueryParams{Limit: limit, Sort: "viewers"})
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(streams.Data))
+	for _, stream := range streams.Data {
+		wanted[stream.UserLogin] = true
+	}
+	for _, login := range reader.Channels() {
+		if !wanted[login] {
+			reader.Part(login)
+		}
+	}
+	for _, stream := range streams.Data {
+		if err := reader.Join(ctx, stream.UserLogin); err != nil {
+			if errors.Is(err, twitch.ErrChatChannelLimit) {
+				break
+			}
+			return err
+		}
+	}
+
+	zlog.Debug().Int("channels", len(reader.Channels())).Int64("dropped", reader.Dropped()).Msg("Chat pool reconciled")
+	return nil
+}
+
+// applyChatScores sets VibeScore on streams whose chat is being read
+func applyChatScores(streams []twitch.Stream) {
+	if chatReader == nil {
+		return
+	}
+	for i := range streams {
+		if stats, ok := chatReader.Stats(streams[i].UserLogin); ok {
+			score := stats.VibeScore(streams[i].ViewerCount)
+			streams[i].VibeScore = &score
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+func TestReconcileChatPool(t *testing.T) {
+	reader := twitch.NewChatReader(twitch.ChatReaderOptions{MaxChannels: 5})
+	ctx := context.Background()
+	reader.Join(ctx, "formerlytop")
+
+	client := &mockTwitchClient{streams: createTestStreamsResponse()}
+	if err := reconcileChatPool(ctx, client, reader, 5); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	channels := reader.Channels()
+	sort.Strings(channels)
+	if len(channels) != 2 || channels[0] != "anotherstreamer" || channels[1] != "teststreamer" {
+		t.Errorf("Expected pool to match the top streams, got %v", channels)
+	}
+
+	orig := chatReader
+	chatReader = reader
+	defer func() { chatReader = orig }()
+
+	streams := client.streams.Data
+	applyChatScores(streams)
+	for _, stream := range streams {
+		if stream.VibeScore == nil {
+			t.Errorf("Expected vibe_score for %s", stream.UserLogin)
+		}
+	}
+}
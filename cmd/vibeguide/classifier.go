@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/classifier"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// streamClassifier labels streams with vibes. It starts with the built-in rules and is
+// replaced in run() when CLASSIFIER_RULES_FILE is set.
+var streamClassifier = classifier.New(classifier.DefaultRuleset())
+
+// applyVibes labels streams and sets chat vibe scores, then applies any ?vibe= filter
+func applyVibes(r *http.Request, streams []twitch.Stream) []twitch.Stream {
+	streamClassifier.Annotate(streams)
+	applyChatScores(streams)
+
+	vibe := r.URL.Query().Get("vibe")
+	if vibe == "" {
+		return streams
+	}
+	filtered := []twitch.Stream{}
+	for _, stream := range streams {
+		if classifier.HasLabel(stream.Vibes, vibe) {
+			filtered = append(filtered, stream)
+		}
+	}
+	return filtered
+}
+
+// classifierRouter exposes the active vibe rules, hot reload and explain mode
+func classifierRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/rules", getClassifierRules)
+	r.With(requireAdmin).Post("/reload", reloadClassifierRules)
+	r.Post("/explain", explainStreamVibes)
+	return r
+}
+
+func getClassifierRules(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getClassifierRules: %v", tId, apiVersion)
+
+	resp.Data = streamClassifier.Rules()
+
+	render.JSON(w, r, resp)
+}
+
+// reloadClassifierRules re-reads the rules file; invalid rules are rejected and the current rules kept
+func reloadClassifierRules(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) reloadClassifierRules: %v", tId, apiVersion)
+
+	rules, err := streamClassifier.Reload()
+	if err != nil {
+		zlog.Error().Msgf("(%s) reloadClassifierRules: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusUnprocessableEntity)
+		return
+	}
+	resp.Data = rules
+
+	zlog.Info().Msgf("(%s) reloadClassifierRules done. labels: %d", tId, len(rules.Labels))
+	render.JSON(w, r, resp)
+}
+
+// explainStreamVibes scores a posted stream against every label and lists the rules that fired
+func explainStreamVibes(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) explainStreamVibes: %v", tId, apiVersion)
+
+	var stream twitch.Stream
+	if err := render.DecodeJSON(r.Body, &stream); err != nil {
+		zlog.Error().Msgf("(%s) explainStreamVibes: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+	resp.Data = streamClassifier.Explain(stream)
+
+	render.JSON(w, r, resp)
+}
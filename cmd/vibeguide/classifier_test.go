@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/site-tech/VibeGuide/pkg/classifier"
+	"github.com/site-tech/VibeGuide/pkg/supajwt"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+func withTestClassifier(t *testing.T, rules string) {
+	t.Helper()
+	rs, err := classifier.Parse([]byte(rules))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	orig := streamClassifier
+	streamClassifier = classifier.New(rs)
+	t.Cleanup(func() { streamClassifier = orig })
+}
+
+func TestGetStreamsHandler_VibeFilter(t *testing.T) {
+	withTestClassifier(t, `labels: [{name: roleplay, rules: [{field: tags, keywords: [Roleplay], weight: 1}]}]`)
+
+	router := setupTestRouter(&mockTwitchClient{streams: createTestStreamsResponse()})
+	req := httptest.NewRequest("GET", "/twitch/streams?vibe=roleplay", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data twitch.StreamsResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if len(response.Data.Data) != 1 || response.Data.Data[0].UserLogin != "anotherstreamer" {
+		t.Fatalf("Expected only the roleplay stream, got %+v", response.Data.Data)
+	}
+	if len(response.Data.Data[0].Vibes) != 1 || response.Data.Data[0].Vibes[0] != "roleplay" {
+		t.Errorf("Expected vibes field on stream, got %v", response.Data.Data[0].Vibes)
+	}
+}
+
+func TestExplainStreamVibes(t *testing.T) {
+	withTestClassifier(t, `labels: [{name: chatty, rules: [{id: jc, field: game_name, keywords: [Just Chatting], weight: 1}]}]`)
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/classifier", classifierRouter())
+
+	req := httptest.NewRequest("POST", "/classifier/explain", strings.NewReader(`{"id":"1","game_name":"Just Chatting"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Data classifier.Explanation `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if len(response.Data.Labels) != 1 || !response.Data.Labels[0].Assigned || response.Data.Labels[0].Fired[0].RuleID != "jc" {
+		t.Errorf("Unexpected explanation: %+v", response.Data)
+	}
+
+	// Reload is admin-only
+	req = httptest.NewRequest("POST", "/classifier/reload", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE supabase_user_id = \$1`).
+		WithArgs(testSupabaseUserID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "supabase_user_id", "role_id"}).AddRow(5, testSupabaseUserID, 1))
+	mock.ExpectQuery(`SELECT \* FROM "roles" WHERE "roles"."id" = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, RoleViewer))
+	claims := &supajwt.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: testSupabaseUserID}}
+	req = httptest.NewRequest("POST", "/classifier/reload", nil)
+	req = req.WithContext(context.WithValue(req.Context(), claimsctx, claims))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d for a viewer, got %d", http.StatusForbidden, w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+
+	// The test classifier has no rules file, so reload is rejected
+	admin := chi.NewRouter()
+	admin.Use(middleware.RequestID)
+	admin.Use(apiVersionContext("v1"))
+	admin.Post("/reload", reloadClassifierRules)
+	req = httptest.NewRequest("POST", "/reload", nil)
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/site-tech/VibeGuide/pkg/config"
+	"github.com/site-tech/VibeGuide/pkg/health"
+	"github.com/site-tech/VibeGuide/pkg/ratelimit"
+	"github.com/site-tech/VibeGuide/pkg/supajwt"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"github.com/site-tech/VibeGuide/pkg/vault"
+)
+
+// configFileEnv names the optional YAML or TOML config file, also settable with -config-file
+const configFileEnv = "CONFIG_FILE"
+
+var Config *VibeConfig
+
+// VibeConfig holds every setting. Each is read, in increasing precedence, from its default, the
+// config file, the environment (or NAME_FILE) and the command line; see pkg/config.
+type VibeConfig struct {
+	// Basic Fields
+	Port   string `env:"PORT"`
+	LogLvl string `env:"LOGLVL"`
+
+	// Twitch API Credentials
+	TwitchClientID     string `env:"TWITCH_CLIENT_ID"`
+	TwitchClientSecret string `env:"TWITCH_CLIENT_SECRET" secret:"true"`
+	// Twitch page sizes and HTTP timeout
+	TwitchDefaultStreamLimit   int           `env:"TWITCH_DEFAULT_STREAM_LIMIT"`
+	TwitchMaxStreamLimit       int           `env:"TWITCH_MAX_STREAM_LIMIT"`
+	TwitchDefaultCategoryLimit int           `env:"TWITCH_DEFAULT_CATEGORY_LIMIT"`
+	TwitchMaxCategoryLimit     int           `env:"TWITCH_MAX_CATEGORY_LIMIT"`
+	TwitchMinQueryLimit        int           `env:"TWITCH_MIN_QUERY_LIMIT"`
+	TwitchMaxQueryLimit        int           `env:"TWITCH_MAX_QUERY_LIMIT"`
+	TwitchDefaultQueryLimit    int           `env:"TWITCH_DEFAULT_QUERY_LIMIT"`
+	TwitchHTTPTimeout          time.Duration `env:"TWITCH_HTTP_TIMEOUT"`
+	// Database Fields
+	DbURL     string `env:"DBURL"`
+	DbName    string `env:"DBNAME"`
+	DbPort    string `env:"DBPORT"`
+	DbUser    string `env:"DBUSER"`
+	DbPass    string `env:"DBPASS" secret:"true"`
+	DbMigrate bool   `env:"DBMIGRATE"`
+	// Supabase Vars
+	SupabaseApiUrl string `env:"SB_API_URL"`
+	SupabaseApiKey string `env:"SB_API_KEY" secret:"true"`
+	// Service role key for the GoTrue admin API (linking Twitch accounts to users)
+	SupabaseServiceRoleKey string `env:"SB_SERVICE_ROLE_KEY" secret:"true"`
+	// Access token verification: HS256 with the project secret, or asymmetric keys from the JWKS
+	SupabaseJWTSecret   string `env:"SB_JWT_SECRET" secret:"true"`
+	SupabaseJWKSURL     string `env:"SB_JWKS_URL"`
+	SupabaseJWTIssuer   string `env:"SB_JWT_ISSUER"`
+	SupabaseJWTAudience string `env:"SB_JWT_AUDIENCE"`
+	// Background Jobs
+	LivePollInterval      time.Duration `env:"LIVE_POLL_INTERVAL"`
+	ScheduleInferInterval time.Duration `env:"SCHEDULE_INFER_INTERVAL"`
+	AlertPollInterval     time.Duration `env:"ALERT_POLL_INTERVAL"`
+	DigestInterval        time.Duration `env:"DIGEST_INTERVAL"`
+	// Web Push (VAPID) Keys
+	VapidPublicKey  string `env:"VAPID_PUBLIC_KEY"`
+	VapidPrivateKey string `env:"VAPID_PRIVATE_KEY" secret:"true"`
+	VapidSubject    string `env:"VAPID_SUBJECT"`
+	// Email Digest (SMTP relay, e.g. Mailpit on localhost:1025)
+	SMTPHost      string `env:"SMTP_HOST"`
+	SMTPPort      uint   `env:"SMTP_PORT"`
+	SMTPUsername  string `env:"SMTP_USERNAME"`
+	SMTPPassword  string `env:"SMTP_PASSWORD" secret:"true"`
+	SMTPFrom      string `env:"SMTP_FROM"`
+	PublicBaseURL string `env:"PUBLIC_BASE_URL"`
+	// Vibe classifier rules (YAML or JSON), empty uses the built-in rules
+	ClassifierRulesFile string `env:"CLASSIFIER_RULES_FILE"`
+	// Chat Activity (anonymous read-only when no token is set)
+	ChatEnabled      bool          `env:"CHAT_ENABLED"`
+	ChatMaxChannels  uint          `env:"CHAT_MAX_CHANNELS"`
+	ChatPoolInterval time.Duration `env:"CHAT_POOL_INTERVAL"`
+	ChatLogin        string        `env:"TWITCH_CHAT_LOGIN"`
+	ChatToken        string        `env:"TWITCH_CHAT_TOKEN" secret:"true"`
+	// Twitch OAuth login: state signing key (random per process when unset) and exact
+	// redirect URIs the flow may return to
+	OAuthStateSecret   string   `env:"OAUTH_STATE_SECRET" secret:"true"`
+	TwitchRedirectURIs []string `env:"TWITCH_REDIRECT_URIS"`
+	// Twitch token vault: comma-separated id:base64key pairs, primary key first
+	TwitchTokenKeys          string        `env:"TWITCH_TOKEN_KEYS" secret:"true"`
+	TwitchTokenCheckInterval time.Duration `env:"TWITCH_TOKEN_CHECK_INTERVAL"`
+	// Viewbot Anomaly Detection
+	AnomalyPollInterval time.Duration `env:"ANOMALY_POLL_INTERVAL"`
+	AnomalyAction       string        `env:"ANOMALY_ACTION"` // Default policy until an admin sets one
+	// Cookie session mode: tokens stay server-side behind an HttpOnly session cookie
+	SessionCookies        bool          `env:"SESSION_COOKIES"`
+	SessionTTL            time.Duration `env:"SESSION_TTL"`
+	SessionRotateInterval time.Duration `env:"SESSION_ROTATE_INTERVAL"`
+	SessionSameSite       string        `env:"SESSION_COOKIE_SAMESITE"`
+	// CORS: credentialed frontend origins, origins allowed on public read endpoints, and
+	// per-route overrides of the frontend origins ("/prefix=origin origin")
+	CORSAllowedOrigins []string      `env:"CORS_ALLOWED_ORIGINS"`
+	CORSPublicOrigins  []string      `env:"CORS_PUBLIC_ORIGINS"`
+	CORSRouteOrigins   []string      `env:"CORS_ROUTE_ORIGINS"`
+	CORSMaxAge         time.Duration `env:"CORS_MAX_AGE"`
+	// Rate limiting: default quota ("120/1m"), per-route quotas ("/prefix=limit/window"), counter
+	// store (memory or postgres) and proxies whose X-Forwarded-For is trusted
+	RateLimit       string   `env:"RATE_LIMIT"`
+	RateLimitRoutes []string `env:"RATE_LIMIT_ROUTES"`
+	RateLimitStore  string   `env:"RATE_LIMIT_STORE"`
+	TrustedProxies  []string `env:"TRUSTED_PROXIES"`
+	// Default quota of new API keys, and the most a user may pick for their own keys
+	APIKeyQuota string `env:"API_KEY_QUOTA"`
+	// Supabase user IDs with the admin role; admins not listed are demoted to viewer
+	AdminUserIDs []string `env:"ADMIN_USER_IDS"`
+	// Content classification labels excluded by ?safe=true
+	SafeModeLabels []string `env:"SAFE_MODE_LABELS"`
+	// Readiness checks: timeout per dependency check and how long results are reused
+	HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT"`
+	HealthCacheTTL     time.Duration `env:"HEALTH_CACHE_TTL"`
+
+	// Parsed by validate
+	logLevel        zerolog.Level
+	twitchTokenKeys *vault.Keyring
+}
+
+// String formats the config like %+v with secrets redacted, so it is safe to log
+func (c VibeConfig) String() string {
+	return config.Redact(c)
+}
+
+// defaultConfig is the lowest configuration layer
+func defaultConfig() VibeConfig {
+	limits := twitch.CurrentLimits()
+	return VibeConfig{
+		Port:                       "8080",
+		LogLvl:                     zerolog.LevelInfoValue,
+		TwitchDefaultStreamLimit:   limits.DefaultStreamLimit,
+		TwitchMaxStreamLimit:       limits.MaxStreamLimit,
+		TwitchDefaultCategoryLimit: limits.DefaultCategoryLimit,
+		TwitchMaxCategoryLimit:     limits.MaxCategoryLimit,
+		TwitchMinQueryLimit:        limits.MinStreamQueryLimit,
+		TwitchMaxQueryLimit:        limits.MaxStreamQueryLimit,
+		TwitchDefaultQueryLimit:    limits.DefaultQueryLimit,
+		TwitchHTTPTimeout:          limits.HTTPTimeout,
+		DbURL:                      "localhost",
+		DbPort:                     "5432",
+		SupabaseApiUrl:             "http://host.docker.internal:54321",
+		SupabaseJWTAudience:        supajwt.DefaultAudience,
+		LivePollInterval:           5 * time.Minute,
+		ScheduleInferInterval:      6 * time.Hour,
+		AlertPollInterval:          time.Minute,
+		DigestInterval:             time.Hour,
+		SMTPPort:                   1025,
+		SMTPFrom:                   "VibeGuide <digest@localhost>",
+		PublicBaseURL:              "http://localhost:8080",
+		ChatMaxChannels:            twitch.DefaultMaxChatChannels,
+		ChatPoolInterval:           2 * time.Minute,
+		TwitchTokenCheckInterval:   15 * time.Minute,
+		AnomalyPollInterval:        time.Minute,
+		AnomalyAction:              anomalyActionFlag,
+		SessionTTL:                 7 * 24 * time.Hour,
+		SessionRotateInterval:      15 * time.Minute,
+		SessionSameSite:            "lax",
+		CORSAllowedOrigins:         []string{},
+		CORSPublicOrigins:          []string{},
+		CORSRouteOrigins:           []string{},
+		CORSMaxAge:                 5 * time.Minute,
+		RateLimit:                  "300/1m",
+		RateLimitRoutes:            []string{},
+		RateLimitStore:             rateLimitStoreMemory,
+		TrustedProxies:             []string{},
+		APIKeyQuota:                "600/1m",
+		TwitchRedirectURIs:         []string{},
+		AdminUserIDs:               []string{},
+		SafeModeLabels:             []string{},
+		HealthCheckTimeout:         health.DefaultTimeout,
+		HealthCacheTTL:             10 * time.Second,
+	}
+}
+
+// loadConfig layers the config file, environment and command-line args over the defaults and
+// validates the result, reporting every problem at once
+func loadConfig(args []string) (*VibeConfig, error) {
+	newConfig := defaultConfig()
+	sources, err := config.Load(&newConfig, config.Options{
+		Args:    args,
+		FileEnv: configFileEnv,
+		Usage:   "Usage: vibeguide [flags]\n\nFlags override the config file and environment variables of the same name.",
+	})
+	if err != nil && sources == nil {
+		// Bad command line or -h
+		return nil, err
+	}
+	errs := []error{err}
+
+	// The token verification endpoints follow the Supabase URL unless set themselves
+	supabaseAuthURL := strings.TrimSuffix(newConfig.SupabaseApiUrl, "/") + "/auth/v1"
+	if sources["SB_JWKS_URL"] == config.SourceDefault {
+		newConfig.SupabaseJWKSURL = supabaseAuthURL + "/.well-known/jwks.json"
+	}
+	if sources["SB_JWT_ISSUER"] == config.SourceDefault {
+		newConfig.SupabaseJWTIssuer = supabaseAuthURL
+	}
+
+	errs = append(errs, newConfig.validate())
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	Config = &newConfig
+	return &newConfig, nil
+}
+
+// validate checks settings whose values the loader can't judge by type alone
+func (c *VibeConfig) validate() error {
+	var errs []error
+	if c.TwitchClientID == "" {
+		errs = append(errs, fmt.Errorf("TWITCH_CLIENT_ID is required"))
+	}
+	if c.TwitchClientSecret == "" {
+		errs = append(errs, fmt.Errorf("TWITCH_CLIENT_SECRET is required"))
+	}
+	if err := c.twitchLimits().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("TWITCH_*_LIMIT: %w", err))
+	}
+	level, err := zerolog.ParseLevel(c.LogLvl)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("LOGLVL: %w", err))
+	}
+	c.logLevel = level
+	if err := validateAnomalyPolicy(AnomalyPolicy{Action: c.AnomalyAction}); err != nil {
+		errs = append(errs, fmt.Errorf("ANOMALY_ACTION: %w", err))
+	}
+	if _, err := sessionSameSite(c.SessionSameSite); err != nil {
+		errs = append(errs, fmt.Errorf("SESSION_COOKIE_SAMESITE: %w", err))
+	}
+	if c.RateLimitStore != rateLimitStoreMemory && c.RateLimitStore != rateLimitStorePostgres {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE must be %s or %s", rateLimitStoreMemory, rateLimitStorePostgres))
+	}
+	if _, err := ratelimit.ParseQuota(c.RateLimit); err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT: %w", err))
+	}
+	if _, err := rateLimitRoutes(c.RateLimitRoutes); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := ratelimit.NewIPExtractor(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %w", err))
+	}
+	if _, err := newCORSMiddleware(c); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := ratelimit.ParseQuota(c.APIKeyQuota); err != nil {
+		errs = append(errs, fmt.Errorf("API_KEY_QUOTA: %w", err))
+	}
+	if c.TwitchTokenKeys != "" {
+		if c.twitchTokenKeys, err = vault.ParseKeyring(c.TwitchTokenKeys); err != nil {
+			errs = append(errs, fmt.Errorf("TWITCH_TOKEN_KEYS: %w", err))
+		}
+	} else if c.SessionCookies {
+		errs = append(errs, fmt.Errorf("SESSION_COOKIES requires TWITCH_TOKEN_KEYS to seal session tokens"))
+	}
+	// Unset is allowed: run() generates a per-instance key
+	if c.OAuthStateSecret != "" && len(c.OAuthStateSecret) < 32 {
+		errs = append(errs, fmt.Errorf("OAUTH_STATE_SECRET must be at least 32 bytes"))
+	}
+	if c.ClassifierRulesFile != "" {
+		if _, err := os.Stat(c.ClassifierRulesFile); err != nil {
+			errs = append(errs, fmt.Errorf("CLASSIFIER_RULES_FILE: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// twitchLimits are the TWITCH_*_LIMIT and TWITCH_HTTP_TIMEOUT settings
+func (c *VibeConfig) twitchLimits() twitch.Limits {
+	return twitch.Limits{
+		DefaultStreamLimit:   c.TwitchDefaultStreamLimit,
+		MaxStreamLimit:       c.TwitchMaxStreamLimit,
+		DefaultCategoryLimit: c.TwitchDefaultCategoryLimit,
+		MaxCategoryLimit:     c.TwitchMaxCategoryLimit,
+		MinStreamQueryLimit:  c.TwitchMinQueryLimit,
+		MaxStreamQueryLimit:  c.TwitchMaxQueryLimit,
+		DefaultQueryLimit:    c.TwitchDefaultQueryLimit,
+		HTTPTimeout:          c.TwitchHTTPTimeout,
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLoadConfig(t *testing.T) {
+	origConfig := Config
+	defer func() { Config = origConfig }()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "vibeguide.yaml")
+	if err := os.WriteFile(file, []byte("port: 9000\nsb_api_url: https://proj.supabase.co\nlive_poll_interval: 2m\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "db_password")
+	if err := os.WriteFile(secret, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TWITCH_CLIENT_ID", "client-id")
+	t.Setenv("TWITCH_CLIENT_SECRET", "client-secret")
+	t.Setenv("DBPASS_FILE", secret)
+	t.Setenv("LIVE_POLL_INTERVAL", "3m")
+
+	cfg, err := loadConfig([]string{"-config-file", file, "-loglvl", "debug"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.Port != "9000" || cfg.LogLvl != "debug" || cfg.LivePollInterval != 3*time.Minute || cfg.DbPass != "hunter2" {
+		t.Errorf("Unexpected config: %+v", *cfg)
+	}
+	if cfg.logLevel != zerolog.DebugLevel {
+		t.Errorf("Expected the parsed log level, got %s", cfg.logLevel)
+	}
+	if cfg.SupabaseJWTIssuer != "https://proj.supabase.co/auth/v1" || cfg.SupabaseJWKSURL != "https://proj.supabase.co/auth/v1/.well-known/jwks.json" {
+		t.Errorf("Expected the JWT settings to follow SB_API_URL, got %s and %s", cfg.SupabaseJWTIssuer, cfg.SupabaseJWKSURL)
+	}
+	if cfg.TwitchMaxQueryLimit != 100 || cfg.AnomalyAction != anomalyActionFlag {
+		t.Errorf("Expected defaults for unset settings, got %+v", *cfg)
+	}
+	if Config != cfg {
+		t.Error("Expected the global config to be set")
+	}
+
+	// An explicitly empty JWKS URL disables asymmetric keys
+	t.Setenv("SB_JWKS_URL", "")
+	cfg, err = loadConfig(nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.SupabaseJWKSURL != "" {
+		t.Errorf("Expected an empty JWKS URL, got %s", cfg.SupabaseJWKSURL)
+	}
+}
+
+func TestLoadConfig_ReportsAllErrors(t *testing.T) {
+	t.Setenv("TWITCH_CLIENT_ID", "")
+	t.Setenv("TWITCH_CLIENT_SECRET", "")
+	t.Setenv("LOGLVL", "loud")
+	t.Setenv("RATE_LIMIT_STORE", "redis")
+	t.Setenv("SESSION_TTL", "forever")
+	t.Setenv("TWITCH_MAX_QUERY_LIMIT", "500")
+	t.Setenv("TWITCH_TOKEN_KEYS", "not-a-key")
+	t.Setenv("OAUTH_STATE_SECRET", "too-short")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "example.com")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/99")
+	t.Setenv("RATE_LIMIT_ROUTES", "twitch=5/1m")
+
+	_, err := loadConfig(nil)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{"TWITCH_CLIENT_ID", "TWITCH_CLIENT_SECRET", "LOGLVL", "RATE_LIMIT_STORE", "SESSION_TTL", "max stream query limit",
+		"TWITCH_TOKEN_KEYS", "OAUTH_STATE_SECRET", "CORS_ALLOWED_ORIGINS", "TRUSTED_PROXIES", "RATE_LIMIT_ROUTES"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfig_SessionCookiesRequireTokenKeys(t *testing.T) {
+	t.Setenv("TWITCH_CLIENT_ID", "client-id")
+	t.Setenv("TWITCH_CLIENT_SECRET", "client-secret")
+	t.Setenv("SESSION_COOKIES", "true")
+	t.Setenv("TWITCH_TOKEN_KEYS", "")
+
+	if _, err := loadConfig(nil); err == nil || !strings.Contains(err.Error(), "SESSION_COOKIES requires TWITCH_TOKEN_KEYS") {
+		t.Errorf("Expected SESSION_COOKIES to require TWITCH_TOKEN_KEYS, got: %v", err)
+	}
+}
+
+func TestVibeConfig_RedactsSecrets(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.TwitchClientID = "client-id"
+	cfg.TwitchClientSecret = "client-secret"
+	cfg.DbPass = "hunter2"
+	cfg.TwitchTokenKeys = "k1:c2VjcmV0"
+
+	for _, out := range []string{fmt.Sprintf("%+v", &cfg), fmt.Sprintf("%v", cfg), cfg.String()} {
+		for _, secret := range []string{"client-secret", "hunter2", "c2VjcmV0"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("Expected %q to be redacted, got %s", secret, out)
+			}
+		}
+		if !strings.Contains(out, "TwitchClientID:client-id") {
+			t.Errorf("Expected other settings to be shown, got %s", out)
+		}
+	}
+}
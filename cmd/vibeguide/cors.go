@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/site-tech/VibeGuide/pkg/cors"
+)
+
+// publicCORSRoutes are read-only endpoints any CORS_PUBLIC_ORIGINS site may call, without
+// credentials. Origins in CORS_ALLOWED_ORIGINS keep their credentialed policy here too.
+var publicCORSRoutes = []string{
+	"/v1/heartbeat",
+	"/v1/twitch/streams",
+	"/v1/twitch/categories",
+	"/v1/twitch/channels",
+	"/v1/lineups/shared",
+	"/v1/classifier/rules",
+}
+
+// corsExposedHeaders lets scripts read the rate limit state
+var corsExposedHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"}
+
+// appCORSOptions is the credentialed policy for the frontend, used on every route
+func appCORSOptions(origins []string, cfg *VibeConfig) cors.Options {
+	return cors.Options{
+		AllowedOrigins:   origins,
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", csrfHeader, apiKeyHeader},
+		ExposedHeaders:   corsExposedHeaders,
+		AllowCredentials: true,
+		MaxAge:           cfg.CORSMaxAge,
+	}
+}
+
+// newCORSMiddleware builds the CORS middleware from the CORS_* settings. CORS_ROUTE_ORIGINS
+// entries ("/v1/prefix=https://a.example https://*.b.example") replace the app origins under a
+// path prefix.
+func newCORSMiddleware(cfg *VibeConfig) (func(http.Handler) http.Handler, error) {
+	app, err := cors.New(appCORSOptions(cfg.CORSAllowedOrigins, cfg))
+	if err != nil {
+		return nil, fmt.Errorf("CORS_ALLOWED_ORIGINS: %w", err)
+	}
+	public, err := cors.New(cors.Options{
+		AllowedOrigins: cfg.CORSPublicOrigins,
+		AllowedMethods: []string{"GET", "HEAD"},
+		AllowedHeaders: []string{"Accept", "Content-Type", apiKeyHeader},
+		ExposedHeaders: corsExposedHeaders,
+		MaxAge:         cfg.CORSMaxAge,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("CORS_PUBLIC_ORIGINS: %w", err)
+	}
+
+	routes := map[string]cors.Route{}
+	for _, prefix := range publicCORSRoutes {
+		routes[prefix] = cors.Route{Prefix: prefix, Policies: []*cors.Policy{app, public}}
+	}
+	for _, entry := range cfg.CORSRouteOrigins {
+		prefix, origins, ok := strings.Cut(entry, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("CORS_ROUTE_ORIGINS: invalid entry %q, expected /prefix=origin [origin...]", entry)
+		}
+		override, err := cors.New(appCORSOptions(strings.Fields(origins), cfg))
+		if err != nil {
+			return nil, fmt.Errorf("CORS_ROUTE_ORIGINS %s: %w", prefix, err)
+		}
+		policies := []*cors.Policy{override}
+		if isPublicCORSRoute(prefix) {
+			policies = append(policies, public)
+		}
+		routes[prefix] = cors.Route{Prefix: prefix, Policies: policies}
+	}
+
+	list := make([]cors.Route, 0, len(routes))
+	for _, route := range routes {
+		list = append(list, route)
+	}
+	return cors.Middleware([]*cors.Policy{app}, list...), nil
+}
+
+func isPublicCORSRoute(prefix string) bool {
+	for _, public := range publicCORSRoutes {
+		if prefix == public || strings.HasPrefix(prefix, public+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewCORSMiddleware(t *testing.T) {
+	cfg := &VibeConfig{
+		CORSAllowedOrigins: []string{"https://vibeguide.tv"},
+		CORSPublicOrigins:  []string{"*"},
+		CORSRouteOrigins:   []string{"/v1/lineups/shared=https://*.partner.tv"},
+		CORSMaxAge:         time.Minute,
+	}
+	mw, err := newCORSMiddleware(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		reqMethod   string
+		status      int
+		allowOrigin string
+	}{
+		{"frontend on private route", "OPTIONS", "/v1/alerts/subscriptions", "https://vibeguide.tv", "POST", http.StatusNoContent, "https://vibeguide.tv"},
+		{"other site on private route", "OPTIONS", "/v1/alerts/subscriptions", "https://evil.com", "POST", http.StatusForbidden, ""},
+		{"other site reads public route", "GET", "/v1/twitch/streams/top", "https://fan.site", "", http.StatusOK, "*"},
+		{"other site can't read follows", "GET", "/v1/twitch/follows", "https://fan.site", "", http.StatusOK, ""},
+		{"partner override", "GET", "/v1/lineups/shared/abc", "https://embed.partner.tv", "", http.StatusOK, "https://embed.partner.tv"},
+		{"override keeps public access", "GET", "/v1/lineups/shared/abc", "https://fan.site", "", http.StatusOK, "*"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Origin", tt.origin)
+		if tt.reqMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+			t.Errorf("%s: expected Allow-Origin %q, got %q", tt.name, tt.allowOrigin, got)
+		}
+	}
+}
+
+func TestRoutes_HeartbeatIsCORSEnabled(t *testing.T) {
+	corsHandler, err := newCORSMiddleware(&VibeConfig{CORSPublicOrigins: []string{"*"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	passthrough := func(next http.Handler) http.Handler { return next }
+	router := routes(&mockTwitchClient{}, corsHandler, passthrough, nil)
+
+	req := httptest.NewRequest("GET", "/v1/heartbeat", nil)
+	req.Header.Set("Origin", "https://fan.site")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected the heartbeat readable cross-origin, got Allow-Origin %q", got)
+	}
+}
+
+func TestNewCORSMiddleware_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  VibeConfig
+	}{
+		{"wildcard with credentials", VibeConfig{CORSAllowedOrigins: []string{"*"}}},
+		{"bad public origin", VibeConfig{CORSPublicOrigins: []string{"fan.site"}}},
+		{"override without prefix", VibeConfig{CORSRouteOrigins: []string{"https://partner.tv"}}},
+	}
+	for _, tt := range tests {
+		if _, err := newCORSMiddleware(&tt.cfg); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
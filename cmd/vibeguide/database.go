@@ -12,6 +12,7 @@ import (
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -31,6 +32,8 @@ func Connect(dbCred DBCredentials) (*gorm.DB, error) {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
 		url, dbCred.User, dbCred.Pass, dbCred.Name, dbCred.Port)
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		// Map unique violations to gorm.ErrDuplicatedKey
+		TranslateError: true,
 		Logger: logger.New(
 			log.New(os.Stdout, "\r\n", log.LstdFlags),
 			logger.Config{
@@ -51,7 +54,23 @@ func Connect(dbCred DBCredentials) (*gorm.DB, error) {
 // Migration
 
 func MigrateDatabase(db *gorm.DB) error {
-	return db.AutoMigrate(&Role{}, &User{}, &Image{})
+	err := db.AutoMigrate(&Role{}, &User{}, &Image{}, &LiveSession{}, &InferredSchedule{},
+		&AlertSubscription{}, &AlertDestination{}, &AlertPreference{}, &AlertOutbox{},
+		&DigestSubscription{}, &Lineup{}, &Vibe{}, &VibeRule{},
+		&AnomalyPolicy{}, &BlocklistEntry{}, &BlocklistAudit{}, &ViewingPreference{}, &TwitchToken{}, &TwitchAccount{}, &UserSession{},
+		&RateLimitCounter{}, &APIKey{}, &OAuthNonce{}, &DeviceLogin{})
+	if err != nil {
+		return err
+	}
+	return SeedRoles(db)
+}
+
+// SeedRoles creates the default roles, leaving existing ones untouched
+func SeedRoles(db *gorm.DB) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoNothing: true,
+	}).Create(&defaultRoles).Error
 }
 
 // Mock
@@ -88,21 +107,38 @@ func DbMock(t *testing.T) (*sql.DB, *gorm.DB, sqlmock.Sqlmock) {
 type Role struct {
 	// Id, created_at, updated_at, deleted_at
 	gorm.Model
-	Name        string `gorm:"uniqueIndex"`
-	Description string
+	Name        string `gorm:"uniqueIndex" json:"name"`
+	Description string `json:"description"`
 	// Role has many users
-	Users []User
+	Users []User `json:"-"`
+}
+
+// Role names
+const (
+	RoleViewer = "viewer"
+	RoleAdmin  = "admin"
+)
+
+// defaultRoles are seeded on migration. New users get RoleViewer.
+var defaultRoles = []Role{
+	{Name: RoleViewer, Description: "Signed-in viewer"},
+	{Name: RoleAdmin, Description: "Operator with access to /v1/admin"},
 }
 
 type User struct {
 	gorm.Model
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Phone     string `json:"phone"`
+	// SupabaseUserID links the row to the Supabase auth user. The unique index is partial so
+	// rows created before the column existed, which are all empty, don't collide.
+	SupabaseUserID string `gorm:"uniqueIndex:idx_users_supabase_user_id,where:supabase_user_id <> ''" json:"supabase_user_id"`
+	Email          string `json:"email"`
+	FirstName      string `json:"first_name"`
+	LastName       string `json:"last_name"`
+	Phone          string `json:"phone"`
 	// User has one role
-	RoleID uint
+	RoleID uint `json:"role_id"`
+	Role   Role `json:"role"`
 	// User has many images
-	Images []Image
+	Images []Image `json:"-"`
 }
 
 type Image struct {
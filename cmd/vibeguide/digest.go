@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mailer"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// digestPeriod is how much history each digest covers and how often it is sent
+const digestPeriod = 7 * 24 * time.Hour
+
+//go:embed templates/digest.html.tmpl templates/digest.txt.tmpl
+var digestTemplateFS embed.FS
+
+var digestTemplateFuncs = map[string]any{
+	"duration": formatDigestDuration,
+	"join":     strings.Join,
+}
+
+var (
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest.html.tmpl").Funcs(digestTemplateFuncs).ParseFS(digestTemplateFS, "templates/digest.html.tmpl"))
+	digestTextTemplate = texttemplate.Must(texttemplate.New("digest.txt.tmpl").Funcs(digestTemplateFuncs).ParseFS(digestTemplateFS, "templates/digest.txt.tmpl"))
+)
+
+// DigestSubscription is a user's opt-in to the weekly email digest. Follows is a snapshot of
+// the channels they follow on Twitch, refreshed whenever their follows are fetched.
+type DigestSubscription struct {
+	gorm.Model
+	SupabaseUserID   string          `gorm:"uniqueIndex" json:"supabase_user_id"`
+	Email            string          `json:"email"`
+	TwitchUserID     string          `json:"twitch_user_id"`
+	Enabled          bool            `gorm:"index" json:"enabled"`
+	UnsubscribeToken string          `gorm:"uniqueIndex" json:"-"`
+	Follows          []twitch.Follow `gorm:"serializer:json" json:"follows"`
+	FollowsSyncedAt  *time.Time      `json:"follows_synced_at"`
+	LastSentAt       *time.Time      `json:"last_sent_at"`
+}
+
+// DigestChannel summarises one followed channel's week
+type DigestChannel struct {
+	BroadcasterID    string        `json:"broadcaster_id"`
+	BroadcasterLogin string        `json:"broadcaster_login"`
+	BroadcasterName  string        `json:"broadcaster_name"`
+	Sessions         int           `json:"sessions"`
+	Duration         time.Duration `json:"duration"`
+	Categories       []string      `json:"categories"`
+	PeakViewers      int           `json:"peak_viewers"`
+}
+
+// WeeklyDigest is the data rendered into the digest email templates
+type WeeklyDigest struct {
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+	Channels       []DigestChannel
+	UnsubscribeURL string
+}
+
+// summarizeDigest aggregates the sessions of followed channels that overlap [start, end).
+// Channels that did not stream are left out; the rest are ordered by time streamed.
+// Sessions the filter rejects, by broadcaster or by any category streamed, are not counted.
+func summarizeDigest(follows []twitch.Follow, sessions []LiveSession, filter twitch.ContentFilter, start, end time.Time) []DigestChannel {
+	byID := make(map[string]*DigestChannel, len(follows))
+	for _, follow := range follows {
+		byID[follow.BroadcasterID] = &DigestChannel{
+			BroadcasterID:    follow.BroadcasterID,
+			BroadcasterLogin: follow.BroadcasterLogin,
+			BroadcasterName:  follow.BroadcasterName,
+		}
+	}
+
+	for i := range sessions {
+		session := &sessions[i]
+		channel, followed := byID[session.BroadcasterID]
+		if !followed || !allowSession(filter, session) {
+			continue
+		}
+
+		from, to := session.StartedAt, session.EndOrLastSeen()
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if !to.After(from) {
+			continue
+		}
+
+		channel.Sessions++
+		channel.Duration += to.Sub(from)
+		if session.PeakViewers > channel.PeakViewers {
+			channel.PeakViewers = session.PeakViewers
+		}
+		for _, category := range session.Categories {
+			if !containsString(channel.Categories, category) {
+				channel.Categories = append(channel.Categories, category)
+			}
+		}
+		if channel.BroadcasterLogin == "" {
+			channel.BroadcasterLogin = session.BroadcasterLogin
+		}
+	}
+
+	var channels []DigestChannel
+	for _, channel := range byID {
+		if channel.Sessions == 0 {
+			continue
+		}
+		if channel.BroadcasterName == "" {
+			channel.BroadcasterName = channel.BroadcasterLogin
+		}
+		channels = append(channels, *channel)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Duration != channels[j].Duration {
+			return channels[i].Duration > channels[j].Duration
+		}
+		return channels[i].BroadcasterLogin < channels[j].BroadcasterLogin
+	})
+	return channels
+}
+
+// allowSession checks a recorded session against the filter; sessions keep no title, so
+// only broadcaster and category entries apply
+func allowSession(filter twitch.ContentFilter, session *LiveSession) bool {
+	stream := twitch.Stream{UserID: session.BroadcasterID, UserLogin: session.BroadcasterLogin}
+	if !filter.AllowStream(stream) {
+		return false
+	}
+	for _, category := range session.Categories {
+		stream.GameName = category
+		if !filter.AllowStream(stream) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDigestDuration renders a duration as "3h 20m"
+func formatDigestDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours := int(d / time.Hour)
+	minutes := int((d % time.Hour) / time.Minute)
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+}
+
+// renderDigest builds the email for a digest
+func renderDigest(to string, digest WeeklyDigest) (mailer.Message, error) {
+	var html, text bytes.Buffer
+	if err := digestHTMLTemplate.Execute(&html, digest); err != nil {
+		return mailer.Message{}, fmt.Errorf("failed to render html digest: %w", err)
+	}
+	if err := digestTextTemplate.Execute(&text, digest); err != nil {
+		return mailer.Message{}, fmt.Errorf("failed to render text digest: %w", err)
+	}
+
+	return mailer.Message{
+		To:      to,
+		Subject: fmt.Sprintf("Your week on Twitch: %s – %s", digest.PeriodStart.Format("Jan 2"), digest.PeriodEnd.Format("Jan 2")),
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			// RFC 8058 one-click unsubscribe
+			"List-Unsubscribe":      "<" + digest.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+// digestUnsubscribeURL builds the public unsubscribe link for a token
+func digestUnsubscribeURL(token string) string {
+	return strings.TrimRight(Config.PublicBaseURL, "/") + "/v1/digest/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+// newDigestToken generates a random unsubscribe token
+func newDigestToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// digestWatchedBroadcasters returns the channels followed by opted-in users so the
+// live session tracker records them even when they are outside the top streams
+func digestWatchedBroadcasters(ctx context.Context, db *gorm.DB) ([]string, error) {
+	var subs []DigestSubscription
+	if err := db.WithContext(ctx).Select("follows").Where("enabled = ?", true).Find(&subs).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, sub := range subs {
+		for _, follow := range sub.Follows {
+			if !seen[follow.BroadcasterID] {
+				seen[follow.BroadcasterID] = true
+				ids = append(ids, follow.BroadcasterID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// syncDigestFollows refreshes the follow snapshot of an existing digest subscription
+func syncDigestFollows(ctx context.Context, db *gorm.DB, supabaseUserID string, follows []twitch.Follow) error {
+	now := time.Now().UTC()
+	return db.WithContext(ctx).Model(&DigestSubscription{}).
+		Where("supabase_user_id = ?", supabaseUserID).
+		Select("follows", "follows_synced_at").
+		Updates(&DigestSubscription{Follows: follows, FollowsSyncedAt: &now}).Error
+}
+
+// startDigestJob periodically sends digests to opted-in users whose last digest is a week old
+func startDigestJob(ctx context.Context, m mailer.Mailer, filter twitch.ContentFilter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			zlog.Info().Msg("Digest job stopping")
+			return
+		case <-ticker.C:
+			sent, err := sendDueDigests(ctx, DB, m, filter, time.Now().UTC())
+			workerHeartbeats.Beat(workerDigest, err)
+			if err != nil {
+				zlog.Error().Err(err).Msg("Digest job failed")
+				continue
+			}
+			zlog.Info().Int("digests", sent).Msg("Digest job completed")
+		}
+	}
+}
+
+// sendDueDigests sends a digest to every enabled subscription not sent within the last
+// digestPeriod. It returns the number of digests sent.
+func sendDueDigests(ctx context.Context, db *gorm.DB, m mailer.Mailer, filter twitch.ContentFilter, now time.Time) (int, error) {
+	dueBefore := now.Add(-digestPeriod)
+
+	var subs []DigestSubscription
+	err := db.WithContext(ctx).
+		Where("enabled = ? AND (last_sent_at IS NULL OR last_sent_at <= ?)", true, dueBefore).
+		Order("id").
+		Find(&subs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range subs {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		sub := &subs[i]
+
+		// Claim the subscription so concurrent instances do not send the same digest twice
+		claim := db.WithContext(ctx).Model(&DigestSubscription{}).
+			Where("id = ? AND (last_sent_at IS NULL OR last_sent_at <= ?)", sub.ID, dueBefore).
+			Update("last_sent_at", now)
+		if claim.Error != nil {
+			return sent, claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		if err := sendDigest(ctx, db, m, filter, sub, now); err != nil {
+			zlog.Error().Err(err).Uint("subscription_id", sub.ID).Msg("Failed to send digest")
+			// Release the claim so the next run retries
+			db.WithContext(ctx).Model(&DigestSubscription{}).Where("id = ?", sub.ID).Update("last_sent_at", sub.LastSentAt)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// sendDigest summarises the past week for one subscription and emails it
+func sendDigest(ctx context.Context, db *gorm.DB, m mailer.Mailer, filter twitch.ContentFilter, sub *DigestSubscription, now time.Time) error {
+	start := now.Add(-digestPeriod)
+
+	ids := make([]string, 0, len(sub.Follows))
+	for _, follow := range sub.Follows {
+		ids = append(ids, follow.BroadcasterID)
+	}
+
+	var sessions []LiveSession
+	if len(ids) > 0 {
+		err := db.WithContext(ctx).
+			Where("broadcaster_id IN ? AND started_at < ? AND (ended_at IS NULL OR ended_at >= ?)", ids, now, start).
+			Find(&sessions).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	msg, err := renderDigest(sub.Email, WeeklyDigest{
+		PeriodStart:    start,
+		PeriodEnd:      now,
+		Channels:       summarizeDigest(sub.Follows, sessions, filter, start, now),
+		UnsubscribeURL: digestUnsubscribeURL(sub.UnsubscribeToken),
+	})
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, msg)
+}
+
+// ============= HANDLERS =============
+
+// digestRouter creates a router for the weekly email digest
+func digestRouter(twitchClient twitch.Client) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/subscription", getDigestSubscription)
+	r.Put("/subscription", subscribeDigestHandler(twitchClient))
+	r.Delete("/subscription", disableDigestSubscription)
+	// Linked from the email, so it is authenticated by the token rather than a session.
+	// POST supports one-click unsubscribe from mail clients.
+	r.Get("/unsubscribe", unsubscribeDigest)
+	r.Post("/unsubscribe", unsubscribeDigest)
+	return r
+}
+
+func getDigestSubscription(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getDigestSubscription: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var sub DigestSubscription
+	err := DB.WithContext(r.Context()).Where("supabase_user_id = ?", userID).First(&sub).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handleErr(w, r, fmt.Errorf("not subscribed to the digest"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = sub
+
+	zlog.Info().Msgf("(%s) getDigestSubscription done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// subscribeDigestHandler opts the user in, snapshotting their Twitch follows
+func subscribeDigestHandler(twitchClient twitch.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tId := middleware.GetReqID(ctx)
+		apiVersion := ctx.Value(apivctx).(string)
+		resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+		zlog.Info().Msgf("(%s) subscribeDigest: %v", tId, apiVersion)
+
+		user, err := getAuthenticatedUser(r)
+		if err != nil {
+			handleErr(w, r, err, http.StatusUnauthorized)
+			return
+		}
+		if DB == nil {
+			handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+			return
+		}
+		if user.Email == "" {
+			handleErr(w, r, fmt.Errorf("an email address is required for the digest"), http.StatusBadRequest)
+			return
+		}
+
+		twitchToken, twitchUserID, err := resolveTwitchIdentity(ctx, twitchClient, user.ID.String())
+		if err != nil {
+			handleErr(w, r, err, twitchIdentityStatus(err))
+			return
+		}
+		follows, err := twitchClient.GetUserFollows(ctx, twitchUserID, twitchToken)
+		if err != nil {
+			handleErr(w, r, err, determineErrorStatusCode(err))
+			return
+		}
+		followsCache.Set(twitchUserID, follows)
+
+		var sub DigestSubscription
+		err = DB.WithContext(ctx).Where("supabase_user_id = ?", user.ID.String()).First(&sub).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErr(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		if sub.UnsubscribeToken == "" {
+			if sub.UnsubscribeToken, err = newDigestToken(); err != nil {
+				handleErr(w, r, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		now := time.Now().UTC()
+		sub.SupabaseUserID = user.ID.String()
+		sub.Email = user.Email
+		sub.TwitchUserID = twitchUserID
+		sub.Enabled = true
+		sub.Follows = follows.Data
+		sub.FollowsSyncedAt = &now
+		if err := DB.WithContext(ctx).Save(&sub).Error; err != nil {
+			handleErr(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		resp.Data = sub
+
+		zlog.Info().Msgf("(%s) subscribeDigest done. follows: %d", tId, len(sub.Follows))
+		render.JSON(w, r, resp)
+	}
+}
+
+func disableDigestSubscription(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) disableDigestSubscription: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	err := DB.WithContext(r.Context()).Model(&DigestSubscription{}).
+		Where("supabase_user_id = ?", userID).
+		Update("enabled", false).Error
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = map[string]bool{"enabled": false}
+
+	zlog.Info().Msgf("(%s) disableDigestSubscription done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func unsubscribeDigest(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) unsubscribeDigest: %v", tId, apiVersion)
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		handleErr(w, r, fmt.Errorf("token is required"), http.StatusBadRequest)
+		return
+	}
+	if DB == nil {
+		handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	result := DB.WithContext(r.Context()).Model(&DigestSubscription{}).
+		Where("unsubscribe_token = ?", token).
+		Update("enabled", false)
+	if result.Error != nil {
+		handleErr(w, r, result.Error, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		handleErr(w, r, fmt.Errorf("invalid unsubscribe token"), http.StatusNotFound)
+		return
+	}
+	resp.Data = map[string]bool{"enabled": false}
+
+	zlog.Info().Msgf("(%s) unsubscribeDigest done.", tId)
+	render.JSON(w, r, resp)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+func TestSummarizeDigest(t *testing.T) {
+	end := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	start := end.Add(-digestPeriod)
+	ended := func(t time.Time) *time.Time { return &t }
+
+	follows := []twitch.Follow{
+		{BroadcasterID: "1", BroadcasterLogin: "alpha", BroadcasterName: "Alpha"},
+		{BroadcasterID: "2", BroadcasterLogin: "bravo", BroadcasterName: "Bravo"},
+		{BroadcasterID: "3", BroadcasterLogin: "charlie", BroadcasterName: "Charlie"},
+	}
+	sessions := []LiveSession{
+		// Started before the window, only the last hour counts
+		{BroadcasterID: "1", StartedAt: start.Add(-2 * time.Hour), EndedAt: ended(start.Add(time.Hour)), PeakViewers: 100, Categories: []string{"Just Chatting"}},
+		{BroadcasterID: "1", StartedAt: start.Add(48 * time.Hour), EndedAt: ended(start.Add(50 * time.Hour)), PeakViewers: 300, Categories: []string{"Just Chatting", "Minecraft"}},
+		// Still live, counted up to when it was last seen
+		{BroadcasterID: "2", StartedAt: end.Add(-4 * time.Hour), LastSeenAt: end.Add(-30 * time.Minute), PeakViewers: 50, Categories: []string{"Art"}},
+		// Not followed
+		{BroadcasterID: "9", StartedAt: start.Add(time.Hour), EndedAt: ended(start.Add(10 * time.Hour))},
+	}
+
+	channels := summarizeDigest(follows, sessions, NewBlocklist(), start, end)
+	if len(channels) != 2 {
+		t.Fatalf("Expected 2 channels that streamed, got %d", len(channels))
+	}
+
+	if channels[0].BroadcasterID != "2" || channels[0].Duration != 3*time.Hour+30*time.Minute {
+		t.Errorf("Expected Bravo first with 3h30m, got %s with %s", channels[0].BroadcasterID, channels[0].Duration)
+	}
+
+	alpha := channels[1]
+	if alpha.Sessions != 2 || alpha.Duration != 3*time.Hour {
+		t.Errorf("Expected Alpha with 2 sessions and 3h, got %d and %s", alpha.Sessions, alpha.Duration)
+	}
+	if alpha.PeakViewers != 300 {
+		t.Errorf("Expected peak viewers 300, got %d", alpha.PeakViewers)
+	}
+	if strings.Join(alpha.Categories, ",") != "Just Chatting,Minecraft" {
+		t.Errorf("Expected deduplicated categories, got %v", alpha.Categories)
+	}
+
+	// Blocked broadcasters and sessions in blocked categories are left out
+	blocklist := NewBlocklist()
+	blocklist.Set([]BlocklistEntry{{Kind: blockBroadcaster, Value: "2"}, {Kind: blockCategory, Value: "minecraft"}})
+	channels = summarizeDigest(follows, sessions, blocklist, start, end)
+	if len(channels) != 1 || channels[0].BroadcasterID != "1" || channels[0].Sessions != 1 {
+		t.Errorf("Expected only Alpha's first session, got %+v", channels)
+	}
+}
+
+func TestFormatDigestDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		45 * time.Minute:             "45m",
+		2 * time.Hour:                "2h",
+		3*time.Hour + 20*time.Minute: "3h 20m",
+		3*time.Hour + 19*time.Minute + 40*time.Second: "3h 20m",
+	}
+	for d, expected := range tests {
+		if got := formatDigestDuration(d); got != expected {
+			t.Errorf("formatDigestDuration(%s) = %q, expected %q", d, got, expected)
+		}
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	digest := WeeklyDigest{
+		PeriodStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+		Channels: []DigestChannel{{
+			BroadcasterLogin: "alpha",
+			BroadcasterName:  "Alpha <script>",
+			Sessions:         1,
+			Duration:         90 * time.Minute,
+			Categories:       []string{"Just Chatting", "Minecraft"},
+			PeakViewers:      300,
+		}},
+		UnsubscribeURL: "http://localhost:8080/v1/digest/unsubscribe?token=abc",
+	}
+
+	msg, err := renderDigest("viewer@example.com", digest)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, want := range []string{"Alpha <script>", "1h 30m across 1 stream", "Just Chatting, Minecraft", "Peak viewers: 300", digest.UnsubscribeURL} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("Expected text body to contain %q, got:\n%s", want, msg.Text)
+		}
+	}
+	if strings.Contains(msg.HTML, "<script>") || !strings.Contains(msg.HTML, "Alpha &lt;script&gt;") {
+		t.Error("Expected channel names to be escaped in the HTML body")
+	}
+	if msg.Headers["List-Unsubscribe"] != "<"+digest.UnsubscribeURL+">" {
+		t.Errorf("Expected List-Unsubscribe header, got %q", msg.Headers["List-Unsubscribe"])
+	}
+}
+
+func TestUnsubscribeDigest(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "digest_subscriptions" SET "enabled"=.*WHERE unsubscribe_token = `).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "digest_subscriptions"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/digest", digestRouter(&mockTwitchClient{}))
+
+	req := httptest.NewRequest("GET", "/digest/unsubscribe?token=abc", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/digest/unsubscribe?token=unknown", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
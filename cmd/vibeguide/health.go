@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/health"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Background workers reported by /readyz
+const (
+	workerLiveSessions      = "live_sessions"
+	workerScheduleInference = "schedule_inference"
+	workerAlertDispatcher   = "alert_dispatcher"
+	workerDigest            = "digest"
+	workerAnomalyMonitor    = "anomaly_monitor"
+	workerTwitchTokens      = "twitch_tokens"
+	workerChatPool          = "chat_pool"
+)
+
+// workerHeartbeats tracks the workers run() starts; each beats after every cycle
+var workerHeartbeats = health.NewHeartbeats()
+
+// appTokenChecker is implemented by the real Twitch client
+type appTokenChecker interface {
+	CheckAppToken(ctx context.Context) error
+}
+
+// newReadinessChecker builds the /readyz checks. Twitch and the database are critical: without
+// them the guide can't be served. Supabase (sign-in) and the workers only degrade the service.
+func newReadinessChecker(twitchClient twitch.Client, cfg *VibeConfig) *health.Checker {
+	var checks []health.Check
+	if tc, ok := twitchClient.(appTokenChecker); ok {
+		checks = append(checks, health.Check{
+			Name:     "twitch_app_token",
+			Critical: true,
+			Timeout:  cfg.HealthCheckTimeout,
+			Run:      tc.CheckAppToken,
+		})
+	}
+	checks = append(checks,
+		health.Check{
+			Name:     "twitch_helix",
+			Critical: true,
+			Timeout:  cfg.HealthCheckTimeout,
+			Run: func(ctx context.Context) error {
+				_, err := twitchClient.GetTopStreams(ctx, 1)
+				return err
+			},
+		},
+		health.Check{Name: "database", Critical: true, Timeout: cfg.HealthCheckTimeout, Run: pingDatabase},
+		health.Check{Name: "supabase", Timeout: cfg.HealthCheckTimeout, Run: pingSupabase},
+	)
+	checks = append(checks, workerHeartbeats.Checks("worker:")...)
+	return health.NewChecker(cfg.HealthCacheTTL, checks...)
+}
+
+func pingDatabase(ctx context.Context) error {
+	if DB == nil {
+		return fmt.Errorf("not connected")
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// pingSupabase calls GoTrue's health endpoint
+func pingSupabase(ctx context.Context) error {
+	if gotrueURL == "" {
+		return fmt.Errorf("not configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gotrueURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+	if Config != nil {
+		req.Header.Set("apikey", Config.SupabaseApiKey)
+	}
+	resp, err := gotrueHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("auth health returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ============= HANDLERS =============
+
+// healthz answers while the process is up and serving requests
+func healthz(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, map[string]string{"status": health.StatusUp})
+}
+
+// readyz reports each dependency, answering 503 when a critical one is down
+func readyz(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Run(r.Context())
+		if !report.Ready() {
+			zlog.Warn().Interface("checks", report.Checks).Msg("Not ready")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		render.JSON(w, r, report)
+	}
+}
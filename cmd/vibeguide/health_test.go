@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/site-tech/VibeGuide/pkg/health"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+func TestReadyz(t *testing.T) {
+	sqldb, gormdb, _ := DbMock(t)
+	defer sqldb.Close()
+	origDB, origURL := DB, gotrueURL
+	defer func() { DB, gotrueURL = origDB, origURL }()
+
+	supabaseUp := true
+	supabase := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("Expected /health, got %s", r.URL.Path)
+		}
+		if !supabaseUp {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer supabase.Close()
+	gotrueURL = supabase.URL
+
+	twitchClient := &mockTwitchClient{streams: &twitch.StreamsResponse{}}
+	checker := newReadinessChecker(twitchClient, &VibeConfig{HealthCheckTimeout: time.Second})
+	r := chi.NewRouter()
+	r.Get("/healthz", healthz)
+	r.Get("/readyz", readyz(checker))
+
+	probe := func(path string) (int, health.Report) {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var report health.Report
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return w.Code, report
+	}
+
+	if code, report := probe("/healthz"); code != http.StatusOK || report.Status != health.StatusUp {
+		t.Errorf("Expected liveness to be up, got %d %+v", code, report)
+	}
+
+	DB = gormdb
+	code, report := probe("/readyz")
+	if code != http.StatusOK || report.Status != health.StatusUp {
+		t.Errorf("Expected ready, got %d %+v", code, report)
+	}
+	for _, name := range []string{"twitch_helix", "database", "supabase"} {
+		if report.Checks[name].Status != health.StatusUp {
+			t.Errorf("Expected %s to be up, got %+v", name, report.Checks[name])
+		}
+	}
+
+	// Supabase only degrades the service
+	supabaseUp = false
+	code, report = probe("/readyz")
+	if code != http.StatusOK || report.Status != health.StatusDegraded || report.Checks["supabase"].Error == "" {
+		t.Errorf("Expected degraded, got %d %+v", code, report)
+	}
+
+	// Without a database or Twitch the service can't serve the guide
+	DB = nil
+	twitchClient.shouldErr, twitchClient.errMsg = true, "helix unavailable"
+	code, report = probe("/readyz")
+	if code != http.StatusServiceUnavailable || report.Status != health.StatusDown {
+		t.Errorf("Expected status code %d, got %d %+v", http.StatusServiceUnavailable, code, report)
+	}
+	if report.Checks["database"].Error != "not connected" || report.Checks["twitch_helix"].Error != "helix unavailable" {
+		t.Errorf("Expected the failures in the details, got %+v", report.Checks)
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Lineup row types
+const (
+	lineupRowCategory = "category" // Top live streams in one category
+	lineupRowChannels = "channels" // Specific broadcasters, whichever are live
+	lineupRowFilter   = "filter"   // A saved GetStreams query
+)
+
+// maxLineupRows bounds how many GetStreams calls resolving one guide can make
+const maxLineupRows = 30
+
+// Lineup is a user's personal guide: an ordered list of named rows
+type Lineup struct {
+	gorm.Model
+	SupabaseUserID string      `gorm:"index" json:"-"`
+	Name           string      `json:"name"`
+	Slug           string      `gorm:"uniqueIndex" json:"slug"`
+	Public         bool        `json:"public"` // Readable by anyone with the slug
+	Rows           []LineupRow `gorm:"serializer:json" json:"rows"`
+}
+
+// LineupRow is one row of a lineup, resolved to live streams when the guide is built
+type LineupRow struct {
+	Title          string                     `json:"title"`
+	Type           string                     `json:"type"`
+	GameID         string                     `json:"game_id,omitempty"`
+	BroadcasterIDs []string                   `json:"broadcaster_ids,omitempty"`
+	Filter         *twitch.StreamsQueryParams `json:"filter,omitempty"`
+	Limit          int                        `json:"limit,omitempty"`
+}
+
+// LineupGuide is a lineup with each row resolved to its live streams
+type LineupGuide struct {
+	ID   uint             `json:"id"`
+	Name string           `json:"name"`
+	Slug string           `json:"slug"`
+	Rows []LineupGuideRow `json:"rows"`
+}
+
+// LineupGuideRow is a resolved row. Error is set instead of failing the whole guide
+// when a single row cannot be fetched.
+type LineupGuideRow struct {
+	LineupRow
+	Streams []twitch.Stream `json:"streams"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Query builds the GetStreams parameters for a row
+func (row *LineupRow) Query() twitch.StreamsQueryParams {
+	params := twitch.StreamsQueryParams{Limit: row.Limit, Sort: "viewers"}
+	switch row.Type {
+	case lineupRowCategory:
+		params.GameID = row.GameID
+	case lineupRowChannels:
+		params.UserIDs = row.BroadcasterIDs
+		if params.Limit == 0 {
+			params.Limit = twitch.MaxStreamQueryLimit
+		}
+	case lineupRowFilter:
+		if row.Filter != nil {
+			params = *row.Filter
+		}
+		if params.Limit == 0 {
+			params.Limit = row.Limit
+		}
+		if params.Sort == "" {
+			params.Sort = "viewers"
+		}
+	}
+	if params.Limit == 0 {
+		params.Limit = twitch.DefaultQueryLimit
+	}
+	return params
+}
+
+// validateLineup checks a lineup submitted by a user
+func validateLineup(lineup *Lineup) error {
+	lineup.Name = strings.TrimSpace(lineup.Name)
+	if lineup.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(lineup.Rows) > maxLineupRows {
+		return fmt.Errorf("a lineup can have at most %d rows, got %d", maxLineupRows, len(lineup.Rows))
+	}
+
+	for i := range lineup.Rows {
+		row := &lineup.Rows[i]
+		switch row.Type {
+		case lineupRowCategory:
+			if row.GameID == "" {
+				return fmt.Errorf("row %d: game_id is required for category rows", i)
+			}
+		case lineupRowChannels:
+			if len(row.BroadcasterIDs) == 0 {
+				return fmt.Errorf("row %d: broadcaster_ids is required for channels rows", i)
+			}
+		case lineupRowFilter:
+			if row.Filter == nil {
+				return fmt.Errorf("row %d: filter is required for filter rows", i)
+			}
+		default:
+			return fmt.Errorf("row %d: type must be one of %s, %s or %s, got %s", i, lineupRowCategory, lineupRowChannels, lineupRowFilter, row.Type)
+		}
+		if err := twitch.ValidateStreamsParams(row.Query()); err != nil {
+			return fmt.Errorf("row %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// newLineupSlug generates a random, URL-safe slug for sharing a lineup
+func newLineupSlug() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
+
+// resolveLineupGuide fetches the live streams for every row of a lineup concurrently. In safe
+// mode mature and excluded-label streams are left out, and ?vibe= filters every row.
+func resolveLineupGuide(r *http.Request, twitchClient twitch.Client, lineup *Lineup, safe bool) LineupGuide {
+	ctx := r.Context()
+	guide := LineupGuide{
+		ID:   lineup.ID,
+		Name: lineup.Name,
+		Slug: lineup.Slug,
+		Rows: make([]LineupGuideRow, len(lineup.Rows)),
+	}
+
+	var wg sync.WaitGroup
+	for i, row := range lineup.Rows {
+		guide.Rows[i] = LineupGuideRow{LineupRow: row, Streams: []twitch.Stream{}}
+		wg.Add(1)
+		go func(guideRow *LineupGuideRow) {
+			defer wg.Done()
+			streams, err := twitchClient.GetStreams(ctx, guideRow.Query())
+			if err != nil {
+				guideRow.Error = err.Error()
+				return
+			}
+			guideRow.Streams = applyAnomalyPolicy(applyVibes(r, applyContentSafety(ctx, twitchClient, streams.Data, safe)))
+		}(&guide.Rows[i])
+	}
+	wg.Wait()
+
+	return guide
+}
+
+// ============= HANDLERS =============
+
+// lineupsRouter creates a router for personal guide lineups
+func lineupsRouter(twitchClient twitch.Client) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", listLineups)
+	r.Post("/", createLineup)
+	r.Get("/{id}", getLineup)
+	r.Put("/{id}", updateLineup)
+	r.Delete("/{id}", deleteLineup)
+	r.Get("/{id}/guide", getLineupGuideHandler(twitchClient))
+	// Shared lineups are readable without authentication
+	r.Get("/shared/{slug}", getSharedLineup)
+	r.Get("/shared/{slug}/guide", getSharedLineupGuideHandler(twitchClient))
+	return r
+}
+
+// loadOwnedLineup loads the lineup identified by the {id} URL param if it belongs to the caller.
+// It writes the error response and returns false when the request cannot proceed.
+func loadOwnedLineup(w http.ResponseWriter, r *http.Request) (*Lineup, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("id must be numeric"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	var lineup Lineup
+	err = DB.WithContext(r.Context()).Where("id = ? AND supabase_user_id = ?", id, userID).First(&lineup).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handleErr(w, r, fmt.Errorf("not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return nil, false
+	}
+	return &lineup, true
+}
+
+// loadSharedLineup loads a public lineup by the {slug} URL param
+func loadSharedLineup(w http.ResponseWriter, r *http.Request) (*Lineup, bool) {
+	if DB == nil {
+		handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	var lineup Lineup
+	err := DB.WithContext(r.Context()).Where("slug = ? AND public = ?", chi.URLParam(r, "slug"), true).First(&lineup).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handleErr(w, r, fmt.Errorf("not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return nil, false
+	}
+	return &lineup, true
+}
+
+// lineupBody is the request body for creating or replacing a lineup
+type lineupBody struct {
+	Name   string      `json:"name"`
+	Public bool        `json:"public"`
+	Rows   []LineupRow `json:"rows"`
+}
+
+func listLineups(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) listLineups: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var lineups []Lineup
+	if err := DB.WithContext(r.Context()).Where("supabase_user_id = ?", userID).Order("id").Find(&lineups).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = lineups
+
+	zlog.Info().Msgf("(%s) listLineups done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func createLineup(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) createLineup: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var body lineupBody
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) createLineup: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	lineup := Lineup{
+		SupabaseUserID: userID,
+		Name:           body.Name,
+		Public:         body.Public,
+		Rows:           body.Rows,
+	}
+	if err := validateLineup(&lineup); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	slug, err := newLineupSlug()
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	lineup.Slug = slug
+
+	if err := DB.WithContext(r.Context()).Create(&lineup).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = lineup
+
+	zlog.Info().Msgf("(%s) createLineup done.", tId)
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, resp)
+}
+
+func getLineup(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getLineup: %v", tId, apiVersion)
+
+	lineup, ok := loadOwnedLineup(w, r)
+	if !ok {
+		return
+	}
+	resp.Data = lineup
+
+	zlog.Info().Msgf("(%s) getLineup done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func updateLineup(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) updateLineup: %v", tId, apiVersion)
+
+	lineup, ok := loadOwnedLineup(w, r)
+	if !ok {
+		return
+	}
+
+	var body lineupBody
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) updateLineup: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	lineup.Name = body.Name
+	lineup.Public = body.Public
+	lineup.Rows = body.Rows
+	if err := validateLineup(lineup); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := DB.WithContext(r.Context()).Save(lineup).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = lineup
+
+	zlog.Info().Msgf("(%s) updateLineup done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func deleteLineup(w http.ResponseWriter, r *http.Request) {
+	deleteOwnedRow(w, r, &Lineup{}, "deleteLineup")
+}
+
+// getLineupGuideHandler resolves one of the caller's lineups to live streams
+func getLineupGuideHandler(twitchClient twitch.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tId := middleware.GetReqID(r.Context())
+		apiVersion := r.Context().Value(apivctx).(string)
+		resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+		zlog.Info().Msgf("(%s) getLineupGuide: %v", tId, apiVersion)
+
+		safe, err := safeModeFor(r)
+		if err != nil {
+			handleErr(w, r, err, http.StatusBadRequest)
+			return
+		}
+		lineup, ok := loadOwnedLineup(w, r)
+		if !ok {
+			return
+		}
+		resp.Data = resolveLineupGuide(r, twitchClient, lineup, safe)
+
+		zlog.Info().Msgf("(%s) getLineupGuide done.", tId)
+		render.JSON(w, r, resp)
+	}
+}
+
+func getSharedLineup(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getSharedLineup: %v", tId, apiVersion)
+
+	lineup, ok := loadSharedLineup(w, r)
+	if !ok {
+		return
+	}
+	resp.Data = lineup
+
+	zlog.Info().Msgf("(%s) getSharedLineup done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// getSharedLineupGuideHandler resolves a public lineup to live streams
+func getSharedLineupGuideHandler(twitchClient twitch.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tId := middleware.GetReqID(r.Context())
+		apiVersion := r.Context().Value(apivctx).(string)
+		resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+		zlog.Info().Msgf("(%s) getSharedLineupGuide: %v", tId, apiVersion)
+
+		safe, err := safeModeFor(r)
+		if err != nil {
+			handleErr(w, r, err, http.StatusBadRequest)
+			return
+		}
+		lineup, ok := loadSharedLineup(w, r)
+		if !ok {
+			return
+		}
+		resp.Data = resolveLineupGuide(r, twitchClient, lineup, safe)
+
+		zlog.Info().Msgf("(%s) getSharedLineupGuide done.", tId)
+		render.JSON(w, r, resp)
+	}
+}
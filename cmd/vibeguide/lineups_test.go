@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+func TestValidateLineup(t *testing.T) {
+	tests := []struct {
+		name    string
+		lineup  Lineup
+		wantErr bool
+	}{
+		{"category row", Lineup{Name: "Mine", Rows: []LineupRow{{Type: lineupRowCategory, GameID: "509658"}}}, false},
+		{"channels row", Lineup{Name: "Mine", Rows: []LineupRow{{Type: lineupRowChannels, BroadcasterIDs: []string{"123", "456"}}}}, false},
+		{"filter row", Lineup{Name: "Mine", Rows: []LineupRow{{Type: lineupRowFilter, Filter: &twitch.StreamsQueryParams{GameID: "32982", Sort: "recent"}}}}, false},
+		{"missing name", Lineup{Name: "  ", Rows: []LineupRow{}}, true},
+		{"category without game", Lineup{Name: "Mine", Rows: []LineupRow{{Type: lineupRowCategory}}}, true},
+		{"non-numeric broadcaster", Lineup{Name: "Mine", Rows: []LineupRow{{Type: lineupRowChannels, BroadcasterIDs: []string{"abc"}}}}, true},
+		{"invalid filter sort", Lineup{Name: "Mine", Rows: []LineupRow{{Type: lineupRowFilter, Filter: &twitch.StreamsQueryParams{Sort: "random"}}}}, true},
+		{"limit out of range", Lineup{Name: "Mine", Rows: []LineupRow{{Type: lineupRowCategory, GameID: "1", Limit: 500}}}, true},
+		{"unknown type", Lineup{Name: "Mine", Rows: []LineupRow{{Type: "playlist"}}}, true},
+		{"too many rows", Lineup{Name: "Mine", Rows: make([]LineupRow, maxLineupRows+1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLineup(&tt.lineup)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %t, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLineupRowQuery(t *testing.T) {
+	category := LineupRow{Type: lineupRowCategory, GameID: "509658"}
+	if q := category.Query(); q.GameID != "509658" || q.Limit != twitch.DefaultQueryLimit || q.Sort != "viewers" {
+		t.Errorf("Unexpected category query: %+v", q)
+	}
+
+	channels := LineupRow{Type: lineupRowChannels, BroadcasterIDs: []string{"1", "2"}}
+	if q := channels.Query(); len(q.UserIDs) != 2 || q.Limit != twitch.MaxStreamQueryLimit {
+		t.Errorf("Unexpected channels query: %+v", q)
+	}
+
+	filter := LineupRow{Type: lineupRowFilter, Limit: 5, Filter: &twitch.StreamsQueryParams{Sort: "recent"}}
+	if q := filter.Query(); q.Sort != "recent" || q.Limit != 5 {
+		t.Errorf("Unexpected filter query: %+v", q)
+	}
+}
+
+func TestGetSharedLineupGuide(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	rowsJSON := `[{"title":"Chatting","type":"category","game_id":"509658"},{"title":"Friends","type":"channels","broadcaster_ids":["123456"]}]`
+	rows := sqlmock.NewRows([]string{"id", "supabase_user_id", "name", "slug", "public", "rows"}).
+		AddRow(7, "user-1", "Evening", "abc123", true, rowsJSON)
+	mock.ExpectQuery(`SELECT \* FROM "lineups" WHERE \(slug = \$1 AND public = \$2\)`).
+		WithArgs("abc123", true, 1).
+		WillReturnRows(rows)
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/lineups", lineupsRouter(&mockTwitchClient{streams: createTestStreamsResponse()}))
+
+	req := httptest.NewRequest("GET", "/lineups/shared/abc123/guide", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data LineupGuide `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if response.Data.Name != "Evening" || len(response.Data.Rows) != 2 {
+		t.Fatalf("Unexpected guide: %+v", response.Data)
+	}
+	for _, row := range response.Data.Rows {
+		if len(row.Streams) == 0 || row.Error != "" {
+			t.Errorf("Expected row %q to resolve to streams, got %d streams and error %q", row.Title, len(row.Streams), row.Error)
+		}
+	}
+}
+
+func TestLineupsRouter_RequiresAuth(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/lineups", lineupsRouter(&mockTwitchClient{}))
+
+	req := httptest.NewRequest("GET", "/lineups/1/guide", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// LiveSession records one continuous broadcast observed by polling GetStreams
+type LiveSession struct {
+	gorm.Model
+	BroadcasterID    string     `gorm:"index" json:"broadcaster_id"`
+	BroadcasterLogin string     `json:"broadcaster_login"`
+	StreamID         string     `gorm:"index" json:"stream_id"`
+	StartedAt        time.Time  `gorm:"index" json:"started_at"`
+	LastSeenAt       time.Time  `json:"last_seen_at"`
+	EndedAt          *time.Time `gorm:"index" json:"ended_at"`
+	PeakViewers      int        `json:"peak_viewers"`
+	Categories       []string   `gorm:"serializer:json" json:"categories"`
+}
+
+// EndOrLastSeen returns when the session ended, or the last time it was seen live if still open
+func (s *LiveSession) EndOrLastSeen() time.Time {
+	if s.EndedAt != nil {
+		return *s.EndedAt
+	}
+	return s.LastSeenAt
+}
+
+// startLiveSessionTracker periodically polls Twitch and records go-live and go-offline times
+func startLiveSessionTracker(ctx context.Context, twitchClient twitch.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			zlog.Info().Msg("Live session tracker stopping")
+			return
+		case <-ticker.C:
+			err := pollLiveSessions(ctx, DB, twitchClient, time.Now().UTC())
+			workerHeartbeats.Beat(workerLiveSessions, err)
+			if err != nil {
+				zlog.Error().Err(err).Msg("Live session poll failed")
+				continue
+			}
+			zlog.Debug().Msg("Live session poll completed")
+		}
+	}
+}
+
+// liveSessionLockKey is the Postgres advisory lock held while a poll reads and writes
+// LiveSession rows. Every instance runs the tracker, so without it two polls would each
+// see no open session for a new stream and both insert one.
+const liveSessionLockKey int64 = 0x76676c69766573 // "vglives"
+
+// pollLiveSessions fetches the current top streams plus every broadcaster with an open
+// session or followed by a digest subscriber, then opens, extends or closes LiveSession rows accordingly.
+// Only one instance polls at a time; the others skip the tick while the lock is held.
+func pollLiveSessions(ctx context.Context, db *gorm.DB, twitchClient twitch.Client, now time.Time) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", liveSessionLockKey).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			zlog.Debug().Msg("Live session poll skipped, another instance is polling")
+			return nil
+		}
+		return pollLiveSessionsLocked(ctx, tx, twitchClient, now)
+	})
+}
+
+// pollLiveSessionsLocked does the work of pollLiveSessions inside its transaction
+func pollLiveSessionsLocked(ctx context.Context, tx *gorm.DB, twitchClient twitch.Client, now time.Time) error {
+	topStreams, err := twitchClient.GetStreams(ctx, twitch.StreamsQueryParams{Limit: twitch.MaxStreamQueryLimit})
+	if err != nil {
+		return err
+	}
+
+	var openSessions []LiveSession
+	if err := tx.Where("ended_at IS NULL").Find(&openSessions).Error; err != nil {
+		return err
+	}
+
+	live := make(map[string]twitch.Stream, len(topStreams.Data))
+	for _, stream := range topStreams.Data {
+		live[stream.UserID] = stream
+	}
+
+	watched, err := digestWatchedBroadcasters(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	// Channels that fell out of the top list are not necessarily offline, so check them by ID
+	var unseen []string
+	for _, session := range openSessions {
+		if _, ok := live[session.BroadcasterID]; !ok {
+			unseen = append(unseen, session.BroadcasterID)
+		}
+	}
+	for _, broadcasterID := range watched {
+		if _, ok := live[broadcasterID]; !ok && !containsString(unseen, broadcasterID) {
+			unseen = append(unseen, broadcasterID)
+		}
+	}
+	streams, err := getStreamsByUserIDs(ctx, twitchClient, unseen)
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		live[stream.UserID] = stream
+	}
+
+	open := make(map[string]*LiveSession, len(openSessions))
+	for i := range openSessions {
+		session := &openSessions[i]
+		stream, isLive := live[session.BroadcasterID]
+		if isLive && stream.ID == session.StreamID {
+			open[session.BroadcasterID] = session
+			continue
+		}
+
+		// Offline, or restarted with a new stream ID: close the old session
+		endedAt := session.LastSeenAt
+		session.EndedAt = &endedAt
+		if err := tx.Save(session).Error; err != nil {
+			return err
+		}
+	}
+
+	for userID, stream := range live {
+		session, exists := open[userID]
+		if !exists {
+			session = newLiveSession(stream, now)
+		}
+		session.LastSeenAt = now
+		session.BroadcasterLogin = stream.UserLogin
+		if stream.ViewerCount > session.PeakViewers {
+			session.PeakViewers = stream.ViewerCount
+		}
+		if stream.GameName != "" && !containsString(session.Categories, stream.GameName) {
+			session.Categories = append(session.Categories, stream.GameName)
+		}
+		if err := tx.Save(session).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newLiveSession creates an open session for a stream, preferring Twitch's own start time
+func newLiveSession(stream twitch.Stream, now time.Time) *LiveSession {
+	startedAt, err := time.Parse(time.RFC3339, stream.StartedAt)
+	if err != nil {
+		startedAt = now
+	}
+	return &LiveSession{
+		BroadcasterID:    stream.UserID,
+		BroadcasterLogin: stream.UserLogin,
+		StreamID:         stream.ID,
+		StartedAt:        startedAt.UTC(),
+	}
+}
+
+// getStreamsByUserIDs fetches live streams for the given broadcasters in batches of 100
+func getStreamsByUserIDs(ctx context.Context, twitchClient twitch.Client, userIDs []string) ([]twitch.Stream, error) {
+	var streams []twitch.Stream
+	for start := 0; start < len(userIDs); start += twitch.MaxStreamUserIDs {
+		end := start + twitch.MaxStreamUserIDs
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+
+		resp, err := twitchClient.GetStreams(ctx, twitch.StreamsQueryParams{
+			Limit:   twitch.MaxStreamQueryLimit,
+			UserIDs: userIDs[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, resp.Data...)
+	}
+	return streams, nil
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
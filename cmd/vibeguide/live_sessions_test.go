@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPollLiveSessions_SkipsWhenLockHeld(t *testing.T) {
+	_, db, mock := DbMock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(liveSessionLockKey).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_xact_lock"}).AddRow(false))
+	mock.ExpectCommit()
+
+	// Any Twitch call fails, so the poll must not reach the client when another instance holds the lock
+	client := &mockTwitchClient{shouldErr: true, errMsg: "unexpected Twitch call"}
+	if err := pollLiveSessions(context.Background(), db, client, time.Now().UTC()); err != nil {
+		t.Fatalf("Expected skipped poll to succeed, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet SQL expectations: %v", err)
+	}
+}
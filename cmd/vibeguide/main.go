@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
 	"fmt"
 	_ "image/gif"
 	_ "image/png"
@@ -9,15 +12,22 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httplog/v2"
 	"github.com/go-chi/render"
+	"github.com/rs/zerolog"
+	"github.com/site-tech/VibeGuide/pkg/classifier"
+	"github.com/site-tech/VibeGuide/pkg/health"
 	"github.com/site-tech/VibeGuide/pkg/logger"
+	"github.com/site-tech/VibeGuide/pkg/mailer"
 	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/oauthstate"
+	"github.com/site-tech/VibeGuide/pkg/ratelimit"
+	"github.com/site-tech/VibeGuide/pkg/supajwt"
 	"github.com/site-tech/VibeGuide/pkg/twitch"
 	"github.com/supabase-community/supabase-go"
 	"gorm.io/gorm"
@@ -34,66 +44,6 @@ type apiVersionCtx string
 
 var apivctx apiVersionCtx = "api.version"
 
-var Config *VibeConfig
-
-type VibeConfig struct {
-	// Basic Fields
-	Port   string
-	LogLvl string
-
-	// Twitch API Credentials
-	TwitchClientID     string
-	TwitchClientSecret string
-	// Database Fields
-	DbURL     string
-	DbName    string
-	DbPort    string
-	DbUser    string
-	DbPass    string
-	DbMigrate bool
-	// Supabase Vars
-	SupabaseApiUrl string
-	SupabaseApiKey string
-}
-
-func loadConfig() (*VibeConfig, error) {
-	newConfig := VibeConfig{}
-	var err error
-
-	// Load vars from env
-	newConfig.Port = os.Getenv("PORT")
-	newConfig.LogLvl = os.Getenv("LOGLVL")
-
-	// Load Twitch API credentials
-	newConfig.TwitchClientID = os.Getenv("TWITCH_CLIENT_ID")
-	newConfig.TwitchClientSecret = os.Getenv("TWITCH_CLIENT_SECRET")
-
-	// Validate required Twitch credentials
-	if newConfig.TwitchClientID == "" {
-		return nil, fmt.Errorf("TWITCH_CLIENT_ID environment variable is required")
-	}
-	if newConfig.TwitchClientSecret == "" {
-		return nil, fmt.Errorf("TWITCH_CLIENT_SECRET environment variable is required")
-	}
-
-	Config = &newConfig
-	newConfig.DbURL = getEnv("DBURL", "localhost")
-	newConfig.DbName = getEnv("DBNAME", "")
-	newConfig.DbPort = getEnv("DBPORT", "5432")
-	newConfig.DbUser = getEnv("DBUSER", "")
-	newConfig.DbPass = os.Getenv("DBPASS")
-	newConfig.SupabaseApiUrl = getEnv("SB_API_URL", "http://host.docker.internal:54321")
-	newConfig.SupabaseApiKey = getEnv("SB_API_KEY", "")
-
-	newConfig.DbMigrate, err = getEnvAsBool("DBMIGRATE", false)
-	if err != nil {
-		return nil, err
-	}
-
-	Config = &newConfig
-	return &newConfig, nil
-}
-
 func main() {
 	if err := run(); err != nil {
 		zlog.Fatal().Err(err)
@@ -104,17 +54,25 @@ func run() (err error) {
 	zlog.Info().Msg("VibeGuide Backend Service")
 
 	zlog.Info().Msg("loading config...")
-	config, err := loadConfig()
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
 	if err != nil {
 		zlog.Error().Msg(fmt.Sprintf("getConfig err: %v\n", err))
 		return
 	}
+	zerolog.SetGlobalLevel(config.logLevel)
+	if err := twitch.SetLimits(config.twitchLimits()); err != nil {
+		return err
+	}
 	zlog.Info().Msg("config loaded")
 
 	// Handle SIGINT (CTRL+C) gracefully
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	// VibeConfig.String redacts secrets
 	zlog.Info().Msg(fmt.Sprintf("vibe config: %+v\n", config))
 
 	// Initialize Twitch client
@@ -136,6 +94,40 @@ func run() (err error) {
 
 	zlog.Info().Msg("Twitch client initialized and tested successfully")
 
+	if config.ClassifierRulesFile != "" {
+		streamClassifier, err = classifier.NewFromFile(config.ClassifierRulesFile)
+		if err != nil {
+			return fmt.Errorf("failed to load classifier rules: %w", err)
+		}
+		zlog.Info().Msgf("classifier rules loaded from %s", config.ClassifierRulesFile)
+	}
+
+	if len(config.SafeModeLabels) > 0 {
+		safeModeLabels = config.SafeModeLabels
+	}
+
+	if config.ChatEnabled {
+		opts := twitch.ChatReaderOptions{MaxChannels: int(config.ChatMaxChannels)}
+		if config.ChatToken != "" {
+			opts.Login = config.ChatLogin
+			opts.Token = func(context.Context) (string, error) { return config.ChatToken, nil }
+		}
+		chatReader = twitch.NewChatReader(opts)
+		go func() {
+			if err := chatReader.Run(ctx); err != nil && ctx.Err() == nil {
+				zlog.Error().Err(err).Msg("Chat reader stopped")
+			}
+		}()
+		workerHeartbeats.Register(workerChatPool, config.ChatPoolInterval)
+		go startChatPool(ctx, twitchClient, chatReader, int(config.ChatMaxChannels), config.ChatPoolInterval)
+		zlog.Info().Msg("Chat reader started")
+	}
+
+	setAnomalyPolicy(AnomalyPolicy{Action: config.AnomalyAction, Reasons: []string{}})
+	workerHeartbeats.Register(workerAnomalyMonitor, config.AnomalyPollInterval)
+	go startAnomalyMonitor(ctx, twitchClient, config.AnomalyPollInterval)
+	zlog.Info().Msg("Anomaly monitor started")
+
 	// Start cache cleanup goroutine
 	go startCacheCleanup(ctx)
 	zlog.Info().Msg("Cache cleanup goroutine started")
@@ -165,6 +157,65 @@ func run() (err error) {
 		zlog.Info().Msg("db migrated")
 	}
 
+	// Session tracking and schedule inference need somewhere to store history
+	if DB != nil {
+		if err := loadAnomalyPolicy(ctx, DB); err != nil {
+			zlog.Error().Err(err).Msg("Failed to load anomaly policy, using ANOMALY_ACTION")
+		}
+		go startAnomalyPolicyRefresh(ctx, anomalyPolicyRefreshInterval)
+		if err := reloadBlocklist(ctx, DB); err != nil {
+			return fmt.Errorf("failed to load blocklist: %w", err)
+		}
+		go startBlocklistRefresh(ctx, blocklistRefreshInterval)
+
+		if config.twitchTokenKeys != nil {
+			twitchTokenKeys = config.twitchTokenKeys
+			workerHeartbeats.Register(workerTwitchTokens, config.TwitchTokenCheckInterval)
+			go startTwitchTokenMaintenance(ctx, twitchClient, config.TwitchTokenCheckInterval)
+			zlog.Info().Msg("Twitch token vault enabled")
+		} else {
+			zlog.Warn().Msg("TWITCH_TOKEN_KEYS not set, Twitch follows and digests disabled")
+		}
+		if config.SessionCookies {
+			sessionCookies = true
+			zlog.Info().Msg("Cookie session mode enabled")
+		}
+
+		workerHeartbeats.Register(workerLiveSessions, config.LivePollInterval)
+		go startLiveSessionTracker(ctx, twitchClient, config.LivePollInterval)
+		workerHeartbeats.Register(workerScheduleInference, config.ScheduleInferInterval)
+		go startScheduleInference(ctx, config.ScheduleInferInterval)
+		zlog.Info().Msg("Live session tracker and schedule inference started")
+
+		notifiers, err := buildNotifiers(config)
+		if err != nil {
+			return err
+		}
+		// Alerts and digests, like the API routes, never surface blocked content
+		dispatcher := NewAlertDispatcher(DB, twitch.NewFilteredClient(twitchClient, contentBlocklist), notifiers, config.AlertPollInterval)
+		workerHeartbeats.Register(workerAlertDispatcher, config.AlertPollInterval)
+		go dispatcher.Run(ctx)
+		zlog.Info().Msg("Alert dispatcher started")
+
+		if config.SMTPHost != "" {
+			digestMailer, err := mailer.NewSMTPMailer(mailer.SMTPConfig{
+				Host:     config.SMTPHost,
+				Port:     int(config.SMTPPort),
+				Username: config.SMTPUsername,
+				Password: config.SMTPPassword,
+				From:     config.SMTPFrom,
+			})
+			if err != nil {
+				return err
+			}
+			workerHeartbeats.Register(workerDigest, config.DigestInterval)
+			go startDigestJob(ctx, digestMailer, contentBlocklist, config.DigestInterval)
+			zlog.Info().Msg("Digest job started")
+		} else {
+			zlog.Warn().Msg("SMTP_HOST not set, weekly digest disabled")
+		}
+	}
+
 	zlog.Info().Msg("creating supabase client...")
 	// Setup Supabase Auth Client
 	supabaseClient, err := supabase.NewClient(config.SupabaseApiUrl, config.SupabaseApiKey,
@@ -175,10 +226,56 @@ func run() (err error) {
 		return
 	}
 	SBClient = supabaseClient
+	gotrueURL = strings.TrimSuffix(config.SupabaseApiUrl, "/") + "/auth/v1"
 	zlog.Info().Msg("supabase client created.")
 
+	tokenVerifier, err = supajwt.NewVerifier(supajwt.Config{
+		Secret:   []byte(config.SupabaseJWTSecret),
+		JWKSURL:  config.SupabaseJWKSURL,
+		Issuer:   config.SupabaseJWTIssuer,
+		Audience: config.SupabaseJWTAudience,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create token verifier: %w", err)
+	}
+
+	stateKey := []byte(config.OAuthStateSecret)
+	if len(stateKey) == 0 {
+		zlog.Warn().Msg("OAUTH_STATE_SECRET not set, Twitch logins must complete on the instance that started them")
+		stateKey = make([]byte, 32)
+		if _, err := rand.Read(stateKey); err != nil {
+			return fmt.Errorf("failed to generate OAuth state key: %w", err)
+		}
+	}
+	oauthStates, err = oauthstate.NewSigner(stateKey, oauthstate.DefaultTTL, newOAuthNonceStore(DB))
+	if err != nil {
+		return fmt.Errorf("OAUTH_STATE_SECRET: %w", err)
+	}
+	deviceLogins = newDeviceLoginStore(DB)
+
+	corsHandler, err := newCORSMiddleware(config)
+	if err != nil {
+		return err
+	}
+	var rateLimitStore ratelimit.Store
+	if config.RateLimitStore == rateLimitStorePostgres {
+		if DB == nil {
+			return fmt.Errorf("RATE_LIMIT_STORE=postgres requires a database")
+		}
+		rateLimitStore = &postgresRateLimitStore{db: DB}
+	} else {
+		rateLimitMemory = ratelimit.NewMemoryStore()
+		rateLimitStore = rateLimitMemory
+	}
+	rateLimitHandler, err := newRateLimitMiddleware(config, rateLimitStore)
+	if err != nil {
+		return err
+	}
+
 	zlog.Info().Msg("building router...")
-	router := routes(twitchClient)
+	// API routes only ever see streams and categories the blocklist allows
+	readiness := newReadinessChecker(twitchClient, config)
+	router := routes(twitch.NewFilteredClient(twitchClient, contentBlocklist), corsHandler, rateLimitHandler, readiness)
 	zlog.Info().Msg("router built")
 
 	// Build HTTP server
@@ -216,17 +313,18 @@ func run() (err error) {
 
 // ============= ROUTER =============
 
-func routes(twitchClient twitch.Client) *chi.Mux {
+func routes(twitchClient twitch.Client, corsHandler, rateLimitHandler func(http.Handler) http.Handler, readiness *health.Checker) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Use(render.SetContentType(render.ContentTypeJSON),
 		middleware.RedirectSlashes,
 		middleware.RequestID,
+		// Ahead of Heartbeat, which answers without calling the rest of the chain
+		corsHandler,
 		middleware.Heartbeat("/v1/heartbeat"),
 		httplog.RequestLogger(logger.NewRouterLogger()),
 		render.SetContentType(render.ContentTypeJSON),
 		middleware.Recoverer,
-		corsMiddleware(),
 	)
 
 	r.Use(middleware.Timeout(45 * time.Second)) // Increased for potentially slower HEIC decoding
@@ -239,27 +337,53 @@ func routes(twitchClient twitch.Client) *chi.Mux {
 		logger.WriteErrCheck(w.Write([]byte("pong")))
 	})
 
+	// Liveness and readiness probes
+	r.Get("/healthz", healthz)
+	r.Get("/readyz", readyz(readiness))
+
 	r.Route("/v1", func(r chi.Router) {
 		r.Use(apiVersionContext("v1"))
 		r.Use(twitchClientContext(twitchClient))
+		r.Use(CookieSession)
+		r.Use(VerifyBearer)
+		r.Use(APIKeyAuth)
+		r.Use(rateLimitHandler)
+		r.Use(RejectInvalidAPIKey)
 		r.Get("/test", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			render.JSON(w, r, map[string]string{"message": "getTest"})
 		})
 		// CRUD API Routes
-		r.Mount("/vibe", vibeRouter())
+		r.Mount("/vibe", vibeRouter(twitchClient))
 		// Auth Routes
 		r.Mount("/auth", authRouter())
 		// Twitch API Routes
 		r.Mount("/twitch", twitchRouter(twitchClient))
+		// Go-live Alert Routes
+		r.Mount("/alerts", alertsRouter())
+		// Weekly Email Digest Routes
+		r.Mount("/digest", digestRouter(twitchClient))
+		// Personal Guide Lineup Routes
+		r.Mount("/lineups", lineupsRouter(twitchClient))
+		// Vibe Classifier Routes
+		r.Mount("/classifier", classifierRouter())
+		// User Settings Routes
+		r.Mount("/users", usersRouter())
+		// Admin Moderation Routes
+		r.Mount("/admin", adminRouter())
 	})
 
 	return r
 }
 
-func vibeRouter() http.Handler {
+func vibeRouter(twitchClient twitch.Client) http.Handler {
 	r := chi.NewRouter()
-	r.Post("/", demoHandler)
+	r.Get("/", listVibes)
+	r.Post("/", createVibe)
+	r.Get("/{id}", getVibe)
+	r.Put("/{id}", updateVibe)
+	r.Delete("/{id}", deleteVibe)
+	r.Get("/{id}/streams", getVibeStreamsHandler(twitchClient))
 
 	return r
 }
@@ -271,23 +395,25 @@ func authRouter() http.Handler {
 	r.Post("/login", loginUser)
 	r.Post("/logout", logoutUser)
 	r.Get("/user", getUserAuth)
+	r.Put("/user", updateUserAuth)
+	r.Post("/refresh", refreshSession)
+	r.Post("/recover", recoverPassword)
+	r.Post("/verify", verifyOTP)
+	r.Post("/magiclink", sendMagicLink)
+	r.Post("/otp", sendOTP)
+	r.Get("/session", getCookieSession)
 
 	// Twitch OAuth
 	r.Get("/twitch/url", getTwitchAuthURL)
 	r.Post("/twitch/callback", twitchCallback)
 	r.Get("/twitch/validate", validateTwitchToken)
+	r.Post("/twitch/token", storeTwitchProviderToken)
+	r.Post("/twitch/device", startTwitchDeviceLogin)
+	r.Post("/twitch/device/poll", pollTwitchDeviceLogin)
 
 	return r
 }
 
-func demoHandler(w http.ResponseWriter, r *http.Request) {
-	tId := middleware.GetReqID(r.Context())
-	apiVersion := r.Context().Value(apivctx).(string)
-	zlog.Info().Msgf("(%s) demoHandler: %v", tId, apiVersion)
-
-	zlog.Info().Msgf("(%s) demoHandler done", tId)
-}
-
 // ======== ROUTER HELPERS ========
 
 func handleErr(w http.ResponseWriter, r *http.Request, err error, code int) {
@@ -328,68 +454,6 @@ func twitchClientContext(twitchClient twitch.Client) func(next http.Handler) htt
 	}
 }
 
-func corsMiddleware() func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Allow requests from frontend
-			origin := r.Header.Get("Origin")
-			if origin == "" {
-				origin = "*"
-			}
-
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token, X-Twitch-Token")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Max-Age", "300")
-
-			// Handle preflight requests
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusNoContent)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// --- Helper Functions for Robust Env Var Parsing ---
-
-// getEnv retrieves an environment variable or returns a fallback value.
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
-	}
-	return fallback
-}
-
-// getEnvAsUint retrieves and parses an environment variable as a uint or returns a fallback.
-func getEnvAsUint(key string, fallback uint) (uint, error) {
-	strVal := os.Getenv(key)
-	if strVal == "" {
-		return fallback, nil
-	}
-	val, err := strconv.ParseUint(strVal, 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("could not parse env var %s: %w", key, err)
-	}
-	return uint(val), nil
-}
-
-// getEnvAsBool retrieves and parses an environment variable as a bool or returns a fallback.
-func getEnvAsBool(key string, fallback bool) (bool, error) {
-	strVal := os.Getenv(key)
-	if strVal == "" {
-		return fallback, nil
-	}
-	val, err := strconv.ParseBool(strVal)
-	if err != nil {
-		return false, fmt.Errorf("could not parse env var %s: %w", key, err)
-	}
-	return val, nil
-}
-
 // startCacheCleanup starts a goroutine that periodically cleans expired cache entries
 func startCacheCleanup(ctx context.Context) {
 	ticker := time.NewTicker(10 * time.Minute) // Clean every 10 minutes
@@ -402,7 +466,26 @@ func startCacheCleanup(ctx context.Context) {
 			return
 		case <-ticker.C:
 			cleanupFollowsCache()
-			zlog.Debug().Msg("Follows cache cleanup completed")
+			channelLabels.Clear()
+			if oauthNonceMemory != nil {
+				oauthNonceMemory.Sweep(time.Now())
+			} else if DB != nil {
+				sweepOAuthNonces(ctx, DB, time.Now())
+			}
+			if deviceLoginMemory != nil {
+				deviceLoginMemory.sweep(time.Now())
+			} else if DB != nil {
+				sweepDeviceLogins(ctx, DB, time.Now())
+			}
+			if rateLimitMemory != nil {
+				rateLimitMemory.Sweep(time.Now())
+			} else if DB != nil {
+				sweepRateLimitCounters(ctx, DB, time.Now())
+			}
+			if sessionCookies && DB != nil {
+				sweepSessions(ctx, DB, time.Now())
+			}
+			zlog.Debug().Msg("Follows and content label cache cleanup completed")
 		}
 	}
 }
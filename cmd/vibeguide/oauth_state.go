@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/site-tech/VibeGuide/pkg/oauthstate"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// oauthSessionCookie binds a Twitch login to the browser that started it
+const oauthSessionCookie = "vg_oauth_session"
+
+// twitchLoginScopes are requested by every Twitch login flow
+var twitchLoginScopes = []string{"user:read:email", "user:read:follows"}
+
+// oauthNonceMemory holds the nonces of outstanding Twitch logins when there is no database, in
+// which case the callback must reach the instance that started the login. Swept by startCacheCleanup.
+var oauthNonceMemory *oauthstate.MemoryNonceStore
+
+// OAuthNonce is an outstanding Twitch login, so a callback landing on any instance can be verified
+type OAuthNonce struct {
+	Nonce     string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (OAuthNonce) TableName() string { return "oauth_nonces" }
+
+// postgresNonceStore shares OAuth nonces between instances through Postgres
+type postgresNonceStore struct {
+	db *gorm.DB
+}
+
+func (s *postgresNonceStore) Put(nonce string, expiresAt time.Time) error {
+	return s.db.Create(&OAuthNonce{Nonce: nonce, ExpiresAt: expiresAt}).Error
+}
+
+// Consume deletes the nonce in one statement, so concurrent callbacks can't both use it
+func (s *postgresNonceStore) Consume(nonce string, now time.Time) (bool, error) {
+	var consumed []OAuthNonce
+	err := s.db.Raw(`DELETE FROM oauth_nonces WHERE nonce = ? RETURNING nonce, expires_at`, nonce).Scan(&consumed).Error
+	if err != nil {
+		return false, err
+	}
+	return len(consumed) == 1 && !now.After(consumed[0].ExpiresAt), nil
+}
+
+// sweepOAuthNonces deletes nonces of abandoned logins from the Postgres store
+func sweepOAuthNonces(ctx context.Context, db *gorm.DB, now time.Time) {
+	if err := db.WithContext(ctx).Where("expires_at < ?", now).Delete(&OAuthNonce{}).Error; err != nil {
+		zlog.Error().Err(err).Msg("Failed to sweep OAuth nonces")
+	}
+}
+
+// newOAuthNonceStore keeps nonces in Postgres when there is a database, otherwise in memory
+func newOAuthNonceStore(db *gorm.DB) oauthstate.NonceStore {
+	if db != nil {
+		return &postgresNonceStore{db: db}
+	}
+	zlog.Warn().Msg("No database, OAuth nonces kept in memory: Twitch logins must complete on the instance that started them")
+	oauthNonceMemory = oauthstate.NewMemoryNonceStore()
+	return oauthNonceMemory
+}
+
+// oauthStates signs and verifies the Twitch OAuth state. Created in run().
+var oauthStates *oauthstate.Signer
+
+// oauthSession returns the browser's OAuth session ID, setting the cookie if it has none yet
+func oauthSession(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(oauthSessionCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	id, err := oauthstate.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthSessionCookie,
+		Value:    id,
+		Path:     "/v1/auth/twitch",
+		MaxAge:   int(oauthstate.DefaultTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		// The frontend calls the callback cross-site with credentials
+		SameSite: http.SameSiteNoneMode,
+	})
+	return id, nil
+}
+
+// allowedRedirectURI reports whether uri is on the TWITCH_REDIRECT_URIS allowlist. Matching is
+// exact, so no prefix or wildcard tricks can turn the flow into an open redirect.
+func allowedRedirectURI(uri string) bool {
+	return Config != nil && slices.Contains(Config.TwitchRedirectURIs, uri)
+}
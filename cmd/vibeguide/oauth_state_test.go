@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/site-tech/VibeGuide/pkg/oauthstate"
+)
+
+const testRedirectURI = "http://localhost:5173/auth/twitch/callback"
+
+func setupAuthTestRouter(t *testing.T) *chi.Mux {
+	t.Helper()
+	signer, err := oauthstate.NewSigner(bytes.Repeat([]byte{1}, 32), oauthstate.DefaultTTL, oauthstate.NewMemoryNonceStore())
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	origStates, origConfig := oauthStates, Config
+	oauthStates = signer
+	Config = &VibeConfig{TwitchRedirectURIs: []string{testRedirectURI}}
+	t.Cleanup(func() { oauthStates, Config = origStates, origConfig })
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(twitchClientContext(&mockTwitchClient{}))
+	r.Mount("/auth", authRouter())
+	return r
+}
+
+// startTwitchLogin requests an authorization URL and returns the minted state and session cookie
+func startTwitchLogin(t *testing.T, r *chi.Mux) (string, *http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/auth/twitch/url?redirect_uri="+url.QueryEscape(testRedirectURI), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oauthSessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly session cookie, got %+v", cookies)
+	}
+	authURL, _ := url.Parse(response.Data["auth_url"])
+	if authURL.Query().Get("state") != response.Data["state"] {
+		t.Errorf("Expected the minted state in the auth URL")
+	}
+	return response.Data["state"], cookies[0]
+}
+
+func twitchCallbackRequest(state string, cookie *http.Cookie) *http.Request {
+	query := url.Values{"code": {"abc"}, "state": {state}, "redirect_uri": {testRedirectURI}}
+	req := httptest.NewRequest("POST", "/auth/twitch/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestGetTwitchAuthURL_RedirectAllowlist(t *testing.T) {
+	r := setupAuthTestRouter(t)
+
+	for _, redirect := range []string{"https://evil.example/cb", testRedirectURI + "/../x", "http://localhost:5173"} {
+		req := httptest.NewRequest("GET", "/auth/twitch/url?redirect_uri="+url.QueryEscape(redirect), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", redirect, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestTwitchCallback_VerifiesState(t *testing.T) {
+	r := setupAuthTestRouter(t)
+	fake, _ := withFakeGoTrue(t)
+	state, cookie := startTwitchLogin(t, r)
+
+	// The valid callback signs in through the Twitch account's existing link
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+	mock.ExpectQuery(`SELECT \* FROM "twitch_accounts" WHERE twitch_user_id = \$1`).
+		WithArgs("test_user", 1).
+		WillReturnRows(twitchAccountRows().AddRow(1, "test_user", "test_login", testSupabaseUserID, "viewer@example.com"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "twitch_accounts"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"no session cookie", twitchCallbackRequest(state, nil), http.StatusBadRequest},
+		{"other browser", twitchCallbackRequest(state, &http.Cookie{Name: oauthSessionCookie, Value: "someone-else"}), http.StatusBadRequest},
+		{"client chosen state", twitchCallbackRequest("xyz", cookie), http.StatusBadRequest},
+		{"valid", twitchCallbackRequest(state, cookie), http.StatusOK},
+		{"replayed", twitchCallbackRequest(state, cookie), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, tt.req)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status code %d, got %d: %s", tt.name, tt.status, w.Code, w.Body.String())
+		}
+	}
+
+	if _, ok := fake.requests["PUT /admin/users/"+testSupabaseUserID]; !ok {
+		t.Errorf("Expected the linked user's twitch metadata updated")
+	}
+	if body := fake.requests["POST /admin/generate_link"]; body["email"] != "viewer@example.com" {
+		t.Errorf("Expected a sign-in link for the linked user, got %v", body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresNonceStore(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	store := &postgresNonceStore{db: gormdb}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "oauth_nonces" \("nonce","expires_at"\) VALUES \(\$1,\$2\)`).
+		WithArgs("n1", now.Add(oauthstate.DefaultTTL)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := store.Put("n1", now.Add(oauthstate.DefaultTTL)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	consume := `DELETE FROM oauth_nonces WHERE nonce = \$1 RETURNING nonce, expires_at`
+	mock.ExpectQuery(consume).WithArgs("n1").
+		WillReturnRows(sqlmock.NewRows([]string{"nonce", "expires_at"}).AddRow("n1", now.Add(oauthstate.DefaultTTL)))
+	if fresh, err := store.Consume("n1", now); err != nil || !fresh {
+		t.Errorf("Expected the nonce consumed, got %t, %v", fresh, err)
+	}
+
+	// Already used, e.g. by a callback on another instance
+	mock.ExpectQuery(consume).WithArgs("n1").
+		WillReturnRows(sqlmock.NewRows([]string{"nonce", "expires_at"}))
+	if fresh, err := store.Consume("n1", now); err != nil || fresh {
+		t.Errorf("Expected a replay to be rejected, got %t, %v", fresh, err)
+	}
+
+	mock.ExpectQuery(consume).WithArgs("n2").
+		WillReturnRows(sqlmock.NewRows([]string{"nonce", "expires_at"}).AddRow("n2", now.Add(-time.Second)))
+	if fresh, err := store.Consume("n2", now); err != nil || fresh {
+		t.Errorf("Expected an expired nonce to be rejected, got %t, %v", fresh, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
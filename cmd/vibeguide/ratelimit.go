@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/ratelimit"
+	"github.com/site-tech/VibeGuide/pkg/supajwt"
+	"gorm.io/gorm"
+)
+
+// Rate limit stores (RATE_LIMIT_STORE)
+const (
+	rateLimitStoreMemory   = "memory"
+	rateLimitStorePostgres = "postgres"
+)
+
+// defaultRateLimitRoutes are the built-in per-route quotas, tighter where a request costs us
+// Helix budget or an auth email. RATE_LIMIT_ROUTES entries replace or add to them.
+var defaultRateLimitRoutes = map[string]string{
+	"/v1/twitch": "60/1m",
+	"/v1/vibe":   "60/1m",
+	"/v1/auth":   "30/1m",
+}
+
+// RateLimitCounter is one client's request count in one window, for the Postgres store
+type RateLimitCounter struct {
+	Key         string    `gorm:"primaryKey"`
+	WindowStart time.Time `gorm:"primaryKey"`
+	Count       int
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+// postgresRateLimitStore shares counters between instances through Postgres
+type postgresRateLimitStore struct {
+	db *gorm.DB
+}
+
+func (s *postgresRateLimitStore) Incr(ctx context.Context, key string, windowStart, expiresAt time.Time) (int, error) {
+	var count int
+	err := s.db.WithContext(ctx).Raw(`INSERT INTO rate_limit_counters (key, window_start, count, expires_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limit_counters.count + 1
+		RETURNING count`, key, windowStart, expiresAt).Scan(&count).Error
+	return count, err
+}
+
+// sweepRateLimitCounters deletes counters of ended windows from the Postgres store
+func sweepRateLimitCounters(ctx context.Context, db *gorm.DB, now time.Time) {
+	if err := db.WithContext(ctx).Where("expires_at < ?", now).Delete(&RateLimitCounter{}).Error; err != nil {
+		zlog.Error().Err(err).Msg("Failed to sweep rate limit counters")
+	}
+}
+
+// rateLimitMemory is the in-memory counter store, when used. Swept by startCacheCleanup.
+var rateLimitMemory *ratelimit.MemoryStore
+
+// rateLimitRoute is the quota for requests under a path prefix
+type rateLimitRoute struct {
+	prefix string
+	quota  ratelimit.Quota
+}
+
+// rateLimitRoutes merges RATE_LIMIT_ROUTES over the defaults, longest prefix first
+func rateLimitRoutes(entries []string) ([]rateLimitRoute, error) {
+	quotas := map[string]string{}
+	for prefix, q := range defaultRateLimitRoutes {
+		quotas[prefix] = q
+	}
+	for _, entry := range entries {
+		prefix, q, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("RATE_LIMIT_ROUTES: invalid entry %q, expected /prefix=limit/window", entry)
+		}
+		quotas[strings.TrimSuffix(prefix, "/")] = q
+	}
+	var routes []rateLimitRoute
+	for prefix, q := range quotas {
+		parsed, err := ratelimit.ParseQuota(q)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_ROUTES %s: %w", prefix, err)
+		}
+		routes = append(routes, rateLimitRoute{prefix: prefix, quota: parsed})
+	}
+	slices.SortFunc(routes, func(a, b rateLimitRoute) int { return len(b.prefix) - len(a.prefix) })
+	return routes, nil
+}
+
+// newRateLimitMiddleware builds the rate limiter from the RATE_LIMIT* settings, which validate has
+// checked. Each client gets a bucket per route prefix, so a busy guide doesn't use up a client's
+// auth quota.
+func newRateLimitMiddleware(cfg *VibeConfig, store ratelimit.Store) (func(http.Handler) http.Handler, error) {
+	quota, err := ratelimit.ParseQuota(cfg.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT: %w", err)
+	}
+	ips, err := ratelimit.NewIPExtractor(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	routes, err := rateLimitRoutes(cfg.RateLimitRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := ratelimit.NewLimiter(store)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bucket, routeQuota := "default", quota
+			for _, route := range routes {
+				if r.URL.Path == route.prefix || strings.HasPrefix(r.URL.Path, route.prefix+"/") {
+					bucket, routeQuota = route.prefix, route.quota
+					break
+				}
+			}
+
+			identity := rateLimitIdentity(r, ips)
+			res, err := limiter.Allow(r.Context(), identity+"|"+bucket, routeQuota)
+			// API keys also have their own quota across all routes; report whichever is tighter
+			if key, ok := currentAPIKey(r); ok && err == nil && res.Allowed && key.Quota != "" {
+				if keyQuota, parseErr := ratelimit.ParseQuota(key.Quota); parseErr == nil {
+					var keyRes ratelimit.Result
+					keyRes, err = limiter.Allow(r.Context(), identity, keyQuota)
+					if !keyRes.Allowed || keyRes.Remaining < res.Remaining {
+						res = keyRes
+					}
+				}
+			}
+			if err != nil {
+				// Fail open: an unavailable store shouldn't take the API down with it
+				zlog.Error().Err(err).Msg("Rate limit store error")
+				next.ServeHTTP(w, r)
+				return
+			}
+			res.SetHeaders(w.Header())
+			if !res.Allowed {
+				handleRateLimited(w, r, res)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// rateLimitIdentity names the client a request counts against: its API key, else its verified
+// user, else its IP
+func rateLimitIdentity(r *http.Request, ips *ratelimit.IPExtractor) string {
+	if key, ok := currentAPIKey(r); ok {
+		return "key:" + strconv.FormatUint(uint64(key.ID), 10)
+	}
+	if claims, ok := r.Context().Value(claimsctx).(*supajwt.Claims); ok {
+		return "user:" + claims.Subject
+	}
+	return "ip:" + ips.ClientIP(r)
+}
+
+// handleRateLimited answers 429 in the API envelope
+func handleRateLimited(w http.ResponseWriter, r *http.Request, res ratelimit.Result) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion, _ := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	resp.Data = mytypes.APIError{
+		Code:    string(authErrRateLimited),
+		Message: fmt.Sprintf("rate limit of %d requests per %s exceeded, retry in %ds", res.Quota.Limit, res.Quota.Window, int(math.Ceil(res.Reset.Seconds()))),
+	}
+	zlog.Warn().
+		Str("transaction_id", tId).
+		Str("request_path", r.URL.Path).
+		Str("quota", res.Quota.String()).
+		Msg("Rate limited")
+	w.WriteHeader(http.StatusTooManyRequests)
+	render.JSON(w, r, resp)
+}
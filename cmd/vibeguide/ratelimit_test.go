@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/ratelimit"
+	"github.com/site-tech/VibeGuide/pkg/supajwt"
+)
+
+func setupRateLimitRouter(t *testing.T, cfg *VibeConfig) *chi.Mux {
+	t.Helper()
+	mw, err := newRateLimitMiddleware(cfg, ratelimit.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(mw)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.Get("/v1/twitch/streams", ok)
+	r.Get("/v1/lineups", ok)
+	return r
+}
+
+func TestRateLimit_PerRouteQuota(t *testing.T) {
+	r := setupRateLimitRouter(t, &VibeConfig{RateLimit: "5/1m", RateLimitRoutes: []string{"/v1/twitch=2/1m"}})
+
+	get := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("/v1/twitch/streams", "203.0.113.7:1000"); w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status code %d, got %d", i+1, http.StatusOK, w.Code)
+		}
+	}
+	w := get("/v1/twitch/streams", "203.0.113.7:1000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected RateLimit headers, got %v", w.Header())
+	}
+	var resp struct {
+		mytypes.APIHandlerResp
+		Data mytypes.APIError `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.Code != "rate_limited" || resp.ApiVersion != "v1" {
+		t.Errorf("Expected a rate_limited envelope, got %s", w.Body.String())
+	}
+
+	// Other routes and other clients have their own buckets
+	if w := get("/v1/lineups", "203.0.113.7:1000"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "5" {
+		t.Errorf("Expected the default quota on other routes, got %d %v", w.Code, w.Header())
+	}
+	if w := get("/v1/twitch/streams", "198.51.100.2:1000"); w.Code != http.StatusOK {
+		t.Errorf("Expected another client to be allowed, got %d", w.Code)
+	}
+}
+
+func TestRateLimitIdentity(t *testing.T) {
+	ips, _ := ratelimit.NewIPExtractor([]string{"10.0.0.0/8"})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.5:1000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if id := rateLimitIdentity(req, ips); id != "ip:203.0.113.7" {
+		t.Errorf("Expected the forwarded client IP, got %s", id)
+	}
+
+	claims := &supajwt.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: testSupabaseUserID}}
+	req = req.WithContext(context.WithValue(req.Context(), claimsctx, claims))
+	if id := rateLimitIdentity(req, ips); id != "user:"+testSupabaseUserID {
+		t.Errorf("Expected the user, got %s", id)
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), apikeyctx, &APIKey{ID: 9}))
+	if id := rateLimitIdentity(req, ips); id != "key:9" {
+		t.Errorf("Expected the API key, got %s", id)
+	}
+}
+
+func TestNewRateLimitMiddleware_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  VibeConfig
+	}{
+		{"bad default", VibeConfig{RateLimit: "lots"}},
+		{"bad route entry", VibeConfig{RateLimit: "10/1m", RateLimitRoutes: []string{"twitch=1/1m"}}},
+		{"bad route quota", VibeConfig{RateLimit: "10/1m", RateLimitRoutes: []string{"/v1/twitch=1"}}},
+		{"bad proxy", VibeConfig{RateLimit: "10/1m", TrustedProxies: []string{"lb"}}},
+	}
+	for _, tt := range tests {
+		if _, err := newRateLimitMiddleware(&tt.cfg, ratelimit.NewMemoryStore()); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestPostgresRateLimitStore_Incr(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`INSERT INTO rate_limit_counters .* ON CONFLICT \(key, window_start\) DO UPDATE SET count = rate_limit_counters.count \+ 1\s+RETURNING count`).
+		WithArgs("ip:1.2.3.4|default", start, start.Add(time.Minute)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	store := &postgresRateLimitStore{db: gormdb}
+	count, err := store.Incr(context.Background(), "ip:1.2.3.4|default", start, start.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected count 3, got %d", count)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
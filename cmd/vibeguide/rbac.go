@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+type authUserCtx string
+
+var authctx authUserCtx = "auth.user"
+
+// currentUser returns the local user Authenticate put in the request context
+func currentUser(r *http.Request) (*User, bool) {
+	user, ok := r.Context().Value(authctx).(*User)
+	return user, ok
+}
+
+// currentRole returns the role name of the authenticated user, or "" when there is none
+func currentRole(r *http.Request) string {
+	if user, ok := currentUser(r); ok {
+		return user.Role.Name
+	}
+	return ""
+}
+
+// Authenticate verifies the bearer token, maps the Supabase user to a local User row (created
+// on first sight) and puts it, with its role, into the request context
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sbUser, err := getAuthenticatedUser(r)
+		if err != nil {
+			handleErr(w, r, err, http.StatusUnauthorized)
+			return
+		}
+		if DB == nil {
+			handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+			return
+		}
+
+		user, err := ensureLocalUser(r.Context(), DB, sbUser.ID.String(), sbUser.Email)
+		if err != nil {
+			zlog.Error().Err(err).Msg("Failed to load local user")
+			handleErr(w, r, fmt.Errorf("failed to load user"), http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authctx, user)))
+	})
+}
+
+// requireAdmin guards operator-only endpoints: it authenticates the caller and only lets admins through
+func requireAdmin(next http.Handler) http.Handler {
+	return Authenticate(RequireRole(RoleAdmin)(next))
+}
+
+// RequireRole only lets through users with one of the given roles. It must run after Authenticate.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := currentUser(r); !ok {
+				handleErr(w, r, fmt.Errorf("authentication required"), http.StatusUnauthorized)
+				return
+			}
+			if !slices.Contains(roles, currentRole(r)) {
+				handleErr(w, r, fmt.Errorf("%s role required", roles[0]), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ensureLocalUser loads the local user for a Supabase user, creating it with the viewer role if
+// needed. ADMIN_USER_IDS is the source of truth for the admin role: listed users are promoted and
+// admins no longer listed are demoted to viewer, both on their next request.
+func ensureLocalUser(ctx context.Context, db *gorm.DB, supabaseUserID, email string) (*User, error) {
+	var user User
+	err := db.WithContext(ctx).Preload("Role").Where("supabase_user_id = ?", supabaseUserID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		viewer, err := findRole(ctx, db, RoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		user = User{SupabaseUserID: supabaseUserID, Email: email, RoleID: viewer.ID}
+		// A concurrent first request may have created the row already
+		err = db.WithContext(ctx).Omit("Role").Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "supabase_user_id"}},
+			// Matches the partial unique index on users
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "supabase_user_id <> ''"}}},
+			DoNothing:   true,
+		}).Create(&user).Error
+		if err != nil {
+			return nil, err
+		}
+		user = User{}
+		if err := db.WithContext(ctx).Preload("Role").Where("supabase_user_id = ?", supabaseUserID).First(&user).Error; err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	listed := Config != nil && slices.Contains(Config.AdminUserIDs, supabaseUserID)
+	if listed != (user.Role.Name == RoleAdmin) {
+		name := RoleViewer
+		if listed {
+			name = RoleAdmin
+		}
+		role, err := findRole(ctx, db, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.WithContext(ctx).Model(&user).Omit("Role").Update("role_id", role.ID).Error; err != nil {
+			return nil, err
+		}
+		zlog.Info().Str("supabase_user_id", supabaseUserID).Str("role", name).Msg("Role reconciled with ADMIN_USER_IDS")
+		user.RoleID, user.Role = role.ID, *role
+	}
+	return &user, nil
+}
+
+func findRole(ctx context.Context, db *gorm.DB, name string) (*Role, error) {
+	var role Role
+	if err := db.WithContext(ctx).Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, fmt.Errorf("role %q not found, has the database been migrated: %w", name, err)
+	}
+	return &role, nil
+}
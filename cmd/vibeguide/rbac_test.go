@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"gorm.io/gorm/schema"
+)
+
+func TestRequireRole(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.With(RequireRole(RoleAdmin)).Get("/admin", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		user     *User
+		expected int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"viewer", &User{Role: Role{Name: RoleViewer}}, http.StatusForbidden},
+		{"admin", &User{Role: Role{Name: RoleAdmin}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		if tt.user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), authctx, tt.user))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status code %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
+
+func TestEnsureLocalUser_CreatesOnFirstSight(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE supabase_user_id = \$1`).
+		WithArgs("sb-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "roles" WHERE name = \$1`).
+		WithArgs(RoleViewer, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, RoleViewer))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "users" .* ON CONFLICT \("supabase_user_id"\) WHERE supabase_user_id <> '' DO NOTHING`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE supabase_user_id = \$1`).
+		WithArgs("sb-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "supabase_user_id", "email", "role_id"}).AddRow(5, "sb-1", "a@example.com", 1))
+	mock.ExpectQuery(`SELECT \* FROM "roles" WHERE "roles"."id" = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, RoleViewer))
+
+	user, err := ensureLocalUser(context.Background(), gormdb, "sb-1", "a@example.com")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if user.ID != 5 || user.Role.Name != RoleViewer {
+		t.Errorf("Expected new viewer user 5, got %+v", user)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestEnsureLocalUser_ReconcilesAdminList(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origConfig := Config
+	Config = &VibeConfig{AdminUserIDs: []string{"sb-admin"}}
+	defer func() { Config = origConfig }()
+
+	expectUser := func(supabaseUserID string, roleID uint, roleName string) {
+		mock.ExpectQuery(`SELECT \* FROM "users" WHERE supabase_user_id = \$1`).
+			WithArgs(supabaseUserID, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "supabase_user_id", "role_id"}).AddRow(5, supabaseUserID, roleID))
+		mock.ExpectQuery(`SELECT \* FROM "roles" WHERE "roles"."id" = \$1`).
+			WithArgs(roleID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(roleID, roleName))
+	}
+	expectRoleChange := func(roleID uint, roleName string) {
+		mock.ExpectQuery(`SELECT \* FROM "roles" WHERE name = \$1`).
+			WithArgs(roleName, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(roleID, roleName))
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "users" SET "role_id"=\$1`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	// Listed viewer is promoted
+	expectUser("sb-admin", 1, RoleViewer)
+	expectRoleChange(2, RoleAdmin)
+	user, err := ensureLocalUser(context.Background(), gormdb, "sb-admin", "")
+	if err != nil || user.Role.Name != RoleAdmin {
+		t.Errorf("Expected the listed user promoted, got %+v, %v", user, err)
+	}
+
+	// Admin removed from the list is demoted
+	expectUser("sb-former", 2, RoleAdmin)
+	expectRoleChange(1, RoleViewer)
+	user, err = ensureLocalUser(context.Background(), gormdb, "sb-former", "")
+	if err != nil || user.Role.Name != RoleViewer {
+		t.Errorf("Expected the unlisted admin demoted, got %+v, %v", user, err)
+	}
+
+	// Roles already in line are left alone
+	expectUser("sb-admin", 2, RoleAdmin)
+	if _, err := ensureLocalUser(context.Background(), gormdb, "sb-admin", ""); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestUserSupabaseIDIndex_IsPartial(t *testing.T) {
+	// A full unique index can't be built on a users table whose existing rows are all empty
+	s, err := schema.Parse(&User{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("Failed to parse User: %v", err)
+	}
+	for _, idx := range s.ParseIndexes() {
+		if idx.Name == "idx_users_supabase_user_id" {
+			if idx.Class != "UNIQUE" || idx.Where != "supabase_user_id <> ''" {
+				t.Errorf("Expected a unique index on non-empty IDs, got %s where %q", idx.Class, idx.Where)
+			}
+			return
+		}
+	}
+	t.Error("Expected an index on supabase_user_id")
+}
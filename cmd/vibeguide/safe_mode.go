@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// contentLabelTTL is how long a channel's classification labels are cached
+const contentLabelTTL = 15 * time.Minute
+
+// safeModeLabels are the content classification labels safe mode excludes. Replaced in run()
+// from SAFE_MODE_LABELS.
+var safeModeLabels = []string{
+	twitch.LabelSexualThemes,
+	twitch.LabelGambling,
+	twitch.LabelDrugsIntoxication,
+	twitch.LabelViolentGraphic,
+}
+
+// ViewingPreference holds a user's server-side viewing defaults, so shared TVs signed in to
+// the same account behave the same way
+type ViewingPreference struct {
+	ID             uint      `gorm:"primarykey" json:"-"`
+	CreatedAt      time.Time `json:"-"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	SupabaseUserID string    `gorm:"uniqueIndex" json:"-"`
+	SafeMode       bool      `json:"safe_mode"`
+}
+
+type cachedLabels struct {
+	labels    []string
+	fetchedAt time.Time
+}
+
+// ContentLabelCache caches channel content classification labels by broadcaster ID
+type ContentLabelCache struct {
+	mu      sync.RWMutex
+	entries map[string]cachedLabels
+}
+
+var channelLabels = NewContentLabelCache()
+
+// NewContentLabelCache creates an empty label cache
+func NewContentLabelCache() *ContentLabelCache {
+	return &ContentLabelCache{entries: make(map[string]cachedLabels)}
+}
+
+// Get returns the cached labels for a broadcaster if they have not expired
+func (c *ContentLabelCache) Get(broadcasterID string) ([]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[broadcasterID]
+	if !ok || time.Since(entry.fetchedAt) > contentLabelTTL {
+		return nil, false
+	}
+	return entry.labels, true
+}
+
+// Set caches the labels for a broadcaster
+func (c *ContentLabelCache) Set(broadcasterID string, labels []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if labels == nil {
+		labels = []string{}
+	}
+	c.entries[broadcasterID] = cachedLabels{labels: labels, fetchedAt: time.Now()}
+}
+
+// Clear removes expired entries
+func (c *ContentLabelCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if time.Since(entry.fetchedAt) > contentLabelTTL {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// annotateContentLabels fills in ContentLabels in place, fetching uncached channels in batches.
+// It returns the broadcaster IDs whose labels could not be fetched.
+func annotateContentLabels(ctx context.Context, twitchClient twitch.Client, streams []twitch.Stream) map[string]bool {
+	missing := []string{}
+	for _, stream := range streams {
+		if _, ok := channelLabels.Get(stream.UserID); !ok && !slices.Contains(missing, stream.UserID) {
+			missing = append(missing, stream.UserID)
+		}
+	}
+
+	unknown := map[string]bool{}
+	for start := 0; start < len(missing); start += twitch.MaxChannelIDs {
+		batch := missing[start:min(start+twitch.MaxChannelIDs, len(missing))]
+		channels, err := twitchClient.GetChannels(ctx, batch)
+		if err != nil {
+			zlog.Error().Err(err).Int("channels", len(batch)).Msg("Failed to fetch content classification labels")
+			for _, id := range batch {
+				unknown[id] = true
+			}
+			continue
+		}
+		for _, channel := range channels.Data {
+			channelLabels.Set(channel.BroadcasterID, channel.ContentClassificationLabels)
+		}
+	}
+
+	for i := range streams {
+		if labels, ok := channelLabels.Get(streams[i].UserID); ok {
+			streams[i].ContentLabels = labels
+		} else {
+			unknown[streams[i].UserID] = true
+		}
+	}
+	return unknown
+}
+
+// applyContentSafety returns a copy of streams with content labels set and, in safe mode, without
+// mature streams and streams carrying an excluded label. Streams whose labels could not be fetched
+// are dropped in safe mode too, since we can't vouch for them. The input is left untouched, as it
+// may be shared, e.g. by lineup rows resolved concurrently from the same response.
+func applyContentSafety(ctx context.Context, twitchClient twitch.Client, streams []twitch.Stream, safe bool) []twitch.Stream {
+	streams = slices.Clone(streams)
+	unknown := annotateContentLabels(ctx, twitchClient, streams)
+	if !safe {
+		return streams
+	}
+
+	filtered := []twitch.Stream{}
+	for _, stream := range streams {
+		if stream.IsMature || unknown[stream.UserID] || hasSafeModeLabel(stream.ContentLabels) {
+			continue
+		}
+		filtered = append(filtered, stream)
+	}
+	return filtered
+}
+
+func hasSafeModeLabel(labels []string) bool {
+	for _, label := range labels {
+		if slices.Contains(safeModeLabels, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// safeModeFor decides whether a request is in safe mode. An explicit ?safe= wins, otherwise the
+// signed-in user's stored default applies.
+func safeModeFor(r *http.Request) (bool, error) {
+	if raw := r.URL.Query().Get("safe"); raw != "" {
+		safe, err := strconv.ParseBool(raw)
+		if err != nil {
+			return false, fmt.Errorf("invalid safe parameter: must be true or false")
+		}
+		return safe, nil
+	}
+
+	userID := optionalUserID(r)
+	if userID == "" || DB == nil {
+		return false, nil
+	}
+	var pref ViewingPreference
+	err := DB.WithContext(r.Context()).Where("supabase_user_id = ?", userID).First(&pref).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Error().Err(err).Msg("Failed to load viewing preference")
+		}
+		return false, nil
+	}
+	return pref.SafeMode, nil
+}
+
+// ============= HANDLERS =============
+
+func getViewingPreference(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getViewingPreference: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	pref := ViewingPreference{SupabaseUserID: userID}
+	err := DB.WithContext(r.Context()).Where("supabase_user_id = ?", userID).First(&pref).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = pref
+
+	zlog.Info().Msgf("(%s) getViewingPreference done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func updateViewingPreference(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) updateViewingPreference: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var body ViewingPreference
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) updateViewingPreference: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	pref := ViewingPreference{SupabaseUserID: userID, SafeMode: body.SafeMode}
+	err := DB.WithContext(r.Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "supabase_user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"safe_mode", "updated_at"}),
+	}).Create(&pref).Error
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = pref
+
+	zlog.Info().Msgf("(%s) updateViewingPreference done.", tId)
+	render.JSON(w, r, resp)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+func withEmptyLabelCache(t *testing.T) {
+	t.Helper()
+	orig := channelLabels
+	channelLabels = NewContentLabelCache()
+	t.Cleanup(func() { channelLabels = orig })
+}
+
+func TestApplyContentSafety(t *testing.T) {
+	withEmptyLabelCache(t)
+
+	client := &mockTwitchClient{labels: map[string][]string{
+		"1": {twitch.LabelGambling},
+		"2": {twitch.LabelProfanityVulgarity},
+	}}
+	streams := []twitch.Stream{
+		{UserID: "1", UserLogin: "slots"},
+		{UserID: "2", UserLogin: "sweary"},
+		{UserID: "3", UserLogin: "mature", IsMature: true},
+		{UserID: "4", UserLogin: "cozy"},
+	}
+
+	all := applyContentSafety(context.Background(), client, streams, false)
+	if len(all) != 4 || all[0].ContentLabels[0] != twitch.LabelGambling {
+		t.Fatalf("Expected every stream labelled and kept, got %+v", all)
+	}
+	if streams[0].ContentLabels != nil {
+		t.Errorf("Expected the input streams left untouched, got %+v", streams[0])
+	}
+
+	safe := applyContentSafety(context.Background(), client, streams, true)
+	if len(safe) != 2 || safe[0].UserLogin != "sweary" || safe[1].UserLogin != "cozy" {
+		t.Errorf("Expected only sweary and cozy in safe mode, got %+v", safe)
+	}
+
+	// Labels that can't be fetched fail closed in safe mode
+	withEmptyLabelCache(t)
+	failing := &mockTwitchClient{shouldErr: true, errMsg: "helix down"}
+	if kept := applyContentSafety(context.Background(), failing, streams, true); len(kept) != 0 {
+		t.Errorf("Expected unlabelled streams dropped in safe mode, got %+v", kept)
+	}
+}
+
+func TestGetStreamsHandler_SafeMode(t *testing.T) {
+	withEmptyLabelCache(t)
+
+	client := &mockTwitchClient{
+		streams: createTestStreamsResponse(),
+		labels:  map[string][]string{"987654321": {twitch.LabelSexualThemes}},
+	}
+	router := setupTestRouter(client)
+
+	req := httptest.NewRequest("GET", "/twitch/streams?safe=true", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data twitch.StreamsResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if len(response.Data.Data) != 1 || response.Data.Data[0].UserLogin != "anotherstreamer" {
+		t.Errorf("Expected the labelled stream excluded, got %+v", response.Data.Data)
+	}
+
+	req = httptest.NewRequest("GET", "/twitch/streams?safe=maybe", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/schedule"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+const (
+	// minSessionsForInference is the least history a channel needs before a pattern is inferred
+	minSessionsForInference = 3
+	defaultScheduleDays     = 7
+	maxScheduleDays         = 28
+	scheduleSourceInferred  = "inferred"
+)
+
+// InferredSchedule stores the weekly pattern inferred from a broadcaster's live sessions
+type InferredSchedule struct {
+	gorm.Model
+	BroadcasterID    string             `gorm:"uniqueIndex" json:"broadcaster_id"`
+	BroadcasterLogin string             `json:"broadcaster_login"`
+	Segments         []schedule.Segment `gorm:"serializer:json" json:"segments"`
+	WeeksObserved    int                `json:"weeks_observed"`
+	Confidence       float64            `json:"confidence"`
+	Summary          string             `json:"summary"`
+	AnalyzedAt       time.Time          `json:"analyzed_at"`
+}
+
+// PredictedSegment is a dated schedule segment; IsInferred is always true for predictions
+type PredictedSegment struct {
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	Confidence float64   `json:"confidence"`
+	IsInferred bool      `json:"is_inferred"`
+}
+
+// ChannelScheduleResponse is returned by the channel schedule endpoint
+type ChannelScheduleResponse struct {
+	BroadcasterID    string             `json:"broadcaster_id"`
+	BroadcasterLogin string             `json:"broadcaster_login"`
+	Source           string             `json:"source"`
+	IsOfficial       bool               `json:"is_official"`
+	Summary          string             `json:"summary"`
+	Confidence       float64            `json:"confidence"`
+	WeeksObserved    int                `json:"weeks_observed"`
+	AnalyzedAt       time.Time          `json:"analyzed_at"`
+	Pattern          []schedule.Segment `json:"pattern"`
+	Segments         []PredictedSegment `json:"segments"`
+}
+
+// startScheduleInference periodically re-infers weekly patterns from recorded live sessions
+func startScheduleInference(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			zlog.Info().Msg("Schedule inference job stopping")
+			return
+		case <-ticker.C:
+			count, err := inferSchedules(ctx, DB, time.Now().UTC())
+			workerHeartbeats.Beat(workerScheduleInference, err)
+			if err != nil {
+				zlog.Error().Err(err).Msg("Schedule inference failed")
+				continue
+			}
+			zlog.Info().Int("schedules", count).Msg("Schedule inference completed")
+		}
+	}
+}
+
+// inferSchedules analyses the session history of every recently seen broadcaster
+// and upserts their inferred schedules. It returns the number of schedules written.
+func inferSchedules(ctx context.Context, db *gorm.DB, now time.Time) (int, error) {
+	windowStart := now.AddDate(0, 0, -7*schedule.DefaultWindowWeeks)
+
+	var broadcasterIDs []string
+	err := db.WithContext(ctx).Model(&LiveSession{}).
+		Where("started_at >= ?", windowStart).
+		Distinct().
+		Pluck("broadcaster_id", &broadcasterIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for _, broadcasterID := range broadcasterIDs {
+		if ctx.Err() != nil {
+			return written, ctx.Err()
+		}
+
+		var sessions []LiveSession
+		err := db.WithContext(ctx).
+			Where("broadcaster_id = ? AND started_at >= ?", broadcasterID, windowStart).
+			Order("started_at").
+			Find(&sessions).Error
+		if err != nil {
+			return written, err
+		}
+		if len(sessions) < minSessionsForInference {
+			continue
+		}
+
+		history := make([]schedule.Session, 0, len(sessions))
+		for _, s := range sessions {
+			history = append(history, schedule.Session{Start: s.StartedAt, End: s.EndOrLastSeen()})
+		}
+		pattern := schedule.Infer(history, now, schedule.Options{})
+
+		inferred := InferredSchedule{
+			BroadcasterID:    broadcasterID,
+			BroadcasterLogin: sessions[len(sessions)-1].BroadcasterLogin,
+			Segments:         pattern.Segments,
+			WeeksObserved:    pattern.WeeksObserved,
+			Confidence:       pattern.Confidence,
+			Summary:          pattern.Summary,
+			AnalyzedAt:       now,
+		}
+		err = db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "broadcaster_id"}},
+			UpdateAll: true,
+		}).Create(&inferred).Error
+		if err != nil {
+			return written, err
+		}
+		written++
+	}
+
+	return written, nil
+}
+
+// getChannelScheduleHandler returns the inferred schedule of a channel as predicted segments.
+// Blocked broadcasters are answered like channels without a schedule.
+func getChannelScheduleHandler(filter twitch.ContentFilter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tId := middleware.GetReqID(ctx)
+		apiVersion := ctx.Value(apivctx).(string)
+		broadcasterID := chi.URLParam(r, "broadcasterID")
+
+		zlog.Info().Msgf("(%s) getChannelScheduleHandler started", tId)
+
+		if _, err := strconv.Atoi(broadcasterID); err != nil {
+			handleErr(w, r, fmt.Errorf("broadcaster_id must be a numeric string, got %s", broadcasterID), http.StatusBadRequest)
+			return
+		}
+
+		days := defaultScheduleDays
+		if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+			parsedDays, err := strconv.Atoi(daysStr)
+			if err != nil || parsedDays < 1 || parsedDays > maxScheduleDays {
+				handleErr(w, r, fmt.Errorf("days must be between 1 and %d", maxScheduleDays), http.StatusBadRequest)
+				return
+			}
+			days = parsedDays
+		}
+
+		if DB == nil {
+			handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+			return
+		}
+
+		var inferred InferredSchedule
+		err := DB.WithContext(ctx).Where("broadcaster_id = ?", broadcasterID).First(&inferred).Error
+		if err == nil && !filter.AllowStream(twitch.Stream{UserID: broadcasterID, UserLogin: inferred.BroadcasterLogin}) {
+			err = gorm.ErrRecordNotFound
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErr(w, r, fmt.Errorf("no schedule available for broadcaster %s", broadcasterID), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			handleErr(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		occurrences := schedule.NextOccurrences(inferred.Segments, time.Now(), days)
+		segments := make([]PredictedSegment, 0, len(occurrences))
+		for _, o := range occurrences {
+			segments = append(segments, PredictedSegment{
+				StartTime:  o.StartTime,
+				EndTime:    o.EndTime,
+				Confidence: o.Confidence,
+				IsInferred: true,
+			})
+		}
+
+		resp := mytypes.APIHandlerResp{
+			TransactionId: tId,
+			ApiVersion:    apiVersion,
+			Data: ChannelScheduleResponse{
+				BroadcasterID:    inferred.BroadcasterID,
+				BroadcasterLogin: inferred.BroadcasterLogin,
+				Source:           scheduleSourceInferred,
+				IsOfficial:       false,
+				Summary:          inferred.Summary,
+				Confidence:       inferred.Confidence,
+				WeeksObserved:    inferred.WeeksObserved,
+				AnalyzedAt:       inferred.AnalyzedAt,
+				Pattern:          inferred.Segments,
+				Segments:         segments,
+			},
+		}
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, resp)
+
+		zlog.Info().
+			Str("transaction_id", tId).
+			Str("api_version", apiVersion).
+			Str("broadcaster_id", broadcasterID).
+			Int("segment_count", len(segments)).
+			Msg("getChannelScheduleHandler completed successfully")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/gorm"
+)
+
+func TestGetChannelScheduleHandler_Inferred(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	segments := `[{"weekday":2,"start_minute":1140,"duration_minutes":240,"confidence":0.9}]`
+	rows := sqlmock.NewRows([]string{"id", "broadcaster_id", "broadcaster_login", "segments", "weeks_observed", "confidence", "summary", "analyzed_at"}).
+		AddRow(1, "123456", "teststreamer", segments, 6, 0.9, "usually live Tue 19:00–23:00 UTC", time.Now())
+	mock.ExpectQuery(`SELECT \* FROM "inferred_schedules"`).WillReturnRows(rows)
+
+	router := setupTestRouter(&mockTwitchClient{})
+	req := httptest.NewRequest("GET", "/twitch/channels/123456/schedule", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data ChannelScheduleResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+
+	if response.Data.Source != "inferred" || response.Data.IsOfficial {
+		t.Errorf("Expected schedule to be marked inferred, got source %q official %t", response.Data.Source, response.Data.IsOfficial)
+	}
+	if len(response.Data.Segments) == 0 {
+		t.Fatal("Expected predicted segments, got none")
+	}
+	for _, seg := range response.Data.Segments {
+		if !seg.IsInferred {
+			t.Error("Expected every predicted segment to be marked inferred")
+		}
+		if seg.StartTime.Weekday() != time.Tuesday || seg.StartTime.Hour() != 19 {
+			t.Errorf("Expected segment on Tuesday 19:00 UTC, got %s", seg.StartTime)
+		}
+	}
+}
+
+func TestGetChannelScheduleHandler_NotFound(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	mock.ExpectQuery(`SELECT \* FROM "inferred_schedules"`).WillReturnError(gorm.ErrRecordNotFound)
+
+	router := setupTestRouter(&mockTwitchClient{})
+	req := httptest.NewRequest("GET", "/twitch/channels/123456/schedule", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestGetChannelScheduleHandler_InvalidParams(t *testing.T) {
+	router := setupTestRouter(&mockTwitchClient{})
+
+	for _, path := range []string{
+		"/twitch/channels/abc/schedule",
+		"/twitch/channels/123456/schedule?days=0",
+		"/twitch/channels/123456/schedule?days=100",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", path, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestGetChannelScheduleHandler_Blocked(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+	contentBlocklist.Set([]BlocklistEntry{{Kind: blockBroadcaster, Value: "teststreamer"}})
+	defer contentBlocklist.Set(nil)
+
+	rows := sqlmock.NewRows([]string{"id", "broadcaster_id", "broadcaster_login", "segments"}).
+		AddRow(1, "123456", "teststreamer", `[]`)
+	mock.ExpectQuery(`SELECT \* FROM "inferred_schedules"`).WillReturnRows(rows)
+
+	router := setupTestRouter(&mockTwitchClient{})
+	req := httptest.NewRequest("GET", "/twitch/channels/123456/schedule", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a blocked broadcaster, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/oauthstate"
+	"github.com/site-tech/VibeGuide/pkg/vault"
+	"github.com/supabase-community/gotrue-go/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Cookie session mode (SESSION_COOKIES): the browser only ever holds an opaque HttpOnly session
+// cookie. Supabase tokens stay sealed in user_sessions and are injected as the bearer token on
+// each request; Twitch tokens already live in the token vault, keyed by the Supabase user.
+const (
+	sessionCookie = "vg_session"
+	csrfCookie    = "vg_csrf"
+	csrfHeader    = "X-CSRF-Token"
+	// sessionRotateGrace keeps a rotated-out session ID valid for requests already in flight
+	sessionRotateGrace = time.Minute
+	// sessionRefreshMargin refreshes the Supabase access token this long before it expires
+	sessionRefreshMargin = time.Minute
+)
+
+var (
+	errNoSession    = errors.New("session not found")
+	errCSRFMismatch = errors.New("missing or invalid CSRF token")
+)
+
+type userSessionCtx string
+
+var sessionctx userSessionCtx = "auth.session"
+
+// sessionCookies enables cookie session mode. Set in run(); requires the token vault keyring.
+var sessionCookies bool
+
+// UserSession is a cookie session. Only hashes of the session ID and CSRF token are stored; the
+// Supabase tokens are sealed with twitchTokenKeys and bound to the user ID.
+type UserSession struct {
+	ID              uint `gorm:"primarykey"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	TokenHash       string `gorm:"uniqueIndex" json:"-"`
+	PreviousHash    string `gorm:"index" json:"-"` // Session ID before the last rotation
+	RotatedAt       time.Time
+	CSRFHash        string `json:"-"`
+	SupabaseUserID  string `gorm:"index"`
+	AccessToken     string `json:"-"`
+	RefreshToken    string `json:"-"`
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time `gorm:"index"`
+}
+
+func (s *UserSession) seal(keys *vault.Keyring, accessToken, refreshToken string) error {
+	access, err := keys.Seal([]byte(accessToken), []byte("session/"+s.SupabaseUserID+"/access"))
+	if err != nil {
+		return err
+	}
+	refresh, err := keys.Seal([]byte(refreshToken), []byte("session/"+s.SupabaseUserID+"/refresh"))
+	if err != nil {
+		return err
+	}
+	s.AccessToken, s.RefreshToken = access, refresh
+	return nil
+}
+
+func (s *UserSession) open(keys *vault.Keyring) (string, string, error) {
+	access, err := keys.Open(s.AccessToken, []byte("session/"+s.SupabaseUserID+"/access"))
+	if err != nil {
+		return "", "", err
+	}
+	refresh, err := keys.Open(s.RefreshToken, []byte("session/"+s.SupabaseUserID+"/refresh"))
+	if err != nil {
+		return "", "", err
+	}
+	return string(access), string(refresh), nil
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionSameSite parses SESSION_COOKIE_SAMESITE
+func sessionSameSite(mode string) (http.SameSite, error) {
+	switch strings.ToLower(mode) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("invalid SameSite mode %q, expected lax, strict or none", mode)
+	}
+}
+
+// setSessionCookies sets the HttpOnly session cookie and the CSRF cookie the frontend echoes in
+// X-CSRF-Token. A negative maxAge clears both.
+func setSessionCookies(w http.ResponseWriter, sessionID, csrfToken string, maxAge int) {
+	sameSite := http.SameSiteLaxMode
+	if Config != nil {
+		sameSite, _ = sessionSameSite(Config.SessionSameSite)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sessionID,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: sameSite,
+	})
+	if csrfToken == "" && maxAge >= 0 {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		SameSite: sameSite,
+	})
+}
+
+// startCookieSession stores a Supabase session server-side and sets the session cookies, replacing
+// any session the browser already had so a planted session ID can't survive a login. It returns
+// the CSRF token for the frontend.
+func startCookieSession(w http.ResponseWriter, r *http.Request, s types.Session) (string, error) {
+	if DB == nil || twitchTokenKeys == nil {
+		return "", errTwitchVaultUnavailable
+	}
+	ctx := r.Context()
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		DB.WithContext(ctx).Where("token_hash = ?", hashSessionToken(cookie.Value)).Delete(&UserSession{})
+	}
+
+	sessionID, err := oauthstate.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	csrfToken, err := oauthstate.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	row := UserSession{
+		TokenHash:       hashSessionToken(sessionID),
+		RotatedAt:       now,
+		CSRFHash:        hashSessionToken(csrfToken),
+		SupabaseUserID:  s.User.ID.String(),
+		AccessExpiresAt: sessionAccessExpiry(s, now),
+		ExpiresAt:       now.Add(Config.SessionTTL),
+	}
+	if err := row.seal(twitchTokenKeys, s.AccessToken, s.RefreshToken); err != nil {
+		return "", err
+	}
+	if err := DB.WithContext(ctx).Create(&row).Error; err != nil {
+		return "", err
+	}
+	setSessionCookies(w, sessionID, csrfToken, int(Config.SessionTTL.Seconds()))
+	return csrfToken, nil
+}
+
+// endCookieSession deletes the request's session and clears the cookies
+func endCookieSession(w http.ResponseWriter, r *http.Request) {
+	if session, ok := r.Context().Value(sessionctx).(*UserSession); ok && DB != nil {
+		if err := DB.WithContext(r.Context()).Delete(session).Error; err != nil {
+			zlog.Error().Err(err).Msg("Failed to delete session")
+		}
+	}
+	setSessionCookies(w, "", "", -1)
+}
+
+func sessionAccessExpiry(s types.Session, now time.Time) time.Time {
+	if s.ExpiresAt > 0 {
+		return time.Unix(s.ExpiresAt, 0)
+	}
+	return now.Add(time.Duration(s.ExpiresIn) * time.Second)
+}
+
+// loadCookieSession finds the live session for a session ID, accepting the previous ID for a
+// short grace period after rotation
+func loadCookieSession(ctx context.Context, db *gorm.DB, sessionID string, now time.Time) (*UserSession, error) {
+	hash := hashSessionToken(sessionID)
+	var row UserSession
+	err := db.WithContext(ctx).
+		Where("(token_hash = ? OR (previous_hash = ? AND rotated_at > ?)) AND expires_at > ?", hash, hash, now.Add(-sessionRotateGrace), now).
+		First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// checkCSRF enforces the double-submit CSRF token on cookie-authenticated mutating requests: the
+// X-CSRF-Token header must match both the CSRF cookie and the session's token
+func checkCSRF(r *http.Request, session *UserSession) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	header := r.Header.Get(csrfHeader)
+	cookie, err := r.Cookie(csrfCookie)
+	if header == "" || err != nil || subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return errCSRFMismatch
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSessionToken(header)), []byte(session.CSRFHash)) != 1 {
+		return errCSRFMismatch
+	}
+	return nil
+}
+
+// sessionRefresh is one Supabase refresh shared by every request holding the same refresh token;
+// session and access are set before done is closed
+type sessionRefresh struct {
+	done    chan struct{}
+	session UserSession
+	access  string
+	err     error
+}
+
+// sessionRefreshes holds the refreshes in flight, keyed by a hash of the refresh token
+var (
+	sessionRefreshMu sync.Mutex
+	sessionRefreshes = make(map[string]*sessionRefresh)
+)
+
+// refreshCookieSession swaps the session's Supabase tokens for fresh ones. Supabase rotates the
+// refresh token on every use, so parallel requests for one session share a single refresh and
+// all continue with the rotated tokens.
+func refreshCookieSession(ctx context.Context, session *UserSession, refreshToken string, now time.Time) (string, error) {
+	if SBClient == nil {
+		return "", fmt.Errorf("supabase client unavailable")
+	}
+
+	key := hashSessionToken(refreshToken)
+	sessionRefreshMu.Lock()
+	call, inflight := sessionRefreshes[key]
+	if !inflight {
+		call = &sessionRefresh{done: make(chan struct{})}
+		sessionRefreshes[key] = call
+		// Detached from this request so its cancellation doesn't fail the others waiting
+		go func(loaded UserSession) {
+			call.session, call.access, call.err = refreshSessionTokens(context.WithoutCancel(ctx), loaded, refreshToken, now)
+			sessionRefreshMu.Lock()
+			delete(sessionRefreshes, key)
+			sessionRefreshMu.Unlock()
+			close(call.done)
+		}(*session)
+	}
+	sessionRefreshMu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if call.err != nil {
+		return "", call.err
+	}
+	session.AccessToken, session.RefreshToken = call.session.AccessToken, call.session.RefreshToken
+	session.AccessExpiresAt = call.session.AccessExpiresAt
+	return call.access, nil
+}
+
+// refreshSessionTokens refreshes a session under its row lock. When another instance refreshed
+// it since it was loaded, the tokens it stored are used instead of spending the old refresh token.
+func refreshSessionTokens(ctx context.Context, loaded UserSession, refreshToken string, now time.Time) (UserSession, string, error) {
+	var row UserSession
+	var access string
+	err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&row, loaded.ID).Error; err != nil {
+			return err
+		}
+		if now.Add(sessionRefreshMargin).Before(row.AccessExpiresAt) {
+			var err error
+			access, _, err = row.open(twitchTokenKeys)
+			return err
+		}
+
+		token, err := SBClient.Auth.RefreshToken(refreshToken)
+		if err != nil {
+			return err
+		}
+		row.AccessExpiresAt = sessionAccessExpiry(token.Session, now)
+		if err := row.seal(twitchTokenKeys, token.AccessToken, token.RefreshToken); err != nil {
+			return err
+		}
+		access = token.AccessToken
+		return tx.Model(&row).Updates(map[string]interface{}{
+			"access_token":      row.AccessToken,
+			"refresh_token":     row.RefreshToken,
+			"access_expires_at": row.AccessExpiresAt,
+		}).Error
+	})
+	return row, access, err
+}
+
+// rotateCookieSession issues a new session ID, keeping the old one briefly valid, and extends the
+// session. The CSRF token stays the same for the session's lifetime.
+func rotateCookieSession(ctx context.Context, w http.ResponseWriter, session *UserSession, now time.Time) error {
+	sessionID, err := oauthstate.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	session.PreviousHash, session.TokenHash = session.TokenHash, hashSessionToken(sessionID)
+	session.RotatedAt, session.ExpiresAt = now, now.Add(Config.SessionTTL)
+	err = DB.WithContext(ctx).Model(session).Updates(map[string]interface{}{
+		"previous_hash": session.PreviousHash,
+		"token_hash":    session.TokenHash,
+		"rotated_at":    session.RotatedAt,
+		"expires_at":    session.ExpiresAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	setSessionCookies(w, sessionID, "", int(Config.SessionTTL.Seconds()))
+	return nil
+}
+
+// CookieSession authenticates requests that carry a session cookie instead of a bearer token. It
+// enforces CSRF on mutating requests, refreshes and rotates the session as needed, and injects
+// the Supabase access token as the Authorization header so VerifyBearer and the handlers work
+// unchanged. Requests with their own Authorization header are left alone.
+func CookieSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookie)
+		if !sessionCookies || DB == nil || err != nil || cookie.Value == "" || r.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		now := time.Now()
+		session, err := loadCookieSession(ctx, DB, cookie.Value, now)
+		if err != nil {
+			if !errors.Is(err, errNoSession) {
+				zlog.Error().Err(err).Msg("Failed to load session")
+			}
+			setSessionCookies(w, "", "", -1)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := checkCSRF(r, session); err != nil {
+			handleErr(w, r, err, http.StatusForbidden)
+			return
+		}
+
+		access, refresh, err := session.open(twitchTokenKeys)
+		if err != nil {
+			zlog.Error().Err(err).Str("supabase_user_id", session.SupabaseUserID).Msg("Failed to open session tokens")
+			endCookieSession(w, r)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if now.Add(sessionRefreshMargin).After(session.AccessExpiresAt) {
+			refreshed, err := refreshCookieSession(ctx, session, refresh, now)
+			status := gotrueStatus(err)
+			switch {
+			case err == nil:
+				access = refreshed
+			case status >= http.StatusBadRequest && status < http.StatusInternalServerError:
+				// Supabase revoked the session (sign-out elsewhere, deleted user)
+				DB.WithContext(ctx).Delete(session)
+				setSessionCookies(w, "", "", -1)
+				next.ServeHTTP(w, r)
+				return
+			default:
+				zlog.Error().Err(err).Str("supabase_user_id", session.SupabaseUserID).Msg("Failed to refresh session")
+			}
+		}
+		if now.Sub(session.RotatedAt) >= Config.SessionRotateInterval && session.TokenHash == hashSessionToken(cookie.Value) {
+			if err := rotateCookieSession(ctx, w, session, now); err != nil {
+				zlog.Error().Err(err).Msg("Failed to rotate session")
+			}
+		}
+
+		r.Header.Set("Authorization", "Bearer "+access)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, sessionctx, session)))
+	})
+}
+
+// getCookieSession returns the current session's CSRF token, so the frontend can recover it after
+// a reload (the CSRF cookie belongs to the API origin and isn't readable from the page)
+func getCookieSession(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getCookieSession: %v", tId, apiVersion)
+
+	session, ok := r.Context().Value(sessionctx).(*UserSession)
+	cookie, err := r.Cookie(csrfCookie)
+	if !ok || err != nil || hashSessionToken(cookie.Value) != session.CSRFHash {
+		handleErr(w, r, errNoSession, http.StatusUnauthorized)
+		return
+	}
+	resp.Data = map[string]interface{}{
+		"supabase_user_id": session.SupabaseUserID,
+		"csrf_token":       cookie.Value,
+		"expires_at":       session.ExpiresAt,
+	}
+
+	zlog.Info().Msgf("(%s) getCookieSession done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// sweepSessions drops expired sessions
+func sweepSessions(ctx context.Context, db *gorm.DB, now time.Time) {
+	if err := db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&UserSession{}).Error; err != nil {
+		zlog.Error().Err(err).Msg("Failed to sweep expired sessions")
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"github.com/supabase-community/gotrue-go/types"
+)
+
+const testSessionID, testCSRFToken = "session-id", "csrf-token"
+
+// withCookieSessions enables cookie session mode with a test keyring and mock database
+func withCookieSessions(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	withTestTokenKeys(t, "k1:"+testTokenKey(1))
+	sqldb, gormdb, mock := DbMock(t)
+	origDB, origConfig, origEnabled := DB, Config, sessionCookies
+	DB, sessionCookies = gormdb, true
+	Config = &VibeConfig{SessionTTL: 24 * time.Hour, SessionRotateInterval: 15 * time.Minute}
+	t.Cleanup(func() {
+		sqldb.Close()
+		DB, Config, sessionCookies = origDB, origConfig, origEnabled
+	})
+	return mock
+}
+
+// sessionRow returns a stored session for testSessionID with sealed Supabase tokens
+func sessionRow(t *testing.T, accessExpiresAt, rotatedAt time.Time) *sqlmock.Rows {
+	t.Helper()
+	row := UserSession{SupabaseUserID: testSupabaseUserID}
+	if err := row.seal(twitchTokenKeys, "stored-access", "stored-refresh"); err != nil {
+		t.Fatalf("Failed to seal session: %v", err)
+	}
+	return sqlmock.NewRows([]string{"id", "token_hash", "rotated_at", "csrf_hash", "supabase_user_id", "access_token", "refresh_token", "access_expires_at", "expires_at"}).
+		AddRow(5, hashSessionToken(testSessionID), rotatedAt, hashSessionToken(testCSRFToken), testSupabaseUserID,
+			row.AccessToken, row.RefreshToken, accessExpiresAt, time.Now().Add(time.Hour))
+}
+
+// sessionProbeRouter records the Authorization header the handlers see
+func sessionProbeRouter(seen *string) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(CookieSession)
+	probe := func(w http.ResponseWriter, r *http.Request) {
+		*seen = r.Header.Get("Authorization")
+	}
+	r.Get("/probe", probe)
+	r.Post("/probe", probe)
+	return r
+}
+
+func sessionRequest(method string, csrf string) *http.Request {
+	req := httptest.NewRequest(method, "/probe", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: testSessionID})
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+	if csrf != "" {
+		req.Header.Set(csrfHeader, csrf)
+	}
+	return req
+}
+
+func TestCookieSession_InjectsBearer(t *testing.T) {
+	mock := withCookieSessions(t)
+	mock.ExpectQuery(`SELECT \* FROM "user_sessions" WHERE \(token_hash = \$1 OR \(previous_hash = \$2 AND rotated_at > \$3\)\) AND expires_at > \$4`).
+		WillReturnRows(sessionRow(t, time.Now().Add(time.Hour), time.Now()))
+
+	var seen string
+	w := httptest.NewRecorder()
+	sessionProbeRouter(&seen).ServeHTTP(w, sessionRequest("GET", ""))
+	if w.Code != http.StatusOK || seen != "Bearer stored-access" {
+		t.Errorf("Expected the stored access token injected, got %d %q", w.Code, seen)
+	}
+
+	// Explicit bearer tokens bypass the session entirely
+	req := sessionRequest("GET", "")
+	req.Header.Set("Authorization", "Bearer explicit")
+	sessionProbeRouter(&seen).ServeHTTP(httptest.NewRecorder(), req)
+	if seen != "Bearer explicit" {
+		t.Errorf("Expected the explicit bearer token kept, got %q", seen)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCookieSession_RequiresCSRF(t *testing.T) {
+	mock := withCookieSessions(t)
+
+	tests := []struct {
+		name   string
+		csrf   string
+		status int
+	}{
+		{"missing header", "", http.StatusForbidden},
+		{"wrong token", "other-token", http.StatusForbidden},
+		{"double submitted", testCSRFToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		mock.ExpectQuery(`SELECT \* FROM "user_sessions"`).
+			WillReturnRows(sessionRow(t, time.Now().Add(time.Hour), time.Now()))
+
+		var seen string
+		w := httptest.NewRecorder()
+		sessionProbeRouter(&seen).ServeHTTP(w, sessionRequest("POST", tt.csrf))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status code %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+}
+
+func TestCookieSession_RefreshesAndRotates(t *testing.T) {
+	mock := withCookieSessions(t)
+	fake, _ := withFakeGoTrue(t)
+	Config.SessionTTL, Config.SessionRotateInterval = 24*time.Hour, 15*time.Minute
+
+	mock.ExpectQuery(`SELECT \* FROM "user_sessions"`).
+		WillReturnRows(sessionRow(t, time.Now().Add(10*time.Second), time.Now().Add(-time.Hour)))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "user_sessions" WHERE "user_sessions"."id" = \$1 .* FOR UPDATE`).
+		WithArgs(5, 1).
+		WillReturnRows(sessionRow(t, time.Now().Add(10*time.Second), time.Now().Add(-time.Hour)))
+	mock.ExpectExec(`UPDATE "user_sessions" SET .*"access_token"=.*"refresh_token"=.* WHERE "id" = `).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "user_sessions" SET .*"previous_hash"=.*"token_hash"=.* WHERE "id" = `).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var seen string
+	w := httptest.NewRecorder()
+	sessionProbeRouter(&seen).ServeHTTP(w, sessionRequest("GET", ""))
+	if seen != "Bearer new-access" {
+		t.Errorf("Expected the refreshed access token injected, got %q", seen)
+	}
+	if body := fake.requests["POST /token"]; body["refresh_token"] != "stored-refresh" {
+		t.Errorf("Expected a refresh with the stored refresh token, got %v", body)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || cookies[0].Value == testSessionID || !cookies[0].HttpOnly {
+		t.Errorf("Expected a rotated HttpOnly session cookie, got %+v", cookies)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCookieSession_ReusesTokensRefreshedElsewhere(t *testing.T) {
+	mock := withCookieSessions(t)
+	fake, _ := withFakeGoTrue(t)
+
+	// Another instance refreshed the session between our read and taking the row lock
+	refreshed := UserSession{SupabaseUserID: testSupabaseUserID}
+	if err := refreshed.seal(twitchTokenKeys, "other-access", "other-refresh"); err != nil {
+		t.Fatalf("Failed to seal session: %v", err)
+	}
+	mock.ExpectQuery(`SELECT \* FROM "user_sessions"`).
+		WillReturnRows(sessionRow(t, time.Now().Add(10*time.Second), time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "user_sessions" WHERE "user_sessions"."id" = \$1 .* FOR UPDATE`).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "supabase_user_id", "access_token", "refresh_token", "access_expires_at"}).
+			AddRow(5, testSupabaseUserID, refreshed.AccessToken, refreshed.RefreshToken, time.Now().Add(time.Hour)))
+	mock.ExpectCommit()
+
+	var seen string
+	sessionProbeRouter(&seen).ServeHTTP(httptest.NewRecorder(), sessionRequest("GET", ""))
+	if seen != "Bearer other-access" {
+		t.Errorf("Expected the tokens refreshed elsewhere injected, got %q", seen)
+	}
+	if _, ok := fake.requests["POST /token"]; ok {
+		t.Error("Expected the spent refresh token not to be used again")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRefreshCookieSession_SharesOneRefresh(t *testing.T) {
+	mock := withCookieSessions(t)
+	release := make(chan struct{})
+	var refreshes atomic.Int32
+	withGoTrueServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshes.Add(1)
+		<-release
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "new-access", "refresh_token": "new-refresh", "expires_in": 3600,
+			"user": map[string]interface{}{"id": testSupabaseUserID},
+		})
+	}))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "user_sessions" WHERE "user_sessions"."id" = \$1 .* FOR UPDATE`).
+		WithArgs(5, 1).
+		WillReturnRows(sessionRow(t, time.Now().Add(10*time.Second), time.Now()))
+	mock.ExpectExec(`UPDATE "user_sessions" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	type result struct {
+		access  string
+		session *UserSession
+		err     error
+	}
+	results := make(chan result, 3)
+	for range 3 {
+		go func() {
+			session := &UserSession{ID: 5, SupabaseUserID: testSupabaseUserID}
+			access, err := refreshCookieSession(context.Background(), session, "stored-refresh", time.Now())
+			results <- result{access, session, err}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for range 3 {
+		res := <-results
+		if res.err != nil || res.access != "new-access" {
+			t.Fatalf("Expected every request to get the refreshed token, got %q %v", res.access, res.err)
+		}
+		if _, refresh, err := res.session.open(twitchTokenKeys); err != nil || refresh != "new-refresh" {
+			t.Errorf("Expected every request to carry the rotated refresh token, got %q %v", refresh, err)
+		}
+	}
+	if refreshes.Load() != 1 {
+		t.Errorf("Expected one Supabase refresh, got %d", refreshes.Load())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestStartCookieSession_ReplacesExistingSession(t *testing.T) {
+	mock := withCookieSessions(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "user_sessions" WHERE token_hash = \$1`).
+		WithArgs(hashSessionToken("planted")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "user_sessions"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(6))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("POST", "/auth/login", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: "planted"})
+	w := httptest.NewRecorder()
+	csrf, err := startCookieSession(w, req, types.Session{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresIn:    3600,
+		User:         types.User{ID: uuid.MustParse(testSupabaseUserID)},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var session, csrfSet *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		switch c.Name {
+		case sessionCookie:
+			session = c
+		case csrfCookie:
+			csrfSet = c
+		}
+	}
+	if session == nil || !session.HttpOnly || session.Value == "planted" || session.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Expected a new HttpOnly SameSite session cookie, got %+v", session)
+	}
+	if csrfSet == nil || csrfSet.HttpOnly || csrfSet.Value != csrf || strings.TrimSpace(csrf) == "" {
+		t.Errorf("Expected a readable CSRF cookie matching the returned token, got %+v", csrfSet)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCompleteTwitchLogin_CookieMode(t *testing.T) {
+	mock := withCookieSessions(t)
+	fake, _ := withFakeGoTrue(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "twitch_accounts"`).
+		WillReturnRows(twitchAccountRows().AddRow(1, "test_user", "test_login", testSupabaseUserID, "viewer@example.com"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "twitch_accounts"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "twitch_tokens"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "user_sessions"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("POST", "/auth/twitch/callback", nil)
+	w := httptest.NewRecorder()
+	data, _, err := completeTwitchLogin(w, req, &twitch.UserToken{AccessToken: "twitch-access", ExpiresIn: 14400}, &twitch.User{ID: "test_user", Login: "test_login"}, testRedirectURI)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if data["csrf_token"] == nil || data["sign_in_link"] != nil || data["access_token"] != nil {
+		t.Errorf("Expected a cookie session instead of tokens or a link, got %v", data)
+	}
+	if body := fake.requests["POST /verify"]; body["token"] != "123456" || body["type"] != "magiclink" {
+		t.Errorf("Expected the magic link OTP redeemed server-side, got %v", body)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 2 || cookies[0].Name != sessionCookie {
+		t.Errorf("Expected session cookies, got %+v", cookies)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/supabase-community/gotrue-go"
+	"github.com/supabase-community/gotrue-go/types"
+)
+
+var errSupabaseAdminUnavailable = errors.New("supabase admin API unavailable, SB_SERVICE_ROLE_KEY is not set")
+
+// gotrueURL is the GoTrue base URL (<SB_API_URL>/auth/v1), for the calls gotrue-go gets wrong.
+// Set in run().
+var gotrueURL string
+
+var gotrueHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// supabaseAdmin returns a GoTrue client authorised with the service role key, for the admin
+// endpoints (creating, updating and deleting users, generating links)
+func supabaseAdmin() (gotrue.Client, error) {
+	if SBClient == nil || Config == nil || Config.SupabaseServiceRoleKey == "" {
+		return nil, errSupabaseAdminUnavailable
+	}
+	return SBClient.Auth.WithToken(Config.SupabaseServiceRoleKey), nil
+}
+
+// gotrueStatus extracts the HTTP status from a gotrue-go error ("response status code 422: ..."),
+// or returns 0 when the error didn't come from a GoTrue response
+func gotrueStatus(err error) int {
+	var status int
+	if err == nil {
+		return 0
+	}
+	if _, scanErr := fmt.Sscanf(err.Error(), "response status code %d", &status); scanErr != nil {
+		return 0
+	}
+	if status < http.StatusContinue || status > 599 {
+		return 0
+	}
+	return status
+}
+
+// verifyForSession redeems an OTP or link token for a session. gotrue-go's VerifyForUser insists
+// on a redirect and a 303, but GoTrue answers a verify without redirect_to with the session as
+// JSON. Errors use gotrue-go's "response status code %d: body" format.
+func verifyForSession(req types.VerifyForUserRequest) (*types.Session, error) {
+	if gotrueURL == "" {
+		return nil, fmt.Errorf("supabase auth unavailable")
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, gotrueURL+"/verify", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if Config != nil {
+		httpReq.Header.Set("apikey", Config.SupabaseApiKey)
+	}
+
+	resp, err := gotrueHTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fullBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("response status code %d: %s", resp.StatusCode, fullBody)
+	}
+	var session types.Session
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"github.com/supabase-community/gotrue-go"
+	"github.com/supabase-community/gotrue-go/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errTwitchAccountLinked = errors.New("this twitch account is already linked to another user")
+	errTwitchEmailRequired = errors.New("twitch account has no verified email, sign in first and then connect twitch")
+	errTwitchEmailInUse    = errors.New("an account with this email already exists, sign in first and then connect twitch")
+)
+
+// TwitchAccount links a Twitch identity to the Supabase user it signs in as. Each Twitch account
+// links to at most one user.
+type TwitchAccount struct {
+	ID             uint      `gorm:"primarykey" json:"-"`
+	CreatedAt      time.Time `json:"linked_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	TwitchUserID   string    `gorm:"uniqueIndex" json:"twitch_user_id"`
+	Login          string    `json:"login"`
+	DisplayName    string    `json:"display_name"`
+	AvatarURL      string    `json:"avatar"`
+	SupabaseUserID string    `gorm:"index" json:"supabase_user_id"`
+	Email          string    `json:"-"` // Supabase email, used to mint sign-in links
+}
+
+// twitchMetadata is the fixed user_metadata format for a linked Twitch identity
+func twitchMetadata(user *twitch.User) map[string]interface{} {
+	return map[string]interface{}{
+		"twitch": map[string]interface{}{
+			"user_id": user.ID,
+			"login":   user.Login,
+			"avatar":  user.ProfileImageURL,
+		},
+	}
+}
+
+// linkTwitchAccount links a Twitch identity to a Supabase user. A signed-in caller (callerID set)
+// links to themselves; otherwise the Twitch account's existing link is used, or a new Supabase
+// user is created from the verified Twitch email. It returns the link and whether a user was created.
+func linkTwitchAccount(ctx context.Context, db *gorm.DB, admin gotrue.Client, callerID, callerEmail string, user *twitch.User) (*TwitchAccount, bool, error) {
+	var existing TwitchAccount
+	err := db.WithContext(ctx).Where("twitch_user_id = ?", user.ID).First(&existing).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	account := TwitchAccount{
+		TwitchUserID: user.ID,
+		Login:        user.Login,
+		DisplayName:  user.DisplayName,
+		AvatarURL:    user.ProfileImageURL,
+	}
+	created := false
+	switch {
+	case callerID != "":
+		if found && existing.SupabaseUserID != callerID {
+			return nil, false, errTwitchAccountLinked
+		}
+		account.SupabaseUserID, account.Email = callerID, callerEmail
+	case found:
+		account.SupabaseUserID, account.Email = existing.SupabaseUserID, existing.Email
+	default:
+		if user.Email == "" {
+			return nil, false, errTwitchEmailRequired
+		}
+		newUser, err := admin.AdminCreateUser(types.AdminCreateUserRequest{
+			Email:        user.Email,
+			EmailConfirm: true,
+			UserMetadata: twitchMetadata(user),
+		})
+		if err != nil {
+			if gotrueStatus(err) == http.StatusUnprocessableEntity {
+				return nil, false, errTwitchEmailInUse
+			}
+			return nil, false, fmt.Errorf("failed to create user: %w", err)
+		}
+		account.SupabaseUserID, account.Email = newUser.ID.String(), newUser.Email
+		created = true
+	}
+
+	if !created {
+		id, err := uuid.Parse(account.SupabaseUserID)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid supabase user ID %q: %w", account.SupabaseUserID, err)
+		}
+		_, err = admin.AdminUpdateUser(types.AdminUpdateUserRequest{UserID: id, UserMetadata: twitchMetadata(user)})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to update user metadata: %w", err)
+		}
+	}
+
+	err = db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "twitch_user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "login", "display_name", "avatar_url", "supabase_user_id", "email"}),
+	}).Create(&account).Error
+	if err != nil {
+		return nil, false, err
+	}
+	return &account, created, nil
+}
+
+// twitchLinkStatus maps linkTwitchAccount errors to an HTTP status
+func twitchLinkStatus(err error) int {
+	switch {
+	case errors.Is(err, errTwitchAccountLinked), errors.Is(err, errTwitchEmailInUse):
+		return http.StatusConflict
+	case errors.Is(err, errTwitchEmailRequired):
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// completeTwitchLogin links the Twitch identity behind a fresh grant, stores the grant in the
+// token vault and builds the login response. Callers that aren't signed in get a one-time
+// sign-in link for the linked user, or in cookie session mode are signed in directly. It returns
+// the HTTP status to use on error.
+func completeTwitchLogin(w http.ResponseWriter, r *http.Request, token *twitch.UserToken, user *twitch.User, redirectTo string) (map[string]interface{}, int, error) {
+	ctx := r.Context()
+	if DB == nil {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("database unavailable")
+	}
+	admin, err := supabaseAdmin()
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, err
+	}
+
+	var callerID, callerEmail string
+	if caller, err := getAuthenticatedUser(r); err == nil {
+		callerID, callerEmail = caller.ID.String(), caller.Email
+	}
+	account, created, err := linkTwitchAccount(ctx, DB, admin, callerID, callerEmail, user)
+	if err != nil {
+		return nil, twitchLinkStatus(err), err
+	}
+
+	data := map[string]interface{}{
+		"linked":           true,
+		"created":          created,
+		"supabase_user_id": account.SupabaseUserID,
+		"expires_in":       token.ExpiresIn,
+		"scope":            token.Scope,
+		"user": map[string]interface{}{
+			"id":                user.ID,
+			"login":             user.Login,
+			"display_name":      user.DisplayName,
+			"email":             user.Email,
+			"profile_image_url": user.ProfileImageURL,
+		},
+	}
+
+	// The grant stays server-side when the vault is enabled
+	if twitchTokenKeys != nil {
+		err := storeTwitchToken(ctx, DB, twitchTokenKeys, account.SupabaseUserID, user.ID, user.Login, token, time.Now())
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to store twitch token: %w", err)
+		}
+		data["stored"] = true
+	} else {
+		data["stored"] = false
+		data["access_token"] = token.AccessToken
+		data["refresh_token"] = token.RefreshToken
+		data["token_type"] = token.TokenType
+	}
+
+	if callerID == "" && account.Email != "" {
+		link, err := admin.AdminGenerateLink(types.AdminGenerateLinkRequest{
+			Type:       types.LinkTypeMagicLink,
+			Email:      account.Email,
+			RedirectTo: redirectTo,
+		})
+		if err != nil {
+			return nil, http.StatusBadGateway, fmt.Errorf("failed to create sign-in link: %w", err)
+		}
+		if !sessionCookies {
+			data["sign_in_link"] = link.ActionLink
+			return data, 0, nil
+		}
+
+		// Redeem the link server-side so no Supabase token reaches the browser
+		session, err := verifyForSession(types.VerifyForUserRequest{
+			Type:  types.VerificationTypeMagiclink,
+			Token: link.EmailOTP,
+			Email: account.Email,
+		})
+		if err != nil {
+			return nil, http.StatusBadGateway, fmt.Errorf("failed to sign in: %w", err)
+		}
+		csrfToken, err := startCookieSession(w, r, *session)
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to start session: %w", err)
+		}
+		data["csrf_token"] = csrfToken
+	}
+	return data, 0, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"github.com/supabase-community/gotrue-go"
+	"github.com/supabase-community/supabase-go"
+)
+
+const testSupabaseUserID = "8e9c9f6a-3a55-4e0e-9a0f-1f6b5d2e7c11"
+
+// fakeGoTrue stands in for the GoTrue admin API and records the request bodies it receives
+type fakeGoTrue struct {
+	createStatus int
+	requests     map[string]map[string]interface{}
+}
+
+func (f *fakeGoTrue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	f.requests[r.Method+" "+r.URL.Path] = body
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/admin/users":
+		if f.createStatus != 0 {
+			w.WriteHeader(f.createStatus)
+			_, _ = w.Write([]byte(`{"msg":"email exists"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": testSupabaseUserID, "email": body["email"]})
+	case r.Method == http.MethodDelete:
+		_, _ = w.Write([]byte(`{}`))
+	case r.Method == http.MethodPut:
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": testSupabaseUserID})
+	case r.URL.Path == "/token":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "new-access", "refresh_token": "new-refresh", "expires_in": 3600,
+			"user": map[string]interface{}{"id": testSupabaseUserID},
+		})
+	case r.URL.Path == "/admin/generate_link":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"action_link": "https://sb.example/verify?token=abc", "email_otp": "123456"})
+	case r.URL.Path == "/verify":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "link-access", "refresh_token": "link-refresh", "expires_in": 3600,
+			"user": map[string]interface{}{"id": testSupabaseUserID, "email": body["email"]},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// withFakeGoTrue points the Supabase client at a fake GoTrue server with a service role key set
+func withFakeGoTrue(t *testing.T) (*fakeGoTrue, gotrue.Client) {
+	t.Helper()
+	fake := &fakeGoTrue{requests: map[string]map[string]interface{}{}}
+	withGoTrueServer(t, fake)
+
+	origConfig := Config
+	cfg := VibeConfig{}
+	if Config != nil {
+		cfg = *Config
+	}
+	cfg.SupabaseServiceRoleKey = "service-role"
+	Config = &cfg
+	t.Cleanup(func() { Config = origConfig })
+
+	admin, err := supabaseAdmin()
+	if err != nil {
+		t.Fatalf("Failed to create admin client: %v", err)
+	}
+	return fake, admin
+}
+
+// withGoTrueServer points the Supabase client at a local GoTrue stand-in
+func withGoTrueServer(t *testing.T, handler http.Handler) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	origClient, origURL := SBClient, gotrueURL
+	SBClient = &supabase.Client{Auth: gotrue.New("", "anon").WithCustomGoTrueURL(server.URL)}
+	gotrueURL = server.URL
+	t.Cleanup(func() { SBClient, gotrueURL = origClient, origURL })
+}
+
+func twitchAccountRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "twitch_user_id", "login", "supabase_user_id", "email"})
+}
+
+func TestLinkTwitchAccount_CreatesUser(t *testing.T) {
+	fake, admin := withFakeGoTrue(t)
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+
+	mock.ExpectQuery(`SELECT \* FROM "twitch_accounts" WHERE twitch_user_id = \$1`).
+		WithArgs("42", 1).
+		WillReturnRows(twitchAccountRows())
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "twitch_accounts" .* ON CONFLICT \("twitch_user_id"\) DO UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	user := &twitch.User{ID: "42", Login: "streamer", Email: "streamer@example.com", ProfileImageURL: "https://cdn.example/a.png"}
+	account, created, err := linkTwitchAccount(context.Background(), gormdb, admin, "", "", user)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !created || account.SupabaseUserID != testSupabaseUserID || account.Email != "streamer@example.com" {
+		t.Errorf("Expected a new linked user, got created=%v %+v", created, account)
+	}
+
+	body := fake.requests["POST /admin/users"]
+	twitchMeta, _ := body["user_metadata"].(map[string]interface{})["twitch"].(map[string]interface{})
+	if twitchMeta["user_id"] != "42" || twitchMeta["login"] != "streamer" || twitchMeta["avatar"] != user.ProfileImageURL {
+		t.Errorf("Expected twitch metadata on the new user, got %v", body["user_metadata"])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestLinkTwitchAccount_Errors(t *testing.T) {
+	user := &twitch.User{ID: "42", Login: "streamer", Email: "streamer@example.com"}
+
+	tests := []struct {
+		name         string
+		existing     *sqlmock.Rows
+		callerID     string
+		createStatus int
+		user         *twitch.User
+		expected     error
+		status       int
+	}{
+		{"linked to someone else", twitchAccountRows().AddRow(1, "42", "streamer", "other-user", ""), testSupabaseUserID, 0, user, errTwitchAccountLinked, http.StatusConflict},
+		{"email already registered", twitchAccountRows(), "", http.StatusUnprocessableEntity, user, errTwitchEmailInUse, http.StatusConflict},
+		{"no email", twitchAccountRows(), "", 0, &twitch.User{ID: "42"}, errTwitchEmailRequired, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		fake, admin := withFakeGoTrue(t)
+		fake.createStatus = tt.createStatus
+		sqldb, gormdb, mock := DbMock(t)
+		mock.ExpectQuery(`SELECT \* FROM "twitch_accounts"`).WillReturnRows(tt.existing)
+
+		_, _, err := linkTwitchAccount(context.Background(), gormdb, admin, tt.callerID, "", tt.user)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+		if status := twitchLinkStatus(err); status != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, status)
+		}
+		sqldb.Close()
+	}
+}
+
+func TestGotrueStatus(t *testing.T) {
+	if status := gotrueStatus(errors.New("response status code 422: {\"msg\":\"exists\"}")); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422, got %d", status)
+	}
+	if status := gotrueStatus(errors.New("dial tcp: connection refused")); status != 0 {
+		t.Errorf("Expected 0 for a transport error, got %d", status)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/oauthstate"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deviceSlowDown is how much the poll interval grows each time a device polls too fast (RFC 8628)
+const deviceSlowDown = 5 * time.Second
+
+var (
+	errDeviceLoginNotFound = errors.New("device login not found, start the login again")
+	errDeviceLoginExpired  = errors.New("device code expired, start the login again")
+)
+
+// DeviceLogin is a pending Device Code Grant, so polls landing on any instance can complete it.
+// The device code itself never leaves the server; devices poll with an opaque handle instead.
+type DeviceLogin struct {
+	Handle       string `gorm:"primaryKey"`
+	DeviceCode   string
+	PollInterval time.Duration
+	ExpiresAt    time.Time `gorm:"index"`
+	NextPoll     time.Time
+}
+
+// reservePoll reserves the next poll slot. If the device polled before its interval elapsed,
+// the interval grows and it returns false.
+func (l *DeviceLogin) reservePoll(now time.Time) bool {
+	if now.Before(l.NextPoll) {
+		l.slowDown(now)
+		return false
+	}
+	l.NextPoll = now.Add(l.PollInterval)
+	return true
+}
+
+// slowDown grows the poll interval, after a device polled too fast or Twitch asked it to back off
+func (l *DeviceLogin) slowDown(now time.Time) {
+	l.PollInterval += deviceSlowDown
+	l.NextPoll = now.Add(l.PollInterval)
+}
+
+// deviceLoginStore holds pending device logins by handle
+type deviceLoginStore interface {
+	put(ctx context.Context, login *DeviceLogin) error
+	// claim reserves the next poll slot for a handle; ok is false when the device polled too
+	// fast. Expired logins are dropped.
+	claim(ctx context.Context, handle string, now time.Time) (login DeviceLogin, ok bool, err error)
+	// slowDown grows a handle's poll interval and returns the new one
+	slowDown(ctx context.Context, handle string, now time.Time) (time.Duration, error)
+	remove(ctx context.Context, handle string) error
+}
+
+// deviceLogins holds pending device logins. It starts in memory and is replaced in run().
+var deviceLogins deviceLoginStore = newMemoryDeviceLoginStore()
+
+// deviceLoginMemory is set when there is no database, in which case a device must keep polling
+// the instance that started its login. Swept by startCacheCleanup.
+var deviceLoginMemory *memoryDeviceLoginStore
+
+// newDeviceLoginStore keeps device logins in Postgres when there is a database, otherwise in memory
+func newDeviceLoginStore(db *gorm.DB) deviceLoginStore {
+	if db != nil {
+		return &postgresDeviceLoginStore{db: db}
+	}
+	zlog.Warn().Msg("No database, device logins kept in memory: devices must poll the instance that started them")
+	deviceLoginMemory = newMemoryDeviceLoginStore()
+	return deviceLoginMemory
+}
+
+// memoryDeviceLoginStore keeps device logins in this process
+type memoryDeviceLoginStore struct {
+	mu     sync.Mutex
+	logins map[string]*DeviceLogin
+}
+
+func newMemoryDeviceLoginStore() *memoryDeviceLoginStore {
+	return &memoryDeviceLoginStore{logins: make(map[string]*DeviceLogin)}
+}
+
+func (s *memoryDeviceLoginStore) put(_ context.Context, login *DeviceLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logins[login.Handle] = login
+	return nil
+}
+
+func (s *memoryDeviceLoginStore) claim(_ context.Context, handle string, now time.Time) (DeviceLogin, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, found := s.logins[handle]
+	if !found {
+		return DeviceLogin{}, false, errDeviceLoginNotFound
+	}
+	if now.After(l.ExpiresAt) {
+		delete(s.logins, handle)
+		return DeviceLogin{}, false, errDeviceLoginExpired
+	}
+	ok := l.reservePoll(now)
+	return *l, ok, nil
+}
+
+func (s *memoryDeviceLoginStore) slowDown(_ context.Context, handle string, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, found := s.logins[handle]
+	if !found {
+		return 0, errDeviceLoginNotFound
+	}
+	l.slowDown(now)
+	return l.PollInterval, nil
+}
+
+func (s *memoryDeviceLoginStore) remove(_ context.Context, handle string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.logins, handle)
+	return nil
+}
+
+// sweep drops expired device logins
+func (s *memoryDeviceLoginStore) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for handle, l := range s.logins {
+		if now.After(l.ExpiresAt) {
+			delete(s.logins, handle)
+		}
+	}
+}
+
+// postgresDeviceLoginStore shares device logins between instances through Postgres. Each poll
+// locks the login's row, so concurrent polls for one handle take turns.
+type postgresDeviceLoginStore struct {
+	db *gorm.DB
+}
+
+func (s *postgresDeviceLoginStore) put(ctx context.Context, login *DeviceLogin) error {
+	return s.db.WithContext(ctx).Create(login).Error
+}
+
+func (s *postgresDeviceLoginStore) claim(ctx context.Context, handle string, now time.Time) (DeviceLogin, bool, error) {
+	var login DeviceLogin
+	ok, expired := false, false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockDeviceLogin(tx, handle, &login); err != nil {
+			return err
+		}
+		if now.After(login.ExpiresAt) {
+			expired = true
+			return tx.Delete(&login).Error
+		}
+		ok = login.reservePoll(now)
+		return tx.Save(&login).Error
+	})
+	switch {
+	case err != nil:
+		return DeviceLogin{}, false, err
+	case expired:
+		return DeviceLogin{}, false, errDeviceLoginExpired
+	}
+	return login, ok, nil
+}
+
+func (s *postgresDeviceLoginStore) slowDown(ctx context.Context, handle string, now time.Time) (time.Duration, error) {
+	var login DeviceLogin
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockDeviceLogin(tx, handle, &login); err != nil {
+			return err
+		}
+		login.slowDown(now)
+		return tx.Save(&login).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return login.PollInterval, nil
+}
+
+func (s *postgresDeviceLoginStore) remove(ctx context.Context, handle string) error {
+	return s.db.WithContext(ctx).Where("handle = ?", handle).Delete(&DeviceLogin{}).Error
+}
+
+// lockDeviceLogin loads a device login and holds its row lock until tx ends
+func lockDeviceLogin(tx *gorm.DB, handle string, login *DeviceLogin) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("handle = ?", handle).First(login).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errDeviceLoginNotFound
+	}
+	return err
+}
+
+// sweepDeviceLogins deletes abandoned device logins from the Postgres store
+func sweepDeviceLogins(ctx context.Context, db *gorm.DB, now time.Time) {
+	if err := db.WithContext(ctx).Where("expires_at < ?", now).Delete(&DeviceLogin{}).Error; err != nil {
+		zlog.Error().Err(err).Msg("Failed to sweep device logins")
+	}
+}
+
+// startTwitchDeviceLogin starts a Device Code Grant for clients that can't take a redirect (TVs,
+// consoles). The user enters user_code at verification_uri on another device while this client
+// polls /device/poll with device_handle every interval seconds.
+func startTwitchDeviceLogin(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) startTwitchDeviceLogin: %v", tId, apiVersion)
+
+	twitchClient := r.Context().Value("twitchClient").(twitch.Client)
+
+	auth, err := twitchClient.StartDeviceAuthorization(r.Context(), twitchLoginScopes)
+	if err != nil {
+		zlog.Error().Msgf("(%s) startTwitchDeviceLogin: device authorization error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	handle, err := oauthstate.RandomToken(32)
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	interval := time.Duration(auth.Interval) * time.Second
+	err = deviceLogins.put(r.Context(), &DeviceLogin{
+		Handle:       handle,
+		DeviceCode:   auth.DeviceCode,
+		PollInterval: interval,
+		ExpiresAt:    now.Add(time.Duration(auth.ExpiresIn) * time.Second),
+		NextPoll:     now.Add(interval),
+	})
+	if err != nil {
+		zlog.Error().Msgf("(%s) startTwitchDeviceLogin: store device login error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.Data = map[string]interface{}{
+		"device_handle":    handle,
+		"user_code":        auth.UserCode,
+		"verification_uri": auth.VerificationURI,
+		"expires_in":       auth.ExpiresIn,
+		"interval":         auth.Interval,
+	}
+
+	zlog.Info().Msgf("(%s) startTwitchDeviceLogin done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// pollTwitchDeviceLogin polls a pending device login. While the user hasn't approved yet it
+// answers 202 with status authorization_pending or slow_down and the interval to wait; once
+// approved it answers with the same payload as twitchCallback.
+func pollTwitchDeviceLogin(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) pollTwitchDeviceLogin: %v", tId, apiVersion)
+
+	var body struct {
+		DeviceHandle string `json:"device_handle"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.DeviceHandle == "" {
+		handleErr(w, r, fmt.Errorf("device_handle is required"), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	login, ok, err := deviceLogins.claim(r.Context(), body.DeviceHandle, now)
+	switch {
+	case errors.Is(err, errDeviceLoginNotFound):
+		handleErr(w, r, err, http.StatusNotFound)
+		return
+	case errors.Is(err, errDeviceLoginExpired):
+		handleErr(w, r, err, http.StatusGone)
+		return
+	case err != nil:
+		zlog.Error().Msgf("(%s) pollTwitchDeviceLogin: claim device login error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	case !ok:
+		devicePending(w, r, resp, "slow_down", login.PollInterval)
+		return
+	}
+
+	twitchClient := r.Context().Value("twitchClient").(twitch.Client)
+
+	userToken, err := twitchClient.PollDeviceToken(r.Context(), login.DeviceCode, twitchLoginScopes)
+	switch {
+	case errors.Is(err, twitch.ErrAuthorizationPending):
+		devicePending(w, r, resp, "authorization_pending", login.PollInterval)
+		return
+	case errors.Is(err, twitch.ErrSlowDown):
+		interval, err := deviceLogins.slowDown(r.Context(), body.DeviceHandle, now)
+		if err != nil {
+			zlog.Error().Msgf("(%s) pollTwitchDeviceLogin: slow down device login error: %s", tId, err.Error())
+			interval = login.PollInterval + deviceSlowDown
+		}
+		devicePending(w, r, resp, "slow_down", interval)
+		return
+	case errors.Is(err, twitch.ErrDeviceCodeExpired):
+		removeDeviceLogin(r, body.DeviceHandle)
+		handleErr(w, r, errDeviceLoginExpired, http.StatusGone)
+		return
+	case errors.Is(err, twitch.ErrAccessDenied):
+		removeDeviceLogin(r, body.DeviceHandle)
+		handleErr(w, r, err, http.StatusForbidden)
+		return
+	case err != nil:
+		zlog.Error().Msgf("(%s) pollTwitchDeviceLogin: device token error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadGateway)
+		return
+	}
+	// The device code is spent either way
+	removeDeviceLogin(r, body.DeviceHandle)
+
+	user, err := twitchClient.GetUserInfo(r.Context(), userToken.AccessToken)
+	if err != nil {
+		zlog.Error().Msgf("(%s) pollTwitchDeviceLogin: get user info error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	data, status, err := completeTwitchLogin(w, r, userToken, user, "")
+	if err != nil {
+		zlog.Error().Msgf("(%s) pollTwitchDeviceLogin: link account error: %s", tId, err.Error())
+		handleErr(w, r, err, status)
+		return
+	}
+	resp.Data = data
+
+	zlog.Info().Msgf("(%s) pollTwitchDeviceLogin done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// removeDeviceLogin drops a finished device login; a failure only leaves it for the sweep
+func removeDeviceLogin(r *http.Request, handle string) {
+	if err := deviceLogins.remove(r.Context(), handle); err != nil {
+		zlog.Error().Msgf("(%s) remove device login error: %s", middleware.GetReqID(r.Context()), err.Error())
+	}
+}
+
+// devicePending tells the device to poll again after interval
+func devicePending(w http.ResponseWriter, r *http.Request, resp mytypes.APIHandlerResp, status string, interval time.Duration) {
+	resp.Data = map[string]interface{}{
+		"status":   status,
+		"interval": int(interval.Seconds()),
+	}
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, resp)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+// deviceTwitchClient answers device token polls with pollErr until it is cleared
+type deviceTwitchClient struct {
+	mockTwitchClient
+	pollErr error
+}
+
+func (m *deviceTwitchClient) PollDeviceToken(ctx context.Context, deviceCode string, scopes []string) (*twitch.UserToken, error) {
+	if m.pollErr != nil {
+		return nil, m.pollErr
+	}
+	return &twitch.UserToken{AccessToken: "device_token", ExpiresIn: 14400}, nil
+}
+
+func pollDevice(r *chi.Mux, handle string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/auth/twitch/device/poll", strings.NewReader(`{"device_handle":"`+handle+`"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// pollStatus returns the pending status and interval from a 202 poll response
+func pollStatus(t *testing.T, w *httptest.ResponseRecorder) (string, int) {
+	t.Helper()
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	var response struct {
+		Data struct {
+			Status   string `json:"status"`
+			Interval int    `json:"interval"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	return response.Data.Status, response.Data.Interval
+}
+
+// allowPoll lets the next poll through without waiting out the interval
+func allowPoll(handle string) {
+	store := deviceLogins.(*memoryDeviceLoginStore)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.logins[handle].NextPoll = time.Now().Add(-time.Second)
+}
+
+func TestTwitchDeviceLogin(t *testing.T) {
+	client := &deviceTwitchClient{pollErr: twitch.ErrAuthorizationPending}
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(twitchClientContext(client))
+	r.Mount("/auth", authRouter())
+
+	req := httptest.NewRequest("POST", "/auth/twitch/device", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var start struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &start); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	handle, _ := start.Data["device_handle"].(string)
+	if handle == "" || start.Data["user_code"] != "ABCDEFGH" {
+		t.Fatalf("Expected a device handle and user code, got %v", start.Data)
+	}
+	if _, ok := start.Data["device_code"]; ok {
+		t.Errorf("Expected the device code kept server-side")
+	}
+
+	// Polling before the interval elapses backs the device off
+	if status, interval := pollStatus(t, pollDevice(r, handle)); status != "slow_down" || interval != 10 {
+		t.Errorf("Expected slow_down with a 10s interval, got %s %d", status, interval)
+	}
+
+	allowPoll(handle)
+	if status, _ := pollStatus(t, pollDevice(r, handle)); status != "authorization_pending" {
+		t.Errorf("Expected authorization_pending, got %s", status)
+	}
+
+	allowPoll(handle)
+	client.pollErr = twitch.ErrSlowDown
+	if status, interval := pollStatus(t, pollDevice(r, handle)); status != "slow_down" || interval != 15 {
+		t.Errorf("Expected slow_down with a 15s interval, got %s %d", status, interval)
+	}
+
+	// Approval ends in the callback payload
+	withFakeGoTrue(t)
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+	mock.ExpectQuery(`SELECT \* FROM "twitch_accounts"`).
+		WillReturnRows(twitchAccountRows().AddRow(1, "test_user", "test_login", testSupabaseUserID, "viewer@example.com"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "twitch_accounts"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	allowPoll(handle)
+	client.pollErr = nil
+	w = pollDevice(r, handle)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var done struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &done); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if done.Data["linked"] != true || done.Data["supabase_user_id"] != testSupabaseUserID || done.Data["sign_in_link"] == nil {
+		t.Errorf("Expected the twitchCallback payload, got %v", done.Data)
+	}
+
+	if w := pollDevice(r, handle); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a spent handle to be gone, got %d", w.Code)
+	}
+}
+
+func TestTwitchDeviceLogin_Expired(t *testing.T) {
+	r := setupAuthTestRouter(t)
+	deviceLogins.put(context.Background(), &DeviceLogin{Handle: "expired", DeviceCode: "dev", PollInterval: 5 * time.Second, ExpiresAt: time.Now().Add(-time.Minute)})
+
+	if w := pollDevice(r, "expired"); w.Code != http.StatusGone {
+		t.Errorf("Expected status code %d, got %d", http.StatusGone, w.Code)
+	}
+	if w := pollDevice(r, "expired"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected expired login dropped, got %d", w.Code)
+	}
+}
+
+func TestPostgresDeviceLoginStore_Claim(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	store := &postgresDeviceLoginStore{db: gormdb}
+	now := time.Now()
+	columns := []string{"handle", "device_code", "poll_interval", "expires_at", "next_poll"}
+
+	// Polling too early grows the interval under the row lock
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "device_logins" WHERE handle = \$1 .* FOR UPDATE`).
+		WithArgs("early", 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("early", "dev", int64(5*time.Second), now.Add(time.Minute), now.Add(time.Second)))
+	mock.ExpectExec(`UPDATE "device_logins" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	login, ok, err := store.claim(context.Background(), "early", now)
+	if err != nil || ok || login.PollInterval != 10*time.Second {
+		t.Errorf("Expected slow_down with a 10s interval, got ok=%t interval=%s err=%v", ok, login.PollInterval, err)
+	}
+
+	// An expired login is deleted, and the delete is committed
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "device_logins" WHERE handle = \$1 .* FOR UPDATE`).
+		WithArgs("expired", 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("expired", "dev", int64(5*time.Second), now.Add(-time.Minute), now))
+	mock.ExpectExec(`DELETE FROM "device_logins"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, _, err := store.claim(context.Background(), "expired", now); !errors.Is(err, errDeviceLoginExpired) {
+		t.Errorf("Expected errDeviceLoginExpired, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet SQL expectations: %v", err)
+	}
+}
@@ -68,6 +68,14 @@ func (fc *FollowsCache) Set(userID string, data *twitch.FollowsResponse) {
 	}
 }
 
+// Delete drops a user's cached follows, e.g. when their account is deleted
+func (fc *FollowsCache) Delete(userID string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	delete(fc.cache, userID)
+}
+
 // Clear removes expired entries from cache
 func (fc *FollowsCache) Clear() {
 	fc.mu.Lock()
@@ -84,21 +92,6 @@ func (fc *FollowsCache) Clear() {
 // Global follows cache instance
 var followsCache = NewFollowsCache()
 
-// getMetadataKeys returns the keys from user metadata for debugging
-func getMetadataKeys(metadata map[string]interface{}) []string {
-	if metadata == nil {
-		return []string{"<nil metadata>"}
-	}
-	keys := make([]string, 0, len(metadata))
-	for key := range metadata {
-		keys = append(keys, key)
-	}
-	if len(keys) == 0 {
-		return []string{"<empty metadata>"}
-	}
-	return keys
-}
-
 // cleanupFollowsCache removes expired entries from the global follows cache
 func cleanupFollowsCache() {
 	followsCache.Clear()
@@ -112,6 +105,7 @@ func twitchRouter(twitchClient twitch.Client) http.Handler {
 	r.Get("/streams", getStreamsHandler(twitchClient))
 	r.Get("/categories", getCategoriesHandler(twitchClient))
 	r.Get("/follows", getFollowsHandler(twitchClient))
+	r.Get("/channels/{broadcasterID}/schedule", getChannelScheduleHandler(contentBlocklist))
 	return r
 }
 
@@ -132,6 +126,12 @@ func getTopStreamsHandler(twitchClient twitch.Client) http.HandlerFunc {
 			}
 		}
 
+		safe, err := safeModeFor(r)
+		if err != nil {
+			handleErr(w, r, err, http.StatusBadRequest)
+			return
+		}
+
 		// Fetch top streams from Twitch API
 		streamsResponse, err := twitchClient.GetTopStreams(ctx, count)
 		if err != nil {
@@ -150,6 +150,8 @@ func getTopStreamsHandler(twitchClient twitch.Client) http.HandlerFunc {
 			return
 		}
 
+		streamsResponse.Data = applyAnomalyPolicy(applyVibes(r, applyContentSafety(ctx, twitchClient, streamsResponse.Data, safe)))
+
 		// Build successful response
 		resp := mytypes.APIHandlerResp{
 			TransactionId: tId,
@@ -224,6 +226,12 @@ func getStreamsHandler(twitchClient twitch.Client) http.HandlerFunc {
 			return
 		}
 
+		safe, err := safeModeFor(r)
+		if err != nil {
+			handleErr(w, r, err, http.StatusBadRequest)
+			return
+		}
+
 		// Fetch streams from Twitch API
 		streamsResponse, err := twitchClient.GetStreams(ctx, params)
 		if err != nil {
@@ -242,6 +250,8 @@ func getStreamsHandler(twitchClient twitch.Client) http.HandlerFunc {
 			return
 		}
 
+		streamsResponse.Data = applyAnomalyPolicy(applyVibes(r, applyContentSafety(ctx, twitchClient, streamsResponse.Data, safe)))
+
 		// Build successful response
 		resp := mytypes.APIHandlerResp{
 			TransactionId: tId,
@@ -400,106 +410,32 @@ func getFollowsHandler(twitchClient twitch.Client) http.HandlerFunc {
 		zlog.Info().Msgf("🔍 Request Method: %s, URL: %s", r.Method, r.URL.String())
 		zlog.Info().Msgf("🔑 Authorization Header Present: %t", r.Header.Get("Authorization") != "")
 
-		// Extract and validate Supabase JWT token
-		supabaseToken, err := extractBearerToken(r)
-
-		fmt.Printf("1======================================: %v\n", supabaseToken)
+		// Verify the Supabase access token locally
+		user, err := getAuthenticatedUser(r)
 		if err != nil {
-			zlog.Error().Msgf("❌❌❌ FAILED TO EXTRACT BEARER TOKEN - Transaction ID: %s - Error: %v ❌❌❌", tId, err)
 			zlog.Error().
 				Err(err).
 				Str("transaction_id", tId).
 				Str("api_version", apiVersion).
-				Msg("Failed to extract Supabase JWT token")
+				Msg("Failed to validate Supabase JWT token")
 
-			handleErr(w, r, fmt.Errorf("authentication required"), http.StatusUnauthorized)
+			handleErr(w, r, err, http.StatusUnauthorized)
 			return
 		}
 
-		zlog.Info().Msgf("✅ Successfully extracted Supabase JWT token - Transaction ID: %s", tId)
-
-		// Check for Twitch provider token in headers (fallback approach)
-		twitchProviderToken := r.Header.Get("X-Twitch-Token")
-		zlog.Info().Msgf("🎮 Twitch provider token in headers: %t - Transaction ID: %s", twitchProviderToken != "", tId)
-
-		// Get user information from Supabase token
-		zlog.Info().Msgf("🔐 Attempting to validate Supabase JWT with auth client - Transaction ID: %s", tId)
-		authClient := SBClient.Auth.WithToken(supabaseToken)
-		user, err := authClient.GetUser()
-
+		// The user's Twitch grant lives in the server-side token vault
+		twitchToken, twitchUserID, err := resolveTwitchIdentity(ctx, twitchClient, user.ID.String())
 		if err != nil {
-			zlog.Error().Msgf("❌❌❌ FAILED TO VALIDATE SUPABASE JWT - Transaction ID: %s - Error: %v ❌❌❌", tId, err)
-			zlog.Error().
+			zlog.Warn().
 				Err(err).
 				Str("transaction_id", tId).
-				Str("api_version", apiVersion).
-				Msg("Failed to validate Supabase JWT token")
+				Str("supabase_user_id", user.ID.String()).
+				Msg("No usable Twitch token for user")
 
-			handleErr(w, r, fmt.Errorf("invalid authentication token"), http.StatusUnauthorized)
+			handleErr(w, r, err, twitchIdentityStatus(err))
 			return
 		}
 
-		zlog.Info().Msgf("✅ Successfully validated Supabase JWT - User ID: %s - Transaction ID: %s", user.ID.String(), tId)
-
-		// Extract Twitch token - try metadata first, then fallback to header
-		var twitchToken string
-		var twitchTokenSource string
-
-		zlog.Info().Msgf("🎮 Attempting to extract Twitch token from user metadata - User ID: %s - Transaction ID: %s", user.ID.String(), tId)
-		zlog.Info().Msgf("📊 User metadata keys: %+v", getMetadataKeys(user.User.UserMetadata))
-
-		metadataToken, err := extractTwitchTokenFromUser(&user.User)
-		if err == nil && metadataToken != "" {
-			twitchToken = metadataToken
-			twitchTokenSource = "metadata"
-			zlog.Info().Msgf("✅ Successfully extracted Twitch token from metadata - User ID: %s - Transaction ID: %s", user.ID.String(), tId)
-		} else {
-			zlog.Warn().Msgf("⚠️ Failed to extract Twitch token from metadata - User ID: %s - Transaction ID: %s - Error: %v", user.ID.String(), tId, err)
-			zlog.Warn().Msgf("📊 Full user metadata: %+v", user.User.UserMetadata)
-
-			// Fallback to header token
-			if twitchProviderToken != "" {
-				twitchToken = twitchProviderToken
-				twitchTokenSource = "header"
-				zlog.Info().Msgf("✅ Using Twitch token from header as fallback - User ID: %s - Transaction ID: %s", user.ID.String(), tId)
-			} else {
-				zlog.Error().Msgf("❌❌❌ NO TWITCH TOKEN AVAILABLE - User ID: %s - Transaction ID: %s ❌❌❌", user.ID.String(), tId)
-				handleErr(w, r, fmt.Errorf("twitch authentication required - no token in metadata or headers"), http.StatusForbidden)
-				return
-			}
-		}
-
-		zlog.Info().Msgf("🔑 Using Twitch token from: %s - User ID: %s - Transaction ID: %s", twitchTokenSource, user.ID.String(), tId)
-
-		// Extract Twitch user ID - try metadata first, then fallback to API call
-		var twitchUserID string
-		var userIDSource string
-
-		zlog.Info().Msgf("🆔 Attempting to extract Twitch user ID from user metadata - User ID: %s - Transaction ID: %s", user.ID.String(), tId)
-		metadataUserID, err := extractTwitchUserIDFromUser(&user.User)
-		if err == nil && metadataUserID != "" {
-			twitchUserID = metadataUserID
-			userIDSource = "metadata"
-			zlog.Info().Msgf("✅ Successfully extracted Twitch user ID from metadata: %s - Supabase User ID: %s - Transaction ID: %s", twitchUserID, user.ID.String(), tId)
-		} else {
-			zlog.Warn().Msgf("⚠️ Failed to extract Twitch user ID from metadata - User ID: %s - Transaction ID: %s - Error: %v", user.ID.String(), tId, err)
-			zlog.Warn().Msgf("📊 Full user metadata for ID extraction: %+v", user.User.UserMetadata)
-
-			// Fallback: Get user ID from Twitch API using the token
-			zlog.Info().Msgf("🌐 Fetching Twitch user ID from API as fallback - Transaction ID: %s", tId)
-			twitchUser, err := twitchClient.GetUserInfo(ctx, twitchToken)
-			if err != nil {
-				zlog.Error().Msgf("❌❌❌ FAILED TO GET TWITCH USER ID FROM API - Transaction ID: %s - Error: %v ❌❌❌", tId, err)
-				handleErr(w, r, fmt.Errorf("failed to get twitch user information: %v", err), http.StatusForbidden)
-				return
-			}
-			twitchUserID = twitchUser.ID
-			userIDSource = "api"
-			zlog.Info().Msgf("✅ Successfully fetched Twitch user ID from API: %s (login: %s) - Transaction ID: %s", twitchUserID, twitchUser.Login, tId)
-		}
-
-		zlog.Info().Msgf("🔑 Using Twitch user ID from: %s - ID: %s - Transaction ID: %s", userIDSource, twitchUserID, tId)
-
 		// Check cache first
 		zlog.Info().Msgf("💾 Checking cache for Twitch user ID: %s - Transaction ID: %s", twitchUserID, tId)
 		if cachedFollows, found := followsCache.Get(twitchUserID); found {
@@ -554,6 +490,13 @@ func getFollowsHandler(twitchClient twitch.Client) http.HandlerFunc {
 		zlog.Info().Msgf("💾 Caching follows response - Twitch User ID: %s - Transaction ID: %s", twitchUserID, tId)
 		followsCache.Set(twitchUserID, followsResponse)
 
+		// Keep the digest's view of this user's follows current
+		if DB != nil {
+			if err := syncDigestFollows(ctx, DB, user.ID.String(), followsResponse.Data); err != nil {
+				zlog.Warn().Err(err).Str("transaction_id", tId).Msg("Failed to sync digest follows")
+			}
+		}
+
 		// Build successful response
 		resp := mytypes.APIHandlerResp{
 			TransactionId: tId,
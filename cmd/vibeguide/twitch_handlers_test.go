@@ -19,6 +19,7 @@ import (
 type mockTwitchClient struct {
 	streams    *twitch.StreamsResponse
 	categories *twitch.CategoriesResponse
+	labels     map[string][]string // Content classification labels by broadcaster ID
 	shouldErr  bool
 	errMsg     string
 }
@@ -48,6 +49,34 @@ func (m *mockTwitchClient) ExchangeCodeForToken(ctx context.Context, code, redir
 	return &twitch.UserToken{AccessToken: "test_token"}, nil
 }
 
+func (m *mockTwitchClient) RefreshUserToken(ctx context.Context, refreshToken string) (*twitch.UserToken, error) {
+	if m.shouldErr {
+		return nil, fmt.Errorf("%s", m.errMsg)
+	}
+	return &twitch.UserToken{AccessToken: "refreshed_token", RefreshToken: refreshToken, ExpiresIn: 14400}, nil
+}
+
+func (m *mockTwitchClient) RevokeToken(ctx context.Context, accessToken string) error {
+	if m.shouldErr {
+		return fmt.Errorf("%s", m.errMsg)
+	}
+	return nil
+}
+
+func (m *mockTwitchClient) StartDeviceAuthorization(ctx context.Context, scopes []string) (*twitch.DeviceAuthorization, error) {
+	if m.shouldErr {
+		return nil, fmt.Errorf("%s", m.errMsg)
+	}
+	return &twitch.DeviceAuthorization{DeviceCode: "test_device", UserCode: "ABCDEFGH", VerificationURI: "https://www.twitch.tv/activate", ExpiresIn: 1800, Interval: 5}, nil
+}
+
+func (m *mockTwitchClient) PollDeviceToken(ctx context.Context, deviceCode string, scopes []string) (*twitch.UserToken, error) {
+	if m.shouldErr {
+		return nil, fmt.Errorf("%s", m.errMsg)
+	}
+	return &twitch.UserToken{AccessToken: "test_token"}, nil
+}
+
 func (m *mockTwitchClient) ValidateToken(ctx context.Context, accessToken string) (*twitch.TokenValidation, error) {
 	if m.shouldErr {
 		return nil, fmt.Errorf("%s", m.errMsg)
@@ -86,6 +115,17 @@ func (m *mockTwitchClient) GetUserFollows(ctx context.Context, userID string, us
 	}, nil
 }
 
+func (m *mockTwitchClient) GetChannels(ctx context.Context, broadcasterIDs []string) (*twitch.ChannelsResponse, error) {
+	if m.shouldErr {
+		return nil, fmt.Errorf("%s", m.errMsg)
+	}
+	channels := &twitch.ChannelsResponse{Data: []twitch.ChannelInformation{}}
+	for _, id := range broadcasterIDs {
+		channels.Data = append(channels.Data, twitch.ChannelInformation{BroadcasterID: id, ContentClassificationLabels: m.labels[id]})
+	}
+	return channels, nil
+}
+
 // mockTwitchClientWithLimit implements twitch.Client for testing and tracks the limit parameter
 type mockTwitchClientWithLimit struct {
 	streams       *twitch.StreamsResponse
@@ -126,6 +166,34 @@ func (m *mockTwitchClientWithLimit) ExchangeCodeForToken(ctx context.Context, co
 	return &twitch.UserToken{AccessToken: "test_token"}, nil
 }
 
+func (m *mockTwitchClientWithLimit) RefreshUserToken(ctx context.Context, refreshToken string) (*twitch.UserToken, error) {
+	if m.shouldErr {
+		return nil, fmt.Errorf("%s", m.errMsg)
+	}
+	return &twitch.UserToken{AccessToken: "refreshed_token", RefreshToken: refreshToken, ExpiresIn: 14400}, nil
+}
+
+func (m *mockTwitchClientWithLimit) RevokeToken(ctx context.Context, accessToken string) error {
+	if m.shouldErr {
+		return fmt.Errorf("%s", m.errMsg)
+	}
+	return nil
+}
+
+func (m *mockTwitchClientWithLimit) StartDeviceAuthorization(ctx context.Context, scopes []string) (*twitch.DeviceAuthorization, error) {
+	if m.shouldErr {
+		return nil, fmt.Errorf("%s", m.errMsg)
+	}
+	return &twitch.DeviceAuthorization{DeviceCode: "test_device", UserCode: "ABCDEFGH", VerificationURI: "https://www.twitch.tv/activate", ExpiresIn: 1800, Interval: 5}, nil
+}
+
+func (m *mockTwitchClientWithLimit) PollDeviceToken(ctx context.Context, deviceCode string, scopes []string) (*twitch.UserToken, error) {
+	if m.shouldErr {
+		return nil, fmt.Errorf("%s", m.errMsg)
+	}
+	return &twitch.UserToken{AccessToken: "test_token"}, nil
+}
+
 func (m *mockTwitchClientWithLimit) ValidateToken(ctx context.Context, accessToken string) (*twitch.TokenValidation, error) {
 	if m.shouldErr {
 		return nil, fmt.Errorf("%s", m.errMsg)
@@ -164,6 +232,13 @@ func (m *mockTwitchClientWithLimit) GetUserFollows(ctx context.Context, userID s
 	}, nil
 }
 
+func (m *mockTwitchClientWithLimit) GetChannels(ctx context.Context, broadcasterIDs []string) (*twitch.ChannelsResponse, error) {
+	if m.shouldErr {
+		return nil, fmt.Errorf("%s", m.errMsg)
+	}
+	return &twitch.ChannelsResponse{Data: []twitch.ChannelInformation{}}, nil
+}
+
 // createTestStreamsResponse creates a sample streams response for testing
 func createTestStreamsResponse() *twitch.StreamsResponse {
 	return &twitch.StreamsResponse{
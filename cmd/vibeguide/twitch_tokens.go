@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"github.com/site-tech/VibeGuide/pkg/vault"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+const (
+	// twitchTokenRefreshMargin refreshes access tokens this long before they expire
+	twitchTokenRefreshMargin = 10 * time.Minute
+	// twitchTokenValidateEvery is how often Twitch requires apps to validate user tokens
+	twitchTokenValidateEvery = time.Hour
+)
+
+var (
+	errNoTwitchToken          = errors.New("twitch account not connected, sign in with twitch first")
+	errTwitchVaultUnavailable = errors.New("twitch token storage unavailable")
+)
+
+// twitchTokenKeys seals stored Twitch tokens. Set in run() from TWITCH_TOKEN_KEYS; nil disables
+// the vault, and with it every feature that calls Twitch on a user's behalf.
+var twitchTokenKeys *vault.Keyring
+
+// TwitchToken is a user's Twitch grant, keyed by Supabase user ID. Both tokens are sealed with
+// twitchTokenKeys and bound to the user ID, and never leave the server.
+type TwitchToken struct {
+	ID             uint `gorm:"primarykey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	SupabaseUserID string `gorm:"uniqueIndex"`
+	TwitchUserID   string `gorm:"index"`
+	TwitchLogin    string
+	AccessToken    string   `json:"-"`
+	RefreshToken   string   `json:"-"`
+	Scopes         []string `gorm:"serializer:json"`
+	ExpiresAt      time.Time
+	ValidatedAt    time.Time
+}
+
+func (t *TwitchToken) seal(keys *vault.Keyring, accessToken, refreshToken string) error {
+	access, err := keys.Seal([]byte(accessToken), []byte(t.SupabaseUserID+"/access"))
+	if err != nil {
+		return err
+	}
+	refresh, err := keys.Seal([]byte(refreshToken), []byte(t.SupabaseUserID+"/refresh"))
+	if err != nil {
+		return err
+	}
+	t.AccessToken, t.RefreshToken = access, refresh
+	return nil
+}
+
+func (t *TwitchToken) open(keys *vault.Keyring) (string, string, error) {
+	access, err := keys.Open(t.AccessToken, []byte(t.SupabaseUserID+"/access"))
+	if err != nil {
+		return "", "", err
+	}
+	refresh, err := keys.Open(t.RefreshToken, []byte(t.SupabaseUserID+"/refresh"))
+	if err != nil {
+		return "", "", err
+	}
+	return string(access), string(refresh), nil
+}
+
+// storeTwitchToken seals and upserts a user's Twitch grant
+func storeTwitchToken(ctx context.Context, db *gorm.DB, keys *vault.Keyring, supabaseUserID, twitchUserID, login string, token *twitch.UserToken, now time.Time) error {
+	row := TwitchToken{
+		SupabaseUserID: supabaseUserID,
+		TwitchUserID:   twitchUserID,
+		TwitchLogin:    login,
+		Scopes:         token.Scope,
+		ExpiresAt:      now.Add(time.Duration(token.ExpiresIn) * time.Second),
+		ValidatedAt:    now,
+	}
+	if row.Scopes == nil {
+		row.Scopes = []string{}
+	}
+	if err := row.seal(keys, token.AccessToken, token.RefreshToken); err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "supabase_user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "twitch_user_id", "twitch_login",
+			"access_token", "refresh_token", "scopes", "expires_at", "validated_at"}),
+	}).Create(&row).Error
+}
+
+// resolveTwitchIdentity returns the user's Twitch access token and Twitch user ID from the
+// vault, refreshing the token first if it is about to expire
+func resolveTwitchIdentity(ctx context.Context, twitchClient twitch.Client, supabaseUserID string) (string, string, error) {
+	if DB == nil || twitchTokenKeys == nil {
+		return "", "", errTwitchVaultUnavailable
+	}
+
+	var row TwitchToken
+	err := DB.WithContext(ctx).Where("supabase_user_id = ?", supabaseUserID).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", "", errNoTwitchToken
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	access, refresh, err := row.open(twitchTokenKeys)
+	if err != nil {
+		zlog.Error().Err(err).Str("supabase_user_id", supabaseUserID).Msg("Failed to open stored Twitch token")
+		return "", "", errNoTwitchToken
+	}
+	if time.Until(row.ExpiresAt) < twitchTokenRefreshMargin {
+		access, err = refreshTwitchToken(ctx, DB, twitchClient, &row, refresh, time.Now())
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return access, row.TwitchUserID, nil
+}
+
+// twitchIdentityStatus maps resolveTwitchIdentity errors to an HTTP status
+func twitchIdentityStatus(err error) int {
+	switch {
+	case errors.Is(err, errNoTwitchToken):
+		return http.StatusForbidden
+	case errors.Is(err, errTwitchVaultUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// refreshTwitchToken exchanges the stored refresh token and reseals the new pair with the
+// primary key. A grant Twitch no longer accepts is deleted.
+func refreshTwitchToken(ctx context.Context, db *gorm.DB, twitchClient twitch.Client, row *TwitchToken, refreshToken string, now time.Time) (string, error) {
+	token, err := twitchClient.RefreshUserToken(ctx, refreshToken)
+	if errors.Is(err, twitch.ErrTokenInvalid) {
+		zlog.Info().Str("twitch_user_id", row.TwitchUserID).Msg("Twitch grant revoked, removing stored token")
+		if err := db.WithContext(ctx).Delete(row).Error; err != nil {
+			return "", err
+		}
+		return "", errNoTwitchToken
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh twitch token: %w", err)
+	}
+
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	if err := row.seal(twitchTokenKeys, token.AccessToken, token.RefreshToken); err != nil {
+		return "", err
+	}
+	row.ExpiresAt = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	row.ValidatedAt = now
+	if len(token.Scope) > 0 {
+		row.Scopes = token.Scope
+	}
+	err = db.WithContext(ctx).Model(row).Select("access_token", "refresh_token", "expires_at", "validated_at", "scopes").Updates(row).Error
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// startTwitchTokenMaintenance keeps stored Twitch tokens valid: it refreshes tokens due to expire
+// before the next run, validates each token hourly and reseals tokens sealed with retired keys
+func startTwitchTokenMaintenance(ctx context.Context, twitchClient twitch.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checked, err := maintainTwitchTokens(ctx, DB, twitchClient, interval, time.Now())
+		workerHeartbeats.Beat(workerTwitchTokens, err)
+		if err != nil {
+			zlog.Error().Err(err).Msg("Twitch token maintenance failed")
+		} else if checked > 0 {
+			zlog.Info().Int("tokens", checked).Msg("Twitch token maintenance completed")
+		}
+
+		select {
+		case <-ctx.Done():
+			zlog.Info().Msg("Twitch token maintenance stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// maintainTwitchTokens runs one maintenance pass and returns the number of tokens that needed work
+func maintainTwitchTokens(ctx context.Context, db *gorm.DB, twitchClient twitch.Client, interval time.Duration, now time.Time) (int, error) {
+	var rows []TwitchToken
+	err := db.WithContext(ctx).
+		Where("expires_at <= ? OR validated_at <= ?", now.Add(interval+twitchTokenRefreshMargin), now.Add(-twitchTokenValidateEvery)).
+		Or("access_token NOT LIKE ?", twitchTokenKeys.Primary()+".%").
+		Order("id").
+		Find(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range rows {
+		if ctx.Err() != nil {
+			return i, ctx.Err()
+		}
+		if err := maintainTwitchToken(ctx, db, twitchClient, &rows[i], interval, now); err != nil {
+			zlog.Warn().Err(err).Str("twitch_user_id", rows[i].TwitchUserID).Msg("Failed to maintain Twitch token")
+		}
+	}
+	return len(rows), nil
+}
+
+func maintainTwitchToken(ctx context.Context, db *gorm.DB, twitchClient twitch.Client, row *TwitchToken, interval time.Duration, now time.Time) error {
+	access, refresh, err := row.open(twitchTokenKeys)
+	if err != nil {
+		// Sealed with a key that has since been dropped; the user has to connect again
+		zlog.Warn().Err(err).Str("twitch_user_id", row.TwitchUserID).Msg("Removing unreadable Twitch token")
+		return db.WithContext(ctx).Delete(row).Error
+	}
+
+	if row.ExpiresAt.Before(now.Add(interval + twitchTokenRefreshMargin)) {
+		_, err := refreshTwitchToken(ctx, db, twitchClient, row, refresh, now)
+		if errors.Is(err, errNoTwitchToken) {
+			return nil
+		}
+		return err
+	}
+
+	if !row.ValidatedAt.After(now.Add(-twitchTokenValidateEvery)) {
+		_, err := twitchClient.ValidateToken(ctx, access)
+		if errors.Is(err, twitch.ErrTokenInvalid) {
+			// Access tokens can be invalidated early (password change, etc.); the refresh token may still work
+			_, err = refreshTwitchToken(ctx, db, twitchClient, row, refresh, now)
+			if errors.Is(err, errNoTwitchToken) {
+				return nil
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		row.ValidatedAt = now
+	}
+
+	if twitchTokenKeys.NeedsRotation(row.AccessToken) || twitchTokenKeys.NeedsRotation(row.RefreshToken) {
+		if err := row.seal(twitchTokenKeys, access, refresh); err != nil {
+			return err
+		}
+	}
+	return db.WithContext(ctx).Model(row).Select("access_token", "refresh_token", "validated_at").Updates(row).Error
+}
+
+// ============= HANDLERS =============
+
+// storeTwitchProviderToken takes the Twitch tokens Supabase hands the browser after a Twitch
+// sign-in and moves them into the vault, so later requests don't need to send them
+func storeTwitchProviderToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tId := middleware.GetReqID(ctx)
+	apiVersion := ctx.Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) storeTwitchProviderToken: %v", tId, apiVersion)
+
+	// Get Twitch client from context
+	twitchClient := ctx.Value("twitchClient").(twitch.Client)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if twitchTokenKeys == nil {
+		handleErr(w, r, errTwitchVaultUnavailable, http.StatusServiceUnavailable)
+		return
+	}
+
+	var body struct {
+		ProviderToken        string `json:"provider_token"`
+		ProviderRefreshToken string `json:"provider_refresh_token"`
+	}
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) storeTwitchProviderToken: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if body.ProviderToken == "" || body.ProviderRefreshToken == "" {
+		handleErr(w, r, fmt.Errorf("provider_token and provider_refresh_token are required"), http.StatusBadRequest)
+		return
+	}
+
+	validation, err := twitchClient.ValidateToken(ctx, body.ProviderToken)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("invalid twitch token"), http.StatusBadRequest)
+		return
+	}
+	// Only tokens issued to this app can be refreshed with our client secret
+	if Config != nil && validation.ClientID != Config.TwitchClientID {
+		handleErr(w, r, fmt.Errorf("twitch token was issued to a different application"), http.StatusBadRequest)
+		return
+	}
+
+	token := &twitch.UserToken{
+		AccessToken:  body.ProviderToken,
+		RefreshToken: body.ProviderRefreshToken,
+		ExpiresIn:    validation.ExpiresIn,
+		Scope:        validation.Scopes,
+	}
+	err = storeTwitchToken(ctx, DB, twitchTokenKeys, userID, validation.UserID, validation.Login, token, time.Now())
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = map[string]any{
+		"twitch_user_id": validation.UserID,
+		"login":          validation.Login,
+		"scopes":         validation.Scopes,
+	}
+
+	zlog.Info().Msgf("(%s) storeTwitchProviderToken done.", tId)
+	render.JSON(w, r, resp)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"github.com/site-tech/VibeGuide/pkg/vault"
+)
+
+// withTestTokenKeys installs a token vault keyring for the duration of the test
+func withTestTokenKeys(t *testing.T, spec string) {
+	t.Helper()
+	keys, err := vault.ParseKeyring(spec)
+	if err != nil {
+		t.Fatalf("Failed to parse keyring: %v", err)
+	}
+	orig := twitchTokenKeys
+	twitchTokenKeys = keys
+	t.Cleanup(func() { twitchTokenKeys = orig })
+}
+
+func testTokenKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, vault.KeySize))
+}
+
+// sealedTokenRow returns the columns of a stored token sealed with the current keyring
+func sealedTokenRow(t *testing.T, supabaseUserID string, expiresAt, validatedAt time.Time) *sqlmock.Rows {
+	t.Helper()
+	row := TwitchToken{SupabaseUserID: supabaseUserID}
+	if err := row.seal(twitchTokenKeys, "stored-access", "stored-refresh"); err != nil {
+		t.Fatalf("Failed to seal token: %v", err)
+	}
+	return sqlmock.NewRows([]string{"id", "supabase_user_id", "twitch_user_id", "access_token", "refresh_token", "expires_at", "validated_at"}).
+		AddRow(3, supabaseUserID, "42", row.AccessToken, row.RefreshToken, expiresAt, validatedAt)
+}
+
+type revokedTwitchClient struct {
+	mockTwitchClient
+}
+
+func (m *revokedTwitchClient) RefreshUserToken(ctx context.Context, refreshToken string) (*twitch.UserToken, error) {
+	return nil, twitch.ErrTokenInvalid
+}
+
+func TestResolveTwitchIdentity_UsesStoredToken(t *testing.T) {
+	withTestTokenKeys(t, "k1:"+testTokenKey(1))
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	mock.ExpectQuery(`SELECT \* FROM "twitch_tokens" WHERE supabase_user_id = \$1`).
+		WithArgs("sb-1", 1).
+		WillReturnRows(sealedTokenRow(t, "sb-1", time.Now().Add(2*time.Hour), time.Now()))
+
+	token, twitchUserID, err := resolveTwitchIdentity(context.Background(), &mockTwitchClient{}, "sb-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if token != "stored-access" || twitchUserID != "42" {
+		t.Errorf("Expected the stored token for Twitch user 42, got %q, %q", token, twitchUserID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestResolveTwitchIdentity_RefreshesExpiringToken(t *testing.T) {
+	withTestTokenKeys(t, "k1:"+testTokenKey(1))
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	mock.ExpectQuery(`SELECT \* FROM "twitch_tokens" WHERE supabase_user_id = \$1`).
+		WithArgs("sb-1", 1).
+		WillReturnRows(sealedTokenRow(t, "sb-1", time.Now().Add(time.Minute), time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "twitch_tokens" SET .*"access_token"=.*"expires_at"=.* WHERE "id" = `).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	token, _, err := resolveTwitchIdentity(context.Background(), &mockTwitchClient{}, "sb-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if token != "refreshed_token" {
+		t.Errorf("Expected the refreshed token, got %q", token)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestResolveTwitchIdentity_NotConnected(t *testing.T) {
+	withTestTokenKeys(t, "k1:"+testTokenKey(1))
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	mock.ExpectQuery(`SELECT \* FROM "twitch_tokens"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, _, err := resolveTwitchIdentity(context.Background(), &mockTwitchClient{}, "sb-1")
+	if !errors.Is(err, errNoTwitchToken) || twitchIdentityStatus(err) != 403 {
+		t.Errorf("Expected errNoTwitchToken (403), got: %v", err)
+	}
+}
+
+func TestMaintainTwitchTokens_RemovesRevokedGrant(t *testing.T) {
+	withTestTokenKeys(t, "k1:"+testTokenKey(1))
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT \* FROM "twitch_tokens" WHERE \(expires_at <= \$1 OR validated_at <= \$2\) OR access_token NOT LIKE \$3`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "k1.%").
+		WillReturnRows(sealedTokenRow(t, "sb-1", now.Add(5*time.Minute), now))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "twitch_tokens" WHERE "twitch_tokens"."id" = \$1`).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	checked, err := maintainTwitchTokens(context.Background(), gormdb, &revokedTwitchClient{}, 15*time.Minute, now)
+	if err != nil || checked != 1 {
+		t.Fatalf("Expected one token checked, got %d, %v", checked, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestMaintainTwitchTokens_ResealsRotatedKey(t *testing.T) {
+	withTestTokenKeys(t, "k1:"+testTokenKey(1))
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+
+	now := time.Now()
+	rows := sealedTokenRow(t, "sb-1", now.Add(3*time.Hour), now)
+	// k2 becomes the primary key; k1 stays so existing tokens can still be read
+	withTestTokenKeys(t, "k2:"+testTokenKey(2)+",k1:"+testTokenKey(1))
+
+	mock.ExpectQuery(`SELECT \* FROM "twitch_tokens"`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "k2.%").
+		WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "twitch_tokens" SET .*"access_token"=\$2,"refresh_token"=\$3,"validated_at"=\$4 WHERE "id" = \$5`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := maintainTwitchTokens(context.Background(), gormdb, &mockTwitchClient{}, 15*time.Minute, now); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
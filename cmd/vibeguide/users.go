@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// usersRouter creates a router for the signed-in user's own account and settings
+func usersRouter() http.Handler {
+	r := chi.NewRouter()
+	r.With(Authenticate).Get("/me", getCurrentUser)
+	r.With(Authenticate).Delete("/me", deleteAccount)
+	r.With(Authenticate).Get("/me/export", exportAccount)
+	r.With(Authenticate).Get("/me/api-keys", listAPIKeys)
+	r.With(Authenticate).Post("/me/api-keys", createAPIKey)
+	r.With(Authenticate).Delete("/me/api-keys/{id}", revokeAPIKey)
+	r.Get("/me/preferences", getViewingPreference)
+	r.Put("/me/preferences", updateViewingPreference)
+	return r
+}
+
+// getCurrentUser returns the local user row and role for the caller
+func getCurrentUser(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getCurrentUser: %v", tId, apiVersion)
+
+	user, _ := currentUser(r)
+	resp.Data = user
+
+	zlog.Info().Msgf("(%s) getCurrentUser done.", tId)
+	render.JSON(w, r, resp)
+}
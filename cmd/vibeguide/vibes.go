@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/site-tech/VibeGuide/pkg/mytypes"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+	"gorm.io/gorm"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Vibe rule fields
+const (
+	vibeRuleTag          = "tag"           // Stream tag, case-insensitive
+	vibeRuleCategory     = "category"      // Game ID, or game name case-insensitive
+	vibeRuleLanguage     = "language"      // ISO 639-1 stream language
+	vibeRuleTitleKeyword = "title_keyword" // Case-insensitive substring of the title
+)
+
+const (
+	// maxVibeRules bounds the size of a vibe definition
+	maxVibeRules = 50
+	// maxVibeCategoryFetches bounds how many per-category GetStreams calls one evaluation makes
+	maxVibeCategoryFetches = 5
+)
+
+// Vibe is a named mood such as "cozy" or "speedrun focus", defined by rules matched against live streams
+type Vibe struct {
+	gorm.Model
+	SupabaseUserID string     `gorm:"index" json:"-"`
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Public         bool       `json:"public"`
+	Rules          []VibeRule `gorm:"constraint:OnDelete:CASCADE" json:"rules"`
+}
+
+// VibeRule is one matching rule of a vibe. Matching include rules add their weight to a
+// stream's score; a matching exclude rule removes the stream.
+type VibeRule struct {
+	ID      uint    `gorm:"primarykey" json:"id"`
+	VibeID  uint    `gorm:"index" json:"-"`
+	Field   string  `json:"field"`
+	Value   string  `json:"value"`
+	Weight  float64 `json:"weight"`
+	Exclude bool    `json:"exclude"`
+}
+
+// VibeMatch is a live stream ranked against a vibe
+type VibeMatch struct {
+	twitch.Stream
+	Score   float64  `json:"score"`
+	Matched []string `json:"matched"` // "field:value" of each include rule that matched
+}
+
+// validateVibe checks a vibe submitted by a user, defaulting rule weights to 1
+func validateVibe(vibe *Vibe) error {
+	vibe.Name = strings.TrimSpace(vibe.Name)
+	if vibe.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(vibe.Rules) == 0 {
+		return fmt.Errorf("at least one rule is required")
+	}
+	if len(vibe.Rules) > maxVibeRules {
+		return fmt.Errorf("a vibe can have at most %d rules, got %d", maxVibeRules, len(vibe.Rules))
+	}
+
+	hasContentRule := false
+	for i := range vibe.Rules {
+		rule := &vibe.Rules[i]
+		rule.Value = strings.TrimSpace(rule.Value)
+		if rule.Value == "" {
+			return fmt.Errorf("rule %d: value is required", i)
+		}
+		switch rule.Field {
+		case vibeRuleTag, vibeRuleCategory, vibeRuleTitleKeyword:
+			if !rule.Exclude {
+				hasContentRule = true
+			}
+		case vibeRuleLanguage:
+		default:
+			return fmt.Errorf("rule %d: field must be one of %s, %s, %s or %s, got %s", i,
+				vibeRuleTag, vibeRuleCategory, vibeRuleLanguage, vibeRuleTitleKeyword, rule.Field)
+		}
+		if rule.Weight < 0 {
+			return fmt.Errorf("rule %d: weight must not be negative", i)
+		}
+		if rule.Weight == 0 {
+			rule.Weight = 1
+		}
+	}
+	if !hasContentRule {
+		return fmt.Errorf("at least one tag, category or title_keyword include rule is required")
+	}
+	return nil
+}
+
+// ruleMatches reports whether a single rule matches a stream
+func ruleMatches(rule VibeRule, stream twitch.Stream) bool {
+	switch rule.Field {
+	case vibeRuleTag:
+		for _, tag := range stream.Tags {
+			if strings.EqualFold(tag, rule.Value) {
+				return true
+			}
+		}
+	case vibeRuleCategory:
+		return rule.Value == stream.GameID || strings.EqualFold(rule.Value, stream.GameName)
+	case vibeRuleLanguage:
+		return strings.EqualFold(rule.Value, stream.Language)
+	case vibeRuleTitleKeyword:
+		return strings.Contains(strings.ToLower(stream.Title), strings.ToLower(rule.Value))
+	}
+	return false
+}
+
+// scoreVibe evaluates a vibe's rules against a stream. Language include rules restrict the
+// stream to one of the listed languages; at least one tag, category or title rule must match.
+func scoreVibe(rules []VibeRule, stream twitch.Stream) (VibeMatch, bool) {
+	match := VibeMatch{Stream: stream}
+	requiresLanguage, languageOK, contentMatched := false, false, false
+
+	for _, rule := range rules {
+		matches := ruleMatches(rule, stream)
+		if rule.Exclude {
+			if matches {
+				return match, false
+			}
+			continue
+		}
+		if rule.Field == vibeRuleLanguage {
+			requiresLanguage = true
+			languageOK = languageOK || matches
+		} else if matches {
+			contentMatched = true
+		}
+		if matches {
+			match.Score += rule.Weight
+			match.Matched = append(match.Matched, rule.Field+":"+rule.Value)
+		}
+	}
+
+	if !contentMatched || (requiresLanguage && !languageOK) {
+		return match, false
+	}
+	return match, true
+}
+
+// rankVibeStreams scores streams against a vibe and orders matches by score, then viewers
+func rankVibeStreams(rules []VibeRule, streams []twitch.Stream) []VibeMatch {
+	matches := []VibeMatch{}
+	seen := make(map[string]bool, len(streams))
+	for _, stream := range streams {
+		if seen[stream.ID] {
+			continue
+		}
+		seen[stream.ID] = true
+		if match, ok := scoreVibe(rules, stream); ok {
+			matches = append(matches, match)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ViewerCount > matches[j].ViewerCount
+	})
+	return matches
+}
+
+// applyMatchAnomalyPolicy applies the anomaly policy to ranked matches, keeping their scores
+func applyMatchAnomalyPolicy(matches []VibeMatch) []VibeMatch {
+	streams := make([]twitch.Stream, len(matches))
+	byID := make(map[string]VibeMatch, len(matches))
+	for i, match := range matches {
+		streams[i] = match.Stream
+		byID[match.ID] = match
+	}
+
+	result := make([]VibeMatch, 0, len(matches))
+	for _, stream := range applyAnomalyPolicy(streams) {
+		match := byID[stream.ID]
+		match.Stream = stream
+		result = append(result, match)
+	}
+	return result
+}
+
+// fetchVibeCandidates gathers live streams to evaluate: the top streams plus the top
+// streams of each category the vibe names by game ID
+func fetchVibeCandidates(ctx context.Context, twitchClient twitch.Client, rules []VibeRule) ([]twitch.Stream, error) {
+	top, err := twitchClient.GetStreams(ctx, twitch.StreamsQueryParams{Limit: twitch.MaxStreamQueryLimit, Sort: "viewers"})
+	if err != nil {
+		return nil, err
+	}
+	candidates := top.Data
+
+	fetched := 0
+	for _, rule := range rules {
+		if rule.Field != vibeRuleCategory || rule.Exclude || twitch.ValidateGameID(rule.Value) != nil {
+			continue
+		}
+		if fetched == maxVibeCategoryFetches {
+			break
+		}
+		fetched++
+
+		streams, err := twitchClient.GetStreams(ctx, twitch.StreamsQueryParams{
+			Limit:  twitch.MaxStreamQueryLimit,
+			GameID: rule.Value,
+			Sort:   "viewers",
+		})
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, streams.Data...)
+	}
+	return candidates, nil
+}
+
+// ============= HANDLERS =============
+
+// optionalUserID returns the caller's Supabase user ID, or "" for anonymous or unverifiable requests
+func optionalUserID(r *http.Request) string {
+	if r.Header.Get("Authorization") == "" {
+		return ""
+	}
+	user, err := getAuthenticatedUser(r)
+	if err != nil {
+		return ""
+	}
+	return user.ID.String()
+}
+
+// loadVisibleVibe loads the vibe identified by the {id} URL param if it is public or owned by
+// the caller. With ownerOnly set, public vibes of other users are not found either.
+func loadVisibleVibe(w http.ResponseWriter, r *http.Request, userID string, ownerOnly bool) (*Vibe, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("id must be numeric"), http.StatusBadRequest)
+		return nil, false
+	}
+	if DB == nil {
+		handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	query := DB.WithContext(r.Context()).Preload("Rules")
+	if ownerOnly {
+		query = query.Where("id = ? AND supabase_user_id = ?", id, userID)
+	} else {
+		query = query.Where("id = ? AND (public = ? OR supabase_user_id = ?)", id, true, userID)
+	}
+
+	var vibe Vibe
+	err = query.First(&vibe).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handleErr(w, r, fmt.Errorf("not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return nil, false
+	}
+	return &vibe, true
+}
+
+// vibeBody is the request body for creating or replacing a vibe
+type vibeBody struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Public      bool       `json:"public"`
+	Rules       []VibeRule `json:"rules"`
+}
+
+// listVibes returns public vibes plus the caller's own when authenticated
+func listVibes(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) listVibes: %v", tId, apiVersion)
+
+	if DB == nil {
+		handleErr(w, r, fmt.Errorf("database unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var vibes []Vibe
+	err := DB.WithContext(r.Context()).Preload("Rules").
+		Where("public = ? OR supabase_user_id = ?", true, optionalUserID(r)).
+		Order("id").
+		Find(&vibes).Error
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = vibes
+
+	zlog.Info().Msgf("(%s) listVibes done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func createVibe(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) createVibe: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var body vibeBody
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) createVibe: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	vibe := Vibe{
+		SupabaseUserID: userID,
+		Name:           body.Name,
+		Description:    body.Description,
+		Public:         body.Public,
+		Rules:          body.Rules,
+	}
+	for i := range vibe.Rules {
+		vibe.Rules[i].ID = 0
+	}
+	if err := validateVibe(&vibe); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := DB.WithContext(r.Context()).Create(&vibe).Error; err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = vibe
+
+	zlog.Info().Msgf("(%s) createVibe done.", tId)
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, resp)
+}
+
+func getVibe(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) getVibe: %v", tId, apiVersion)
+
+	vibe, ok := loadVisibleVibe(w, r, optionalUserID(r), false)
+	if !ok {
+		return
+	}
+	resp.Data = vibe
+
+	zlog.Info().Msgf("(%s) getVibe done.", tId)
+	render.JSON(w, r, resp)
+}
+
+func updateVibe(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) updateVibe: %v", tId, apiVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	vibe, ok := loadVisibleVibe(w, r, userID, true)
+	if !ok {
+		return
+	}
+
+	var body vibeBody
+	if err := render.DecodeJSON(r.Body, &body); err != nil {
+		zlog.Error().Msgf("(%s) updateVibe: body decode error: %s", tId, err.Error())
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	vibe.Name = body.Name
+	vibe.Description = body.Description
+	vibe.Public = body.Public
+	vibe.Rules = body.Rules
+	for i := range vibe.Rules {
+		vibe.Rules[i].ID = 0
+		vibe.Rules[i].VibeID = vibe.ID
+	}
+	if err := validateVibe(vibe); err != nil {
+		handleErr(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	// Rules are replaced wholesale rather than diffed
+	err := DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("vibe_id = ?", vibe.ID).Delete(&VibeRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(vibe).Error
+	})
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	resp.Data = vibe
+
+	zlog.Info().Msgf("(%s) updateVibe done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// deleteVibe removes a vibe and its rules. The vibe is hard-deleted: a soft delete would leave the
+// rules behind, since the OnDelete:CASCADE constraint only fires when the row really goes.
+func deleteVibe(w http.ResponseWriter, r *http.Request) {
+	tId := middleware.GetReqID(r.Context())
+	apiVersion := r.Context().Value(apivctx).(string)
+	resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+	zlog.Info().Msgf("(%s) deleteVibe: %v", tId, apiVersion)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		handleErr(w, r, fmt.Errorf("id must be numeric"), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var deleted int64
+	err = DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("id = ? AND supabase_user_id = ?", id, userID).Delete(&Vibe{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		// Deleted explicitly too: tables created before the constraint was added have no cascade
+		return tx.Where("vibe_id = ?", id).Delete(&VibeRule{}).Error
+	})
+	if err != nil {
+		handleErr(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if deleted == 0 {
+		handleErr(w, r, fmt.Errorf("not found"), http.StatusNotFound)
+		return
+	}
+
+	zlog.Info().Msgf("(%s) deleteVibe done.", tId)
+	render.JSON(w, r, resp)
+}
+
+// getVibeStreamsHandler evaluates a vibe against live streams and returns the ranked matches
+func getVibeStreamsHandler(twitchClient twitch.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tId := middleware.GetReqID(ctx)
+		apiVersion := ctx.Value(apivctx).(string)
+		resp := mytypes.APIHandlerResp{TransactionId: tId, ApiVersion: apiVersion}
+		zlog.Info().Msgf("(%s) getVibeStreams: %v", tId, apiVersion)
+
+		limit := twitch.DefaultQueryLimit
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil {
+				handleErr(w, r, fmt.Errorf("invalid limit parameter: must be a number"), http.StatusBadRequest)
+				return
+			}
+			if err := twitch.ValidateLimit(parsed); err != nil {
+				handleErr(w, r, err, http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		safe, err := safeModeFor(r)
+		if err != nil {
+			handleErr(w, r, err, http.StatusBadRequest)
+			return
+		}
+		vibe, ok := loadVisibleVibe(w, r, optionalUserID(r), false)
+		if !ok {
+			return
+		}
+
+		candidates, err := fetchVibeCandidates(ctx, twitchClient, vibe.Rules)
+		if err != nil {
+			handleErr(w, r, err, determineErrorStatusCode(err))
+			return
+		}
+		candidates = applyVibes(r, applyContentSafety(ctx, twitchClient, candidates, safe))
+		// The policy runs on the ranked list so demoted streams stay below the others
+		matches := applyMatchAnomalyPolicy(rankVibeStreams(vibe.Rules, candidates))
+		if len(matches) > limit {
+			matches = matches[:limit]
+		}
+
+		resp.Data = map[string]any{
+			"vibe":    vibe,
+			"streams": matches,
+		}
+
+		zlog.Info().Msgf("(%s) getVibeStreams done. candidates: %d, matches: %d", tId, len(candidates), len(matches))
+		render.JSON(w, r, resp)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/site-tech/VibeGuide/pkg/supajwt"
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+func TestValidateVibe(t *testing.T) {
+	tests := []struct {
+		name    string
+		vibe    Vibe
+		wantErr bool
+	}{
+		{"tag rule", Vibe{Name: "cozy", Rules: []VibeRule{{Field: vibeRuleTag, Value: "Cozy"}}}, false},
+		{"missing name", Vibe{Rules: []VibeRule{{Field: vibeRuleTag, Value: "Cozy"}}}, true},
+		{"no rules", Vibe{Name: "cozy"}, true},
+		{"only language", Vibe{Name: "english", Rules: []VibeRule{{Field: vibeRuleLanguage, Value: "en"}}}, true},
+		{"only exclusions", Vibe{Name: "calm", Rules: []VibeRule{{Field: vibeRuleTag, Value: "Rage", Exclude: true}}}, true},
+		{"unknown field", Vibe{Name: "cozy", Rules: []VibeRule{{Field: "mood", Value: "cozy"}}}, true},
+		{"empty value", Vibe{Name: "cozy", Rules: []VibeRule{{Field: vibeRuleTag, Value: " "}}}, true},
+		{"negative weight", Vibe{Name: "cozy", Rules: []VibeRule{{Field: vibeRuleTag, Value: "Cozy", Weight: -1}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateVibe(&tt.vibe)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %t, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	vibe := Vibe{Name: "cozy", Rules: []VibeRule{{Field: vibeRuleTag, Value: "Cozy"}}}
+	if err := validateVibe(&vibe); err != nil || vibe.Rules[0].Weight != 1 {
+		t.Errorf("Expected default weight 1, got %v (err %v)", vibe.Rules[0].Weight, err)
+	}
+}
+
+func TestRankVibeStreams(t *testing.T) {
+	streams := []twitch.Stream{
+		{ID: "1", Title: "Cozy morning art", Tags: []string{"Cozy", "Art"}, Language: "en", ViewerCount: 100},
+		{ID: "2", Title: "chill cozy vibes", Tags: []string{"cozy"}, Language: "en", ViewerCount: 900},
+		{ID: "3", Title: "RAGE speedrun", Tags: []string{"Cozy"}, Language: "en", ViewerCount: 5000},
+		{ID: "4", Title: "cozy stream", Tags: []string{"Cozy"}, Language: "de", ViewerCount: 300},
+		{ID: "5", Title: "Just talking", GameID: "509658", GameName: "Just Chatting", Language: "en", ViewerCount: 50},
+		{ID: "1", Title: "Cozy morning art", Tags: []string{"Cozy", "Art"}, Language: "en", ViewerCount: 100},
+	}
+	rules := []VibeRule{
+		{Field: vibeRuleTag, Value: "cozy", Weight: 2},
+		{Field: vibeRuleTitleKeyword, Value: "cozy", Weight: 1},
+		{Field: vibeRuleTag, Value: "art", Weight: 1},
+		{Field: vibeRuleCategory, Value: "just chatting", Weight: 0.5},
+		{Field: vibeRuleLanguage, Value: "en", Weight: 0},
+		{Field: vibeRuleTitleKeyword, Value: "rage", Exclude: true},
+	}
+
+	matches := rankVibeStreams(rules, streams)
+
+	var ids []string
+	for _, m := range matches {
+		ids = append(ids, m.ID)
+	}
+	// 1 scores 4, 2 scores 3, 5 scores 0.5; 3 is excluded and 4 has the wrong language
+	expected := []string{"1", "2", "5"}
+	if len(ids) != len(expected) {
+		t.Fatalf("Expected matches %v, got %v", expected, ids)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Fatalf("Expected matches %v, got %v", expected, ids)
+		}
+	}
+	if matches[0].Score != 4 || len(matches[0].Matched) != 4 {
+		t.Errorf("Expected score 4 with 4 matched rules, got %v %v", matches[0].Score, matches[0].Matched)
+	}
+}
+
+func TestGetVibeStreamsHandler(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	mock.ExpectQuery(`SELECT \* FROM "vibes" WHERE \(id = \$1 AND \(public = \$2 OR supabase_user_id = \$3\)\)`).
+		WithArgs(4, true, "", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "public"}).AddRow(4, "roleplay", true))
+	mock.ExpectQuery(`SELECT \* FROM "vibe_rules" WHERE "vibe_rules"."vibe_id" = \$1`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "vibe_id", "field", "value", "weight", "exclude"}).
+			AddRow(1, 4, "tag", "Roleplay", 1, false))
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/vibe", vibeRouter(&mockTwitchClient{streams: createTestStreamsResponse()}))
+
+	req := httptest.NewRequest("GET", "/vibe/4/streams", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data struct {
+			Streams []VibeMatch `json:"streams"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if len(response.Data.Streams) != 1 || response.Data.Streams[0].UserLogin != "anotherstreamer" {
+		t.Errorf("Expected only the roleplay stream, got %+v", response.Data.Streams)
+	}
+}
+
+func TestVibeRouter_CreateRequiresAuth(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/vibe", vibeRouter(&mockTwitchClient{}))
+
+	req := httptest.NewRequest("POST", "/vibe", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestDeleteVibe_RemovesRules(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := &supajwt.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: testSupabaseUserID}}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsctx, claims)))
+		})
+	})
+	r.Delete("/vibe/{id}", deleteVibe)
+	del := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/vibe/4", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "vibes" WHERE id = \$1 AND supabase_user_id = \$2`).
+		WithArgs(4, testSupabaseUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "vibe_rules" WHERE vibe_id = \$1`).
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	if w := del(); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// Someone else's vibe: nothing is deleted
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "vibes"`).
+		WithArgs(4, testSupabaseUserID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	if w := del(); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestGetVibeStreamsHandler_AppliesVibeFilter(t *testing.T) {
+	sqldb, gormdb, mock := DbMock(t)
+	defer sqldb.Close()
+	origDB := DB
+	DB = gormdb
+	defer func() { DB = origDB }()
+
+	mock.ExpectQuery(`SELECT \* FROM "vibes" WHERE \(id = \$1 AND \(public = \$2 OR supabase_user_id = \$3\)\)`).
+		WithArgs(4, true, "", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "public"}).AddRow(4, "roleplay", true))
+	mock.ExpectQuery(`SELECT \* FROM "vibe_rules" WHERE "vibe_rules"."vibe_id" = \$1`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "vibe_id", "field", "value", "weight", "exclude"}).
+			AddRow(1, 4, "tag", "Roleplay", 1, false))
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(apiVersionContext("v1"))
+	r.Mount("/vibe", vibeRouter(&mockTwitchClient{streams: createTestStreamsResponse()}))
+
+	req := httptest.NewRequest("GET", "/vibe/4/streams?vibe=no-such-vibe", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data struct {
+			Streams []VibeMatch `json:"streams"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	if len(response.Data.Streams) != 0 {
+		t.Errorf("Expected ?vibe= to filter out every stream, got %+v", response.Data.Streams)
+	}
+}
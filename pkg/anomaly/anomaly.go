@@ -0,0 +1,337 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reason codes for flagged streams
+const (
+	ReasonViewerSpike = "viewer_spike" // A recent viewer jump was an outlier against the deltas before it
+	ReasonChatRatio   = "chat_ratio"   // Far more viewers than chatters
+	ReasonFlatLine    = "flat_line"    // Viewer count has not moved for several samples
+)
+
+// Options tunes the detector. Zero values use the defaults.
+type Options struct {
+	// WindowSize is how many samples are kept per stream
+	WindowSize int
+	// MinSamples is how many samples are needed before spikes are evaluated
+	MinSamples int
+	// SpikeZScore is the robust z-score above which a viewer delta is a spike
+	SpikeZScore float64
+	// MinSpikeViewers ignores spikes smaller than this many viewers
+	MinSpikeViewers int
+	// SpikeCooldown is how many samples after a spike the stream stays flagged for it.
+	// Defaults to WindowSize, so a spike is reported for as long as it is in the window.
+	SpikeCooldown int
+	// MaxViewersPerChatter flags streams with more viewers per unique chatter than this
+	MaxViewersPerChatter float64
+	// MinRatioViewers only applies the chat ratio check to streams with at least this many viewers
+	MinRatioViewers int
+	// FlatLineSamples is how many identical consecutive counts count as a flat line
+	FlatLineSamples int
+	// MinFlatLineViewers only applies the flat line check above this many viewers
+	MinFlatLineViewers int
+}
+
+// Defaults
+const (
+	DefaultWindowSize           = 20
+	DefaultMinSamples           = 6
+	DefaultSpikeZScore          = 3.5
+	DefaultMinSpikeViewers      = 200
+	DefaultMaxViewersPerChatter = 400
+	DefaultMinRatioViewers      = 1000
+	DefaultFlatLineSamples      = 6
+	DefaultMinFlatLineViewers   = 50
+)
+
+// maxReportedZScore caps the z-score reported for a spike
+const maxReportedZScore = 99
+
+// Sample is one viewer count observation. Chatters is -1 when chat is not being read.
+type Sample struct {
+	At       time.Time `json:"at"`
+	Viewers  int       `json:"viewers"`
+	Chatters int       `json:"chatters"`
+}
+
+// Reason explains why a stream was flagged
+type Reason struct {
+	Code   string  `json:"code"`
+	Value  float64 `json:"value"`
+	Detail string  `json:"detail"`
+}
+
+// Assessment is the detector's verdict for one stream
+type Assessment struct {
+	StreamID  string    `json:"stream_id"`
+	Login     string    `json:"login"`
+	Flagged   bool      `json:"flagged"`
+	Reasons   []Reason  `json:"reasons"`
+	Samples   int       `json:"samples"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Codes returns the reason codes of an assessment
+func (a Assessment) Codes() []string {
+	codes := make([]string, len(a.Reasons))
+	for i, r := range a.Reasons {
+		codes[i] = r.Code
+	}
+	return codes
+}
+
+type streamWindow struct {
+	login   string
+	samples []Sample
+	// spike is the last viewer spike, reported for spikeLeft more samples
+	spike     Reason
+	spikeLeft int
+}
+
+// Detector keeps a rolling window of viewer counts per stream and flags anomalies
+type Detector struct {
+	opts Options
+
+	mu          sync.RWMutex
+	streams     map[string]*streamWindow
+	assessments map[string]Assessment
+}
+
+// NewDetector creates a detector with the given options
+func NewDetector(opts Options) *Detector {
+	if opts.WindowSize <= 0 {
+		opts.WindowSize = DefaultWindowSize
+	}
+	if opts.MinSamples <= 0 {
+		opts.MinSamples = DefaultMinSamples
+	}
+	if opts.SpikeZScore <= 0 {
+		opts.SpikeZScore = DefaultSpikeZScore
+	}
+	if opts.MinSpikeViewers <= 0 {
+		opts.MinSpikeViewers = DefaultMinSpikeViewers
+	}
+	if opts.SpikeCooldown <= 0 {
+		opts.SpikeCooldown = opts.WindowSize
+	}
+	if opts.MaxViewersPerChatter <= 0 {
+		opts.MaxViewersPerChatter = DefaultMaxViewersPerChatter
+	}
+	if opts.MinRatioViewers <= 0 {
+		opts.MinRatioViewers = DefaultMinRatioViewers
+	}
+	if opts.FlatLineSamples <= 0 {
+		opts.FlatLineSamples = DefaultFlatLineSamples
+	}
+	if opts.MinFlatLineViewers <= 0 {
+		opts.MinFlatLineViewers = DefaultMinFlatLineViewers
+	}
+	return &Detector{
+		opts:        opts,
+		streams:     make(map[string]*streamWindow),
+		assessments: make(map[string]Assessment),
+	}
+}
+
+// Observe records a sample for a stream and re-evaluates it
+func (d *Detector) Observe(streamID, login string, sample Sample) Assessment {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, ok := d.streams[streamID]
+	if !ok {
+		w = &streamWindow{}
+		d.streams[streamID] = w
+	}
+	w.login = login
+	w.samples = append(w.samples, sample)
+	if len(w.samples) > d.opts.WindowSize {
+		w.samples = w.samples[len(w.samples)-d.opts.WindowSize:]
+	}
+
+	assessment := d.evaluate(w)
+	assessment.StreamID = streamID
+	assessment.Login = login
+	assessment.UpdatedAt = sample.At
+	d.assessments[streamID] = assessment
+	return assessment
+}
+
+// Assessment returns the latest verdict for a stream
+func (d *Detector) Assessment(streamID string) (Assessment, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	a, ok := d.assessments[streamID]
+	return a, ok
+}
+
+// Flagged returns every currently flagged stream, most recently updated first
+func (d *Detector) Flagged() []Assessment {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	flagged := []Assessment{}
+	for _, a := range d.assessments {
+		if a.Flagged {
+			flagged = append(flagged, a)
+		}
+	}
+	sort.Slice(flagged, func(i, j int) bool {
+		return flagged[i].UpdatedAt.After(flagged[j].UpdatedAt)
+	})
+	return flagged
+}
+
+// Prune forgets streams with no samples since before
+func (d *Detector) Prune(before time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, w := range d.streams {
+		if w.samples[len(w.samples)-1].At.Before(before) {
+			delete(d.streams, id)
+			delete(d.assessments, id)
+		}
+	}
+}
+
+// evaluate runs every check against a stream's window of samples
+func (d *Detector) evaluate(w *streamWindow) Assessment {
+	samples := w.samples
+	a := Assessment{Samples: len(samples), Reasons: []Reason{}}
+	// Only the latest delta is tested for a spike, so a spike is held through the cooldown;
+	// otherwise the flag would clear on the very next sample
+	if r, ok := d.checkSpike(samples); ok {
+		w.spike, w.spikeLeft = r, d.opts.SpikeCooldown
+		a.Reasons = append(a.Reasons, r)
+	} else if w.spikeLeft > 0 {
+		w.spikeLeft--
+		a.Reasons = append(a.Reasons, w.spike)
+	}
+	if r, ok := d.checkChatRatio(samples); ok {
+		a.Reasons = append(a.Reasons, r)
+	}
+	if r, ok := d.checkFlatLine(samples); ok {
+		a.Reasons = append(a.Reasons, r)
+	}
+	a.Flagged = len(a.Reasons) > 0
+	return a
+}
+
+// checkSpike flags a latest viewer delta that is an upward outlier by robust z-score
+// (median and median absolute deviation of the earlier deltas)
+func (d *Detector) checkSpike(samples []Sample) (Reason, bool) {
+	if len(samples) < d.opts.MinSamples {
+		return Reason{}, false
+	}
+
+	deltas := make([]float64, len(samples)-1)
+	for i := 1; i < len(samples); i++ {
+		deltas[i-1] = float64(samples[i].Viewers - samples[i-1].Viewers)
+	}
+	latest := deltas[len(deltas)-1]
+	history := deltas[:len(deltas)-1]
+	if latest < float64(d.opts.MinSpikeViewers) {
+		return Reason{}, false
+	}
+
+	z := RobustZScore(latest, history)
+	if z < d.opts.SpikeZScore {
+		return Reason{}, false
+	}
+	// Keep the reported value finite for JSON when the history had no spread
+	z = math.Min(z, maxReportedZScore)
+	return Reason{
+		Code:   ReasonViewerSpike,
+		Value:  math.Round(z*100) / 100,
+		Detail: fmt.Sprintf("viewers jumped by %.0f (robust z-score %.1f)", latest, z),
+	}, true
+}
+
+// checkChatRatio flags streams with far more viewers than chatters
+func (d *Detector) checkChatRatio(samples []Sample) (Reason, bool) {
+	latest := samples[len(samples)-1]
+	if latest.Chatters < 0 || latest.Viewers < d.opts.MinRatioViewers {
+		return Reason{}, false
+	}
+
+	ratio := float64(latest.Viewers) / math.Max(1, float64(latest.Chatters))
+	if ratio <= d.opts.MaxViewersPerChatter {
+		return Reason{}, false
+	}
+	return Reason{
+		Code:   ReasonChatRatio,
+		Value:  math.Round(ratio),
+		Detail: fmt.Sprintf("%d viewers but %d chatters", latest.Viewers, latest.Chatters),
+	}, true
+}
+
+// checkFlatLine flags viewer counts that have not changed at all across recent samples
+func (d *Detector) checkFlatLine(samples []Sample) (Reason, bool) {
+	n := d.opts.FlatLineSamples
+	if len(samples) < n {
+		return Reason{}, false
+	}
+	recent := samples[len(samples)-n:]
+	if recent[0].Viewers < d.opts.MinFlatLineViewers {
+		return Reason{}, false
+	}
+	for _, s := range recent[1:] {
+		if s.Viewers != recent[0].Viewers {
+			return Reason{}, false
+		}
+	}
+	return Reason{
+		Code:   ReasonFlatLine,
+		Value:  float64(recent[0].Viewers),
+		Detail: fmt.Sprintf("viewer count stuck at %d for %d samples", recent[0].Viewers, n),
+	}, true
+}
+
+// RobustZScore scores x against values using the median and median absolute deviation.
+// When the MAD is zero it falls back to the mean absolute deviation. If the values have
+// no spread at all, any x other than the median scores as an infinite outlier.
+func RobustZScore(x float64, values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	med := median(values)
+
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+	}
+	if mad := median(deviations); mad > 0 {
+		return 0.6745 * (x - med) / mad
+	}
+
+	var sum float64
+	for _, dev := range deviations {
+		sum += dev
+	}
+	if meanAD := sum / float64(len(deviations)); meanAD > 0 {
+		return (x - med) / (1.2533 * meanAD)
+	}
+	switch {
+	case x > med:
+		return math.Inf(1)
+	case x < med:
+		return math.Inf(-1)
+	}
+	return 0
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
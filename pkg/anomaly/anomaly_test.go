@@ -0,0 +1,146 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+
+// observeAll feeds viewer counts one minute apart and returns the last assessment
+func observeAll(d *Detector, id string, viewers []int, chatters int) Assessment {
+	var a Assessment
+	for i, v := range viewers {
+		a = d.Observe(id, "streamer"+id, Sample{At: testStart.Add(time.Duration(i) * time.Minute), Viewers: v, Chatters: chatters})
+	}
+	return a
+}
+
+func hasReason(a Assessment, code string) bool {
+	for _, r := range a.Reasons {
+		if r.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDetector_ViewerSpike(t *testing.T) {
+	d := NewDetector(Options{})
+
+	organic := observeAll(d, "1", []int{1000, 1020, 1010, 1045, 1030, 1060, 1050, 1080}, -1)
+	if organic.Flagged {
+		t.Errorf("Expected organic growth not flagged, got %+v", organic.Reasons)
+	}
+
+	spiked := observeAll(d, "2", []int{1000, 1020, 1010, 1045, 1030, 1060, 1050, 6000}, -1)
+	if !hasReason(spiked, ReasonViewerSpike) {
+		t.Errorf("Expected viewer_spike, got %+v", spiked.Reasons)
+	}
+
+	// A jump after a perfectly steady count is still a spike, with a finite score
+	steady := observeAll(d, "4", []int{1500, 1500, 1500, 1500, 1500, 1500, 9000}, -1)
+	if !hasReason(steady, ReasonViewerSpike) || steady.Reasons[0].Value != maxReportedZScore {
+		t.Errorf("Expected capped viewer_spike, got %+v", steady.Reasons)
+	}
+
+	// A spike before enough samples are collected is not judged
+	early := observeAll(d, "3", []int{100, 5000}, -1)
+	if early.Flagged {
+		t.Errorf("Expected too few samples not flagged, got %+v", early.Reasons)
+	}
+}
+
+func TestDetector_SpikeCooldown(t *testing.T) {
+	d := NewDetector(Options{SpikeCooldown: 3})
+
+	spiked := observeAll(d, "1", []int{1000, 1020, 1010, 1045, 1030, 1060, 1050, 6000}, -1)
+	// The count holds at its new level: no new jump, but the spike is still reported
+	var a Assessment
+	for i := 0; i < 3; i++ {
+		a = d.Observe("1", "streamer1", Sample{At: testStart.Add(time.Hour), Viewers: 6010 + i, Chatters: -1})
+		if !hasReason(a, ReasonViewerSpike) {
+			t.Fatalf("Expected viewer_spike to persist %d samples after the spike, got %+v", i+1, a.Reasons)
+		}
+	}
+	if a.Reasons[0] != spiked.Reasons[0] {
+		t.Errorf("Expected the original spike %+v to be reported, got %+v", spiked.Reasons[0], a.Reasons[0])
+	}
+
+	a = d.Observe("1", "streamer1", Sample{At: testStart.Add(time.Hour), Viewers: 6020, Chatters: -1})
+	if a.Flagged {
+		t.Errorf("Expected the spike to clear after the cooldown, got %+v", a.Reasons)
+	}
+
+	// The default cooldown is the full window
+	if d := NewDetector(Options{WindowSize: 12}); d.opts.SpikeCooldown != 12 {
+		t.Errorf("Expected the cooldown to default to the window size, got %d", d.opts.SpikeCooldown)
+	}
+}
+
+func TestDetector_ChatRatio(t *testing.T) {
+	d := NewDetector(Options{})
+
+	if a := d.Observe("1", "quiet", Sample{At: testStart, Viewers: 20000, Chatters: 3}); !hasReason(a, ReasonChatRatio) {
+		t.Errorf("Expected chat_ratio, got %+v", a.Reasons)
+	}
+	if a := d.Observe("2", "lively", Sample{At: testStart, Viewers: 20000, Chatters: 400}); a.Flagged {
+		t.Errorf("Expected lively chat not flagged, got %+v", a.Reasons)
+	}
+	// Unknown chatters never trip the ratio check
+	if a := d.Observe("3", "unread", Sample{At: testStart, Viewers: 20000, Chatters: -1}); a.Flagged {
+		t.Errorf("Expected unknown chat not flagged, got %+v", a.Reasons)
+	}
+}
+
+func TestDetector_FlatLine(t *testing.T) {
+	d := NewDetector(Options{FlatLineSamples: 4})
+
+	if a := observeAll(d, "1", []int{900, 1500, 1500, 1500, 1500}, -1); !hasReason(a, ReasonFlatLine) {
+		t.Errorf("Expected flat_line, got %+v", a.Reasons)
+	}
+	if a := observeAll(d, "2", []int{1500, 1500, 1501, 1500}, -1); a.Flagged {
+		t.Errorf("Expected moving count not flagged, got %+v", a.Reasons)
+	}
+	if a := observeAll(d, "3", []int{10, 10, 10, 10}, -1); a.Flagged {
+		t.Errorf("Expected tiny stream not flagged, got %+v", a.Reasons)
+	}
+}
+
+func TestDetector_WindowAndPrune(t *testing.T) {
+	d := NewDetector(Options{WindowSize: 3})
+	a := observeAll(d, "1", []int{1, 2, 3, 4, 5}, -1)
+	if a.Samples != 3 {
+		t.Errorf("Expected window capped at 3 samples, got %d", a.Samples)
+	}
+
+	d.Observe("2", "quiet", Sample{At: testStart.Add(time.Hour), Viewers: 20000, Chatters: 0})
+	if flagged := d.Flagged(); len(flagged) != 1 || flagged[0].StreamID != "2" {
+		t.Errorf("Expected only stream 2 flagged, got %+v", flagged)
+	}
+
+	d.Prune(testStart.Add(30 * time.Minute))
+	if _, ok := d.Assessment("1"); ok {
+		t.Error("Expected stale stream pruned")
+	}
+	if _, ok := d.Assessment("2"); !ok {
+		t.Error("Expected recent stream kept")
+	}
+}
+
+func TestRobustZScore(t *testing.T) {
+	values := []float64{10, -5, 20, 0, 15, -10}
+	if z := RobustZScore(12, values); z > 1 {
+		t.Errorf("Expected typical value to score low, got %v", z)
+	}
+	if z := RobustZScore(500, values); z < 10 {
+		t.Errorf("Expected outlier to score high, got %v", z)
+	}
+	if z := RobustZScore(5, []float64{5, 5, 5}); z != 0 {
+		t.Errorf("Expected 0 for the median with no spread, got %v", z)
+	}
+	if z := RobustZScore(100, []float64{5, 5, 5}); !math.IsInf(z, 1) {
+		t.Errorf("Expected +Inf for an outlier with no spread, got %v", z)
+	}
+}
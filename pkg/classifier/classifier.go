@@ -0,0 +1,190 @@
+package classifier
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+// Classifier assigns vibe labels to streams using a ruleset that can be swapped at runtime
+type Classifier struct {
+	mu    sync.RWMutex
+	rules *Ruleset
+	path  string // Rules file for Reload, empty when using in-memory rules
+	now   func() time.Time
+}
+
+// Explanation describes how every label scored for one stream
+type Explanation struct {
+	StreamID string       `json:"stream_id"`
+	Labels   []LabelScore `json:"labels"`
+}
+
+// LabelScore is one label's score for a stream and the rules that fired
+type LabelScore struct {
+	Label     string      `json:"label"`
+	Score     float64     `json:"score"`
+	Threshold float64     `json:"threshold"`
+	Assigned  bool        `json:"assigned"`
+	Fired     []FiredRule `json:"fired"`
+}
+
+// FiredRule records a rule that matched and what it matched on
+type FiredRule struct {
+	RuleID string  `json:"rule_id"`
+	Field  string  `json:"field"`
+	Weight float64 `json:"weight"`
+	Match  string  `json:"match"`
+}
+
+// New creates a classifier for an in-memory ruleset
+func New(rules *Ruleset) *Classifier {
+	return &Classifier{rules: rules, now: time.Now}
+}
+
+// NewFromFile creates a classifier from a rules file, which Reload re-reads
+func NewFromFile(path string) (*Classifier, error) {
+	rules, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Classifier{rules: rules, path: path, now: time.Now}, nil
+}
+
+// Reload re-reads the rules file. The current rules are kept if the file is invalid.
+func (c *Classifier) Reload() (*Ruleset, error) {
+	if c.path == "" {
+		return nil, fmt.Errorf("classifier has no rules file to reload")
+	}
+	rules, err := LoadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	c.Replace(rules)
+	return rules, nil
+}
+
+// Replace swaps in a new ruleset
+func (c *Classifier) Replace(rules *Ruleset) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = rules
+}
+
+// Rules returns the active ruleset
+func (c *Classifier) Rules() *Ruleset {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rules
+}
+
+// Classify returns the labels assigned to a stream, highest score first
+func (c *Classifier) Classify(stream twitch.Stream) []string {
+	explanation := c.Explain(stream)
+	labels := []string{}
+	for _, score := range explanation.Labels {
+		if score.Assigned {
+			labels = append(labels, score.Label)
+		}
+	}
+	return labels
+}
+
+// Annotate sets the Vibes field of each stream in place
+func (c *Classifier) Annotate(streams []twitch.Stream) {
+	for i := range streams {
+		streams[i].Vibes = c.Classify(streams[i])
+	}
+}
+
+// Explain scores every label for a stream, listing the rules that fired.
+// Labels are ordered by score, highest first.
+func (c *Classifier) Explain(stream twitch.Stream) Explanation {
+	rules := c.Rules()
+	now := c.now()
+
+	explanation := Explanation{StreamID: stream.ID, Labels: make([]LabelScore, 0, len(rules.Labels))}
+	for _, label := range rules.Labels {
+		score := LabelScore{Label: label.Name, Threshold: label.Threshold, Fired: []FiredRule{}}
+		for i := range label.Rules {
+			rule := &label.Rules[i]
+			if match, ok := rule.match(stream, now); ok {
+				score.Score += rule.Weight
+				score.Fired = append(score.Fired, FiredRule{RuleID: rule.ID, Field: rule.Field, Weight: rule.Weight, Match: match})
+			}
+		}
+		score.Assigned = score.Score >= label.Threshold
+		explanation.Labels = append(explanation.Labels, score)
+	}
+
+	sort.SliceStable(explanation.Labels, func(i, j int) bool {
+		return explanation.Labels[i].Score > explanation.Labels[j].Score
+	})
+	return explanation
+}
+
+// match reports whether the rule fires for a stream and the value it matched
+func (r *Rule) match(stream twitch.Stream, now time.Time) (string, bool) {
+	switch r.Field {
+	case FieldTags:
+		for _, tag := range stream.Tags {
+			if match, ok := r.matchValue(tag, false); ok {
+				return match, true
+			}
+		}
+	case FieldTitle:
+		return r.matchValue(stream.Title, true)
+	case FieldGameName:
+		return r.matchValue(stream.GameName, false)
+	case FieldLanguage:
+		return r.matchValue(stream.Language, false)
+	case FieldUptime:
+		startedAt, err := time.Parse(time.RFC3339, stream.StartedAt)
+		if err != nil {
+			return "", false
+		}
+		uptime := now.Sub(startedAt)
+		if uptime < time.Duration(r.MinUptime) {
+			return "", false
+		}
+		if r.MaxUptime != 0 && uptime >= time.Duration(r.MaxUptime) {
+			return "", false
+		}
+		return uptime.Round(time.Minute).String(), true
+	}
+	return "", false
+}
+
+// matchValue checks keywords (exact, or substring when contains is set) and then the regex, ignoring case
+func (r *Rule) matchValue(value string, contains bool) (string, bool) {
+	if value == "" {
+		return "", false
+	}
+	lower := strings.ToLower(value)
+	for _, keyword := range r.Keywords {
+		k := strings.ToLower(keyword)
+		if lower == k || (contains && strings.Contains(lower, k)) {
+			return keyword, true
+		}
+	}
+	if r.pattern != nil {
+		if match := r.pattern.FindString(value); match != "" {
+			return match, true
+		}
+	}
+	return "", false
+}
+
+// HasLabel reports whether labels contains the given label, ignoring case
+func HasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
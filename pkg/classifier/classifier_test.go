@@ -0,0 +1,174 @@
+package classifier
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/site-tech/VibeGuide/pkg/twitch"
+)
+
+var testNow = time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+
+func newTestClassifier(t *testing.T, rules *Ruleset) *Classifier {
+	t.Helper()
+	c := New(rules)
+	c.now = func() time.Time { return testNow }
+	return c
+}
+
+func TestDefaultRuleset(t *testing.T) {
+	rs := DefaultRuleset()
+	if len(rs.Labels) == 0 {
+		t.Fatal("Expected default labels")
+	}
+
+	c := newTestClassifier(t, rs)
+	cozy := twitch.Stream{
+		ID:        "1",
+		Title:     "comfy farming morning",
+		GameName:  "Stardew Valley",
+		Tags:      []string{"English", "Cozy"},
+		StartedAt: testNow.Add(-time.Hour).Format(time.RFC3339),
+	}
+	if labels := c.Classify(cozy); !HasLabel(labels, "cozy") {
+		t.Errorf("Expected cozy label, got %v", labels)
+	}
+
+	speedrun := twitch.Stream{
+		ID:        "2",
+		Title:     "Any% WR attempts",
+		Tags:      []string{"Speedrun"},
+		StartedAt: testNow.Add(-10 * time.Minute).Format(time.RFC3339),
+	}
+	labels := c.Classify(speedrun)
+	if !HasLabel(labels, "speedrun focus") || !HasLabel(labels, "just started") {
+		t.Errorf("Expected speedrun focus and just started labels, got %v", labels)
+	}
+	if HasLabel(labels, "cozy") {
+		t.Errorf("Did not expect cozy label, got %v", labels)
+	}
+}
+
+func TestParse_YAMLAndJSON(t *testing.T) {
+	yamlRules := `
+labels:
+  - name: late night
+    rules:
+      - field: uptime
+        min_uptime: 4h
+        weight: 1
+`
+	rs, err := Parse([]byte(yamlRules))
+	if err != nil {
+		t.Fatalf("Expected YAML to parse, got: %v", err)
+	}
+	if rs.Labels[0].Threshold != DefaultThreshold || rs.Labels[0].Rules[0].ID != "late night.0" {
+		t.Errorf("Expected defaults applied, got %+v", rs.Labels[0])
+	}
+	if time.Duration(rs.Labels[0].Rules[0].MinUptime) != 4*time.Hour {
+		t.Errorf("Expected min_uptime 4h, got %s", time.Duration(rs.Labels[0].Rules[0].MinUptime))
+	}
+
+	jsonRules := `{"labels":[{"name":"english","rules":[{"id":"en","field":"language","keywords":["en"],"weight":1}]}]}`
+	if _, err := Parse([]byte(jsonRules)); err != nil {
+		t.Errorf("Expected JSON to parse, got: %v", err)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"no labels":        `labels: []`,
+		"unknown field":    `labels: [{name: a, rules: [{field: mood, keywords: [x], weight: 1}]}]`,
+		"missing weight":   `labels: [{name: a, rules: [{field: title, keywords: [x]}]}]`,
+		"bad regex":        `labels: [{name: a, rules: [{field: title, regex: "(", weight: 1}]}]`,
+		"no matcher":       `labels: [{name: a, rules: [{field: tags, weight: 1}]}]`,
+		"duplicate label":  `labels: [{name: a, rules: [{field: tags, keywords: [x], weight: 1}]}, {name: a, rules: [{field: tags, keywords: [x], weight: 1}]}]`,
+		"bad duration":     `labels: [{name: a, rules: [{field: uptime, min_uptime: soon, weight: 1}]}]`,
+		"inverted uptime":  `labels: [{name: a, rules: [{field: uptime, min_uptime: 2h, max_uptime: 1h, weight: 1}]}]`,
+		"language regex":   `labels: [{name: a, rules: [{field: language, regex: "e.", weight: 1}]}]`,
+		"label with no id": `labels: [{rules: [{field: tags, keywords: [x], weight: 1}]}]`,
+	}
+	for name, rules := range tests {
+		if _, err := Parse([]byte(rules)); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	rs, err := Parse([]byte(`
+labels:
+  - name: cozy
+    threshold: 2
+    rules:
+      - {id: tag, field: tags, keywords: [cozy], weight: 1.5}
+      - {id: title, field: title, regex: '(?i)\bchill\b', weight: 1}
+      - {id: ranked, field: title, keywords: [ranked], weight: -3}
+  - name: english
+    rules:
+      - {id: en, field: language, keywords: [en], weight: 1}
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	c := newTestClassifier(t, rs)
+
+	explanation := c.Explain(twitch.Stream{ID: "9", Title: "Chill evening", Tags: []string{"Cozy"}, Language: "de"})
+	if explanation.Labels[0].Label != "cozy" || explanation.Labels[0].Score != 2.5 || !explanation.Labels[0].Assigned {
+		t.Fatalf("Expected cozy assigned with score 2.5, got %+v", explanation.Labels[0])
+	}
+	fired := explanation.Labels[0].Fired
+	if len(fired) != 2 || fired[0].RuleID != "tag" || fired[1].Match != "Chill" {
+		t.Errorf("Unexpected fired rules: %+v", fired)
+	}
+	if explanation.Labels[1].Assigned {
+		t.Errorf("Expected english not assigned, got %+v", explanation.Labels[1])
+	}
+
+	// A negative weight can pull a label below its threshold
+	labels := c.Classify(twitch.Stream{Title: "chill ranked grind", Tags: []string{"cozy"}})
+	if HasLabel(labels, "cozy") {
+		t.Errorf("Expected negative rule to suppress cozy, got %v", labels)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	write := func(label string) {
+		rules := "labels: [{name: " + label + ", rules: [{field: tags, keywords: [x], weight: 1}]}]"
+		if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("first")
+	c, err := NewFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	write("second")
+	if _, err := c.Reload(); err != nil {
+		t.Fatalf("Expected reload to succeed, got: %v", err)
+	}
+	if c.Rules().Labels[0].Name != "second" {
+		t.Errorf("Expected reloaded label, got %q", c.Rules().Labels[0].Name)
+	}
+
+	// An invalid file keeps the previous rules
+	if err := os.WriteFile(path, []byte("labels: ["), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Reload(); err == nil {
+		t.Error("Expected reload of invalid file to fail")
+	}
+	if c.Rules().Labels[0].Name != "second" {
+		t.Errorf("Expected previous rules kept, got %q", c.Rules().Labels[0].Name)
+	}
+
+	if _, err := New(DefaultRuleset()).Reload(); err == nil {
+		t.Error("Expected reload without a file to fail")
+	}
+}
@@ -0,0 +1,178 @@
+package classifier
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Stream fields a rule can match against
+const (
+	FieldTags     = "tags"      // Any tag equals a keyword, or matches the regex
+	FieldTitle    = "title"     // The title contains a keyword, or matches the regex
+	FieldGameName = "game_name" // The category name equals a keyword, or matches the regex
+	FieldLanguage = "language"  // The stream language equals a keyword
+	FieldUptime   = "uptime"    // Time since the stream started is within [min_uptime, max_uptime)
+)
+
+// DefaultThreshold is the score a label needs when its definition does not set one
+const DefaultThreshold = 1.0
+
+//go:embed default_rules.yaml
+var defaultRulesYAML []byte
+
+// Ruleset is a declarative set of vibe labels and the rules that score them
+type Ruleset struct {
+	Labels []Label `yaml:"labels" json:"labels"`
+}
+
+// Label is a vibe label assigned when the weights of its fired rules reach Threshold
+type Label struct {
+	Name      string  `yaml:"name" json:"name"`
+	Threshold float64 `yaml:"threshold" json:"threshold"`
+	Rules     []Rule  `yaml:"rules" json:"rules"`
+}
+
+// Rule scores a label when it matches a stream. Keywords and Regex are alternatives;
+// the rule fires when either matches. Weight may be negative to count against a label.
+type Rule struct {
+	ID        string   `yaml:"id" json:"id"`
+	Field     string   `yaml:"field" json:"field"`
+	Keywords  []string `yaml:"keywords,omitempty" json:"keywords,omitempty"`
+	Regex     string   `yaml:"regex,omitempty" json:"regex,omitempty"`
+	MinUptime Duration `yaml:"min_uptime,omitempty" json:"min_uptime,omitempty"`
+	MaxUptime Duration `yaml:"max_uptime,omitempty" json:"max_uptime,omitempty"`
+	Weight    float64  `yaml:"weight" json:"weight"`
+
+	pattern *regexp.Regexp
+}
+
+// Duration is a time.Duration written as a Go duration string such as "90m" in rule files
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Parse reads a ruleset from YAML or JSON and validates it. JSON is accepted because it is a subset of YAML.
+func Parse(data []byte) (*Ruleset, error) {
+	var rs Ruleset
+	if err := yaml.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	if err := rs.compile(); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// LoadFile reads and parses a ruleset file
+func LoadFile(path string) (*Ruleset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	return Parse(data)
+}
+
+// DefaultRuleset returns the built-in ruleset shipped with the service
+func DefaultRuleset() *Ruleset {
+	rs, err := Parse(defaultRulesYAML)
+	if err != nil {
+		panic(fmt.Sprintf("classifier: invalid default rules: %v", err))
+	}
+	return rs
+}
+
+// compile validates the ruleset, applies defaults and compiles regular expressions
+func (rs *Ruleset) compile() error {
+	if len(rs.Labels) == 0 {
+		return fmt.Errorf("ruleset has no labels")
+	}
+
+	names := make(map[string]bool, len(rs.Labels))
+	for li := range rs.Labels {
+		label := &rs.Labels[li]
+		label.Name = strings.TrimSpace(label.Name)
+		if label.Name == "" {
+			return fmt.Errorf("label %d: name is required", li)
+		}
+		if names[label.Name] {
+			return fmt.Errorf("label %q is defined more than once", label.Name)
+		}
+		names[label.Name] = true
+		if label.Threshold == 0 {
+			label.Threshold = DefaultThreshold
+		}
+		if len(label.Rules) == 0 {
+			return fmt.Errorf("label %q: at least one rule is required", label.Name)
+		}
+
+		for ri := range label.Rules {
+			rule := &label.Rules[ri]
+			if rule.ID == "" {
+				rule.ID = fmt.Sprintf("%s.%d", label.Name, ri)
+			}
+			if err := rule.compile(); err != nil {
+				return fmt.Errorf("label %q rule %q: %w", label.Name, rule.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Rule) compile() error {
+	if r.Weight == 0 {
+		return fmt.Errorf("weight is required")
+	}
+
+	switch r.Field {
+	case FieldTags, FieldTitle, FieldGameName, FieldLanguage:
+		if len(r.Keywords) == 0 && r.Regex == "" {
+			return fmt.Errorf("keywords or regex is required for field %s", r.Field)
+		}
+		if r.Field == FieldLanguage && r.Regex != "" {
+			return fmt.Errorf("regex is not supported for field %s", r.Field)
+		}
+	case FieldUptime:
+		if r.MinUptime == 0 && r.MaxUptime == 0 {
+			return fmt.Errorf("min_uptime or max_uptime is required for field %s", r.Field)
+		}
+		if r.MaxUptime != 0 && r.MaxUptime <= r.MinUptime {
+			return fmt.Errorf("max_uptime must be greater than min_uptime")
+		}
+	default:
+		return fmt.Errorf("field must be one of %s, %s, %s, %s or %s, got %q",
+			FieldTags, FieldTitle, FieldGameName, FieldLanguage, FieldUptime, r.Field)
+	}
+
+	if r.Regex != "" {
+		pattern, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		r.pattern = pattern
+	}
+	return nil
+}
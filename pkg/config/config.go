@@ -0,0 +1,289 @@
+// Package config fills a settings struct from layered sources. The struct's own values are the
+// defaults; an optional YAML or TOML file overrides them, environment variables override the file
+// and command-line flags override everything.
+//
+// Fields are bound with an `env:"NAME"` tag. The same name, lower-cased, is the key in the file
+// (nested tables join with "_", so [twitch] client_id sets TWITCH_CLIENT_ID) and, lower-cased with
+// "-" for "_", the flag (-twitch-client-id). Any setting can also be read from the file named by
+// NAME_FILE, for secrets mounted by Docker or Kubernetes. Fields tagged `secret:"true"` are
+// hidden by Redact.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources a setting can come from, as reported by Load
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Redacted replaces the value of a set secret in Redact output
+const Redacted = "[REDACTED]"
+
+// Options says where Load looks for settings
+type Options struct {
+	// Args are the command-line arguments, without the program name
+	Args []string
+	// LookupEnv reads environment variables, os.LookupEnv when nil
+	LookupEnv func(string) (string, bool)
+	// ReadFile reads the config file and NAME_FILE secrets, os.ReadFile when nil
+	ReadFile func(string) ([]byte, error)
+	// FileEnv names the variable (and, as for fields, the flag) giving the config file path
+	FileEnv string
+	// Usage is written with the flag list for -h
+	Usage string
+	// Output receives flag errors and usage, os.Stderr when nil
+	Output io.Writer
+}
+
+// Sources maps each setting's name to where its value came from
+type Sources map[string]string
+
+// field is a settable struct field and its setting name
+type field struct {
+	name   string
+	secret bool
+	value  reflect.Value
+}
+
+// flagValue records a flag's raw value, so only flags given on the command line apply
+type flagValue struct {
+	raw    string
+	isBool bool
+}
+
+func (f *flagValue) String() string     { return f.raw }
+func (f *flagValue) Set(s string) error { f.raw = s; return nil }
+func (f *flagValue) IsBoolFlag() bool   { return f.isBool }
+
+// Load fills dst, a pointer to a struct holding the defaults, from the file, environment and
+// flags. Every invalid setting is reported, joined into one error; flag.ErrHelp is returned
+// as is for -h.
+func Load(dst any, opts Options) (Sources, error) {
+	if opts.LookupEnv == nil {
+		opts.LookupEnv = os.LookupEnv
+	}
+	if opts.ReadFile == nil {
+		opts.ReadFile = os.ReadFile
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stderr
+	}
+	fields, err := fieldsOf(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flags are parsed first so a bad command line fails fast, but applied last
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(opts.Output)
+	if opts.Usage != "" {
+		fs.Usage = func() {
+			fmt.Fprintln(opts.Output, opts.Usage)
+			fs.PrintDefaults()
+		}
+	}
+	flags := make(map[string]*flagValue, len(fields))
+	for _, f := range fields {
+		v := &flagValue{isBool: f.value.Kind() == reflect.Bool}
+		flags[f.name] = v
+		fs.Var(v, flagName(f.name), "env "+f.name)
+	}
+	var configFile *flagValue
+	if opts.FileEnv != "" {
+		configFile = &flagValue{}
+		fs.Var(configFile, flagName(opts.FileEnv), "config file (YAML or TOML), env "+opts.FileEnv)
+	}
+	if err := fs.Parse(opts.Args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	var errs []error
+	var file map[string]string
+	if opts.FileEnv != "" {
+		path, _ := opts.LookupEnv(opts.FileEnv)
+		if setFlags[flagName(opts.FileEnv)] {
+			path = configFile.raw
+		}
+		if path != "" {
+			file, err = readFile(path, opts.ReadFile)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	known := make(map[string]bool, len(fields))
+	sources := make(Sources, len(fields))
+	for _, f := range fields {
+		known[f.name] = true
+		raw, source, err := lookup(f, file, flags[f.name], setFlags[flagName(f.name)], opts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sources[f.name] = source
+		if source == SourceDefault {
+			continue
+		}
+		if err := setValue(f.value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.name, err))
+		}
+	}
+	for name := range file {
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("config file: unknown setting %q", strings.ToLower(name)))
+		}
+	}
+	return sources, errors.Join(errs...)
+}
+
+// lookup finds a field's raw value by precedence: flag, then environment, then file
+func lookup(f field, file map[string]string, flag *flagValue, flagSet bool, opts Options) (string, string, error) {
+	if flagSet {
+		return flag.raw, SourceFlag, nil
+	}
+	value, ok := opts.LookupEnv(f.name)
+	path, fromFile := opts.LookupEnv(f.name + "_FILE")
+	switch {
+	case ok && fromFile:
+		return "", "", fmt.Errorf("%s: set either %s or %s_FILE, not both", f.name, f.name, f.name)
+	case fromFile:
+		b, err := opts.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("%s_FILE: %w", f.name, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), SourceEnv, nil
+	case ok:
+		// An empty variable clears a string or list but leaves other types at their default
+		if value == "" && f.value.Kind() != reflect.String && f.value.Kind() != reflect.Slice {
+			break
+		}
+		return value, SourceEnv, nil
+	}
+	if value, ok := file[f.name]; ok {
+		return value, SourceFile, nil
+	}
+	return "", SourceDefault, nil
+}
+
+func fieldsOf(dst any) ([]field, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: Load needs a pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		name := sf.Tag.Get("env")
+		if name == "" || !sf.IsExported() {
+			continue
+		}
+		fields = append(fields, field{name: name, secret: sf.Tag.Get("secret") == "true", value: v.Field(i)})
+	}
+	return fields, nil
+}
+
+func flagName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "_", "-")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses raw into a field. Lists are comma-separated, skipping blanks; durations must
+// be positive.
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("must be a positive duration, got %s", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be an integer, got %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be a non-negative integer, got %q", raw)
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("config: unsupported type %s", v.Type())
+		}
+		list := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("config: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Redact formats a settings struct like %+v, with set secrets replaced by Redacted
+func Redact(v any) string {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Sprintf("%+v", v)
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < rv.NumField(); i++ {
+		sf := rv.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(sf.Name)
+		b.WriteByte(':')
+		if sf.Tag.Get("secret") == "true" && !rv.Field(i).IsZero() {
+			b.WriteString(Redacted)
+			continue
+		}
+		fmt.Fprintf(&b, "%v", rv.Field(i).Interface())
+	}
+	b.WriteByte('}')
+	return b.String()
+}
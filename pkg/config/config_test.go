@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSettings struct {
+	Port     string        `env:"PORT"`
+	ClientID string        `env:"TWITCH_CLIENT_ID"`
+	Secret   string        `env:"TWITCH_CLIENT_SECRET" secret:"true"`
+	Migrate  bool          `env:"DBMIGRATE"`
+	Channels uint          `env:"CHAT_MAX_CHANNELS"`
+	Limit    int           `env:"TWITCH_DEFAULT_QUERY_LIMIT"`
+	Interval time.Duration `env:"LIVE_POLL_INTERVAL"`
+	Origins  []string      `env:"CORS_ALLOWED_ORIGINS"`
+	internal string
+}
+
+func defaults() testSettings {
+	return testSettings{Port: "8080", Channels: 50, Limit: 20, Interval: 5 * time.Minute}
+}
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func files(files map[string]string) func(string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		data, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(data), nil
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	s := defaults()
+	sources, err := Load(&s, Options{
+		Args: []string{"-port", "9090", "-dbmigrate"},
+		LookupEnv: env(map[string]string{
+			"CONFIG_FILE":               "/etc/vibe.yaml",
+			"TWITCH_CLIENT_ID":          "from-env",
+			"TWITCH_CLIENT_SECRET_FILE": "/run/secrets/twitch",
+		}),
+		ReadFile: files(map[string]string{
+			"/etc/vibe.yaml":      "port: 8081\nlive_poll_interval: 1m\ntwitch:\n  client_id: from-file\ncors_allowed_origins: [https://a.example, https://b.example]\n",
+			"/run/secrets/twitch": "s3cret\n",
+		}),
+		FileEnv: "CONFIG_FILE",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if s.Port != "9090" || sources["PORT"] != SourceFlag {
+		t.Errorf("Expected the flag to win, got %s from %s", s.Port, sources["PORT"])
+	}
+	if s.ClientID != "from-env" || sources["TWITCH_CLIENT_ID"] != SourceEnv {
+		t.Errorf("Expected the environment to beat the file, got %s", s.ClientID)
+	}
+	if s.Secret != "s3cret" {
+		t.Errorf("Expected the secret from TWITCH_CLIENT_SECRET_FILE, got %q", s.Secret)
+	}
+	if s.Interval != time.Minute || sources["LIVE_POLL_INTERVAL"] != SourceFile {
+		t.Errorf("Expected the file to beat the default, got %s", s.Interval)
+	}
+	if len(s.Origins) != 2 || s.Origins[1] != "https://b.example" {
+		t.Errorf("Expected a list from the file, got %v", s.Origins)
+	}
+	if !s.Migrate {
+		t.Error("Expected a bare bool flag to set true")
+	}
+	if s.Channels != 50 || sources["CHAT_MAX_CHANNELS"] != SourceDefault {
+		t.Errorf("Expected the default, got %d from %s", s.Channels, sources["CHAT_MAX_CHANNELS"])
+	}
+}
+
+func TestLoad_TOML(t *testing.T) {
+	s := defaults()
+	_, err := Load(&s, Options{
+		Args: []string{"-config-file", "vibe.toml"},
+		ReadFile: files(map[string]string{"vibe.toml": `# VibeGuide
+port = "8082" # inline comment
+chat_max_channels = 75
+
+[twitch]
+client_id = 'abc#123'
+default_query_limit = 30
+
+[cors]
+allowed_origins = [
+  "https://a.example",
+  "https://b.example",
+]
+`}),
+		LookupEnv: env(nil),
+		FileEnv:   "CONFIG_FILE",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if s.Port != "8082" || s.Channels != 75 || s.ClientID != "abc#123" || s.Limit != 30 || len(s.Origins) != 2 {
+		t.Errorf("Unexpected settings: %+v", s)
+	}
+}
+
+func TestLoad_AggregatesErrors(t *testing.T) {
+	s := defaults()
+	_, err := Load(&s, Options{
+		LookupEnv: env(map[string]string{
+			"CONFIG_FILE":               "vibe.yaml",
+			"DBMIGRATE":                 "maybe",
+			"LIVE_POLL_INTERVAL":        "-1m",
+			"TWITCH_CLIENT_SECRET":      "a",
+			"TWITCH_CLIENT_SECRET_FILE": "b",
+		}),
+		ReadFile: files(map[string]string{"vibe.yaml": "chat_max_channels: lots\nprot: 8080\n"}),
+		FileEnv:  "CONFIG_FILE",
+	})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{"DBMIGRATE", "LIVE_POLL_INTERVAL", "TWITCH_CLIENT_SECRET_FILE, not both", "CHAT_MAX_CHANNELS", `unknown setting "prot"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestLoad_EmptyEnv(t *testing.T) {
+	s := defaults()
+	s.ClientID = "default"
+	_, err := Load(&s, Options{LookupEnv: env(map[string]string{"TWITCH_CLIENT_ID": "", "CHAT_MAX_CHANNELS": ""})})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if s.ClientID != "" || s.Channels != 50 {
+		t.Errorf("Expected empty to clear strings and keep other defaults, got %+v", s)
+	}
+}
+
+func TestLoad_Flags(t *testing.T) {
+	s := defaults()
+	if _, err := Load(&s, Options{Args: []string{"-h"}, LookupEnv: env(nil), Output: io.Discard}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected flag.ErrHelp, got %v", err)
+	}
+	if _, err := Load(&s, Options{Args: []string{"-nope"}, LookupEnv: env(nil), Output: io.Discard}); err == nil {
+		t.Error("Expected an error for an unknown flag")
+	}
+	if _, err := Load(&s, Options{Args: []string{"serve"}, LookupEnv: env(nil)}); err == nil {
+		t.Error("Expected an error for a stray argument")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	s := defaults()
+	s.Secret = "s3cret"
+	out := Redact(&s)
+	if strings.Contains(out, "s3cret") || !strings.Contains(out, "Secret:"+Redacted) {
+		t.Errorf("Expected the secret to be redacted, got %s", out)
+	}
+	if !strings.Contains(out, "Port:8080") || strings.Contains(out, "internal") {
+		t.Errorf("Expected exported settings only, got %s", out)
+	}
+
+	s.Secret = ""
+	if out := Redact(s); !strings.Contains(out, "Secret: ") {
+		t.Errorf("Expected an unset secret to show as empty, got %s", out)
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readFile loads a YAML (or JSON) or TOML config file into setting names and raw values
+func readFile(path string, read func(string) ([]byte, error)) (map[string]string, error) {
+	data, err := read(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	var tree map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		tree, err = parseTOML(string(data))
+	default:
+		return nil, fmt.Errorf("config file %s: expected a .yaml, .yml, .json or .toml extension", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	settings := map[string]string{}
+	if err := flatten("", tree, settings); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// flatten turns nested tables into upper-case names joined with "_", and lists into
+// comma-separated values
+func flatten(prefix string, tree map[string]any, out map[string]string) error {
+	for key, value := range tree {
+		name := strings.ToUpper(key)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			if err := flatten(name, v, out); err != nil {
+				return err
+			}
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				if _, nested := item.(map[string]any); nested {
+					return fmt.Errorf("%s: lists may only hold plain values", strings.ToLower(name))
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			out[name] = strings.Join(items, ",")
+		case nil:
+			out[name] = ""
+		default:
+			out[name] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// parseTOML reads the subset of TOML a settings file needs: [table] headers, key = value pairs
+// with strings, numbers, booleans and arrays of those, and comments
+func parseTOML(data string) (map[string]any, error) {
+	root := map[string]any{}
+	table := root
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table header %q", lineNo, line)
+			}
+			table = root
+			for _, part := range strings.Split(strings.Trim(line, "[]"), ".") {
+				part = strings.TrimSpace(part)
+				if part == "" {
+					return nil, fmt.Errorf("line %d: invalid table header %q", lineNo, line)
+				}
+				next, ok := table[part].(map[string]any)
+				if !ok {
+					next = map[string]any{}
+					table[part] = next
+				}
+				table = next
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		value = strings.TrimSpace(value)
+		// Arrays may span lines until the brackets balance
+		for strings.HasPrefix(value, "[") && strings.Count(value, "[") > strings.Count(value, "]") && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+		parsed, err := parseTOMLValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineNo, key, err)
+		}
+		table[key] = parsed
+	}
+	return root, nil
+}
+
+// stripComment drops a # comment outside of quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseTOMLValue(value string) (any, error) {
+	switch {
+	case value == "":
+		return nil, fmt.Errorf("missing value")
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, fmt.Errorf("unterminated string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	case strings.HasPrefix(value, "["):
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("unterminated array %s", value)
+		}
+		items := []any{}
+		for _, item := range splitTOMLArray(value[1 : len(value)-1]) {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			parsed, err := parseTOMLValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, parsed)
+		}
+		return items, nil
+	case value == "true" || value == "false":
+		return value == "true", nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err == nil {
+		return strings.ReplaceAll(value, "_", ""), nil
+	}
+	return nil, fmt.Errorf("unsupported value %s", value)
+}
+
+// splitTOMLArray splits array items on commas outside of quotes
+func splitTOMLArray(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
@@ -0,0 +1,225 @@
+// Package cors implements CORS policies driven by an origin allowlist. A policy allows exact
+// origins ("https://vibeguide.tv"), wildcard subdomains ("https://*.vibeguide.tv") or any origin
+// ("*", only without credentials). Middleware picks the policies for a request by path prefix so
+// routes can override the default, always sets Vary: Origin and rejects preflights no policy allows.
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures a Policy
+type Options struct {
+	// AllowedOrigins are exact origins, wildcard subdomain patterns or "*"
+	AllowedOrigins []string
+	// AllowedMethods a preflight may ask for. Simple methods (GET, HEAD, POST) are not implied.
+	AllowedMethods []string
+	// AllowedHeaders a preflight may ask for, matched case-insensitively
+	AllowedHeaders []string
+	// ExposedHeaders lets scripts read these response headers
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and read responses to credentialed requests
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight answer
+	MaxAge time.Duration
+}
+
+// originPattern matches one allowlist entry. A wildcard pattern matches any subdomain of host,
+// at any depth, but not host itself.
+type originPattern struct {
+	scheme   string
+	host     string // Includes the port, if any
+	wildcard bool
+}
+
+func (p originPattern) matches(scheme, host string) bool {
+	if scheme != p.scheme {
+		return false
+	}
+	if p.wildcard {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// Policy answers CORS requests for a set of routes
+type Policy struct {
+	anyOrigin   bool
+	origins     []originPattern
+	methods     []string
+	headers     []string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// New validates options and builds a policy
+func New(opts Options) (*Policy, error) {
+	p := &Policy{credentials: opts.AllowCredentials}
+	for _, origin := range opts.AllowedOrigins {
+		if origin == "*" {
+			if opts.AllowCredentials {
+				return nil, fmt.Errorf("cors: origin \"*\" cannot be allowed with credentials")
+			}
+			p.anyOrigin = true
+			continue
+		}
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			return nil, err
+		}
+		p.origins = append(p.origins, pattern)
+	}
+	for _, method := range opts.AllowedMethods {
+		p.methods = append(p.methods, strings.ToUpper(method))
+	}
+	for _, header := range opts.AllowedHeaders {
+		p.headers = append(p.headers, http.CanonicalHeaderKey(header))
+	}
+	p.exposed = strings.Join(opts.ExposedHeaders, ", ")
+	if opts.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(opts.MaxAge.Seconds()))
+	}
+	return p, nil
+}
+
+func parseOriginPattern(origin string) (originPattern, error) {
+	scheme, host, ok := strings.Cut(strings.ToLower(origin), "://")
+	if !ok || scheme == "" || host == "" || strings.ContainsAny(host, "/?#") {
+		return originPattern{}, fmt.Errorf("cors: invalid origin %q, expected scheme://host[:port]", origin)
+	}
+	if rest, ok := strings.CutPrefix(host, "*."); ok {
+		if rest == "" || strings.Contains(rest, "*") {
+			return originPattern{}, fmt.Errorf("cors: invalid wildcard origin %q", origin)
+		}
+		return originPattern{scheme: scheme, host: rest, wildcard: true}, nil
+	}
+	if strings.Contains(host, "*") {
+		return originPattern{}, fmt.Errorf("cors: wildcard must be the first label in %q", origin)
+	}
+	return originPattern{scheme: scheme, host: host}, nil
+}
+
+// AllowsOrigin reports whether the policy allows requests from origin
+func (p *Policy) AllowsOrigin(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return false
+	}
+	if p.anyOrigin {
+		return true
+	}
+	for _, pattern := range p.origins {
+		if pattern.matches(u.Scheme, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsPreflight reports whether the policy allows the method and headers a preflight asks for
+func (p *Policy) allowsPreflight(method, headers string) bool {
+	if !slices.Contains(p.methods, strings.ToUpper(method)) {
+		return false
+	}
+	for _, header := range strings.Split(headers, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !slices.Contains(p.headers, http.CanonicalHeaderKey(header)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Policy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// Route applies policies to requests whose path starts with Prefix. The first policy that allows
+// the request's origin answers it.
+type Route struct {
+	Prefix   string
+	Policies []*Policy
+}
+
+// Middleware answers CORS for each request with the policies of the longest matching route, or
+// with defaults when no route matches. Preflights from disallowed origins, or asking for methods
+// or headers the policy doesn't allow, get 403; other requests from disallowed origins pass
+// through without CORS headers, so browsers won't expose the response.
+func Middleware(defaults []*Policy, routes ...Route) func(http.Handler) http.Handler {
+	routes = slices.Clone(routes)
+	slices.SortFunc(routes, func(a, b Route) int { return len(b.Prefix) - len(a.Prefix) })
+
+	policiesFor := func(path string) []*Policy {
+		for _, route := range routes {
+			if path == route.Prefix || strings.HasPrefix(path, strings.TrimSuffix(route.Prefix, "/")+"/") {
+				return route.Policies
+			}
+		}
+		return defaults
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var policy *Policy
+			for _, p := range policiesFor(r.URL.Path) {
+				if p.AllowsOrigin(origin) {
+					policy = p
+					break
+				}
+			}
+
+			if preflight {
+				if policy == nil || !policy.allowsPreflight(r.Header.Get("Access-Control-Request-Method"), r.Header.Get("Access-Control-Request-Headers")) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				policy.setOrigin(h, origin)
+				h.Set("Access-Control-Allow-Methods", strings.Join(policy.methods, ", "))
+				if len(policy.headers) > 0 {
+					h.Set("Access-Control-Allow-Headers", strings.Join(policy.headers, ", "))
+				}
+				if policy.maxAge != "" {
+					h.Set("Access-Control-Max-Age", policy.maxAge)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if policy != nil {
+				policy.setOrigin(h, origin)
+				if policy.exposed != "" {
+					h.Set("Access-Control-Expose-Headers", policy.exposed)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func mustNew(t *testing.T, opts Options) *Policy {
+	t.Helper()
+	p, err := New(opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return p
+}
+
+func TestPolicy_AllowsOrigin(t *testing.T) {
+	p := mustNew(t, Options{AllowedOrigins: []string{"https://vibeguide.tv", "https://*.vibeguide.tv", "http://localhost:5173"}})
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://vibeguide.tv", true},
+		{"https://VibeGuide.tv", true},
+		{"https://app.vibeguide.tv", true},
+		{"https://a.b.vibeguide.tv", true},
+		{"http://localhost:5173", true},
+		{"http://vibeguide.tv", false},
+		{"https://evilvibeguide.tv", false},
+		{"https://vibeguide.tv.evil.com", false},
+		{"https://app.vibeguide.tv:8443", false},
+		{"http://localhost:3000", false},
+		{"null", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := p.AllowsOrigin(tt.origin); got != tt.allowed {
+			t.Errorf("AllowsOrigin(%q) = %v, expected %v", tt.origin, got, tt.allowed)
+		}
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"any origin with credentials", Options{AllowedOrigins: []string{"*"}, AllowCredentials: true}},
+		{"missing scheme", Options{AllowedOrigins: []string{"vibeguide.tv"}}},
+		{"path", Options{AllowedOrigins: []string{"https://vibeguide.tv/app"}}},
+		{"inner wildcard", Options{AllowedOrigins: []string{"https://app.*.tv"}}},
+		{"bare wildcard", Options{AllowedOrigins: []string{"https://*."}}},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.opts); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	private := mustNew(t, Options{
+		AllowedOrigins:   []string{"https://vibeguide.tv"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           5 * time.Minute,
+	})
+	public := mustNew(t, Options{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, ExposedHeaders: []string{"RateLimit-Remaining"}})
+	partner := mustNew(t, Options{AllowedOrigins: []string{"https://*.partner.tv"}, AllowedMethods: []string{"GET"}, AllowCredentials: true})
+
+	handler := Middleware([]*Policy{private},
+		Route{Prefix: "/v1/streams", Policies: []*Policy{private, public}},
+		Route{Prefix: "/v1/streams/partner", Policies: []*Policy{partner}},
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		reqMethod   string
+		reqHeaders  string
+		status      int
+		allowOrigin string
+		credentials string
+	}{
+		{"same origin", "GET", "/v1/lineups", "", "", "", http.StatusOK, "", ""},
+		{"trusted origin", "GET", "/v1/lineups", "https://vibeguide.tv", "", "", http.StatusOK, "https://vibeguide.tv", "true"},
+		{"untrusted origin gets no headers", "GET", "/v1/lineups", "https://evil.com", "", "", http.StatusOK, "", ""},
+		{"trusted preflight", "OPTIONS", "/v1/lineups", "https://vibeguide.tv", "DELETE", "authorization, content-type", http.StatusNoContent, "https://vibeguide.tv", "true"},
+		{"untrusted preflight", "OPTIONS", "/v1/lineups", "https://evil.com", "DELETE", "", http.StatusForbidden, "", ""},
+		{"disallowed method", "OPTIONS", "/v1/lineups", "https://vibeguide.tv", "PATCH", "", http.StatusForbidden, "", ""},
+		{"disallowed header", "OPTIONS", "/v1/lineups", "https://vibeguide.tv", "POST", "X-Secret", http.StatusForbidden, "", ""},
+		{"public route any origin", "GET", "/v1/streams/top", "https://fan.site", "", "", http.StatusOK, "*", ""},
+		{"public route trusted origin keeps credentials", "GET", "/v1/streams", "https://vibeguide.tv", "", "", http.StatusOK, "https://vibeguide.tv", "true"},
+		{"public route rejects writes", "OPTIONS", "/v1/streams", "https://fan.site", "POST", "", http.StatusForbidden, "", ""},
+		{"public route rejects authorization", "OPTIONS", "/v1/streams", "https://fan.site", "GET", "Authorization", http.StatusForbidden, "", ""},
+		{"override wins on longer prefix", "GET", "/v1/streams/partner/x", "https://app.partner.tv", "", "", http.StatusOK, "https://app.partner.tv", "true"},
+		{"override replaces defaults", "GET", "/v1/streams/partner", "https://vibeguide.tv", "", "", http.StatusOK, "", ""},
+		{"prefix matches whole segments", "GET", "/v1/streamsx", "https://fan.site", "", "", http.StatusOK, "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.reqMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+		}
+		if tt.reqHeaders != "" {
+			req.Header.Set("Access-Control-Request-Headers", tt.reqHeaders)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+			t.Errorf("%s: expected Allow-Origin %q, got %q", tt.name, tt.allowOrigin, got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+			t.Errorf("%s: expected Allow-Credentials %q, got %q", tt.name, tt.credentials, got)
+		}
+		if w.Header().Values("Vary")[0] != "Origin" {
+			t.Errorf("%s: expected Vary: Origin, got %v", tt.name, w.Header().Values("Vary"))
+		}
+	}
+}
+
+func TestMiddleware_PreflightHeaders(t *testing.T) {
+	p := mustNew(t, Options{
+		AllowedOrigins: []string{"https://vibeguide.tv"},
+		AllowedMethods: []string{"get", "post"},
+		AllowedHeaders: []string{"content-type", "x-csrf-token"},
+		MaxAge:         5 * time.Minute,
+	})
+	handler := Middleware([]*Policy{p})(http.NotFoundHandler())
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://vibeguide.tv")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "X-CSRF-Token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Errorf("Expected methods \"GET, POST\", got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, X-Csrf-Token" {
+		t.Errorf("Expected canonical headers, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "300" {
+		t.Errorf("Expected max age 300, got %q", got)
+	}
+	if got := w.Header().Values("Vary"); len(got) != 3 {
+		t.Errorf("Expected preflight Vary headers, got %v", got)
+	}
+}
@@ -0,0 +1,152 @@
+// Package health runs dependency checks for readiness probes. Each check has its own timeout
+// and its result is cached, so frequent probes don't hammer the dependencies they check.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Check and report statuses
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded" // Only non-critical checks are down
+	StatusDown     = "down"
+)
+
+// DefaultTimeout bounds a check that does not set its own
+const DefaultTimeout = 3 * time.Second
+
+// Check is one dependency check
+type Check struct {
+	Name string
+	// Critical checks make the service unready when down; others only degrade it
+	Critical bool
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Status     string    `json:"status"`
+	Critical   bool      `json:"critical"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Report is the outcome of every check
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether every critical check is up
+func (r Report) Ready() bool {
+	return r.Status != StatusDown
+}
+
+// cachedCheck serialises runs of a check, so concurrent probes share one result
+type cachedCheck struct {
+	Check
+	mu     sync.Mutex
+	result Result
+}
+
+// Checker runs checks, reusing results younger than its TTL
+type Checker struct {
+	ttl    time.Duration
+	checks []*cachedCheck
+	now    func() time.Time
+}
+
+// NewChecker builds a checker whose results are cached for ttl
+func NewChecker(ttl time.Duration, checks ...Check) *Checker {
+	c := &Checker{ttl: ttl, now: time.Now}
+	for _, check := range checks {
+		if check.Timeout <= 0 {
+			check.Timeout = DefaultTimeout
+		}
+		c.checks = append(c.checks, &cachedCheck{Check: check})
+	}
+	return c
+}
+
+// Run runs every check whose cached result is stale, concurrently, and reports them all
+func (c *Checker) Run(ctx context.Context) Report {
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(c.checks))}
+	for i, check := range c.checks {
+		res := results[i]
+		report.Checks[check.Name] = res
+		if res.Status == StatusUp {
+			continue
+		}
+		if check.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check *cachedCheck) Result {
+	check.mu.Lock()
+	defer check.mu.Unlock()
+	if !check.result.CheckedAt.IsZero() && c.now().Sub(check.result.CheckedAt) < c.ttl {
+		return check.result
+	}
+
+	// The result is shared, so a probe giving up early mustn't cancel the check for everyone
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), check.Timeout)
+	defer cancel()
+	start := c.now()
+	err := runCheck(checkCtx, check.Run)
+	if err == nil && checkCtx.Err() != nil {
+		err = checkCtx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", check.Timeout)
+	}
+
+	res := Result{Status: StatusUp, Critical: check.Critical, CheckedAt: c.now()}
+	res.DurationMS = res.CheckedAt.Sub(start).Milliseconds()
+	if err != nil {
+		res.Status, res.Error = StatusDown, err.Error()
+	}
+	check.result = res
+	return res
+}
+
+// runCheck runs fn, giving up when ctx ends even if fn ignores it
+func runCheck(ctx context.Context, fn func(context.Context) error) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
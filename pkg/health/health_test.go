@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChecker_Run(t *testing.T) {
+	var dbCalls atomic.Int32
+	c := NewChecker(time.Minute,
+		Check{Name: "database", Critical: true, Run: func(context.Context) error {
+			dbCalls.Add(1)
+			return nil
+		}},
+		Check{Name: "worker", Run: func(context.Context) error { return errors.New("stuck") }},
+	)
+
+	report := c.Run(context.Background())
+	if report.Status != StatusDegraded || !report.Ready() {
+		t.Errorf("Expected a degraded but ready report, got %+v", report)
+	}
+	if res := report.Checks["worker"]; res.Status != StatusDown || res.Error != "stuck" || res.Critical {
+		t.Errorf("Unexpected worker result: %+v", res)
+	}
+	if res := report.Checks["database"]; res.Status != StatusUp || !res.Critical {
+		t.Errorf("Unexpected database result: %+v", res)
+	}
+
+	// Cached until the TTL passes
+	c.Run(context.Background())
+	if dbCalls.Load() != 1 {
+		t.Errorf("Expected the cached result to be reused, got %d calls", dbCalls.Load())
+	}
+	now := time.Now().Add(2 * time.Minute)
+	c.now = func() time.Time { return now }
+	c.Run(context.Background())
+	if dbCalls.Load() != 2 {
+		t.Errorf("Expected a stale result to be rechecked, got %d calls", dbCalls.Load())
+	}
+}
+
+func TestChecker_CriticalTimeout(t *testing.T) {
+	c := NewChecker(time.Minute, Check{Name: "twitch", Critical: true, Timeout: 20 * time.Millisecond, Run: func(context.Context) error {
+		// Ignores its context, the checker still gives up
+		time.Sleep(time.Second)
+		return nil
+	}})
+
+	start := time.Now()
+	report := c.Run(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected the check to time out, took %s", time.Since(start))
+	}
+	if report.Status != StatusDown || report.Ready() {
+		t.Errorf("Expected an unready report, got %+v", report)
+	}
+	if res := report.Checks["twitch"]; !strings.Contains(res.Error, "timed out") {
+		t.Errorf("Expected a timeout error, got %q", res.Error)
+	}
+}
+
+func TestHeartbeats(t *testing.T) {
+	h := NewHeartbeats()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+
+	if err := h.Status("digest"); err == nil {
+		t.Error("Expected an unregistered worker to be reported")
+	}
+
+	h.Register("live_sessions", time.Minute)
+	if err := h.Status("live_sessions"); err != nil {
+		t.Errorf("Expected a just-started worker to be up, got %v", err)
+	}
+
+	now = now.Add(90 * time.Second)
+	h.Beat("live_sessions", errors.New("helix 503"))
+	if err := h.Status("live_sessions"); err == nil || !strings.Contains(err.Error(), "helix 503") {
+		t.Errorf("Expected the failed cycle to be reported, got %v", err)
+	}
+
+	h.Beat("live_sessions", nil)
+	now = now.Add(3 * time.Minute)
+	if err := h.Status("live_sessions"); err == nil || !strings.Contains(err.Error(), "no cycle completed") {
+		t.Errorf("Expected a stale worker to be reported, got %v", err)
+	}
+
+	checks := h.Checks("worker:")
+	if len(checks) != 1 || checks[0].Name != "worker:live_sessions" || checks[0].Critical {
+		t.Errorf("Unexpected worker checks: %+v", checks)
+	}
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// staleAfter is how many missed intervals make a worker stale
+const staleAfter = 2
+
+// heartbeat is a worker's schedule and its last completed cycle
+type heartbeat struct {
+	interval  time.Duration
+	startedAt time.Time
+	lastBeat  time.Time
+	lastErr   error
+}
+
+// Heartbeats tracks background workers, each reporting after every cycle
+type Heartbeats struct {
+	mu      sync.Mutex
+	workers map[string]*heartbeat
+	now     func() time.Time
+}
+
+// NewHeartbeats returns an empty worker registry
+func NewHeartbeats() *Heartbeats {
+	return &Heartbeats{workers: map[string]*heartbeat{}, now: time.Now}
+}
+
+// Register records that a worker started and runs every interval
+func (h *Heartbeats) Register(name string, interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.workers[name] = &heartbeat{interval: interval, startedAt: h.now()}
+}
+
+// Beat records that a worker finished a cycle, with its error if the cycle failed
+func (h *Heartbeats) Beat(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if w, ok := h.workers[name]; ok {
+		w.lastBeat, w.lastErr = h.now(), err
+	}
+}
+
+// Status returns an error when the worker's last cycle failed or it missed its schedule
+func (h *Heartbeats) Status(name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.workers[name]
+	if !ok {
+		return fmt.Errorf("not running")
+	}
+	last := w.lastBeat
+	if last.IsZero() {
+		last = w.startedAt
+	}
+	if since := h.now().Sub(last); since > staleAfter*w.interval {
+		return fmt.Errorf("no cycle completed in %s, runs every %s", since.Round(time.Second), w.interval)
+	}
+	if w.lastErr != nil {
+		return fmt.Errorf("last cycle failed: %w", w.lastErr)
+	}
+	return nil
+}
+
+// Checks returns a non-critical check per registered worker, named prefix+name
+func (h *Heartbeats) Checks(prefix string) []Check {
+	h.mu.Lock()
+	names := make([]string, 0, len(h.workers))
+	for name := range h.workers {
+		names = append(names, name)
+	}
+	h.mu.Unlock()
+	sort.Strings(names)
+
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = Check{
+			Name: prefix + name,
+			Run:  func(context.Context) error { return h.Status(name) },
+		}
+	}
+	return checks
+}
@@ -22,6 +22,8 @@ func NewRouterLogger() *httplog.Logger {
 		QuietDownRoutes: []string{
 			"/",
 			"/ping",
+			"/healthz",
+			"/readyz",
 		},
 		QuietDownPeriod: 10 * time.Second,
 	})
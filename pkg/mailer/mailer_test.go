@@ -0,0 +1,176 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts one message without auth or TLS, the way Mailpit does locally
+type fakeSMTPServer struct {
+	listener net.Listener
+	from     string
+	rcpt     string
+	data     chan string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &fakeSMTPServer{listener: ln, data: make(chan string, 1)}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	reply("220 fake ESMTP")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = strings.Trim(strings.TrimPrefix(cmd, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpt = strings.Trim(strings.TrimPrefix(cmd, "RCPT TO:"), "<>")
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var body strings.Builder
+			for {
+				l, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				body.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.data <- body.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestNewSMTPMailer_Validation(t *testing.T) {
+	if _, err := NewSMTPMailer(SMTPConfig{From: "digest@example.com"}); err == nil {
+		t.Error("Expected error for missing host")
+	}
+	if _, err := NewSMTPMailer(SMTPConfig{Host: "localhost", From: "not an address"}); err == nil {
+		t.Error("Expected error for invalid from address")
+	}
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	server := newFakeSMTPServer(t)
+
+	m, err := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: server.port(), From: "VibeGuide <digest@example.com>"})
+	if err != nil {
+		t.Fatalf("Failed to create mailer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = m.Send(ctx, Message{
+		To:      "viewer@example.com",
+		Subject: "Your week on Twitch",
+		Text:    "teststreamer streamed 3h 20m",
+		HTML:    "<p>teststreamer streamed <b>3h 20m</b></p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://vibeguide.example/unsubscribe?token=abc>"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if server.from != "digest@example.com" || server.rcpt != "viewer@example.com" {
+		t.Errorf("Unexpected envelope from=%q rcpt=%q", server.from, server.rcpt)
+	}
+
+	raw := <-server.data
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if msg.Header.Get("List-Unsubscribe") != "<https://vibeguide.example/unsubscribe?token=abc>" {
+		t.Errorf("Expected List-Unsubscribe header, got %q", msg.Header.Get("List-Unsubscribe"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Expected multipart/alternative, got %q", msg.Header.Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read part: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		types = append(types, part.Header.Get("Content-Type"))
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") && !strings.Contains(string(body), "<b>3h 20m</b>") {
+			t.Errorf("Expected decoded HTML body, got %q", body)
+		}
+	}
+	if len(types) != 2 {
+		t.Errorf("Expected text and HTML parts, got %v", types)
+	}
+}
+
+func TestBuildMIME_StripsHeaderInjection(t *testing.T) {
+	raw, err := BuildMIME("digest@example.com", Message{
+		To:      "viewer@example.com",
+		Subject: "hi",
+		Headers: map[string]string{"X-Test": "value\r\nBcc: attacker@example.com"},
+	}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Error("Expected injected Bcc header to be stripped")
+	}
+}
@@ -5,3 +5,9 @@ type APIHandlerResp struct {
 	ApiVersion    string `json:"apiVersion"`
 	Data          any    `json:"data"`
 }
+
+// APIError is the data of an error response that carries a machine-readable code
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when a destination resolves to an address that is not publicly routable.
+// Destinations are user supplied, so delivering to them must never reach the internal network.
+var ErrBlockedAddress = errors.New("notification destination resolves to a non-public address")
+
+// IsPublicIP reports whether ip may be used as a delivery address
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// CheckPublicHost resolves host and returns ErrBlockedAddress when any of its addresses is not public.
+// It is a fail-fast check for user input; the client from NewHTTPClient checks again at dial time,
+// so a host re-pointed after validation (DNS rebinding) is still refused.
+func CheckPublicHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return fmt.Errorf("%w: %s is %s", ErrBlockedAddress, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// NewHTTPClient returns the client notifiers use by default. It refuses to connect to non-public
+// addresses, does not follow redirects (a 3xx is reported as a StatusError) and ignores proxy
+// settings, since a proxy would dial the destination on our behalf without the address check.
+func NewHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   DefaultTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   DefaultTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// dialControl runs after DNS resolution, right before each connection is made
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout bounds every delivery request
+const DefaultTimeout = 10 * time.Second
+
+// ErrGone is returned when the destination reports it no longer exists (HTTP 404/410).
+// Callers should disable the destination instead of retrying.
+var ErrGone = errors.New("notification destination is gone")
+
+// Alert is the channel-agnostic content of a notification
+type Alert struct {
+	Type             string    `json:"type"`
+	Title            string    `json:"title"`
+	Message          string    `json:"message"`
+	URL              string    `json:"url"`
+	BroadcasterID    string    `json:"broadcaster_id"`
+	BroadcasterLogin string    `json:"broadcaster_login"`
+	BroadcasterName  string    `json:"broadcaster_name"`
+	GameID           string    `json:"game_id"`
+	GameName         string    `json:"game_name"`
+	StreamTitle      string    `json:"stream_title"`
+	ThumbnailURL     string    `json:"thumbnail_url"`
+	OccurredAt       time.Time `json:"occurred_at"`
+}
+
+// Target describes where a notification is delivered; which fields are used depends on the Notifier
+type Target struct {
+	URL    string // Webhook URL or push service endpoint
+	Secret string // HMAC signing secret for generic webhooks
+	P256dh string // Web Push subscription public key (base64url)
+	Auth   string // Web Push subscription auth secret (base64url)
+}
+
+// Notifier delivers an Alert to a Target
+type Notifier interface {
+	Notify(ctx context.Context, target Target, alert Alert) error
+}
+
+// StatusError is returned when a destination answers with a non-success status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("notification delivery failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether a delivery that failed with this status may succeed later
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// IsRetryable reports whether a delivery error is worth retrying
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, ErrGone) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Retryable()
+	}
+	// Network errors, timeouts and the like
+	return true
+}
+
+// postJSON sends a JSON body and maps the response status to an error
+func postJSON(ctx context.Context, httpClient *http.Client, url string, payload any, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification payload: %w", err)
+	}
+	return post(ctx, httpClient, url, body, "application/json", headers)
+}
+
+// post sends a request body and maps the response status to an error
+func post(ctx context.Context, httpClient *http.Client, url string, body []byte, contentType string, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("notification request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return fmt.Errorf("%w: status %d", ErrGone, resp.StatusCode)
+	default:
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+}
+
+// defaultHTTPClient returns httpClient, or the guarded client from NewHTTPClient when nil
+func defaultHTTPClient(httpClient *http.Client) *http.Client {
+	if httpClient != nil {
+		return httpClient
+	}
+	return NewHTTPClient()
+}
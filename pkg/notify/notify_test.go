@@ -0,0 +1,303 @@
+package notify
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAlert() Alert {
+	return Alert{
+		Type:             "went_live",
+		Title:            "TestStreamer is live",
+		Message:          "Playing Just Chatting",
+		URL:              "https://twitch.tv/teststreamer",
+		BroadcasterID:    "987654321",
+		BroadcasterLogin: "teststreamer",
+		OccurredAt:       time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// captureServer records the last request body and headers and answers with status
+func captureServer(t *testing.T, status int, body *[]byte, headers *http.Header) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		*body = data
+		*headers = r.Header.Clone()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDiscordNotifier(t *testing.T) {
+	var body []byte
+	var headers http.Header
+	server := captureServer(t, http.StatusNoContent, &body, &headers)
+
+	err := NewDiscordNotifier(server.Client()).Notify(context.Background(), Target{URL: server.URL}, testAlert())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var payload struct {
+		Content string           `json:"content"`
+		Embeds  []map[string]any `json:"embeds"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("Failed to parse payload: %v", err)
+	}
+	if payload.Content != "TestStreamer is live" || len(payload.Embeds) != 1 {
+		t.Errorf("Unexpected Discord payload: %s", body)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var body []byte
+	var headers http.Header
+	server := captureServer(t, http.StatusOK, &body, &headers)
+
+	err := NewSlackNotifier(server.Client()).Notify(context.Background(), Target{URL: server.URL}, testAlert())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("Failed to parse payload: %v", err)
+	}
+	if !strings.Contains(payload["text"], "<https://twitch.tv/teststreamer|Watch now>") {
+		t.Errorf("Expected Slack link in payload, got: %s", payload["text"])
+	}
+}
+
+func TestWebhookNotifier_Signature(t *testing.T) {
+	var body []byte
+	var headers http.Header
+	server := captureServer(t, http.StatusOK, &body, &headers)
+
+	notifier := NewWebhookNotifier(server.Client())
+	notifier.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	err := notifier.Notify(context.Background(), Target{URL: server.URL, Secret: "shh"}, testAlert())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if headers.Get(TimestampHeader) != "1700000000" {
+		t.Errorf("Expected timestamp header, got %q", headers.Get(TimestampHeader))
+	}
+	expected := "sha256=" + SignWebhook("shh", "1700000000", body)
+	if headers.Get(SignatureHeader) != expected {
+		t.Errorf("Expected signature %q, got %q", expected, headers.Get(SignatureHeader))
+	}
+}
+
+func TestNotifier_StatusErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		gone      bool
+		retryable bool
+	}{
+		{http.StatusGone, true, false},
+		{http.StatusNotFound, true, false},
+		{http.StatusBadRequest, false, false},
+		{http.StatusTooManyRequests, false, true},
+		{http.StatusBadGateway, false, true},
+	}
+
+	for _, tt := range tests {
+		var body []byte
+		var headers http.Header
+		server := captureServer(t, tt.status, &body, &headers)
+
+		err := NewWebhookNotifier(server.Client()).Notify(context.Background(), Target{URL: server.URL}, testAlert())
+		if err == nil {
+			t.Fatalf("status %d: expected error, got nil", tt.status)
+		}
+		if errors.Is(err, ErrGone) != tt.gone {
+			t.Errorf("status %d: expected gone=%t, got error %v", tt.status, tt.gone, err)
+		}
+		if IsRetryable(err) != tt.retryable {
+			t.Errorf("status %d: expected retryable=%t", tt.status, tt.retryable)
+		}
+	}
+}
+
+func TestWebPushNotifier_EncryptsAndSigns(t *testing.T) {
+	keys, err := GenerateVAPIDKeys("mailto:ops@example.com")
+	if err != nil {
+		t.Fatalf("Failed to generate VAPID keys: %v", err)
+	}
+
+	// Browser side of the subscription
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	target := Target{
+		P256dh: base64.RawURLEncoding.EncodeToString(uaPrivate.PublicKey().Bytes()),
+		Auth:   base64.RawURLEncoding.EncodeToString(auth),
+	}
+
+	var body []byte
+	var headers http.Header
+	server := captureServer(t, http.StatusCreated, &body, &headers)
+	target.URL = server.URL + "/push/abc"
+
+	notifier, err := NewWebPushNotifier(keys, server.Client())
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	if err := notifier.Notify(context.Background(), target, testAlert()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if headers.Get("Content-Encoding") != "aes128gcm" {
+		t.Errorf("Expected aes128gcm content encoding, got %q", headers.Get("Content-Encoding"))
+	}
+	verifyVAPIDHeader(t, headers.Get("Authorization"), keys, server.URL)
+
+	// Decrypt the body the way a user agent would
+	salt := body[:16]
+	recordSize := binary.BigEndian.Uint32(body[16:20])
+	keyIDLen := int(body[20])
+	asPublicBytes := body[21 : 21+keyIDLen]
+	ciphertext := body[21+keyIDLen:]
+	if recordSize != webPushRecordSize {
+		t.Errorf("Expected record size %d, got %d", webPushRecordSize, recordSize)
+	}
+
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	if err != nil {
+		t.Fatalf("Invalid sender key: %v", err)
+	}
+	shared, err := uaPrivate.ECDH(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cek, nonce, err := deriveWebPushKeys(shared, auth, salt, uaPrivate.PublicKey().Bytes(), asPublicBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("Failed to decrypt push payload: %v", err)
+	}
+	if plaintext[len(plaintext)-1] != 0x02 {
+		t.Error("Expected last-record padding delimiter")
+	}
+
+	var alert Alert
+	if err := json.Unmarshal(plaintext[:len(plaintext)-1], &alert); err != nil {
+		t.Fatalf("Failed to parse decrypted alert: %v", err)
+	}
+	if alert.BroadcasterID != "987654321" {
+		t.Errorf("Expected decrypted broadcaster ID, got %q", alert.BroadcasterID)
+	}
+}
+
+// verifyVAPIDHeader checks the vapid Authorization header is a valid ES256 JWT for the origin
+func verifyVAPIDHeader(t *testing.T, header string, keys VAPIDKeys, origin string) {
+	t.Helper()
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ", ") {
+		if strings.HasPrefix(part, "t=") {
+			token = part[2:]
+		}
+		if strings.HasPrefix(part, "k=") {
+			key = part[2:]
+		}
+	}
+	if key != keys.PublicKey {
+		t.Errorf("Expected VAPID public key %q, got %q", keys.PublicKey, key)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a JWT, got %q", token)
+	}
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]any
+	json.Unmarshal(claimsJSON, &claims)
+	if claims["aud"] != origin {
+		t.Errorf("Expected aud %q, got %v", origin, claims["aud"])
+	}
+
+	pubBytes, _ := base64.RawURLEncoding.DecodeString(keys.PublicKey)
+	pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), pubBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		t.Error("VAPID token signature did not verify")
+	}
+}
+
+func TestNewHTTPClient_RefusesPrivateAddresses(t *testing.T) {
+	var body []byte
+	var headers http.Header
+	server := captureServer(t, http.StatusOK, &body, &headers)
+
+	// The default client checks the dialed address, so a loopback destination is refused
+	err := NewWebhookNotifier(nil).Notify(context.Background(), Target{URL: server.URL}, testAlert())
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Expected ErrBlockedAddress, got %v", err)
+	}
+	if body != nil {
+		t.Error("Expected no request to reach the server")
+	}
+
+	if err := CheckPublicHost(context.Background(), "127.0.0.1"); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Expected loopback to be blocked, got %v", err)
+	}
+	for _, ip := range []string{"10.0.0.1", "172.16.5.4", "192.168.1.1", "169.254.169.254", "0.0.0.0", "::1", "fe80::1", "fd00::1"} {
+		if IsPublicIP(net.ParseIP(ip)) {
+			t.Errorf("Expected %s to be blocked", ip)
+		}
+	}
+	if !IsPublicIP(net.ParseIP("93.184.216.34")) {
+		t.Error("Expected a public address to be allowed")
+	}
+}
+
+func TestNewHTTPClient_DoesNotFollowRedirects(t *testing.T) {
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	// Swap only the dialer so the test server is reachable; the redirect policy is the one under test
+	client := NewHTTPClient()
+	client.Transport = redirect.Client().Transport
+	err := NewWebhookNotifier(client).Notify(context.Background(), Target{URL: redirect.URL}, testAlert())
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusFound {
+		t.Errorf("Expected the redirect to be reported as a status error, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Generic webhook signature headers
+const (
+	SignatureHeader = "X-VibeGuide-Signature"
+	TimestampHeader = "X-VibeGuide-Timestamp"
+)
+
+// DiscordNotifier posts alerts to a Discord incoming webhook
+type DiscordNotifier struct {
+	httpClient *http.Client
+}
+
+// NewDiscordNotifier creates a Discord notifier; a nil client uses NewHTTPClient
+func NewDiscordNotifier(httpClient *http.Client) *DiscordNotifier {
+	return &DiscordNotifier{httpClient: defaultHTTPClient(httpClient)}
+}
+
+// Notify sends the alert as a Discord embed
+func (n *DiscordNotifier) Notify(ctx context.Context, target Target, alert Alert) error {
+	embed := map[string]any{
+		"title":       alert.Title,
+		"description": alert.Message,
+		"url":         alert.URL,
+		"timestamp":   alert.OccurredAt.UTC().Format(time.RFC3339),
+	}
+	if alert.ThumbnailURL != "" {
+		embed["image"] = map[string]string{"url": alert.ThumbnailURL}
+	}
+
+	payload := map[string]any{
+		"content": alert.Title,
+		"embeds":  []any{embed},
+	}
+	return postJSON(ctx, n.httpClient, target.URL, payload, nil)
+}
+
+// SlackNotifier posts alerts to a Slack incoming webhook
+type SlackNotifier struct {
+	httpClient *http.Client
+}
+
+// NewSlackNotifier creates a Slack notifier; a nil client uses NewHTTPClient
+func NewSlackNotifier(httpClient *http.Client) *SlackNotifier {
+	return &SlackNotifier{httpClient: defaultHTTPClient(httpClient)}
+}
+
+// Notify sends the alert as a Slack message with a link
+func (n *SlackNotifier) Notify(ctx context.Context, target Target, alert Alert) error {
+	text := fmt.Sprintf("*%s*\n%s", alert.Title, alert.Message)
+	if alert.URL != "" {
+		text = fmt.Sprintf("%s\n<%s|Watch now>", text, alert.URL)
+	}
+	return postJSON(ctx, n.httpClient, target.URL, map[string]string{"text": text}, nil)
+}
+
+// WebhookNotifier posts the raw alert JSON to an arbitrary HTTP endpoint.
+// When the target has a secret the body is signed with HMAC-SHA256 over "timestamp.body".
+type WebhookNotifier struct {
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewWebhookNotifier creates a generic webhook notifier; a nil client uses NewHTTPClient
+func NewWebhookNotifier(httpClient *http.Client) *WebhookNotifier {
+	return &WebhookNotifier{httpClient: defaultHTTPClient(httpClient), now: time.Now}
+}
+
+// Notify posts the alert, signing it when a secret is configured
+func (n *WebhookNotifier) Notify(ctx context.Context, target Target, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification payload: %w", err)
+	}
+
+	headers := map[string]string{}
+	if target.Secret != "" {
+		timestamp := strconv.FormatInt(n.now().Unix(), 10)
+		headers[TimestampHeader] = timestamp
+		headers[SignatureHeader] = "sha256=" + SignWebhook(target.Secret, timestamp, body)
+	}
+
+	return post(ctx, n.httpClient, target.URL, body, "application/json", headers)
+}
+
+// SignWebhook computes the hex HMAC-SHA256 signature receivers use to verify a webhook
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Web Push defaults (RFC 8030, RFC 8291, RFC 8292)
+const (
+	WebPushTTL        = 24 * time.Hour
+	webPushRecordSize = 4096
+	vapidTokenExpiry  = 12 * time.Hour
+)
+
+// VAPIDKeys identifies this application server to push services
+type VAPIDKeys struct {
+	PublicKey  string // base64url uncompressed P-256 point, handed to browsers as applicationServerKey
+	PrivateKey string // base64url raw P-256 scalar
+	Subject    string // mailto: or https: contact URI
+}
+
+// GenerateVAPIDKeys creates a new VAPID key pair
+func GenerateVAPIDKeys(subject string) (VAPIDKeys, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return VAPIDKeys{}, fmt.Errorf("failed to generate VAPID key: %w", err)
+	}
+	priv, err := key.Bytes()
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	pub, err := key.PublicKey.Bytes()
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	return VAPIDKeys{
+		PublicKey:  base64.RawURLEncoding.EncodeToString(pub),
+		PrivateKey: base64.RawURLEncoding.EncodeToString(priv),
+		Subject:    subject,
+	}, nil
+}
+
+// WebPushNotifier sends encrypted (aes128gcm) Web Push messages authenticated with VAPID
+type WebPushNotifier struct {
+	httpClient *http.Client
+	keys       VAPIDKeys
+	signingKey *ecdsa.PrivateKey
+	now        func() time.Time
+}
+
+// NewWebPushNotifier creates a Web Push notifier; a nil client uses NewHTTPClient
+func NewWebPushNotifier(keys VAPIDKeys, httpClient *http.Client) (*WebPushNotifier, error) {
+	raw, err := decodeBase64URL(keys.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	signingKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	if keys.Subject == "" {
+		return nil, fmt.Errorf("VAPID subject is required")
+	}
+
+	return &WebPushNotifier{
+		httpClient: defaultHTTPClient(httpClient),
+		keys:       keys,
+		signingKey: signingKey,
+		now:        time.Now,
+	}, nil
+}
+
+// Notify encrypts the alert JSON for the subscription and posts it to the push service
+func (n *WebPushNotifier) Notify(ctx context.Context, target Target, alert Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification payload: %w", err)
+	}
+
+	body, err := encryptWebPush(payload, target.P256dh, target.Auth)
+	if err != nil {
+		return err
+	}
+
+	token, err := n.vapidToken(target.URL)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		"Content-Encoding": "aes128gcm",
+		"TTL":              strconv.Itoa(int(WebPushTTL.Seconds())),
+		"Urgency":          "high",
+		"Authorization":    fmt.Sprintf("vapid t=%s, k=%s", token, n.keys.PublicKey),
+	}
+	return post(ctx, n.httpClient, target.URL, body, "application/octet-stream", headers)
+}
+
+// vapidToken signs an ES256 JWT whose audience is the push service origin
+func (n *WebPushNotifier) vapidToken(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid push endpoint %q", endpoint)
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": n.now().Add(vapidTokenExpiry).Unix(),
+		"sub": n.keys.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, n.signingKey, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// encryptWebPush encrypts a payload for a push subscription per RFC 8291
+func encryptWebPush(payload []byte, p256dh, authSecret string) ([]byte, error) {
+	uaPublicBytes, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription p256dh key: %w", err)
+	}
+	auth, err := decodeBase64URL(authSecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription auth secret: %w", err)
+	}
+
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription p256dh key: %w", err)
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	asPublicBytes := asPrivate.PublicKey().Bytes()
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	cek, nonce, err := deriveWebPushKeys(sharedSecret, auth, salt, uaPublicBytes, asPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Single record: payload followed by the last-record delimiter
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	if len(plaintext)+gcm.Overhead() > webPushRecordSize {
+		return nil, fmt.Errorf("push payload too large: %d bytes", len(payload))
+	}
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+
+	// Header: salt | record size | key id length | key id (sender public key)
+	body := make([]byte, 0, 16+4+1+len(asPublicBytes)+len(ciphertext))
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, webPushRecordSize)
+	body = append(body, byte(len(asPublicBytes)))
+	body = append(body, asPublicBytes...)
+	body = append(body, ciphertext...)
+
+	return body, nil
+}
+
+// deriveWebPushKeys derives the content encryption key and nonce (RFC 8291 section 3.4)
+func deriveWebPushKeys(sharedSecret, auth, salt, uaPublic, asPublic []byte) (cek, nonce []byte, err error) {
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, auth, string(keyInfo), 32)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	cek, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cek, nonce, nil
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers produce both
+func decodeBase64URL(s string) ([]byte, error) {
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
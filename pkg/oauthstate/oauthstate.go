@@ -0,0 +1,186 @@
+// Package oauthstate mints and verifies the OAuth 2.0 state parameter. A state is an HMAC-signed,
+// expiring token naming the redirect URI and a hash of the browser session that started the
+// flow, plus a single-use nonce, so a callback can't be forged, replayed or completed in a
+// different browser.
+package oauthstate
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long a login has to come back from the provider
+const DefaultTTL = 10 * time.Minute
+
+var (
+	// ErrInvalidState is returned for states that are malformed or carry a bad signature
+	ErrInvalidState = errors.New("invalid oauth state")
+	// ErrExpiredState is returned for states older than the signer's TTL
+	ErrExpiredState = errors.New("oauth state expired")
+	// ErrStateMismatch is returned when the session or redirect URI differs from the one the state was minted for
+	ErrStateMismatch = errors.New("oauth state does not match this session")
+	// ErrStateReplayed is returned when the state's nonce was already used or has been swept
+	ErrStateReplayed = errors.New("oauth state already used")
+)
+
+// NonceStore remembers outstanding nonces until they are used or expire
+type NonceStore interface {
+	// Put records a nonce that may be consumed until expiresAt
+	Put(nonce string, expiresAt time.Time) error
+	// Consume removes the nonce, reporting whether it was outstanding and unexpired
+	Consume(nonce string, now time.Time) (bool, error)
+}
+
+type payload struct {
+	Nonce       string `json:"n"`
+	RedirectURI string `json:"r"`
+	Session     string `json:"s"`
+	ExpiresAt   int64  `json:"e"`
+}
+
+// Signer mints and verifies states
+type Signer struct {
+	key    []byte
+	ttl    time.Duration
+	nonces NonceStore
+	now    func() time.Time
+}
+
+// NewSigner creates a Signer. The key should be at least 32 random bytes and shared by every
+// instance that may receive the callback.
+func NewSigner(key []byte, ttl time.Duration, nonces NonceStore) (*Signer, error) {
+	if len(key) < 32 {
+		return nil, fmt.Errorf("oauthstate: signing key must be at least 32 bytes")
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Signer{key: key, ttl: ttl, nonces: nonces, now: time.Now}, nil
+}
+
+// Mint creates a state for a login started by the given browser session that will return to
+// redirectURI
+func (s *Signer) Mint(redirectURI, sessionID string) (string, error) {
+	nonce, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := s.now().Add(s.ttl)
+	if err := s.nonces.Put(nonce, expiresAt); err != nil {
+		return "", fmt.Errorf("oauthstate: failed to store nonce: %w", err)
+	}
+
+	body, err := json.Marshal(payload{
+		Nonce:       nonce,
+		RedirectURI: redirectURI,
+		Session:     hashSession(sessionID),
+		ExpiresAt:   expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+	return encoded + "." + s.sign(encoded), nil
+}
+
+// Verify checks a state returned to the callback and consumes its nonce, so each state is
+// accepted at most once
+func (s *Signer) Verify(state, redirectURI, sessionID string) error {
+	encoded, sig, ok := strings.Cut(state, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(encoded))) {
+		return ErrInvalidState
+	}
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidState
+	}
+	var p payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return ErrInvalidState
+	}
+
+	now := s.now()
+	if now.Unix() > p.ExpiresAt {
+		return ErrExpiredState
+	}
+	if !hmac.Equal([]byte(p.Session), []byte(hashSession(sessionID))) || p.RedirectURI != redirectURI {
+		return ErrStateMismatch
+	}
+	fresh, err := s.nonces.Consume(p.Nonce, now)
+	if err != nil {
+		return fmt.Errorf("oauthstate: failed to consume nonce: %w", err)
+	}
+	if !fresh {
+		return ErrStateReplayed
+	}
+	return nil
+}
+
+func (s *Signer) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashSession(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns n random bytes, base64url-encoded
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("oauthstate: failed to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// MemoryNonceStore keeps nonces in memory. States minted by one instance can only be verified
+// by the same instance.
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewMemoryNonceStore creates an empty store
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Put records a nonce
+func (m *MemoryNonceStore) Put(nonce string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nonces[nonce] = expiresAt
+	return nil
+}
+
+// Consume removes the nonce, reporting whether it was outstanding and unexpired
+func (m *MemoryNonceStore) Consume(nonce string, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expiresAt, ok := m.nonces[nonce]
+	delete(m.nonces, nonce)
+	return ok && !now.After(expiresAt), nil
+}
+
+// Sweep drops expired nonces
+func (m *MemoryNonceStore) Sweep(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for nonce, expiresAt := range m.nonces {
+		if now.After(expiresAt) {
+			delete(m.nonces, nonce)
+		}
+	}
+}
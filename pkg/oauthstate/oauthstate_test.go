@@ -0,0 +1,92 @@
+package oauthstate
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const redirect = "https://vibeguide.tv/auth/twitch/callback"
+
+func newTestSigner(t *testing.T) (*Signer, *MemoryNonceStore) {
+	t.Helper()
+	store := NewMemoryNonceStore()
+	s, err := NewSigner(bytes.Repeat([]byte{7}, 32), time.Minute, store)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return s, store
+}
+
+func TestMintVerify(t *testing.T) {
+	s, _ := newTestSigner(t)
+
+	state, err := s.Mint(redirect, "session-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := s.Verify(state, redirect, "session-1"); err != nil {
+		t.Fatalf("Expected state accepted, got: %v", err)
+	}
+	if err := s.Verify(state, redirect, "session-1"); !errors.Is(err, ErrStateReplayed) {
+		t.Errorf("Expected ErrStateReplayed on reuse, got: %v", err)
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	s, _ := newTestSigner(t)
+	state, _ := s.Mint(redirect, "session-1")
+	encoded, sig, _ := strings.Cut(state, ".")
+
+	other, _ := NewSigner(bytes.Repeat([]byte{8}, 32), time.Minute, NewMemoryNonceStore())
+	forged, _ := other.Mint(redirect, "session-1")
+
+	tests := []struct {
+		name     string
+		state    string
+		redirect string
+		session  string
+		expected error
+	}{
+		{"other browser", state, redirect, "session-2", ErrStateMismatch},
+		{"other redirect", state, "https://evil.example/cb", "session-1", ErrStateMismatch},
+		{"tampered", encoded + "x." + sig, redirect, "session-1", ErrInvalidState},
+		{"other key", forged, redirect, "session-1", ErrInvalidState},
+		{"client chosen", "abc123", redirect, "session-1", ErrInvalidState},
+	}
+	for _, tt := range tests {
+		if err := s.Verify(tt.state, tt.redirect, tt.session); !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+
+	// Failed checks must not burn the nonce for the legitimate callback
+	if err := s.Verify(state, redirect, "session-1"); err != nil {
+		t.Errorf("Expected the original state still accepted, got: %v", err)
+	}
+}
+
+func TestVerify_Expired(t *testing.T) {
+	s, store := newTestSigner(t)
+	start := time.Now()
+	s.now = func() time.Time { return start }
+	state, _ := s.Mint(redirect, "session-1")
+
+	s.now = func() time.Time { return start.Add(2 * time.Minute) }
+	if err := s.Verify(state, redirect, "session-1"); !errors.Is(err, ErrExpiredState) {
+		t.Errorf("Expected ErrExpiredState, got: %v", err)
+	}
+
+	store.Sweep(start.Add(2 * time.Minute))
+	if len(store.nonces) != 0 {
+		t.Errorf("Expected expired nonces swept, got %d", len(store.nonces))
+	}
+}
+
+func TestNewSigner_ShortKey(t *testing.T) {
+	if _, err := NewSigner([]byte("short"), 0, NewMemoryNonceStore()); err == nil {
+		t.Error("Expected error for a short key")
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPExtractor finds the client IP of a request. X-Forwarded-For is only believed when the
+// connection comes from a trusted proxy, and then only as far back as the proxies are trusted,
+// so clients can't pick their own rate limit bucket by sending the header.
+type IPExtractor struct {
+	trusted []netip.Prefix
+}
+
+// NewIPExtractor creates an IPExtractor trusting proxies in the given CIDRs or single IPs
+func NewIPExtractor(trustedProxies []string) (*IPExtractor, error) {
+	e := &IPExtractor{}
+	for _, cidr := range trustedProxies {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("ratelimit: invalid trusted proxy %q", cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		e.trusted = append(e.trusted, prefix.Masked())
+	}
+	return e, nil
+}
+
+func (e *IPExtractor) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range e.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the client IP: the peer address, or when the peer is a trusted proxy the
+// right-most X-Forwarded-For entry that isn't one
+func (e *IPExtractor) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	peer = peer.Unmap()
+	if !e.isTrusted(peer) {
+		return peer.String()
+	}
+
+	client := peer
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !e.isTrusted(client) {
+			break
+		}
+	}
+	return client.String()
+}
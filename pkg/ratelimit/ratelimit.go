@@ -0,0 +1,139 @@
+// Package ratelimit counts requests per client in fixed windows against a quota and reports the
+// outcome in the IETF RateLimit-* response headers. Counters live in a pluggable Store so several
+// instances can share them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota allows Limit requests per Window
+type Quota struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseQuota parses "<limit>/<window>", e.g. "120/1m" or "10/1s"
+func ParseQuota(s string) (Quota, error) {
+	limit, window, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Quota{}, fmt.Errorf("ratelimit: invalid quota %q, expected <limit>/<window>", s)
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return Quota{}, fmt.Errorf("ratelimit: invalid limit in quota %q", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d < time.Second {
+		return Quota{}, fmt.Errorf("ratelimit: invalid window in quota %q, must be at least 1s", s)
+	}
+	return Quota{Limit: n, Window: d}, nil
+}
+
+func (q Quota) String() string {
+	return fmt.Sprintf("%d/%s", q.Limit, q.Window)
+}
+
+// Store keeps request counters
+type Store interface {
+	// Incr counts one request for key in the window starting at windowStart and returns the
+	// window's count so far. Counters may be dropped once expiresAt passes.
+	Incr(ctx context.Context, key string, windowStart, expiresAt time.Time) (int, error)
+}
+
+// Result is the outcome of one request against a quota
+type Result struct {
+	Allowed   bool
+	Quota     Quota
+	Remaining int
+	Reset     time.Duration // Until the current window ends
+}
+
+// SetHeaders writes the RateLimit-Limit, -Remaining, -Reset and -Policy headers, plus
+// Retry-After when the request was refused
+func (r Result) SetHeaders(h http.Header) {
+	reset := strconv.Itoa(int(math.Ceil(r.Reset.Seconds())))
+	h.Set("RateLimit-Limit", strconv.Itoa(r.Quota.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	h.Set("RateLimit-Reset", reset)
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", r.Quota.Limit, int(r.Quota.Window.Seconds())))
+	if !r.Allowed {
+		h.Set("Retry-After", reset)
+	}
+}
+
+// Limiter applies quotas using a Store
+type Limiter struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewLimiter creates a Limiter over store
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Allow counts a request for key against quota
+func (l *Limiter) Allow(ctx context.Context, key string, quota Quota) (Result, error) {
+	now := l.now()
+	start := now.Truncate(quota.Window)
+	end := start.Add(quota.Window)
+	count, err := l.store.Incr(ctx, key+"|"+quota.String(), start, end)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:   count <= quota.Limit,
+		Quota:     quota,
+		Remaining: max(quota.Limit-count, 0),
+		Reset:     end.Sub(now),
+	}, nil
+}
+
+type memoryCounter struct {
+	windowStart time.Time
+	expiresAt   time.Time
+	count       int
+}
+
+// MemoryStore keeps counters in process memory. Call Sweep periodically to drop old windows.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]*memoryCounter)}
+}
+
+// Incr implements Store
+func (s *MemoryStore) Incr(ctx context.Context, key string, windowStart, expiresAt time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[key]
+	if !ok || !c.windowStart.Equal(windowStart) {
+		c = &memoryCounter{windowStart: windowStart, expiresAt: expiresAt}
+		s.counters[key] = c
+	}
+	c.count++
+	return c.count, nil
+}
+
+// Sweep drops counters whose window has ended
+func (s *MemoryStore) Sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, c := range s.counters {
+		if now.After(c.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+}
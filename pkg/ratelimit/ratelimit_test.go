@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseQuota(t *testing.T) {
+	q, err := ParseQuota("120/1m")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if q.Limit != 120 || q.Window != time.Minute {
+		t.Errorf("Expected 120 per minute, got %+v", q)
+	}
+	for _, bad := range []string{"120", "0/1m", "x/1m", "10/100ms", "10/forever"} {
+		if _, err := ParseQuota(bad); err == nil {
+			t.Errorf("ParseQuota(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	store := NewMemoryStore()
+	l := NewLimiter(store)
+	now := time.Date(2026, 1, 1, 12, 0, 10, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	quota := Quota{Limit: 2, Window: time.Minute}
+
+	for i, expected := range []bool{true, true, false} {
+		res, err := l.Allow(context.Background(), "ip:1.2.3.4", quota)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if res.Allowed != expected {
+			t.Errorf("Request %d: expected allowed=%v, got %v", i+1, expected, res.Allowed)
+		}
+		if res.Reset != 50*time.Second {
+			t.Errorf("Request %d: expected reset in 50s, got %s", i+1, res.Reset)
+		}
+	}
+
+	res, _ := l.Allow(context.Background(), "ip:5.6.7.8", quota)
+	if !res.Allowed || res.Remaining != 1 {
+		t.Errorf("Expected a separate bucket per key, got %+v", res)
+	}
+
+	now = now.Add(time.Minute)
+	res, _ = l.Allow(context.Background(), "ip:1.2.3.4", quota)
+	if !res.Allowed || res.Remaining != 1 {
+		t.Errorf("Expected a fresh window, got %+v", res)
+	}
+
+	store.Sweep(now.Add(2 * time.Minute))
+	if len(store.counters) != 0 {
+		t.Errorf("Expected sweep to drop ended windows, %d left", len(store.counters))
+	}
+}
+
+func TestResult_SetHeaders(t *testing.T) {
+	h := http.Header{}
+	Result{Allowed: false, Quota: Quota{Limit: 60, Window: time.Minute}, Remaining: 0, Reset: 1500 * time.Millisecond}.SetHeaders(h)
+
+	expected := map[string]string{
+		"RateLimit-Limit":     "60",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "2",
+		"RateLimit-Policy":    "60;w=60",
+		"Retry-After":         "2",
+	}
+	for name, value := range expected {
+		if got := h.Get(name); got != value {
+			t.Errorf("Expected %s: %s, got %q", name, value, got)
+		}
+	}
+}
+
+func TestIPExtractor_ClientIP(t *testing.T) {
+	e, err := NewIPExtractor([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		expected   string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer can't spoof", "203.0.113.7:5000", []string{"1.1.1.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:5000", []string{"198.51.100.2"}, "198.51.100.2"},
+		{"client-supplied entries ignored", "10.1.2.3:5000", []string{"1.1.1.1, 198.51.100.2"}, "198.51.100.2"},
+		{"chain of proxies", "10.1.2.3:5000", []string{"198.51.100.2, 192.168.1.1", "10.9.9.9"}, "198.51.100.2"},
+		{"garbage stops the walk", "10.1.2.3:5000", []string{"198.51.100.2, junk"}, "10.1.2.3"},
+		{"ipv4-mapped peer", "[::ffff:203.0.113.7]:5000", nil, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for _, v := range tt.xff {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if got := e.ClientIP(req); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+
+	if _, err := NewIPExtractor([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected an error for an invalid trusted proxy")
+	}
+}
@@ -0,0 +1,324 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default values used when Options fields are left empty
+const (
+	DefaultWindowWeeks     = 8
+	DefaultSlotMinutes     = 60
+	DefaultMinProbability  = 0.5
+	DefaultFullConfidence  = 4 // weeks of history needed before confidence is not discounted
+	minutesPerDay          = 24 * 60
+	minutesPerWeek         = 7 * minutesPerDay
+	minSlotOverlapFraction = 0.5
+)
+
+// Session is a single observed live session of a broadcaster
+type Session struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Options tunes how a weekly pattern is inferred from session history
+type Options struct {
+	WindowWeeks    int     // How many weeks of history to analyse
+	SlotMinutes    int     // Granularity of the weekly grid (must divide a day evenly)
+	MinProbability float64 // Fraction of observed weeks a slot must be live to count as scheduled
+	FullConfidence int     // Weeks of history after which confidence is no longer discounted
+}
+
+// Segment is a recurring weekly block in which a broadcaster is usually live.
+// StartMinute is measured from midnight UTC of Weekday and the block may run past midnight.
+type Segment struct {
+	Weekday         time.Weekday `json:"weekday"`
+	StartMinute     int          `json:"start_minute"`
+	DurationMinutes int          `json:"duration_minutes"`
+	Confidence      float64      `json:"confidence"`
+}
+
+// Pattern is the inferred weekly schedule of a broadcaster
+type Pattern struct {
+	Segments      []Segment `json:"segments"`
+	WeeksObserved int       `json:"weeks_observed"`
+	Confidence    float64   `json:"confidence"`
+	Summary       string    `json:"summary"`
+}
+
+// Occurrence is a concrete, dated instance of a Segment
+type Occurrence struct {
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	Confidence float64   `json:"confidence"`
+}
+
+// withDefaults fills empty option fields with package defaults
+func (o Options) withDefaults() Options {
+	if o.WindowWeeks <= 0 {
+		o.WindowWeeks = DefaultWindowWeeks
+	}
+	if o.SlotMinutes <= 0 || minutesPerDay%o.SlotMinutes != 0 {
+		o.SlotMinutes = DefaultSlotMinutes
+	}
+	if o.MinProbability <= 0 || o.MinProbability > 1 {
+		o.MinProbability = DefaultMinProbability
+	}
+	if o.FullConfidence <= 0 {
+		o.FullConfidence = DefaultFullConfidence
+	}
+	return o
+}
+
+// Infer analyses session history up to now and returns the recurring weekly pattern.
+// All times are evaluated in UTC. An empty pattern is returned when nothing recurs.
+func Infer(sessions []Session, now time.Time, opts Options) Pattern {
+	opts = opts.withDefaults()
+	now = now.UTC()
+
+	windowStart := now.Add(-time.Duration(opts.WindowWeeks) * 7 * 24 * time.Hour)
+
+	// Observation starts at the first recorded session so that weeks before
+	// we began tracking a channel do not count against it
+	observedFrom := now
+	for _, s := range sessions {
+		if s.Start.Before(observedFrom) {
+			observedFrom = s.Start.UTC()
+		}
+	}
+	if observedFrom.Before(windowStart) {
+		observedFrom = windowStart
+	}
+
+	weeksObserved := int((now.Sub(observedFrom) + 7*24*time.Hour - 1) / (7 * 24 * time.Hour))
+	if weeksObserved == 0 {
+		return Pattern{Summary: "no recurring schedule detected"}
+	}
+
+	slotsPerWeek := minutesPerWeek / opts.SlotMinutes
+	slotDuration := time.Duration(opts.SlotMinutes) * time.Minute
+
+	// Count, per weekly slot, in how many distinct weeks the broadcaster was live
+	liveWeeks := make([]map[int]bool, slotsPerWeek)
+	for _, s := range sessions {
+		start, end := s.Start.UTC(), s.End.UTC()
+		if start.Before(observedFrom) {
+			start = observedFrom
+		}
+		if end.After(now) {
+			end = now
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		for slotStart := start.Truncate(slotDuration); slotStart.Before(end); slotStart = slotStart.Add(slotDuration) {
+			slotEnd := slotStart.Add(slotDuration)
+			overlap := minTime(slotEnd, end).Sub(maxTime(slotStart, start))
+			if overlap < time.Duration(float64(slotDuration)*minSlotOverlapFraction) {
+				continue
+			}
+
+			slot := weekMinute(slotStart) / opts.SlotMinutes
+			week := int(now.Sub(slotStart) / (7 * 24 * time.Hour))
+			if liveWeeks[slot] == nil {
+				liveWeeks[slot] = make(map[int]bool)
+			}
+			liveWeeks[slot][week] = true
+		}
+	}
+
+	probabilities := make([]float64, slotsPerWeek)
+	for slot, weeks := range liveWeeks {
+		p := float64(len(weeks)) / float64(weeksObserved)
+		if p > 1 {
+			p = 1
+		}
+		probabilities[slot] = p
+	}
+
+	sampleFactor := float64(weeksObserved) / float64(opts.FullConfidence)
+	if sampleFactor > 1 {
+		sampleFactor = 1
+	}
+
+	segments := mergeSlots(probabilities, opts, sampleFactor)
+
+	pattern := Pattern{
+		Segments:      segments,
+		WeeksObserved: weeksObserved,
+	}
+
+	// Overall confidence is the duration-weighted mean of segment confidences
+	totalMinutes := 0
+	for _, seg := range segments {
+		pattern.Confidence += seg.Confidence * float64(seg.DurationMinutes)
+		totalMinutes += seg.DurationMinutes
+	}
+	if totalMinutes > 0 {
+		pattern.Confidence = round2(pattern.Confidence / float64(totalMinutes))
+	}
+	pattern.Summary = Summarize(segments)
+
+	return pattern
+}
+
+// mergeSlots joins contiguous scheduled slots (wrapping around the week) into segments
+func mergeSlots(probabilities []float64, opts Options, sampleFactor float64) []Segment {
+	n := len(probabilities)
+	scheduled := func(i int) bool { return probabilities[i%n] >= opts.MinProbability }
+
+	// Find a slot that is not scheduled so runs can be walked without splitting one
+	anchor := -1
+	for i := 0; i < n; i++ {
+		if !scheduled(i) {
+			anchor = i
+			break
+		}
+	}
+	if anchor == -1 {
+		// Live around the clock; report a single week-long segment
+		return []Segment{{
+			Weekday:         time.Sunday,
+			DurationMinutes: minutesPerWeek,
+			Confidence:      round2(mean(probabilities) * sampleFactor),
+		}}
+	}
+
+	var segments []Segment
+	for i := anchor + 1; i <= anchor+n; i++ {
+		if !scheduled(i) {
+			continue
+		}
+
+		runStart := i
+		sum := 0.0
+		for i <= anchor+n && scheduled(i) {
+			sum += probabilities[i%n]
+			i++
+		}
+		length := i - runStart
+
+		startMinute := (runStart % n) * opts.SlotMinutes
+		segments = append(segments, Segment{
+			Weekday:         time.Weekday(startMinute / minutesPerDay),
+			StartMinute:     startMinute % minutesPerDay,
+			DurationMinutes: length * opts.SlotMinutes,
+			Confidence:      round2(sum / float64(length) * sampleFactor),
+		})
+	}
+
+	sort.Slice(segments, func(a, b int) bool {
+		if segments[a].Weekday != segments[b].Weekday {
+			return segments[a].Weekday < segments[b].Weekday
+		}
+		return segments[a].StartMinute < segments[b].StartMinute
+	})
+
+	return segments
+}
+
+// Summarize renders segments as a short human readable sentence,
+// e.g. "usually live Tue/Thu 19:00–23:00 UTC"
+func Summarize(segments []Segment) string {
+	if len(segments) == 0 {
+		return "no recurring schedule detected"
+	}
+
+	// Group weekdays that share the same time window
+	type window struct{ start, duration int }
+	var order []window
+	days := make(map[window][]string)
+	for _, seg := range segments {
+		w := window{seg.StartMinute, seg.DurationMinutes}
+		if _, exists := days[w]; !exists {
+			order = append(order, w)
+		}
+		days[w] = append(days[w], seg.Weekday.String()[:3])
+	}
+
+	parts := make([]string, 0, len(order))
+	for _, w := range order {
+		end := (w.start + w.duration) % minutesPerDay
+		parts = append(parts, fmt.Sprintf("%s %s–%s", strings.Join(days[w], "/"), clock(w.start), clock(end)))
+	}
+
+	return "usually live " + strings.Join(parts, ", ") + " UTC"
+}
+
+// NextOccurrences projects the pattern onto the calendar, returning every occurrence
+// that ends after from and starts within the given number of days
+func NextOccurrences(segments []Segment, from time.Time, days int) []Occurrence {
+	from = from.UTC()
+	until := from.Add(time.Duration(days) * 24 * time.Hour)
+
+	// Start of the current week (Sunday 00:00 UTC)
+	weekStart := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC).
+		AddDate(0, 0, -int(from.Weekday()))
+
+	var occurrences []Occurrence
+	// Look one week back to catch segments still running at from
+	for week := -1; week*7 <= days; week++ {
+		base := weekStart.AddDate(0, 0, week*7)
+		for _, seg := range segments {
+			start := base.AddDate(0, 0, int(seg.Weekday)).Add(time.Duration(seg.StartMinute) * time.Minute)
+			end := start.Add(time.Duration(seg.DurationMinutes) * time.Minute)
+			if !end.After(from) || !start.Before(until) {
+				continue
+			}
+			occurrences = append(occurrences, Occurrence{
+				StartTime:  start,
+				EndTime:    end,
+				Confidence: seg.Confidence,
+			})
+		}
+	}
+
+	sort.Slice(occurrences, func(a, b int) bool {
+		return occurrences[a].StartTime.Before(occurrences[b].StartTime)
+	})
+
+	return occurrences
+}
+
+// weekMinute returns the number of minutes since Sunday 00:00 UTC
+func weekMinute(t time.Time) int {
+	t = t.UTC()
+	return int(t.Weekday())*minutesPerDay + t.Hour()*60 + t.Minute()
+}
+
+func clock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func round2(v float64) float64 {
+	return float64(int(v*100+0.5)) / 100
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
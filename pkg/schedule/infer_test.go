@@ -0,0 +1,135 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// weeklySessions builds one session per week on the given weekday and hours, going back n weeks from now
+func weeklySessions(now time.Time, weeks int, weekday time.Weekday, startHour, endHour int) []Session {
+	var sessions []Session
+	for w := 1; w <= weeks; w++ {
+		day := now.AddDate(0, 0, -7*w)
+		for day.Weekday() != weekday {
+			day = day.AddDate(0, 0, 1)
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), startHour, 0, 0, 0, time.UTC)
+		sessions = append(sessions, Session{Start: start, End: start.Add(time.Duration(endHour-startHour) * time.Hour)})
+	}
+	return sessions
+}
+
+func TestInfer_RecurringPattern(t *testing.T) {
+	// Monday noon so every generated session is in the past
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+
+	var sessions []Session
+	sessions = append(sessions, weeklySessions(now, 6, time.Tuesday, 19, 23)...)
+	sessions = append(sessions, weeklySessions(now, 6, time.Thursday, 19, 23)...)
+
+	pattern := Infer(sessions, now, Options{})
+
+	if len(pattern.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d: %+v", len(pattern.Segments), pattern.Segments)
+	}
+
+	for i, weekday := range []time.Weekday{time.Tuesday, time.Thursday} {
+		seg := pattern.Segments[i]
+		if seg.Weekday != weekday {
+			t.Errorf("Expected segment %d on %s, got %s", i, weekday, seg.Weekday)
+		}
+		if seg.StartMinute != 19*60 || seg.DurationMinutes != 4*60 {
+			t.Errorf("Expected segment %d at 19:00 for 4h, got start %d duration %d", i, seg.StartMinute, seg.DurationMinutes)
+		}
+		if seg.Confidence != 1 {
+			t.Errorf("Expected full confidence, got %v", seg.Confidence)
+		}
+	}
+
+	expectedSummary := "usually live Tue/Thu 19:00–23:00 UTC"
+	if pattern.Summary != expectedSummary {
+		t.Errorf("Expected summary %q, got %q", expectedSummary, pattern.Summary)
+	}
+}
+
+func TestInfer_IrregularSessionsIgnored(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+
+	sessions := weeklySessions(now, 8, time.Saturday, 14, 18)
+	// A single one-off stream should not show up as a recurring segment
+	oneOff := time.Date(2024, 5, 22, 2, 0, 0, 0, time.UTC)
+	sessions = append(sessions, Session{Start: oneOff, End: oneOff.Add(3 * time.Hour)})
+
+	pattern := Infer(sessions, now, Options{})
+
+	if len(pattern.Segments) != 1 {
+		t.Fatalf("Expected 1 segment, got %d: %+v", len(pattern.Segments), pattern.Segments)
+	}
+	if pattern.Segments[0].Weekday != time.Saturday {
+		t.Errorf("Expected Saturday segment, got %s", pattern.Segments[0].Weekday)
+	}
+}
+
+func TestInfer_ShortHistoryDiscountsConfidence(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+
+	pattern := Infer(weeklySessions(now, 2, time.Friday, 20, 22), now, Options{})
+
+	if len(pattern.Segments) != 1 {
+		t.Fatalf("Expected 1 segment, got %d", len(pattern.Segments))
+	}
+	if pattern.Confidence >= 1 || pattern.Confidence <= 0 {
+		t.Errorf("Expected discounted confidence between 0 and 1, got %v", pattern.Confidence)
+	}
+}
+
+func TestInfer_SegmentAcrossMidnight(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+
+	pattern := Infer(weeklySessions(now, 4, time.Friday, 22, 26), now, Options{})
+
+	if len(pattern.Segments) != 1 {
+		t.Fatalf("Expected 1 segment spanning midnight, got %d: %+v", len(pattern.Segments), pattern.Segments)
+	}
+	seg := pattern.Segments[0]
+	if seg.Weekday != time.Friday || seg.StartMinute != 22*60 || seg.DurationMinutes != 4*60 {
+		t.Errorf("Unexpected segment: %+v", seg)
+	}
+	if pattern.Summary != "usually live Fri 22:00–02:00 UTC" {
+		t.Errorf("Unexpected summary %q", pattern.Summary)
+	}
+}
+
+func TestInfer_NoSessions(t *testing.T) {
+	pattern := Infer(nil, time.Now(), Options{})
+
+	if len(pattern.Segments) != 0 {
+		t.Errorf("Expected no segments, got %d", len(pattern.Segments))
+	}
+}
+
+func TestNextOccurrences(t *testing.T) {
+	segments := []Segment{
+		{Weekday: time.Tuesday, StartMinute: 19 * 60, DurationMinutes: 240, Confidence: 0.8},
+		{Weekday: time.Thursday, StartMinute: 19 * 60, DurationMinutes: 240, Confidence: 0.6},
+	}
+
+	// Tuesday 20:00, in the middle of the Tuesday segment
+	from := time.Date(2024, 6, 4, 20, 0, 0, 0, time.UTC)
+	occurrences := NextOccurrences(segments, from, 7)
+
+	if len(occurrences) != 3 {
+		t.Fatalf("Expected 3 occurrences, got %d: %+v", len(occurrences), occurrences)
+	}
+
+	expectedStarts := []time.Time{
+		time.Date(2024, 6, 4, 19, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 6, 19, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 11, 19, 0, 0, 0, time.UTC),
+	}
+	for i, expected := range expectedStarts {
+		if !occurrences[i].StartTime.Equal(expected) {
+			t.Errorf("Expected occurrence %d at %s, got %s", i, expected, occurrences[i].StartTime)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package supajwt verifies Supabase access tokens locally, so authenticated requests don't need
+// a round trip to GoTrue. Tokens signed with the project's shared secret (HS256) and with
+// asymmetric signing keys published in the project's JWKS (RS256, ES256) are supported.
+package supajwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultAudience is the audience GoTrue issues to signed-in users
+	DefaultAudience = "authenticated"
+	// DefaultJWKSTTL is how long fetched signing keys are trusted before being refetched
+	DefaultJWKSTTL = 10 * time.Minute
+	// DefaultLeeway absorbs clock skew between GoTrue and this server
+	DefaultLeeway = 30 * time.Second
+	// DefaultFetchTimeout bounds a JWKS fetch made with the default HTTP client
+	DefaultFetchTimeout = 10 * time.Second
+	// minRefetchInterval stops tokens with unknown key IDs from hammering the JWKS endpoint
+	minRefetchInterval = 30 * time.Second
+)
+
+var (
+	// ErrNoKey is returned when no key is configured for the token's algorithm or key ID
+	ErrNoKey = errors.New("no verification key for token")
+	// ErrNotConfigured is returned by NewVerifier when neither a secret nor a JWKS URL is set
+	ErrNotConfigured = errors.New("supajwt: a JWT secret or JWKS URL is required")
+)
+
+// Claims are the claims GoTrue puts in an access token
+type Claims struct {
+	jwt.RegisteredClaims
+	Email        string         `json:"email"`
+	Phone        string         `json:"phone"`
+	Role         string         `json:"role"`
+	SessionID    string         `json:"session_id"`
+	AppMetadata  map[string]any `json:"app_metadata"`
+	UserMetadata map[string]any `json:"user_metadata"`
+}
+
+// Config configures a Verifier
+type Config struct {
+	Secret     []byte        // Project JWT secret for HS256 tokens; leave empty to reject them
+	JWKSURL    string        // JWKS endpoint for asymmetric keys; leave empty to reject RS256/ES256
+	Issuer     string        // Expected iss claim; not checked when empty
+	Audience   string        // Expected aud claim (DefaultAudience)
+	JWKSTTL    time.Duration // DefaultJWKSTTL
+	Leeway     time.Duration // DefaultLeeway
+	HTTPClient *http.Client  // Used to fetch the JWKS (a client with DefaultFetchTimeout)
+}
+
+// Verifier checks access token signatures and standard claims
+type Verifier struct {
+	cfg    Config
+	parser *jwt.Parser
+
+	mu        sync.RWMutex
+	keys      map[string]any
+	fetchedAt time.Time
+	lastFetch time.Time
+	inflight  *jwksFetch // The fetch in progress, shared by every request waiting on it
+}
+
+// jwksFetch is one JWKS fetch; err is set before done is closed
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewVerifier creates a Verifier, filling in defaults for unset fields
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if len(cfg.Secret) == 0 && cfg.JWKSURL == "" {
+		return nil, ErrNotConfigured
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = DefaultAudience
+	}
+	if cfg.JWKSTTL <= 0 {
+		cfg.JWKSTTL = DefaultJWKSTTL
+	}
+	if cfg.Leeway <= 0 {
+		cfg.Leeway = DefaultLeeway
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: DefaultFetchTimeout}
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	return &Verifier{cfg: cfg, parser: jwt.NewParser(opts...)}, nil
+}
+
+// Verify checks the token's signature, expiry, audience and issuer and returns its claims
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		return v.keyFor(ctx, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	return claims, nil
+}
+
+func (v *Verifier) keyFor(ctx context.Context, token *jwt.Token) (any, error) {
+	if token.Method.Alg() == "HS256" {
+		if len(v.cfg.Secret) == 0 {
+			return nil, ErrNoKey
+		}
+		return v.cfg.Secret, nil
+	}
+	if v.cfg.JWKSURL == "" {
+		return nil, ErrNoKey
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := v.cachedKey(kid); ok {
+		return key, nil
+	}
+	// The key may have been rotated in since the last fetch
+	if err := v.refresh(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := v.cachedKey(kid); ok {
+		return key, nil
+	}
+	return nil, ErrNoKey
+}
+
+func (v *Verifier) cachedKey(kid string) (any, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if time.Since(v.fetchedAt) > v.cfg.JWKSTTL {
+		return nil, false
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// refresh refetches the JWKS. Concurrent callers share a single fetch, which runs without
+// holding the lock so cached keys stay readable; each caller stops waiting when its own
+// context is done.
+func (v *Verifier) refresh(ctx context.Context) error {
+	v.mu.Lock()
+	f := v.inflight
+	if f == nil {
+		// We fetched too recently to try again
+		if time.Since(v.lastFetch) < minRefetchInterval {
+			v.mu.Unlock()
+			return nil
+		}
+		v.lastFetch = time.Now()
+		f = &jwksFetch{done: make(chan struct{})}
+		v.inflight = f
+		// Detached from this request so its cancellation doesn't fail the others waiting
+		go v.fetch(context.WithoutCancel(ctx), f)
+	}
+	v.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetch runs a shared JWKS fetch and swaps in the keys when it succeeds
+func (v *Verifier) fetch(ctx context.Context, f *jwksFetch) {
+	keys, err := fetchJWKS(ctx, v.cfg.HTTPClient, v.cfg.JWKSURL)
+
+	v.mu.Lock()
+	if err == nil {
+		v.keys = keys
+		v.fetchedAt = time.Now()
+	}
+	v.inflight = nil
+	v.mu.Unlock()
+
+	f.err = err
+	close(f.done)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, url string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip keys we can't use rather than failing every token
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,208 @@
+package supajwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://project.supabase.co/auth/v1"
+
+var testSecret = []byte("super-secret-jwt-token-with-at-least-32-characters")
+
+func testClaims() Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "8d6c0f4e-1f4a-4b7e-9a51-2f3c7c1d2e10",
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{DefaultAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Email:        "viewer@example.com",
+		Role:         "authenticated",
+		UserMetadata: map[string]any{"twitch": map[string]any{"user_id": "42"}},
+	}
+}
+
+func signHS256(t *testing.T, claims Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSecret)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestVerify_HS256(t *testing.T) {
+	v, err := NewVerifier(Config{Secret: testSecret, Issuer: testIssuer})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	claims, err := v.Verify(context.Background(), signHS256(t, testClaims()))
+	if err != nil {
+		t.Fatalf("Expected valid token, got: %v", err)
+	}
+	if claims.Subject != "8d6c0f4e-1f4a-4b7e-9a51-2f3c7c1d2e10" || claims.Email != "viewer@example.com" {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+	if twitch, ok := claims.UserMetadata["twitch"].(map[string]any); !ok || twitch["user_id"] != "42" {
+		t.Errorf("Expected user metadata preserved, got %+v", claims.UserMetadata)
+	}
+}
+
+func TestVerify_RejectsInvalidClaims(t *testing.T) {
+	v, err := NewVerifier(Config{Secret: testSecret, Issuer: testIssuer})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expired := testClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	wrongAud := testClaims()
+	wrongAud.Audience = jwt.ClaimStrings{"anon"}
+	wrongIss := testClaims()
+	wrongIss.Issuer = "https://other.supabase.co/auth/v1"
+	noExp := testClaims()
+	noExp.ExpiresAt = nil
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("not-the-project-secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", signHS256(t, expired)},
+		{"wrong audience", signHS256(t, wrongAud)},
+		{"wrong issuer", signHS256(t, wrongIss)},
+		{"no expiry", signHS256(t, noExp)},
+		{"wrong secret", forged},
+		{"garbage", "not-a-jwt"},
+	}
+	for _, tt := range tests {
+		if _, err := v.Verify(context.Background(), tt.token); err == nil {
+			t.Errorf("%s: expected token rejected", tt.name)
+		}
+	}
+}
+
+func TestVerify_HS256WithoutSecret(t *testing.T) {
+	v, err := NewVerifier(Config{JWKSURL: "http://127.0.0.1:0/jwks.json"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), signHS256(t, testClaims())); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey, got: %v", err)
+	}
+}
+
+func TestVerify_ES256FromJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "key-1",
+			"use": "sig",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	}))
+	defer server.Close()
+
+	v, err := NewVerifier(Config{JWKSURL: server.URL, Issuer: testIssuer})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, testClaims())
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	for range 3 {
+		if _, err := v.Verify(context.Background(), sign("key-1")); err != nil {
+			t.Fatalf("Expected valid token, got: %v", err)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("Expected the JWKS fetched once and cached, got %d fetches", fetches.Load())
+	}
+
+	// Unknown key IDs trigger at most one refetch per interval
+	for range 3 {
+		if _, err := v.Verify(context.Background(), sign("rotated")); err == nil {
+			t.Error("Expected token with unknown kid rejected")
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("Expected unknown kids rate limited, got %d fetches", fetches.Load())
+	}
+}
+
+func TestRefresh_SharesOneFetch(t *testing.T) {
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]any{"keys": []any{}})
+	}))
+	defer server.Close()
+
+	v, err := NewVerifier(Config{JWKSURL: server.URL})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// A caller whose request goes away stops waiting without failing the fetch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := v.refresh(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got: %v", err)
+	}
+
+	errs := make(chan error, 5)
+	for range 5 {
+		go func() { errs <- v.refresh(context.Background()) }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for range 5 {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected shared fetch to succeed, got: %v", err)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("Expected one JWKS fetch, got %d", fetches.Load())
+	}
+}
+
+func TestNewVerifier_RequiresKeys(t *testing.T) {
+	if _, err := NewVerifier(Config{}); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected ErrNotConfigured, got: %v", err)
+	}
+}
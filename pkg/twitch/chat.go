@@ -0,0 +1,520 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Chat reader defaults
+const (
+	DefaultMaxChatChannels = 50
+	DefaultChatWindow      = 5 * time.Minute
+	DefaultChatBufferSize  = 1024
+	// chatJoinInterval keeps JOINs within Twitch's limit of 20 per 10 seconds
+	chatJoinInterval = 500 * time.Millisecond
+	chatBucketSize   = 10 * time.Second
+	chatMaxBackoff   = time.Minute
+)
+
+// ErrChatChannelLimit is returned by Join when the reader is already in MaxChannels channels
+var ErrChatChannelLimit = errors.New("chat channel limit reached")
+
+// errChatReconnect is returned by the read loop when Twitch asks the client to reconnect
+var errChatReconnect = errors.New("chat server requested reconnect")
+
+var channelLoginPattern = regexp.MustCompile(`^[a-z0-9_]{1,25}$`)
+
+// ChatReaderOptions configures a ChatReader
+type ChatReaderOptions struct {
+	// URL of the IRC-over-WebSocket endpoint, defaults to TwitchChatURL
+	URL string
+	// Token returns a user access token with chat:read and Login is that user's login.
+	// When Token is nil the reader connects anonymously, which is read-only.
+	Token func(ctx context.Context) (string, error)
+	Login string
+	// MaxChannels caps how many channels can be joined at once
+	MaxChannels int
+	// Window is the rolling window stats are computed over
+	Window time.Duration
+	// BufferSize bounds the queue between the socket and the stats aggregator.
+	// Messages that arrive while the queue is full are dropped and counted.
+	BufferSize int
+	Dialer     *websocket.Dialer
+}
+
+// ChatStats summarises a channel's chat over the rolling window
+type ChatStats struct {
+	Channel           string        `json:"channel"`
+	MessagesPerMinute float64       `json:"messages_per_minute"`
+	UniqueChatters    int           `json:"unique_chatters"`
+	EmoteDensity      float64       `json:"emote_density"` // Emotes per message
+	Window            time.Duration `json:"window"`
+	// Observed is how much of the window the channel has been joined for
+	Observed time.Duration `json:"observed"`
+}
+
+// VibeScore rates how lively chat is from 0 to 100, blending message rate, the share of
+// viewers who are chatting and emote use. viewers may be 0 when unknown.
+func (s ChatStats) VibeScore(viewers int) float64 {
+	activity := 1 - math.Exp(-s.MessagesPerMinute/30)
+
+	var participation float64
+	if viewers > 0 {
+		// 5% of viewers chatting counts as full participation
+		participation = math.Min(1, float64(s.UniqueChatters)/float64(viewers)*20)
+	} else {
+		participation = 1 - math.Exp(-float64(s.UniqueChatters)/20)
+	}
+
+	emotes := math.Min(1, s.EmoteDensity/1.5)
+
+	score := 100 * (0.5*activity + 0.3*participation + 0.2*emotes)
+	return math.Round(score*10) / 10
+}
+
+// chatMessage is a parsed PRIVMSG queued for aggregation
+type chatMessage struct {
+	channel string
+	user    string
+	emotes  int
+	at      time.Time
+}
+
+// chatBucket aggregates the messages received in one chatBucketSize slot
+type chatBucket struct {
+	start    time.Time
+	messages int
+	emotes   int
+	chatters map[string]struct{}
+}
+
+// channelChat holds the rolling stats for one joined channel
+type channelChat struct {
+	joinedAt time.Time
+	buckets  []chatBucket
+}
+
+// ChatReader joins a bounded pool of channels over Twitch IRC-over-WebSocket and keeps
+// rolling chat activity stats for each
+type ChatReader struct {
+	opts ChatReaderOptions
+	now  func() time.Time
+
+	mu       sync.Mutex
+	channels map[string]*channelChat
+	conn     *websocket.Conn
+	lastJoin time.Time
+
+	writeMu  sync.Mutex
+	messages chan chatMessage
+	dropped  atomic.Int64
+}
+
+// NewChatReader creates a chat reader. Call Run to connect.
+func NewChatReader(opts ChatReaderOptions) *ChatReader {
+	if opts.URL == "" {
+		opts.URL = TwitchChatURL
+	}
+	if opts.MaxChannels <= 0 {
+		opts.MaxChannels = DefaultMaxChatChannels
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultChatWindow
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultChatBufferSize
+	}
+	if opts.Dialer == nil {
+		opts.Dialer = websocket.DefaultDialer
+	}
+
+	return &ChatReader{
+		opts:     opts,
+		now:      time.Now,
+		channels: make(map[string]*channelChat),
+		messages: make(chan chatMessage, opts.BufferSize),
+	}
+}
+
+// Join adds a channel to the pool, sending JOIN if connected. It returns ErrChatChannelLimit
+// when the pool is full.
+func (c *ChatReader) Join(ctx context.Context, login string) error {
+	login = strings.ToLower(strings.TrimPrefix(login, "#"))
+	if !channelLoginPattern.MatchString(login) {
+		return fmt.Errorf("invalid channel login %q", login)
+	}
+
+	c.mu.Lock()
+	if _, joined := c.channels[login]; joined {
+		c.mu.Unlock()
+		return nil
+	}
+	if len(c.channels) >= c.opts.MaxChannels {
+		c.mu.Unlock()
+		return ErrChatChannelLimit
+	}
+	c.channels[login] = newChannelChat(c.now(), c.opts.Window)
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		// Joined when the connection is established
+		return nil
+	}
+	return c.sendJoin(ctx, conn, login)
+}
+
+// Part removes a channel from the pool and discards its stats
+func (c *ChatReader) Part(login string) {
+	login = strings.ToLower(login)
+
+	c.mu.Lock()
+	_, joined := c.channels[login]
+	delete(c.channels, login)
+	conn := c.conn
+	c.mu.Unlock()
+
+	if joined && conn != nil {
+		c.send(conn, "PART #"+login)
+	}
+}
+
+// Channels returns the logins of joined channels
+func (c *ChatReader) Channels() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	logins := make([]string, 0, len(c.channels))
+	for login := range c.channels {
+		logins = append(logins, login)
+	}
+	return logins
+}
+
+// Dropped returns how many messages were discarded because the aggregator fell behind
+func (c *ChatReader) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+// Stats returns the rolling chat stats for a joined channel
+func (c *ChatReader) Stats(login string) (ChatStats, bool) {
+	login = strings.ToLower(login)
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, joined := c.channels[login]
+	if !joined {
+		return ChatStats{}, false
+	}
+
+	windowStart := now.Add(-c.opts.Window)
+	var messages, emotes int
+	chatters := make(map[string]struct{})
+	for _, bucket := range ch.buckets {
+		if !bucket.start.After(windowStart.Add(-chatBucketSize)) || bucket.start.After(now) {
+			continue
+		}
+		messages += bucket.messages
+		emotes += bucket.emotes
+		for user := range bucket.chatters {
+			chatters[user] = struct{}{}
+		}
+	}
+
+	// Channels joined part-way through the window are rated over the time observed
+	observed := c.opts.Window
+	if elapsed := now.Sub(ch.joinedAt); elapsed < observed {
+		observed = max(elapsed, time.Minute)
+	}
+
+	stats := ChatStats{
+		Channel:           login,
+		MessagesPerMinute: math.Round(float64(messages)/observed.Minutes()*10) / 10,
+		UniqueChatters:    len(chatters),
+		Window:            c.opts.Window,
+		Observed:          min(now.Sub(ch.joinedAt), c.opts.Window),
+	}
+	if messages > 0 {
+		stats.EmoteDensity = math.Round(float64(emotes)/float64(messages)*100) / 100
+	}
+	return stats, true
+}
+
+// Run connects and reads chat until ctx is cancelled, reconnecting with backoff
+func (c *ChatReader) Run(ctx context.Context) error {
+	go c.aggregate(ctx)
+
+	attempt := 0
+	for {
+		start := c.now()
+		err := c.connectAndServe(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// A connection that stayed up for a while resets the backoff
+		if c.now().Sub(start) > chatMaxBackoff {
+			attempt = 0
+		}
+		delay := chatBackoff(attempt)
+		if errors.Is(err, errChatReconnect) {
+			delay = 0
+		}
+		attempt++
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// chatBackoff doubles from one second with jitter, capped at chatMaxBackoff
+func chatBackoff(attempt int) time.Duration {
+	delay := time.Second << min(attempt, 6)
+	if delay > chatMaxBackoff {
+		delay = chatMaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// connectAndServe runs one connection: authenticate, join the pool and read until it drops
+func (c *ChatReader) connectAndServe(ctx context.Context) error {
+	pass, nick := "SCHMOOPIIE", fmt.Sprintf("justinfan%d", 10000+rand.Intn(90000))
+	if c.opts.Token != nil {
+		token, err := c.opts.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get chat token: %w", err)
+		}
+		pass, nick = "oauth:"+strings.TrimPrefix(token, "oauth:"), strings.ToLower(c.opts.Login)
+	}
+
+	conn, _, err := c.opts.Dialer.DialContext(ctx, c.opts.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to chat: %w", err)
+	}
+	defer conn.Close()
+
+	// Unblock the read loop when the reader is stopped
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for _, line := range []string{"CAP REQ :twitch.tv/tags twitch.tv/commands", "PASS " + pass, "NICK " + nick} {
+		if err := c.send(conn, line); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	pool := make([]string, 0, len(c.channels))
+	for login := range c.channels {
+		pool = append(pool, login)
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+
+	// Rejoin in the background so PINGs are answered while JOINs are throttled
+	go func() {
+		for _, login := range pool {
+			if err := c.sendJoin(ctx, conn, login); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\r\n") {
+			if line == "" {
+				continue
+			}
+			if err := c.handleLine(conn, line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleLine processes one IRC line
+func (c *ChatReader) handleLine(conn *websocket.Conn, line string) error {
+	msg := parseIRCMessage(line)
+	switch msg.command {
+	case "PING":
+		return c.send(conn, "PONG :"+msg.trailing)
+	case "RECONNECT":
+		return errChatReconnect
+	case "NOTICE":
+		if strings.Contains(msg.trailing, "Login authentication failed") || strings.Contains(msg.trailing, "Improperly formatted auth") {
+			return fmt.Errorf("chat authentication failed: %s", msg.trailing)
+		}
+	case "PRIVMSG":
+		if len(msg.params) == 0 {
+			return nil
+		}
+		c.enqueue(chatMessage{
+			channel: strings.TrimPrefix(msg.params[0], "#"),
+			user:    msg.user(),
+			emotes:  countEmotes(msg.tags["emotes"]),
+			at:      c.now(),
+		})
+	}
+	return nil
+}
+
+// enqueue hands a message to the aggregator without blocking the socket reader
+func (c *ChatReader) enqueue(msg chatMessage) {
+	select {
+	case c.messages <- msg:
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+// aggregate folds queued messages into per-channel buckets
+func (c *ChatReader) aggregate(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-c.messages:
+			c.record(msg)
+		}
+	}
+}
+
+func (c *ChatReader) record(msg chatMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, joined := c.channels[msg.channel]
+	if !joined {
+		return
+	}
+
+	slot := msg.at.Truncate(chatBucketSize)
+	bucket := &ch.buckets[int(slot.Unix()/int64(chatBucketSize/time.Second))%len(ch.buckets)]
+	if !bucket.start.Equal(slot) {
+		*bucket = chatBucket{start: slot, chatters: make(map[string]struct{})}
+	}
+	bucket.messages++
+	bucket.emotes += msg.emotes
+	if msg.user != "" {
+		bucket.chatters[msg.user] = struct{}{}
+	}
+}
+
+func newChannelChat(now time.Time, window time.Duration) *channelChat {
+	// One spare bucket so a partially elapsed slot does not evict the oldest full one
+	return &channelChat{joinedAt: now, buckets: make([]chatBucket, int(window/chatBucketSize)+1)}
+}
+
+// sendJoin sends JOIN, spacing JOINs to stay within Twitch's rate limit
+func (c *ChatReader) sendJoin(ctx context.Context, conn *websocket.Conn, login string) error {
+	c.mu.Lock()
+	wait := c.lastJoin.Add(chatJoinInterval).Sub(c.now())
+	if wait < 0 {
+		wait = 0
+	}
+	c.lastJoin = c.now().Add(wait)
+	c.mu.Unlock()
+
+	if wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return c.send(conn, "JOIN #"+login)
+}
+
+// send writes one IRC line; gorilla/websocket allows only one concurrent writer
+func (c *ChatReader) send(conn *websocket.Conn, line string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteMessage(websocket.TextMessage, []byte(line+"\r\n"))
+}
+
+// ircMessage is a parsed IRCv3 line: @tags :prefix COMMAND params :trailing
+type ircMessage struct {
+	tags     map[string]string
+	prefix   string
+	command  string
+	params   []string
+	trailing string
+}
+
+// user returns the sender's login from the prefix nick!user@host
+func (m ircMessage) user() string {
+	if i := strings.IndexByte(m.prefix, '!'); i > 0 {
+		return m.prefix[:i]
+	}
+	return m.prefix
+}
+
+// parseIRCMessage parses an IRC line, tolerating missing parts
+func parseIRCMessage(line string) ircMessage {
+	msg := ircMessage{tags: map[string]string{}}
+
+	if strings.HasPrefix(line, "@") {
+		raw, rest, _ := strings.Cut(line[1:], " ")
+		for _, tag := range strings.Split(raw, ";") {
+			key, value, _ := strings.Cut(tag, "=")
+			msg.tags[key] = value
+		}
+		line = rest
+	}
+	if strings.HasPrefix(line, ":") {
+		msg.prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+	if head, trailing, found := strings.Cut(line, " :"); found {
+		line, msg.trailing = head, trailing
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		msg.command = fields[0]
+		msg.params = fields[1:]
+	}
+	// Commands like PING carry their argument as trailing or as a bare param
+	if msg.trailing == "" && len(msg.params) > 0 && msg.command == "PING" {
+		msg.trailing = msg.params[0]
+	}
+	return msg
+}
+
+// countEmotes counts emote occurrences in an emotes tag such as "25:0-4,12-16/1902:6-10"
+func countEmotes(tag string) int {
+	if tag == "" {
+		return 0
+	}
+	count := 0
+	for _, emote := range strings.Split(tag, "/") {
+		_, ranges, found := strings.Cut(emote, ":")
+		if !found || ranges == "" {
+			continue
+		}
+		count += strings.Count(ranges, ",") + 1
+	}
+	return count
+}
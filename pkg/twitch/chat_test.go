@@ -0,0 +1,224 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeChatServer is a local IRC-over-WebSocket server that records what clients send
+type fakeChatServer struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	lines  []string
+	conns  chan *websocket.Conn
+}
+
+func newFakeChatServer(t *testing.T) *fakeChatServer {
+	t.Helper()
+	f := &fakeChatServer{conns: make(chan *websocket.Conn, 1)}
+	upgrader := websocket.Upgrader{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		f.conns <- conn
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\r\n") {
+				f.lines = append(f.lines, line)
+			}
+			f.mu.Unlock()
+		}
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeChatServer) url() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+// waitForLine waits until the client has sent a line with the given prefix
+func (f *fakeChatServer) waitForLine(t *testing.T, prefix string) string {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		for _, line := range f.lines {
+			if strings.HasPrefix(line, prefix) {
+				f.mu.Unlock()
+				return line
+			}
+		}
+		f.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for client to send %q", prefix)
+	return ""
+}
+
+func TestChatReader_FakeServer(t *testing.T) {
+	fake := newFakeChatServer(t)
+	reader := NewChatReader(ChatReaderOptions{
+		URL:   fake.url(),
+		Login: "VibeBot",
+		Token: func(ctx context.Context) (string, error) { return "abc123", nil },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := reader.Join(ctx, "TestStreamer"); err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	go reader.Run(ctx)
+
+	conn := <-fake.conns
+	if pass := fake.waitForLine(t, "PASS "); pass != "PASS oauth:abc123" {
+		t.Errorf("Expected oauth PASS, got %q", pass)
+	}
+	fake.waitForLine(t, "NICK vibebot")
+	fake.waitForLine(t, "JOIN #teststreamer")
+
+	lines := []string{
+		"@emotes=25:0-4,12-16/1902:6-10;display-name=Alice :alice!alice@alice.tmi.twitch.tv PRIVMSG #teststreamer :Kappa Keepo Kappa",
+		"@emotes= :bob!bob@bob.tmi.twitch.tv PRIVMSG #teststreamer :hello chat",
+		"@emotes=25:0-4 :alice!alice@alice.tmi.twitch.tv PRIVMSG #teststreamer :Kappa",
+		":carol!carol@carol.tmi.twitch.tv PRIVMSG #otherchannel :not joined",
+		"PING :tmi.twitch.tv",
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(strings.Join(lines, "\r\n")+"\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	fake.waitForLine(t, "PONG :tmi.twitch.tv")
+
+	var stats ChatStats
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		stats, _ = reader.Stats("teststreamer")
+		if stats.UniqueChatters == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Joined moments ago, so the rate is over the one-minute minimum
+	if stats.MessagesPerMinute != 3 {
+		t.Errorf("Expected 3 messages per minute, got %v", stats.MessagesPerMinute)
+	}
+	if stats.UniqueChatters != 2 {
+		t.Errorf("Expected 2 unique chatters, got %d", stats.UniqueChatters)
+	}
+	if stats.EmoteDensity != 1.33 {
+		t.Errorf("Expected emote density 1.33, got %v", stats.EmoteDensity)
+	}
+	if _, ok := reader.Stats("otherchannel"); ok {
+		t.Error("Expected no stats for a channel that was not joined")
+	}
+
+	reader.Part("teststreamer")
+	fake.waitForLine(t, "PART #teststreamer")
+	if len(reader.Channels()) != 0 {
+		t.Errorf("Expected no channels after part, got %v", reader.Channels())
+	}
+}
+
+func TestChatReader_ChannelLimit(t *testing.T) {
+	reader := NewChatReader(ChatReaderOptions{MaxChannels: 2})
+	ctx := context.Background()
+
+	for _, login := range []string{"one", "two", "two"} {
+		if err := reader.Join(ctx, login); err != nil {
+			t.Fatalf("Expected join of %s to succeed, got: %v", login, err)
+		}
+	}
+	if err := reader.Join(ctx, "three"); !errors.Is(err, ErrChatChannelLimit) {
+		t.Errorf("Expected ErrChatChannelLimit, got %v", err)
+	}
+	if err := reader.Join(ctx, "not a login!"); err == nil {
+		t.Error("Expected invalid login to be rejected")
+	}
+}
+
+func TestChatReader_Backpressure(t *testing.T) {
+	reader := NewChatReader(ChatReaderOptions{BufferSize: 2})
+
+	// Nothing is aggregating, so the queue fills and further messages are dropped
+	for i := 0; i < 5; i++ {
+		reader.enqueue(chatMessage{channel: "teststreamer", user: "alice", at: time.Now()})
+	}
+	if reader.Dropped() != 3 {
+		t.Errorf("Expected 3 dropped messages, got %d", reader.Dropped())
+	}
+}
+
+func TestChatStats_RollingWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	reader := NewChatReader(ChatReaderOptions{Window: time.Minute})
+	reader.now = func() time.Time { return now }
+	reader.Join(context.Background(), "teststreamer")
+
+	reader.record(chatMessage{channel: "teststreamer", user: "alice", at: now})
+	now = now.Add(2 * time.Minute)
+	reader.record(chatMessage{channel: "teststreamer", user: "bob", at: now})
+
+	stats, _ := reader.Stats("teststreamer")
+	if stats.UniqueChatters != 1 || stats.MessagesPerMinute != 1 {
+		t.Errorf("Expected only the message inside the window, got %+v", stats)
+	}
+}
+
+func TestParseIRCMessage(t *testing.T) {
+	msg := parseIRCMessage("@badges=;emotes=25:0-4 :alice!alice@alice.tmi.twitch.tv PRIVMSG #teststreamer :hi :) there")
+	if msg.command != "PRIVMSG" || msg.params[0] != "#teststreamer" || msg.trailing != "hi :) there" {
+		t.Errorf("Unexpected parse: %+v", msg)
+	}
+	if msg.user() != "alice" || msg.tags["emotes"] != "25:0-4" {
+		t.Errorf("Unexpected user or tags: %q %v", msg.user(), msg.tags)
+	}
+
+	if ping := parseIRCMessage("PING :tmi.twitch.tv"); ping.command != "PING" || ping.trailing != "tmi.twitch.tv" {
+		t.Errorf("Unexpected PING parse: %+v", ping)
+	}
+}
+
+func TestCountEmotes(t *testing.T) {
+	tests := map[string]int{
+		"":                           0,
+		"25:0-4":                     1,
+		"25:0-4,12-16/1902:6-10":     3,
+		"emotesv2_abc:0-3,5-8,10-13": 3,
+	}
+	for tag, expected := range tests {
+		if got := countEmotes(tag); got != expected {
+			t.Errorf("countEmotes(%q) = %d, expected %d", tag, got, expected)
+		}
+	}
+}
+
+func TestChatStats_VibeScore(t *testing.T) {
+	quiet := ChatStats{MessagesPerMinute: 1, UniqueChatters: 2}
+	lively := ChatStats{MessagesPerMinute: 120, UniqueChatters: 80, EmoteDensity: 1.2}
+
+	if quiet.VibeScore(1000) >= lively.VibeScore(1000) {
+		t.Errorf("Expected lively chat to score higher: quiet %v, lively %v", quiet.VibeScore(1000), lively.VibeScore(1000))
+	}
+	if score := lively.VibeScore(0); score < 0 || score > 100 {
+		t.Errorf("Expected score within 0-100, got %v", score)
+	}
+	if (ChatStats{}).VibeScore(100) != 0 {
+		t.Error("Expected silent chat to score 0")
+	}
+}
@@ -17,7 +17,7 @@ import (
 // NewClient creates a new Twitch client instance
 func NewClient(clientID, clientSecret string) Client {
 	httpClient := &http.Client{
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	oauthManager := NewOAuthManager(clientID, clientSecret)
@@ -249,6 +249,84 @@ func (c *ClientImpl) ExchangeCodeForToken(ctx context.Context, code, redirectURI
 	return &token, nil
 }
 
+// RefreshUserToken exchanges a refresh token for a new user access token. Twitch may rotate the
+// refresh token, so callers must store the one returned.
+func (c *ClientImpl) RefreshUserToken(ctx context.Context, refreshToken string) (*UserToken, error) {
+	data := url.Values{}
+	data.Set("client_id", c.clientID)
+	data.Set("client_secret", c.clientSecret)
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", TwitchOAuthURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token refresh request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to refresh user token")
+		return nil, fmt.Errorf("token refresh request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Twitch answers 400 "Invalid refresh token" once the user disconnects the app
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrTokenInvalid
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Error().
+			Int("status_code", resp.StatusCode).
+			Str("response_body", string(body)).
+			Msg("Token refresh failed")
+		return nil, fmt.Errorf("token refresh failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var token UserToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	return &token, nil
+}
+
+// RevokeToken revokes a user access token, ending the grant. Twitch answers 400 for tokens that
+// are already invalid, reported as ErrTokenInvalid.
+func (c *ClientImpl) RevokeToken(ctx context.Context, accessToken string) error {
+	data := url.Values{}
+	data.Set("client_id", c.clientID)
+	data.Set("token", accessToken)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", TwitchOAuthRevoke, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create token revoke request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to revoke user token")
+		return fmt.Errorf("token revoke request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return ErrTokenInvalid
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Error().
+			Int("status_code", resp.StatusCode).
+			Str("response_body", string(body)).
+			Msg("Token revoke failed")
+		return fmt.Errorf("token revoke failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
 // ValidateToken validates an access token and returns user information
 func (c *ClientImpl) ValidateToken(ctx context.Context, accessToken string) (*TokenValidation, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", TwitchOAuthValidate, nil)
@@ -265,6 +343,9 @@ func (c *ClientImpl) ValidateToken(ctx context.Context, accessToken string) (*To
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrTokenInvalid
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		log.Error().
@@ -283,6 +364,23 @@ func (c *ClientImpl) ValidateToken(ctx context.Context, accessToken string) (*To
 	return &validation, nil
 }
 
+// CheckAppToken validates the app access token with Twitch, acquiring one first if needed. It
+// returns ErrTokenInvalid when Twitch no longer accepts the token.
+func (c *ClientImpl) CheckAppToken(ctx context.Context) error {
+	token, err := c.oauthManager.GetToken(ctx)
+	if err != nil {
+		return err
+	}
+	validation, err := c.ValidateToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	if validation.ClientID != c.clientID {
+		return fmt.Errorf("app token belongs to client %s, expected %s", validation.ClientID, c.clientID)
+	}
+	return nil
+}
+
 // GetUserInfo fetches user information using an access token
 func (c *ClientImpl) GetUserInfo(ctx context.Context, accessToken string) (*User, error) {
 	url := fmt.Sprintf("%s%s", TwitchAPIBaseURL, UsersEndpoint)
@@ -479,6 +577,74 @@ func (c *ClientImpl) GetUserFollows(ctx context.Context, userID string, userToke
 	return &followsResponse, nil
 }
 
+// GetChannels fetches channel information, including content classification labels, for up to
+// 100 broadcasters
+func (c *ClientImpl) GetChannels(ctx context.Context, broadcasterIDs []string) (*ChannelsResponse, error) {
+	if len(broadcasterIDs) == 0 {
+		return &ChannelsResponse{Data: []ChannelInformation{}}, nil
+	}
+	if len(broadcasterIDs) > MaxChannelIDs {
+		return nil, fmt.Errorf("at most %d broadcaster IDs may be requested, got %d", MaxChannelIDs, len(broadcasterIDs))
+	}
+	if err := ValidateUserIDs(broadcasterIDs); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	token, err := c.oauthManager.GetToken(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get OAuth token for GetChannels")
+		return nil, fmt.Errorf("failed to get OAuth token: %w", err)
+	}
+
+	queryParams := make([]string, len(broadcasterIDs))
+	for i, id := range broadcasterIDs {
+		queryParams[i] = "broadcaster_id=" + id
+	}
+	url := fmt.Sprintf("%s%s?%s", TwitchAPIBaseURL, ChannelsEndpoint, strings.Join(queryParams, "&"))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Client-Id", c.clientID)
+	req.Header.Set("Content-Type", "application/json")
+
+	log.Debug().Str("url", url).Int("broadcaster_count", len(broadcasterIDs)).Msg("Making request to Twitch API for channels")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Error().Err(err).Str("url", url).Msg("Failed to make request to Twitch API for channels")
+		return nil, fmt.Errorf("failed to make request to Twitch API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Error().
+			Int("status_code", resp.StatusCode).
+			Str("response_body", string(body)).
+			Str("url", url).
+			Msg("Twitch API returned error status for channels")
+		return nil, fmt.Errorf("twitch API returned error status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var channelsResponse ChannelsResponse
+	if err := json.Unmarshal(body, &channelsResponse); err != nil {
+		log.Error().
+			Err(err).
+			Str("response_body", string(body)).
+			Msg("Failed to parse JSON response from Twitch API for channels")
+		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	log.Debug().Int("channel_count", len(channelsResponse.Data)).Msg("Successfully fetched channels from Twitch API")
+	return &channelsResponse, nil
+}
+
 // buildStreamsURL constructs the Twitch API URL with query parameters
 func (c *ClientImpl) buildStreamsURL(params StreamsQueryParams) string {
 	baseURL := fmt.Sprintf("%s%s", TwitchAPIBaseURL, StreamsEndpoint)
@@ -494,6 +660,11 @@ func (c *ClientImpl) buildStreamsURL(params StreamsQueryParams) string {
 		queryParams = append(queryParams, fmt.Sprintf("game_id=%s", params.GameID))
 	}
 
+	// Add one user_id parameter per requested broadcaster
+	for _, userID := range params.UserIDs {
+		queryParams = append(queryParams, fmt.Sprintf("user_id=%s", userID))
+	}
+
 	// Note: Twitch API doesn't support custom sorting beyond default (by viewer count)
 	// The "recent" sort option is handled client-side after receiving the response
 
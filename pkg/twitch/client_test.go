@@ -2,10 +2,13 @@ package twitch
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -37,7 +40,7 @@ func createTestClient(token string, shouldOAuthErr bool) *ClientImpl {
 			shouldErr: shouldOAuthErr,
 		},
 		httpClient: &http.Client{
-			Timeout: HTTPTimeout * time.Second,
+			Timeout: HTTPTimeout,
 		},
 	}
 }
@@ -91,7 +94,7 @@ func TestGetTopStreams_Success(t *testing.T) {
 		Transport: &mockTransport{
 			server: server,
 		},
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	ctx := context.Background()
@@ -165,7 +168,7 @@ func TestGetTopStreams_HTTPError(t *testing.T) {
 		Transport: &mockTransport{
 			server: server,
 		},
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	ctx := context.Background()
@@ -198,7 +201,7 @@ func TestGetTopStreams_InvalidJSON(t *testing.T) {
 		Transport: &mockTransport{
 			server: server,
 		},
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	ctx := context.Background()
@@ -269,7 +272,7 @@ func TestGetTopStreams_LimitValidation(t *testing.T) {
 				Transport: &mockTransport{
 					server: server,
 				},
-				Timeout: HTTPTimeout * time.Second,
+				Timeout: HTTPTimeout,
 			}
 
 			ctx := context.Background()
@@ -348,7 +351,7 @@ func TestGetCategories_Success(t *testing.T) {
 		Transport: &mockTransport{
 			server: server,
 		},
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	ctx := context.Background()
@@ -425,7 +428,7 @@ func TestGetCategories_SortParameter(t *testing.T) {
 				Transport: &mockTransport{
 					server: server,
 				},
-				Timeout: HTTPTimeout * time.Second,
+				Timeout: HTTPTimeout,
 			}
 
 			ctx := context.Background()
@@ -483,7 +486,7 @@ func TestGetCategories_HTTPError(t *testing.T) {
 		Transport: &mockTransport{
 			server: server,
 		},
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	ctx := context.Background()
@@ -517,7 +520,7 @@ func TestGetCategories_InvalidJSON(t *testing.T) {
 		Transport: &mockTransport{
 			server: server,
 		},
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	ctx := context.Background()
@@ -589,7 +592,7 @@ func TestGetCategories_LimitValidation(t *testing.T) {
 				Transport: &mockTransport{
 					server: server,
 				},
-				Timeout: HTTPTimeout * time.Second,
+				Timeout: HTTPTimeout,
 			}
 
 			ctx := context.Background()
@@ -668,7 +671,7 @@ func TestGetStreams_Success(t *testing.T) {
 		Transport: &mockTransport{
 			server: server,
 		},
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	ctx := context.Background()
@@ -717,6 +720,38 @@ func TestGetStreams_ParameterValidation(t *testing.T) {
 	}
 }
 
+func TestSetLimits(t *testing.T) {
+	orig := CurrentLimits()
+	defer SetLimits(orig)
+
+	l := orig
+	l.MaxStreamQueryLimit = 50
+	l.DefaultQueryLimit = 10
+	if err := SetLimits(l); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := ValidateLimit(60); err == nil {
+		t.Error("Expected the lowered max stream query limit to apply")
+	}
+
+	bad := orig
+	bad.MaxStreamQueryLimit = 250
+	bad.DefaultCategoryLimit = 0
+	bad.HTTPTimeout = 0
+	err := SetLimits(bad)
+	if err == nil {
+		t.Fatal("Expected an error for invalid limits")
+	}
+	for _, want := range []string{"max stream query limit", "default category limit", "HTTP timeout"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %q, got: %v", want, err)
+		}
+	}
+	if MaxStreamQueryLimit != 50 {
+		t.Errorf("Expected invalid limits not to be applied, got max %d", MaxStreamQueryLimit)
+	}
+}
+
 func TestGetStreams_RecentSorting(t *testing.T) {
 	// Create test data with different timestamps for sorting
 	testDataWithTimestamps := `{
@@ -754,7 +789,7 @@ func TestGetStreams_RecentSorting(t *testing.T) {
 		Transport: &mockTransport{
 			server: server,
 		},
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	ctx := context.Background()
@@ -787,3 +822,194 @@ func TestGetStreams_RecentSorting(t *testing.T) {
 		t.Errorf("Expected third stream ID '1' (oldest), got '%s'", result.Data[2].ID)
 	}
 }
+
+func TestGetStreams_UserIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userIDs := r.URL.Query()["user_id"]
+		if len(userIDs) != 2 || userIDs[0] != "111" || userIDs[1] != "222" {
+			t.Errorf("Expected user_id query parameters [111 222], got %v", userIDs)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+
+	client := createTestClient("test_token", false)
+	client.httpClient = &http.Client{
+		Transport: &mockTransport{
+			server: server,
+		},
+		Timeout: HTTPTimeout,
+	}
+
+	params := StreamsQueryParams{
+		Limit:   10,
+		UserIDs: []string{"111", "222"},
+	}
+	if _, err := client.GetStreams(context.Background(), params); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Non-numeric IDs are rejected before any request is made
+	params.UserIDs = []string{"abc"}
+	if _, err := client.GetStreams(context.Background(), params); err == nil {
+		t.Fatal("Expected error for non-numeric user_id, got nil")
+	}
+}
+
+func TestGetChannels_ContentLabels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/helix/channels" {
+			t.Errorf("Expected /helix/channels, got %s", r.URL.Path)
+		}
+		if ids := r.URL.Query()["broadcaster_id"]; len(ids) != 2 {
+			t.Errorf("Expected 2 broadcaster_id parameters, got %v", ids)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"data": [
+			{"broadcaster_id": "111", "content_classification_labels": ["Gambling", "ProfanityVulgarity"]},
+			{"broadcaster_id": "222", "content_classification_labels": []}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := createTestClient("test_token", false)
+	client.httpClient = &http.Client{
+		Transport: &mockTransport{
+			server: server,
+		},
+		Timeout: HTTPTimeout,
+	}
+
+	channels, err := client.GetChannels(context.Background(), []string{"111", "222"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(channels.Data) != 2 || channels.Data[0].ContentClassificationLabels[0] != LabelGambling {
+		t.Errorf("Unexpected channels: %+v", channels.Data)
+	}
+
+	if _, err := client.GetChannels(context.Background(), []string{"abc"}); err == nil {
+		t.Error("Expected error for non-numeric broadcaster ID, got nil")
+	}
+}
+
+func TestStream_IsMature(t *testing.T) {
+	var resp StreamsResponse
+	if err := json.Unmarshal([]byte(`{"data": [{"id": "1", "is_mature": true}]}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Data[0].IsMature {
+		t.Error("Expected is_mature to be parsed")
+	}
+}
+
+func TestRefreshUserToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "refresh_token" {
+			t.Errorf("Expected refresh_token grant, got %s", r.Form.Get("grant_type"))
+		}
+		if r.Form.Get("refresh_token") == "revoked" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":400,"message":"Invalid refresh token"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"new-access","refresh_token":"new-refresh","expires_in":14400,"scope":["user:read:follows"],"token_type":"bearer"}`))
+	}))
+	defer server.Close()
+
+	client := createTestClient("test_token", false)
+	client.httpClient = &http.Client{
+		Transport: &mockTransport{
+			server: server,
+		},
+		Timeout: HTTPTimeout,
+	}
+
+	token, err := client.RefreshUserToken(context.Background(), "old-refresh")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if token.AccessToken != "new-access" || token.RefreshToken != "new-refresh" || token.ExpiresIn != 14400 {
+		t.Errorf("Unexpected token: %+v", token)
+	}
+
+	if _, err := client.RefreshUserToken(context.Background(), "revoked"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Expected ErrTokenInvalid, got: %v", err)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/oauth2/revoke" {
+			t.Errorf("Expected /oauth2/revoke, got %s", r.URL.Path)
+		}
+		if r.Form.Get("client_id") == "" {
+			t.Error("Expected client_id to be sent")
+		}
+		if r.Form.Get("token") == "expired" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":400,"message":"Invalid token"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := createTestClient("test_token", false)
+	client.httpClient = &http.Client{
+		Transport: &mockTransport{
+			server: server,
+		},
+		Timeout: HTTPTimeout,
+	}
+
+	if err := client.RevokeToken(context.Background(), "user-access"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := client.RevokeToken(context.Background(), "expired"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Expected ErrTokenInvalid, got: %v", err)
+	}
+}
+
+func TestCheckAppToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/validate" {
+			t.Errorf("Expected /oauth2/validate, got %s", r.URL.Path)
+		}
+		switch r.Header.Get("Authorization") {
+		case "OAuth app-token":
+			w.Write([]byte(`{"client_id":"test_client_id","scopes":[],"expires_in":5000}`))
+		case "OAuth other-app":
+			w.Write([]byte(`{"client_id":"someone_else","scopes":[],"expires_in":5000}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	check := func(token string) error {
+		client := createTestClient(token, false)
+		client.httpClient = &http.Client{Transport: &mockTransport{server: server}, Timeout: HTTPTimeout}
+		return client.CheckAppToken(context.Background())
+	}
+	if err := check("app-token"); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+	if err := check("revoked"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Expected ErrTokenInvalid, got: %v", err)
+	}
+	if err := check("other-app"); err == nil {
+		t.Error("Expected an error for another client's token")
+	}
+	if err := createTestClient("", true).CheckAppToken(context.Background()); err == nil {
+		t.Error("Expected an error when no token can be acquired")
+	}
+}
@@ -0,0 +1,249 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultOfflineGrace is how long a channel must be missing from snapshots before it is reported offline
+const DefaultOfflineGrace = 2 * time.Minute
+
+// EventType identifies the kind of change detected between two snapshots
+type EventType string
+
+const (
+	EventWentLive         EventType = "went_live"
+	EventWentOffline      EventType = "went_offline"
+	EventCategoryChanged  EventType = "category_changed"
+	EventTitleChanged     EventType = "title_changed"
+	EventViewersThreshold EventType = "viewers_threshold_crossed"
+)
+
+// StreamEvent is a domain event emitted by the Detector
+type StreamEvent struct {
+	Type             EventType `json:"type"`
+	BroadcasterID    string    `json:"broadcaster_id"`
+	BroadcasterLogin string    `json:"broadcaster_login"`
+	// Stream is the latest known state; for went_offline it is the last state seen live
+	Stream Stream `json:"stream"`
+	// Previous is the state before the change, nil for went_live
+	Previous   *Stream   `json:"previous,omitempty"`
+	Threshold  int       `json:"threshold,omitempty"` // Set for viewers_threshold_crossed
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// EventSink receives events from the Detector
+type EventSink interface {
+	HandleEvent(ctx context.Context, event StreamEvent) error
+}
+
+// EventSinkFunc adapts a function to the EventSink interface
+type EventSinkFunc func(ctx context.Context, event StreamEvent) error
+
+// HandleEvent calls f(ctx, event)
+func (f EventSinkFunc) HandleEvent(ctx context.Context, event StreamEvent) error {
+	return f(ctx, event)
+}
+
+// DetectorOptions configures a Detector
+type DetectorOptions struct {
+	// OfflineGrace debounces brief disconnects: a channel missing for less than this
+	// is not reported offline, and reappearing within it does not emit went_live
+	OfflineGrace time.Duration
+	// ViewerThresholds emit an event when a stream's viewer count rises to or past a value
+	ViewerThresholds []int
+}
+
+// channelState is what the Detector remembers about a channel between snapshots
+type channelState struct {
+	stream       Stream
+	missingSince time.Time // Zero while the channel is present in snapshots
+}
+
+// Detector diffs consecutive StreamsResponse snapshots and emits StreamEvents.
+// The first snapshot only establishes a baseline and emits nothing.
+type Detector struct {
+	mu         sync.Mutex
+	opts       DetectorOptions
+	watched    map[string]bool
+	state      map[string]*channelState
+	sinks      []EventSink
+	baselined  bool
+	thresholds []int
+}
+
+// NewDetector creates a detector that delivers events to the given sinks
+func NewDetector(opts DetectorOptions, sinks ...EventSink) *Detector {
+	if opts.OfflineGrace < 0 {
+		opts.OfflineGrace = 0
+	}
+
+	thresholds := append([]int(nil), opts.ViewerThresholds...)
+	sort.Ints(thresholds)
+
+	return &Detector{
+		opts:       opts,
+		watched:    make(map[string]bool),
+		state:      make(map[string]*channelState),
+		sinks:      sinks,
+		thresholds: thresholds,
+	}
+}
+
+// AddSink registers an additional sink
+func (d *Detector) AddSink(sink EventSink) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sinks = append(d.sinks, sink)
+}
+
+// Watch restricts detection to the given broadcaster IDs. With no watched
+// channels every stream in a snapshot is tracked.
+func (d *Detector) Watch(broadcasterIDs ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, id := range broadcasterIDs {
+		d.watched[id] = true
+	}
+}
+
+// Unwatch stops tracking the given broadcaster IDs and forgets their state
+func (d *Detector) Unwatch(broadcasterIDs ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, id := range broadcasterIDs {
+		delete(d.watched, id)
+		delete(d.state, id)
+	}
+}
+
+// Watched returns the watched broadcaster IDs in sorted order
+func (d *Detector) Watched() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := make([]string, 0, len(d.watched))
+	for id := range d.watched {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// IsLive reports whether the detector currently considers a channel live
+func (d *Detector) IsLive(broadcasterID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.state[broadcasterID]
+	return ok
+}
+
+// Process diffs a snapshot taken at the given time against the previous one,
+// delivers the resulting events to every sink and returns them.
+// Sink errors are joined and returned after all sinks have been called.
+func (d *Detector) Process(ctx context.Context, snapshot *StreamsResponse, at time.Time) ([]StreamEvent, error) {
+	d.mu.Lock()
+	events := d.diff(snapshot, at)
+	sinks := append([]EventSink(nil), d.sinks...)
+	d.mu.Unlock()
+
+	var errs []error
+	for _, event := range events {
+		for _, sink := range sinks {
+			if err := sink.HandleEvent(ctx, event); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return events, errors.Join(errs...)
+}
+
+// diff updates the detector state and returns the events for this snapshot; callers hold d.mu
+func (d *Detector) diff(snapshot *StreamsResponse, at time.Time) []StreamEvent {
+	emit := d.baselined
+	d.baselined = true
+
+	var events []StreamEvent
+	seen := make(map[string]bool)
+
+	if snapshot != nil {
+		for _, stream := range snapshot.Data {
+			if len(d.watched) > 0 && !d.watched[stream.UserID] {
+				continue
+			}
+			if stream.Type != "" && stream.Type != "live" {
+				continue
+			}
+			seen[stream.UserID] = true
+
+			prev, known := d.state[stream.UserID]
+			if !known {
+				d.state[stream.UserID] = &channelState{stream: stream}
+				if emit {
+					events = append(events, newStreamEvent(EventWentLive, stream, nil, at))
+				}
+				continue
+			}
+
+			// Back within the grace period: a brief disconnect, not a new broadcast
+			prev.missingSince = time.Time{}
+			old := prev.stream
+			prev.stream = stream
+
+			if !emit {
+				continue
+			}
+			if stream.GameID != old.GameID {
+				events = append(events, newStreamEvent(EventCategoryChanged, stream, &old, at))
+			}
+			if stream.Title != old.Title {
+				events = append(events, newStreamEvent(EventTitleChanged, stream, &old, at))
+			}
+			for _, threshold := range d.thresholds {
+				if old.ViewerCount < threshold && stream.ViewerCount >= threshold {
+					event := newStreamEvent(EventViewersThreshold, stream, &old, at)
+					event.Threshold = threshold
+					events = append(events, event)
+				}
+			}
+		}
+	}
+
+	// Channels absent from this snapshot go offline once the grace period has elapsed
+	var gone []string
+	for id, st := range d.state {
+		if seen[id] {
+			continue
+		}
+		if st.missingSince.IsZero() {
+			st.missingSince = at
+		}
+		if at.Sub(st.missingSince) >= d.opts.OfflineGrace {
+			gone = append(gone, id)
+		}
+	}
+	sort.Strings(gone)
+	for _, id := range gone {
+		last := d.state[id].stream
+		delete(d.state, id)
+		if emit {
+			events = append(events, newStreamEvent(EventWentOffline, last, nil, at))
+		}
+	}
+
+	return events
+}
+
+func newStreamEvent(eventType EventType, stream Stream, previous *Stream, at time.Time) StreamEvent {
+	return StreamEvent{
+		Type:             eventType,
+		BroadcasterID:    stream.UserID,
+		BroadcasterLogin: stream.UserLogin,
+		Stream:           stream,
+		Previous:         previous,
+		OccurredAt:       at,
+	}
+}
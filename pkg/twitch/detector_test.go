@@ -0,0 +1,171 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// loadStreamsFixture reads a StreamsResponse from testdata
+func loadStreamsFixture(t *testing.T, name string) *StreamsResponse {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	var resp StreamsResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("Failed to parse test data: %v", err)
+	}
+	return &resp
+}
+
+// recordingSink collects every event it receives
+type recordingSink struct {
+	events []StreamEvent
+}
+
+func (s *recordingSink) HandleEvent(ctx context.Context, event StreamEvent) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+// countEvents returns how many events of a type were emitted for a broadcaster
+func countEvents(events []StreamEvent, eventType EventType, broadcasterID string) int {
+	count := 0
+	for _, e := range events {
+		if e.Type == eventType && e.BroadcasterID == broadcasterID {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDetector_BaselineEmitsNothing(t *testing.T) {
+	sink := &recordingSink{}
+	detector := NewDetector(DetectorOptions{}, sink)
+
+	events, err := detector.Process(context.Background(), loadStreamsFixture(t, "sample_streams_response.json"), time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(events) != 0 || len(sink.events) != 0 {
+		t.Errorf("Expected no events for the baseline snapshot, got %d", len(events))
+	}
+	if !detector.IsLive("987654321") {
+		t.Error("Expected teststreamer to be tracked as live after baseline")
+	}
+}
+
+func TestDetector_DiffSnapshots(t *testing.T) {
+	sink := &recordingSink{}
+	detector := NewDetector(DetectorOptions{ViewerThresholds: []int{1000, 5000}}, sink)
+	ctx := context.Background()
+	start := time.Date(2023, 1, 1, 13, 0, 0, 0, time.UTC)
+
+	if _, err := detector.Process(ctx, loadStreamsFixture(t, "sample_streams_response.json"), start); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	events, err := detector.Process(ctx, loadStreamsFixture(t, "sample_streams_response_updated.json"), start.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	tests := []struct {
+		eventType     EventType
+		broadcasterID string
+		expected      int
+	}{
+		{EventWentLive, "444444444", 1},
+		{EventCategoryChanged, "987654321", 1},
+		{EventTitleChanged, "987654321", 1},
+		// 1500 -> 5200 crosses 5000 but not 1000, which was already exceeded
+		{EventViewersThreshold, "987654321", 1},
+		// Offline grace of zero reports a missing channel immediately
+		{EventWentOffline, "123456789", 1},
+	}
+	for _, tt := range tests {
+		if got := countEvents(events, tt.eventType, tt.broadcasterID); got != tt.expected {
+			t.Errorf("Expected %d %s events for %s, got %d", tt.expected, tt.eventType, tt.broadcasterID, got)
+		}
+	}
+
+	for _, e := range events {
+		if e.Type == EventViewersThreshold && e.Threshold != 5000 {
+			t.Errorf("Expected threshold 5000, got %d", e.Threshold)
+		}
+		if e.Type == EventCategoryChanged && (e.Previous == nil || e.Previous.GameName != "Just Chatting") {
+			t.Errorf("Expected previous category Just Chatting, got %+v", e.Previous)
+		}
+	}
+
+	if len(sink.events) != len(events) {
+		t.Errorf("Expected sink to receive %d events, got %d", len(events), len(sink.events))
+	}
+}
+
+func TestDetector_DebouncesBriefDisconnect(t *testing.T) {
+	sink := &recordingSink{}
+	detector := NewDetector(DetectorOptions{OfflineGrace: 2 * time.Minute}, sink)
+	ctx := context.Background()
+	full := loadStreamsFixture(t, "sample_streams_response.json")
+	// anotherstreamer drops out of the snapshot
+	partial := &StreamsResponse{Data: full.Data[:1]}
+	start := time.Date(2023, 1, 1, 13, 0, 0, 0, time.UTC)
+
+	detector.Process(ctx, full, start)
+	detector.Process(ctx, partial, start.Add(time.Minute))
+	detector.Process(ctx, full, start.Add(2*time.Minute))
+
+	if len(sink.events) != 0 {
+		t.Fatalf("Expected a brief disconnect to emit nothing, got %+v", sink.events)
+	}
+
+	// Missing for longer than the grace period is reported exactly once
+	detector.Process(ctx, partial, start.Add(3*time.Minute))
+	detector.Process(ctx, partial, start.Add(4*time.Minute))
+	detector.Process(ctx, partial, start.Add(6*time.Minute))
+
+	if got := countEvents(sink.events, EventWentOffline, "123456789"); got != 1 {
+		t.Errorf("Expected 1 went_offline event, got %d", got)
+	}
+	if detector.IsLive("123456789") {
+		t.Error("Expected anotherstreamer to no longer be live")
+	}
+}
+
+func TestDetector_WatchedSet(t *testing.T) {
+	sink := &recordingSink{}
+	detector := NewDetector(DetectorOptions{}, sink)
+	detector.Watch("444444444")
+	ctx := context.Background()
+
+	detector.Process(ctx, &StreamsResponse{}, time.Now())
+	detector.Process(ctx, loadStreamsFixture(t, "sample_streams_response_updated.json"), time.Now())
+
+	if len(sink.events) != 1 || sink.events[0].BroadcasterID != "444444444" {
+		t.Errorf("Expected only the watched channel to emit events, got %+v", sink.events)
+	}
+}
+
+func TestDetector_SinkErrorsAreReturned(t *testing.T) {
+	failing := EventSinkFunc(func(ctx context.Context, event StreamEvent) error {
+		return fmt.Errorf("sink unavailable")
+	})
+	recorder := &recordingSink{}
+	detector := NewDetector(DetectorOptions{}, failing, recorder)
+	ctx := context.Background()
+
+	detector.Process(ctx, &StreamsResponse{}, time.Now())
+	_, err := detector.Process(ctx, loadStreamsFixture(t, "sample_streams_response.json"), time.Now())
+
+	if err == nil {
+		t.Fatal("Expected sink error to be returned, got nil")
+	}
+	if len(recorder.events) != 2 {
+		t.Errorf("Expected other sinks to still receive events, got %d", len(recorder.events))
+	}
+}
@@ -0,0 +1,143 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeviceGrantType is the OAuth grant type for exchanging a device code
+const DeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Device Code Grant poll outcomes. ErrAuthorizationPending and ErrSlowDown mean poll again
+// (after backing off for ErrSlowDown); the others end the login.
+var (
+	ErrAuthorizationPending = errors.New("twitch device authorization pending")
+	ErrSlowDown             = errors.New("twitch device polling too fast")
+	ErrDeviceCodeExpired    = errors.New("twitch device code expired")
+	ErrAccessDenied         = errors.New("twitch device authorization denied")
+)
+
+// DeviceAuthorization is a started Device Code Grant. The user enters UserCode at VerificationURI
+// while the device polls with DeviceCode every Interval seconds until ExpiresIn passes.
+type DeviceAuthorization struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// StartDeviceAuthorization starts a Device Code Grant for the given scopes
+func (c *ClientImpl) StartDeviceAuthorization(ctx context.Context, scopes []string) (*DeviceAuthorization, error) {
+	data := url.Values{}
+	data.Set("client_id", c.clientID)
+	data.Set("scopes", strings.Join(scopes, " "))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", TwitchOAuthDevice, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create device authorization request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to start device authorization")
+		return nil, fmt.Errorf("device authorization request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Error().
+			Int("status_code", resp.StatusCode).
+			Str("response_body", string(body)).
+			Msg("Device authorization failed")
+		return nil, fmt.Errorf("device authorization failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var auth DeviceAuthorization
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return nil, fmt.Errorf("failed to parse device authorization response: %w", err)
+	}
+	return &auth, nil
+}
+
+// PollDeviceToken polls once for the token of a started Device Code Grant. It returns
+// ErrAuthorizationPending until the user approves, ErrSlowDown when polled faster than the
+// interval, ErrDeviceCodeExpired once the code expires and ErrAccessDenied if the user declines.
+func (c *ClientImpl) PollDeviceToken(ctx context.Context, deviceCode string, scopes []string) (*UserToken, error) {
+	data := url.Values{}
+	data.Set("client_id", c.clientID)
+	data.Set("client_secret", c.clientSecret)
+	data.Set("device_code", deviceCode)
+	data.Set("grant_type", DeviceGrantType)
+	data.Set("scopes", strings.Join(scopes, " "))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", TwitchOAuthURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create device token request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to poll device token")
+		return nil, fmt.Errorf("device token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if err := deviceTokenError(body); err != nil {
+			return nil, err
+		}
+		log.Error().
+			Int("status_code", resp.StatusCode).
+			Str("response_body", string(body)).
+			Msg("Device token poll failed")
+		return nil, fmt.Errorf("device token poll failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var token UserToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	log.Info().Msg("Successfully exchanged device code for user token")
+	return &token, nil
+}
+
+// deviceTokenError maps a Device Code Grant error body to its sentinel error. Twitch reports the
+// outcome in "message" ({"status":400,"message":"authorization_pending"}), RFC 8628 in "error".
+func deviceTokenError(body []byte) error {
+	var payload struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil
+	}
+	for _, code := range []string{payload.Error, payload.Message} {
+		switch strings.ToLower(code) {
+		case "authorization_pending":
+			return ErrAuthorizationPending
+		case "slow_down":
+			return ErrSlowDown
+		case "expired_token", "invalid device code":
+			return ErrDeviceCodeExpired
+		case "access_denied":
+			return ErrAccessDenied
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartDeviceAuthorization(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/oauth2/device" {
+			t.Errorf("Expected /oauth2/device, got %s", r.URL.Path)
+		}
+		if r.Form.Get("scopes") != "user:read:email user:read:follows" {
+			t.Errorf("Expected space separated scopes, got %q", r.Form.Get("scopes"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"device_code":"dev","expires_in":1800,"interval":5,"user_code":"ABCDEFGH","verification_uri":"https://www.twitch.tv/activate?device-code=ABCDEFGH"}`))
+	}))
+	defer server.Close()
+
+	client := createTestClient("test_token", false)
+	client.httpClient = &http.Client{
+		Transport: &mockTransport{
+			server: server,
+		},
+		Timeout: HTTPTimeout,
+	}
+
+	auth, err := client.StartDeviceAuthorization(context.Background(), []string{"user:read:email", "user:read:follows"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if auth.DeviceCode != "dev" || auth.UserCode != "ABCDEFGH" || auth.Interval != 5 || auth.ExpiresIn != 1800 {
+		t.Errorf("Unexpected device authorization: %+v", auth)
+	}
+}
+
+func TestPollDeviceToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected error
+	}{
+		{"pending", http.StatusBadRequest, `{"status":400,"message":"authorization_pending"}`, ErrAuthorizationPending},
+		{"slow down", http.StatusBadRequest, `{"status":400,"message":"slow_down"}`, ErrSlowDown},
+		{"expired", http.StatusBadRequest, `{"status":400,"message":"invalid device code"}`, ErrDeviceCodeExpired},
+		{"denied rfc", http.StatusBadRequest, `{"error":"access_denied"}`, ErrAccessDenied},
+		{"approved", http.StatusOK, `{"access_token":"user-access","refresh_token":"user-refresh","expires_in":14400,"scope":["user:read:follows"],"token_type":"bearer"}`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				if r.Form.Get("grant_type") != DeviceGrantType || r.Form.Get("device_code") != "dev" {
+					t.Errorf("Expected device code grant, got %v", r.Form)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := createTestClient("test_token", false)
+			client.httpClient = &http.Client{
+				Transport: &mockTransport{
+					server: server,
+				},
+				Timeout: HTTPTimeout,
+			}
+
+			token, err := client.PollDeviceToken(context.Background(), "dev", []string{"user:read:follows"})
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("Expected %v, got: %v", tt.expected, err)
+			}
+			if tt.expected == nil && token.AccessToken != "user-access" {
+				t.Errorf("Unexpected token: %+v", token)
+			}
+		})
+	}
+}
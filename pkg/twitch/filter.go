@@ -0,0 +1,64 @@
+package twitch
+
+import "context"
+
+// ContentFilter decides which streams and categories may be shown
+type ContentFilter interface {
+	AllowStream(stream Stream) bool
+	AllowCategory(category Category) bool
+}
+
+// FilteredClient wraps a Client and drops streams and categories the filter rejects.
+// Results may hold fewer items than the requested limit.
+type FilteredClient struct {
+	Client
+	filter ContentFilter
+}
+
+// NewFilteredClient decorates client with filter
+func NewFilteredClient(client Client, filter ContentFilter) *FilteredClient {
+	return &FilteredClient{Client: client, filter: filter}
+}
+
+// GetTopStreams returns the top streams the filter allows
+func (c *FilteredClient) GetTopStreams(ctx context.Context, limit int) (*StreamsResponse, error) {
+	resp, err := c.Client.GetTopStreams(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	return c.filterStreams(resp), nil
+}
+
+// GetStreams returns the streams the filter allows
+func (c *FilteredClient) GetStreams(ctx context.Context, params StreamsQueryParams) (*StreamsResponse, error) {
+	resp, err := c.Client.GetStreams(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.filterStreams(resp), nil
+}
+
+// GetCategories returns the categories the filter allows
+func (c *FilteredClient) GetCategories(ctx context.Context, limit int, sortBy string) (*CategoriesResponse, error) {
+	resp, err := c.Client.GetCategories(ctx, limit, sortBy)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make([]Category, 0, len(resp.Data))
+	for _, category := range resp.Data {
+		if c.filter.AllowCategory(category) {
+			allowed = append(allowed, category)
+		}
+	}
+	return &CategoriesResponse{Data: allowed}, nil
+}
+
+func (c *FilteredClient) filterStreams(resp *StreamsResponse) *StreamsResponse {
+	allowed := make([]Stream, 0, len(resp.Data))
+	for _, stream := range resp.Data {
+		if c.filter.AllowStream(stream) {
+			allowed = append(allowed, stream)
+		}
+	}
+	return &StreamsResponse{Data: allowed}
+}
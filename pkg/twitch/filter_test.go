@@ -0,0 +1,57 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// stubClient returns fixed streams and categories
+type stubClient struct {
+	Client
+	streams    []Stream
+	categories []Category
+	err        error
+}
+
+func (s *stubClient) GetTopStreams(ctx context.Context, limit int) (*StreamsResponse, error) {
+	return &StreamsResponse{Data: s.streams}, s.err
+}
+
+func (s *stubClient) GetStreams(ctx context.Context, params StreamsQueryParams) (*StreamsResponse, error) {
+	return &StreamsResponse{Data: s.streams}, s.err
+}
+
+func (s *stubClient) GetCategories(ctx context.Context, limit int, sortBy string) (*CategoriesResponse, error) {
+	return &CategoriesResponse{Data: s.categories}, s.err
+}
+
+// blockGame rejects everything in one game
+type blockGame string
+
+func (b blockGame) AllowStream(stream Stream) bool       { return stream.GameID != string(b) }
+func (b blockGame) AllowCategory(category Category) bool { return category.ID != string(b) }
+
+func TestFilteredClient(t *testing.T) {
+	stub := &stubClient{
+		streams:    []Stream{{ID: "1", GameID: "10"}, {ID: "2", GameID: "20"}},
+		categories: []Category{{ID: "10"}, {ID: "20"}},
+	}
+	client := NewFilteredClient(stub, blockGame("20"))
+	ctx := context.Background()
+
+	top, _ := client.GetTopStreams(ctx, 10)
+	streams, _ := client.GetStreams(ctx, StreamsQueryParams{Limit: 10})
+	categories, _ := client.GetCategories(ctx, 10, "")
+	if len(top.Data) != 1 || len(streams.Data) != 1 || streams.Data[0].ID != "1" {
+		t.Errorf("Expected the blocked game's stream dropped, got %+v and %+v", top.Data, streams.Data)
+	}
+	if len(categories.Data) != 1 || categories.Data[0].ID != "10" {
+		t.Errorf("Expected the blocked category dropped, got %+v", categories.Data)
+	}
+
+	stub.err = errors.New("helix down")
+	if _, err := client.GetStreams(ctx, StreamsQueryParams{}); err == nil {
+		t.Error("Expected the wrapped client's error to pass through")
+	}
+}
@@ -15,7 +15,7 @@ import (
 // NewOAuthManager creates a new OAuth manager instance
 func NewOAuthManager(clientID, clientSecret string) OAuthManager {
 	httpClient := &http.Client{
-		Timeout: HTTPTimeout * time.Second,
+		Timeout: HTTPTimeout,
 	}
 
 	return &OAuthManagerImpl{
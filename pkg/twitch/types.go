@@ -2,6 +2,7 @@ package twitch
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -14,30 +15,124 @@ const (
 	TwitchOAuthURL       = "https://id.twitch.tv/oauth2/token"
 	TwitchOAuthAuthorize = "https://id.twitch.tv/oauth2/authorize"
 	TwitchOAuthValidate  = "https://id.twitch.tv/oauth2/validate"
+	TwitchOAuthDevice    = "https://id.twitch.tv/oauth2/device"
+	TwitchOAuthRevoke    = "https://id.twitch.tv/oauth2/revoke"
 	StreamsEndpoint      = "/streams"
 	UsersEndpoint        = "/users"
 	CategoriesEndpoint   = "/games/top"
 	FollowsEndpoint      = "/channels/followed"
+	ChannelsEndpoint     = "/channels"
+	TwitchChatURL        = "wss://irc-ws.chat.twitch.tv:443"
 )
 
-// TODO: move these to be environemnt variables
-// Default values
-const (
+// ErrTokenInvalid is returned when Twitch rejects a user access or refresh token as invalid,
+// expired or revoked. The user has to authorize again.
+var ErrTokenInvalid = errors.New("twitch user token is invalid or revoked")
+
+// Default values, overridable at startup with SetLimits
+var (
 	DefaultStreamLimit   = 100
 	MaxStreamLimit       = 1000
 	DefaultCategoryLimit = 20
 	MaxCategoryLimit     = 100
-	HTTPTimeout          = 10 // seconds
+	HTTPTimeout          = 10 * time.Second
 )
 
-// TODO: move these to be environemnt variables
-// Query parameter validation constants
-const (
+// Query parameter validation values, overridable at startup with SetLimits
+var (
 	MinStreamQueryLimit = 1
 	MaxStreamQueryLimit = 100
 	DefaultQueryLimit   = 20
 )
 
+// Helix caps on IDs per request
+const (
+	MaxStreamUserIDs = 100
+	MaxChannelIDs    = 100
+	// maxHelixPageSize is the most items Helix returns per page
+	maxHelixPageSize = 100
+)
+
+// Limits are the page sizes and HTTP timeout the client applies
+type Limits struct {
+	DefaultStreamLimit   int
+	MaxStreamLimit       int
+	DefaultCategoryLimit int
+	MaxCategoryLimit     int
+	MinStreamQueryLimit  int
+	MaxStreamQueryLimit  int
+	DefaultQueryLimit    int
+	HTTPTimeout          time.Duration
+}
+
+// CurrentLimits returns the limits in effect
+func CurrentLimits() Limits {
+	return Limits{
+		DefaultStreamLimit:   DefaultStreamLimit,
+		MaxStreamLimit:       MaxStreamLimit,
+		DefaultCategoryLimit: DefaultCategoryLimit,
+		MaxCategoryLimit:     MaxCategoryLimit,
+		MinStreamQueryLimit:  MinStreamQueryLimit,
+		MaxStreamQueryLimit:  MaxStreamQueryLimit,
+		DefaultQueryLimit:    DefaultQueryLimit,
+		HTTPTimeout:          HTTPTimeout,
+	}
+}
+
+// Validate checks the limits are consistent and within what Helix accepts
+func (l Limits) Validate() error {
+	var errs []error
+	if l.DefaultStreamLimit < 1 || l.DefaultStreamLimit > l.MaxStreamLimit {
+		errs = append(errs, fmt.Errorf("default stream limit must be between 1 and the max stream limit (%d), got %d", l.MaxStreamLimit, l.DefaultStreamLimit))
+	}
+	if l.DefaultCategoryLimit < 1 || l.DefaultCategoryLimit > l.MaxCategoryLimit {
+		errs = append(errs, fmt.Errorf("default category limit must be between 1 and the max category limit (%d), got %d", l.MaxCategoryLimit, l.DefaultCategoryLimit))
+	}
+	if l.MaxCategoryLimit > maxHelixPageSize {
+		errs = append(errs, fmt.Errorf("max category limit must be at most %d, got %d", maxHelixPageSize, l.MaxCategoryLimit))
+	}
+	if l.MinStreamQueryLimit < 1 || l.MinStreamQueryLimit > l.MaxStreamQueryLimit {
+		errs = append(errs, fmt.Errorf("min stream query limit must be between 1 and the max stream query limit (%d), got %d", l.MaxStreamQueryLimit, l.MinStreamQueryLimit))
+	}
+	if l.MaxStreamQueryLimit > maxHelixPageSize {
+		errs = append(errs, fmt.Errorf("max stream query limit must be at most %d, got %d", maxHelixPageSize, l.MaxStreamQueryLimit))
+	}
+	if l.DefaultQueryLimit < l.MinStreamQueryLimit || l.DefaultQueryLimit > l.MaxStreamQueryLimit {
+		errs = append(errs, fmt.Errorf("default query limit must be between %d and %d, got %d", l.MinStreamQueryLimit, l.MaxStreamQueryLimit, l.DefaultQueryLimit))
+	}
+	if l.HTTPTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("HTTP timeout must be positive, got %s", l.HTTPTimeout))
+	}
+	return errors.Join(errs...)
+}
+
+// SetLimits replaces the limits in effect. Call it at startup, before creating clients.
+func SetLimits(l Limits) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	DefaultStreamLimit = l.DefaultStreamLimit
+	MaxStreamLimit = l.MaxStreamLimit
+	DefaultCategoryLimit = l.DefaultCategoryLimit
+	MaxCategoryLimit = l.MaxCategoryLimit
+	MinStreamQueryLimit = l.MinStreamQueryLimit
+	MaxStreamQueryLimit = l.MaxStreamQueryLimit
+	DefaultQueryLimit = l.DefaultQueryLimit
+	HTTPTimeout = l.HTTPTimeout
+	return nil
+}
+
+// Content classification label IDs Twitch sets on channels
+const (
+	LabelDebatedSocialIssues = "DebatedSocialIssuesAndPolitics"
+	LabelDrugsIntoxication   = "DrugsIntoxication"
+	LabelSexualThemes        = "SexualThemes"
+	LabelViolentGraphic      = "ViolentGraphic"
+	LabelGambling            = "Gambling"
+	LabelProfanityVulgarity  = "ProfanityVulgarity"
+	LabelMatureGame          = "MatureGame"
+)
+
 // Stream represents a Twitch stream with essential information
 type Stream struct {
 	ID           string   `json:"id"`
@@ -53,6 +148,13 @@ type Stream struct {
 	Language     string   `json:"language"`
 	ThumbnailURL string   `json:"thumbnail_url"`
 	Tags         []string `json:"tags"`
+	IsMature     bool     `json:"is_mature"`
+	// ContentLabels are the channel's content classification labels, filled in from GetChannels
+	ContentLabels []string `json:"content_classification_labels,omitempty"`
+	// Vibes, VibeScore and Anomalies are computed by VibeGuide, not returned by Twitch
+	Vibes     []string `json:"vibes,omitempty"`
+	VibeScore *float64 `json:"vibe_score,omitempty"`
+	Anomalies []string `json:"anomalies,omitempty"` // Reason codes when the viewer count looks inflated
 }
 
 // StreamsResponse represents the response from Twitch API for streams
@@ -65,6 +167,8 @@ type StreamsQueryParams struct {
 	Limit  int    `json:"limit"`   // Number of streams to return (1-100, default: 20)
 	GameID string `json:"game_id"` // Filter by specific game/category ID
 	Sort   string `json:"sort"`    // Sorting method: "viewers" (default), "recent"
+	// UserIDs restricts results to the given broadcasters (up to 100 numeric IDs)
+	UserIDs []string `json:"user_ids,omitempty"`
 }
 
 // Category represents a Twitch game category with game information
@@ -86,10 +190,15 @@ type Client interface {
 	GetStreams(ctx context.Context, params StreamsQueryParams) (*StreamsResponse, error)
 	GetAuthorizationURL(redirectURI, state string, scopes []string) string
 	ExchangeCodeForToken(ctx context.Context, code, redirectURI string) (*UserToken, error)
+	RefreshUserToken(ctx context.Context, refreshToken string) (*UserToken, error)
+	RevokeToken(ctx context.Context, accessToken string) error
+	StartDeviceAuthorization(ctx context.Context, scopes []string) (*DeviceAuthorization, error)
+	PollDeviceToken(ctx context.Context, deviceCode string, scopes []string) (*UserToken, error)
 	ValidateToken(ctx context.Context, accessToken string) (*TokenValidation, error)
 	GetUserInfo(ctx context.Context, accessToken string) (*User, error)
 	GetCategories(ctx context.Context, limit int, sortBy string) (*CategoriesResponse, error)
 	GetUserFollows(ctx context.Context, userID string, userToken string) (*FollowsResponse, error)
+	GetChannels(ctx context.Context, broadcasterIDs []string) (*ChannelsResponse, error)
 }
 
 // OAuthManager interface defines OAuth token management functionality
@@ -136,6 +245,10 @@ func ValidateStreamsParams(params StreamsQueryParams) error {
 		return err
 	}
 
+	if err := ValidateUserIDs(params.UserIDs); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -173,6 +286,21 @@ func ValidateSort(sort string) error {
 	return nil
 }
 
+// ValidateUserIDs validates the user_id filter (at most 100 numeric IDs)
+func ValidateUserIDs(userIDs []string) error {
+	if len(userIDs) > MaxStreamUserIDs {
+		return fmt.Errorf("at most %d user_ids may be requested, got %d", MaxStreamUserIDs, len(userIDs))
+	}
+
+	for _, userID := range userIDs {
+		if _, err := strconv.Atoi(userID); err != nil {
+			return fmt.Errorf("user_id must be a numeric string, got %s", userID)
+		}
+	}
+
+	return nil
+}
+
 // UserToken represents an OAuth token for a user (authorization code flow)
 type UserToken struct {
 	AccessToken  string   `json:"access_token"`
@@ -218,6 +346,25 @@ type Follow struct {
 	FollowedAt       string `json:"followed_at"`
 }
 
+// ChannelInformation represents a broadcaster's channel settings
+type ChannelInformation struct {
+	BroadcasterID               string   `json:"broadcaster_id"`
+	BroadcasterLogin            string   `json:"broadcaster_login"`
+	BroadcasterName             string   `json:"broadcaster_name"`
+	BroadcasterLanguage         string   `json:"broadcaster_language"`
+	GameID                      string   `json:"game_id"`
+	GameName                    string   `json:"game_name"`
+	Title                       string   `json:"title"`
+	Tags                        []string `json:"tags"`
+	ContentClassificationLabels []string `json:"content_classification_labels"`
+	IsBrandedContent            bool     `json:"is_branded_content"`
+}
+
+// ChannelsResponse represents the response from Twitch API for channel information
+type ChannelsResponse struct {
+	Data []ChannelInformation `json:"data"`
+}
+
 // Pagination represents pagination information from Twitch API
 type Pagination struct {
 	Cursor string `json:"cursor"`
@@ -0,0 +1,139 @@
+// Package vault seals small secrets, such as OAuth tokens, with AES-256-GCM for storage at rest.
+// A Keyring holds a primary key used for sealing and any number of older keys that can still
+// open values, so keys can be rotated without a migration window.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the AES-256 key length in bytes
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when a sealed value names a key the keyring doesn't hold
+	ErrUnknownKey = errors.New("vault: sealed with an unknown key")
+	// ErrMalformed is returned for values that were not produced by Seal
+	ErrMalformed = errors.New("vault: malformed sealed value")
+)
+
+// Keyring seals with its primary key and opens with any key it holds
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from key IDs and 32-byte keys. The first ID is the primary key.
+func NewKeyring(ids []string, keys map[string][]byte) (*Keyring, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("vault: at least one key is required")
+	}
+	k := &Keyring{primary: ids[0], keys: make(map[string]cipher.AEAD, len(ids))}
+	for _, id := range ids {
+		if id == "" || strings.Contains(id, ".") {
+			return nil, fmt.Errorf("vault: invalid key ID %q", id)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("vault: duplicate key ID %q", id)
+		}
+		key, ok := keys[id]
+		if !ok || len(key) != KeySize {
+			return nil, fmt.Errorf("vault: key %q must be %d bytes", id, KeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("vault: key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("vault: key %q: %w", id, err)
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// ParseKeyring parses a comma-separated list of id:base64key pairs, primary first, e.g.
+// "2024b:...,2024a:...". Keys may use standard or URL-safe base64.
+func ParseKeyring(spec string) (*Keyring, error) {
+	ids := []string{}
+	keys := map[string][]byte{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("vault: key %q must be in id:base64key form", part)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("vault: key %q: %w", id, err)
+		}
+		ids = append(ids, id)
+		keys[id] = key
+	}
+	return NewKeyring(ids, keys)
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if key, err := enc.DecodeString(encoded); err == nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64")
+}
+
+// Primary returns the ID of the key new values are sealed with
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// Seal encrypts plaintext with the primary key. The additional data is authenticated but not
+// stored, so the same value must be passed to Open; bind it to the owner (e.g. a user ID) so a
+// sealed value can't be moved between rows.
+func (k *Keyring) Seal(plaintext, additionalData []byte) (string, error) {
+	aead := k.keys[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("vault: failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData)
+	return k.primary + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal with the key it names
+func (k *Keyring) Open(sealed string, additionalData []byte) ([]byte, error) {
+	id, encoded, ok := strings.Cut(sealed, ".")
+	if !ok {
+		return nil, ErrMalformed
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to open sealed value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// NeedsRotation reports whether a sealed value was sealed with a key other than the primary
+func (k *Keyring) NeedsRotation(sealed string) bool {
+	id, _, _ := strings.Cut(sealed, ".")
+	return id != k.primary
+}
@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, KeySize))
+}
+
+func TestSealOpen(t *testing.T) {
+	k, err := ParseKeyring("k1:" + testKey(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	sealed, err := k.Seal([]byte("twitch-access-token"), []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if bytes.Contains([]byte(sealed), []byte("twitch-access-token")) {
+		t.Fatal("Expected the plaintext not to appear in the sealed value")
+	}
+
+	plain, err := k.Open(sealed, []byte("user-1"))
+	if err != nil || string(plain) != "twitch-access-token" {
+		t.Fatalf("Expected the token back, got %q, %v", plain, err)
+	}
+	if _, err := k.Open(sealed, []byte("user-2")); err == nil {
+		t.Error("Expected a value sealed for another user to fail to open")
+	}
+
+	again, _ := k.Seal([]byte("twitch-access-token"), []byte("user-1"))
+	if again == sealed {
+		t.Error("Expected a fresh nonce per seal")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old, err := ParseKeyring("k1:" + testKey(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	sealed, _ := old.Seal([]byte("secret"), nil)
+
+	rotated, err := ParseKeyring("k2:" + testKey(2) + ", k1:" + testKey(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if rotated.Primary() != "k2" || !rotated.NeedsRotation(sealed) {
+		t.Errorf("Expected k2 primary and the k1 value due for rotation")
+	}
+	if plain, err := rotated.Open(sealed, nil); err != nil || string(plain) != "secret" {
+		t.Errorf("Expected old values still readable, got %q, %v", plain, err)
+	}
+
+	resealed, _ := rotated.Seal([]byte("secret"), nil)
+	if rotated.NeedsRotation(resealed) {
+		t.Error("Expected a freshly sealed value not to need rotation")
+	}
+	if _, err := old.Open(resealed, nil); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey, got: %v", err)
+	}
+}
+
+func TestParseKeyring_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"k1",
+		"k1:not-base64!",
+		"k1:" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"k1:" + testKey(1) + ",k1:" + testKey(2),
+		"k.1:" + testKey(1),
+	}
+	for _, spec := range tests {
+		if _, err := ParseKeyring(spec); err == nil {
+			t.Errorf("ParseKeyring(%q): expected error", spec)
+		}
+	}
+}
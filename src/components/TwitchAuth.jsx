@@ -30,13 +30,10 @@ const TwitchAuth = () => {
       setLoading(true);
       setError(null);
 
-      // Generate random state for CSRF protection
-      const state = crypto.randomUUID();
+      // Get authorization URL; the backend mints and later verifies the state
+      const { auth_url: authUrl, state } = await getTwitchAuthURL(REDIRECT_URI);
       sessionStorage.setItem('oauth_state', state);
 
-      // Get authorization URL
-      const authUrl = await getTwitchAuthURL(REDIRECT_URI, state);
-
       // Redirect to Twitch
       window.location.href = authUrl;
     } catch (err) {
@@ -59,11 +56,20 @@ const TwitchAuth = () => {
       // Exchange code for token
       const data = await exchangeTwitchCode(code, REDIRECT_URI, state);
 
-      // Store tokens and user info
-      localStorage.setItem('twitch_access_token', data.access_token);
-      localStorage.setItem('twitch_refresh_token', data.refresh_token);
+      // Tokens are only returned when the server can't keep them in its vault
+      if (!data.stored) {
+        localStorage.setItem('twitch_access_token', data.access_token);
+        localStorage.setItem('twitch_refresh_token', data.refresh_token);
+      }
       localStorage.setItem('twitch_user', JSON.stringify(data.user));
 
+      // Signed-out logins complete by signing in as the linked Supabase user
+      if (data.sign_in_link) {
+        sessionStorage.removeItem('oauth_state');
+        window.location.href = data.sign_in_link;
+        return;
+      }
+
       setUser(data.user);
 
       // Clean up URL
@@ -106,6 +106,38 @@ export async function getCurrentUser() {
   }
 }
 
+// Provider token most recently handed to the backend's token vault
+let storedProviderToken = null
+
+/**
+ * Hand the Twitch tokens from a Supabase Twitch sign-in to the backend, which keeps them
+ * encrypted server-side. Supabase only exposes them right after sign-in, so this runs once per token.
+ * @param {Object} session - Supabase session
+ */
+async function storeTwitchProviderToken(session) {
+  if (!session.provider_token || !session.provider_refresh_token || session.provider_token === storedProviderToken) {
+    return
+  }
+
+  const response = await fetch(`${API_BASE_URL}/v1/auth/twitch/token`, {
+    method: 'POST',
+    headers: {
+      'Authorization': `Bearer ${session.access_token}`,
+      'Content-Type': 'application/json'
+    },
+    body: JSON.stringify({
+      provider_token: session.provider_token,
+      provider_refresh_token: session.provider_refresh_token
+    })
+  })
+
+  if (!response.ok) {
+    const errorText = await response.text()
+    throw new Error(`Failed to store Twitch token: ${response.status} ${response.statusText} - ${errorText}`)
+  }
+  storedProviderToken = session.provider_token
+}
+
 /**
  * Fetch channels that the authenticated user follows
  * @returns {Promise<Array>} Array of follow objects
@@ -117,26 +149,19 @@ export async function getUserFollows() {
       throw new Error('Not authenticated')
     }
     
-    // Backend-only approach with provider token fallback
     const supabaseToken = session.access_token
-    const twitchToken = session.provider_token
-    
     if (!supabaseToken) {
       throw new Error('No Supabase access token found in session')
     }
-    
-    const headers = {
-      'Authorization': `Bearer ${supabaseToken}`,
-      'Content-Type': 'application/json'
-    }
-    
-    // Add Twitch provider token as fallback if available
-    if (twitchToken) {
-      headers['X-Twitch-Token'] = twitchToken
-    }
+
+    // The backend calls Twitch with the token stored in its vault
+    await storeTwitchProviderToken(session)
     
     const response = await fetch(`${API_BASE_URL}/v1/twitch/follows`, {
-      headers
+      headers: {
+        'Authorization': `Bearer ${supabaseToken}`,
+        'Content-Type': 'application/json'
+      }
     })
     
     if (!response.ok) {
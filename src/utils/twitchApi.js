@@ -104,10 +104,13 @@ export const searchChannels = async (query) => {
 // Backend OAuth functions
 const API_BASE_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080'
 
-export const getTwitchAuthURL = async (redirectUri, state) => {
+// The backend mints the OAuth state and binds it to this browser with a cookie, so both calls
+// must send credentials
+export const getTwitchAuthURL = async (redirectUri) => {
   try {
     const response = await fetch(
-      `${API_BASE_URL}/v1/auth/twitch/url?redirect_uri=${encodeURIComponent(redirectUri)}&state=${state}`
+      `${API_BASE_URL}/v1/auth/twitch/url?redirect_uri=${encodeURIComponent(redirectUri)}`,
+      { credentials: 'include' }
     )
 
     if (!response.ok) {
@@ -115,7 +118,7 @@ export const getTwitchAuthURL = async (redirectUri, state) => {
     }
 
     const data = await response.json()
-    return data.data.auth_url
+    return data.data
   } catch (error) {
     console.error('Error getting Twitch auth URL:', error)
     throw error
@@ -125,8 +128,8 @@ export const getTwitchAuthURL = async (redirectUri, state) => {
 export const exchangeTwitchCode = async (code, redirectUri, state) => {
   try {
     const response = await fetch(
-      `${API_BASE_URL}/v1/auth/twitch/callback?code=${code}&redirect_uri=${encodeURIComponent(redirectUri)}&state=${state}`,
-      { method: 'POST' }
+      `${API_BASE_URL}/v1/auth/twitch/callback?code=${encodeURIComponent(code)}&redirect_uri=${encodeURIComponent(redirectUri)}&state=${encodeURIComponent(state)}`,
+      { method: 'POST', credentials: 'include' }
     )
 
     if (!response.ok) {